@@ -0,0 +1,71 @@
+package progjpeg
+
+import (
+	"bufio"
+	"io"
+)
+
+// WriteTables writes to w an abbreviated tables-only datastream, as defined
+// in section B.5 of the spec: the quantization tables for the quality in o
+// and the Huffman tables used by the encoder, between SOI and EOI markers.
+// Decoders that read it first, such as a [Decoder] with its LoadTables
+// method, can then decode the image-only datastreams written by Encode with
+// [Options.OmitTables] and the same quality. Default parameters are used if
+// a nil *[Options] is passed.
+func WriteTables(w io.Writer, o *Options) error {
+	var e encoder
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	quality := DefaultQuality
+	if o != nil {
+		quality = o.Quality
+	}
+	e.setQuality(quality)
+	// Write the chrominance tables too, so that the tables suit both
+	// grayscale and color images.
+	e.comp = ycbcrComponents
+	e.buf[0] = 0xff
+	e.buf[1] = soiMarker
+	e.write(e.buf[:2])
+	e.writeDQT()
+	e.writeDHT()
+	e.buf[0] = 0xff
+	e.buf[1] = eoiMarker
+	e.write(e.buf[:2])
+	e.flush()
+	return e.err
+}
+
+// decoderTables holds the tables that a Decoder loaded with LoadTables.
+type decoderTables struct {
+	huff  [maxTc + 1][maxTh + 1]huffman
+	quant [maxTq + 1]block
+}
+
+// LoadTables reads an abbreviated tables-only datastream, such as the one
+// written by [WriteTables], and keeps its quantization and Huffman tables
+// for the following calls to Decode, which can then decode abbreviated
+// image-only datastreams. The tables in a datastream passed to Decode
+// override the loaded tables for that call only. Tables that r does not
+// define keep their previously loaded value.
+func (dec *Decoder) LoadTables(r io.Reader) error {
+	d := &dec.d
+	defer func() { *d = decoder{} }()
+	if dec.tables == nil {
+		dec.tables = new(decoderTables)
+	}
+	d.huff, d.quant = dec.tables.huff, dec.tables.quant
+	_, err := d.decode(r, false)
+	if d.nComp != 0 {
+		return FormatError("tables-only datastream has a frame")
+	}
+	// A datastream without a frame ends with a missing SOS error.
+	if err != FormatError("missing SOS marker") {
+		return err
+	}
+	dec.tables.huff, dec.tables.quant = d.huff, d.quant
+	return nil
+}
@@ -0,0 +1,80 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestAbbreviatedDatastreams(t *testing.T) {
+	var tables bytes.Buffer
+	if err := WriteTables(&tables, &Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := Probe(bytes.NewReader(tables.Bytes())); err != nil || p.Scans != 0 || p.Width != 0 {
+		t.Fatalf("tables-only datastream: %+v, %v", p, err)
+	}
+	var dec Decoder
+	if err := dec.LoadTables(bytes.NewReader(tables.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		m image.Image
+		o Options
+	}{
+		{testimg.Photo(64, 48, 1), Options{Quality: 80}},
+		{testimg.Photo(64, 48, 2), Options{Quality: 80, Progressive: true}},
+		{testimg.ZonePlate(64, 48), Options{Quality: 80}},
+		{testimg.Gradient(64, 48), Options{Quality: 80, Grayscale: true, Progressive: true}},
+	} {
+		var full, abbrev bytes.Buffer
+		o := tc.o
+		if err := Encode(&full, tc.m, &o); err != nil {
+			t.Fatal(err)
+		}
+		o.OmitTables = true
+		if err := Encode(&abbrev, tc.m, &o); err != nil {
+			t.Fatal(err)
+		}
+		if abbrev.Len() >= full.Len() {
+			t.Errorf("%+v: image-only datastream is %d bytes, full one %d", tc.o, abbrev.Len(), full.Len())
+		}
+		want, err := Decode(bytes.NewReader(full.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Decode(bytes.NewReader(abbrev.Bytes())); err == nil {
+			t.Errorf("%+v: image-only datastream decoded without tables", tc.o)
+		}
+		got, err := dec.Decode(bytes.NewReader(abbrev.Bytes()))
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.o, err)
+		}
+		if !equalImages(got, want) {
+			t.Errorf("%+v: image-only datastream decodes differently", tc.o)
+		}
+
+		// Splicing the two datastreams gives an interchange datastream.
+		spliced := append(bytes.Clone(tables.Bytes()[:tables.Len()-2]), abbrev.Bytes()[2:]...)
+		if _, err := jpeg.Decode(bytes.NewReader(spliced)); err != nil {
+			t.Errorf("%+v: image/jpeg: %v", tc.o, err)
+		}
+	}
+
+	if err := dec.LoadTables(bytes.NewReader(tables.Bytes())); err != nil {
+		t.Errorf("loading tables again: %v", err)
+	}
+	var full bytes.Buffer
+	if err := Encode(&full, testimg.Gradient(16, 16), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.LoadTables(&full); err == nil {
+		t.Error("LoadTables accepted a datastream with a frame")
+	}
+	if err := Encode(new(bytes.Buffer), testimg.Gradient(16, 16), &Options{OmitTables: true, Regions: []QualityRegion{{image.Rect(0, 0, 8, 8), 90}}}); err == nil {
+		t.Error("OmitTables with regions did not fail")
+	}
+}
@@ -0,0 +1,95 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// withComponentIDs returns a copy of the JPEG file data whose components 1,
+// 2 and 3 are renamed ids[0], ids[1] and ids[2], in its frame header and in
+// its scan headers.
+func withComponentIDs(data []byte, ids string) []byte {
+	data = bytes.Clone(data)
+	rename := func(b *byte) {
+		if 1 <= *b && int(*b) <= len(ids) {
+			*b = ids[*b-1]
+		}
+	}
+	// Outside of the segments, a 0xff byte is followed by 0x00 or by a
+	// marker, so the headers are found by their markers.
+	for i := 0; i+4 < len(data); i++ {
+		if data[i] != 0xff {
+			continue
+		}
+		switch data[i+1] {
+		case sof0Marker, sof1Marker, sof2Marker:
+			for j := 0; j < int(data[i+9]); j++ {
+				rename(&data[i+10+3*j])
+			}
+		case sosMarker:
+			for j := 0; j < int(data[i+4]); j++ {
+				rename(&data[i+5+2*j])
+			}
+		}
+	}
+	return data
+}
+
+// adobeSegment returns the data of an Adobe APP14 segment with the color
+// transform flag transform.
+func adobeSegment(transform byte) []byte {
+	return append([]byte("Adobe\x00\x64\x00\x00\x00\x00"), transform)
+}
+
+func TestDecodeAdobeTransform(t *testing.T) {
+	src := testimg.Photo(48, 32, 1)
+	o := &Options{Quality: 90}
+	// The files decoded as YCbCr have the same pixels as want.
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, o); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		transform int // -1 for no Adobe segment.
+		ids       string
+		rgb       bool
+	}{
+		{"YCbCr", -1, "\x01\x02\x03", false},
+		{"RGB identifiers", -1, "RGB", true},
+		{"Adobe RGB", adobeTransformUnknown, "\x01\x02\x03", true},
+		{"Adobe RGB with RGB identifiers", adobeTransformUnknown, "RGB", true},
+		{"Adobe YCbCr with RGB identifiers", adobeTransformYCbCr, "RGB", false},
+		{"Adobe YCCK with 3 components", adobeTransformYCbCrK, "\x01\x02\x03", false},
+	} {
+		marker, segment := byte(comMarker), []byte("no Adobe segment")
+		if tc.transform >= 0 {
+			marker, segment = app14Marker, adobeSegment(byte(tc.transform))
+		}
+		data := encodeWithOptionsAndSegment(t, src, o, marker, segment)
+		data = withComponentIDs(data, tc.ids)
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if _, ok := m.(*image.RGBA); ok != tc.rgb {
+			t.Errorf("%s: got %T, want RGB %t", tc.name, m, tc.rgb)
+		} else if !tc.rgb && !equalImages(m, want) {
+			t.Errorf("%s: the image differs from that of a YCbCr file", tc.name)
+		}
+		cfg, err := DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.ColorModel != m.ColorModel() {
+			t.Errorf("%s: DecodeConfig's color model differs from Decode's", tc.name)
+		}
+	}
+}
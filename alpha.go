@@ -0,0 +1,86 @@
+package progjpeg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// EncodeWithAlpha writes the color channels of m to w and its alpha channel
+// to alphaW, as two separate JPEG files. JPEG has no notion of transparency,
+// so the common workaround is to ship the alpha channel as a grayscale
+// "mask" image next to the color image.
+//
+// The color file is encoded from the non-premultiplied colors of m, so that
+// fully or partially transparent pixels keep their color instead of fading to
+// black. The color file uses the given options, and the alpha file only
+// their Quality, Progressive, OptimizeScans and Deterministic settings: it
+// uses the default grayscale scan script when o.Progressive is set, and is
+// not recorded in o.Session.
+func EncodeWithAlpha(w, alphaW io.Writer, m *image.NRGBA, o *Options) error {
+	b := m.Bounds()
+	rgb := image.NewRGBA(b)
+	alpha := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		src := m.Pix[m.PixOffset(b.Min.X, y):]
+		dst := rgb.Pix[rgb.PixOffset(b.Min.X, y):]
+		a := alpha.Pix[alpha.PixOffset(b.Min.X, y):]
+		for i, n := 0, b.Dx(); i < n; i++ {
+			dst[4*i+0] = src[4*i+0]
+			dst[4*i+1] = src[4*i+1]
+			dst[4*i+2] = src[4*i+2]
+			dst[4*i+3] = 0xff
+			a[i] = src[4*i+3]
+		}
+	}
+	if err := Encode(w, rgb, o); err != nil {
+		return err
+	}
+	var ao *Options
+	if o != nil {
+		// The other options, such as the Session, the scan script and the
+		// quality regions, belong to the color image.
+		ao = &Options{
+			Quality:       o.Quality,
+			Progressive:   o.Progressive,
+			OptimizeScans: o.OptimizeScans,
+			Deterministic: o.Deterministic,
+		}
+	}
+	return Encode(alphaW, alpha, ao)
+}
+
+// DecodeWithAlpha reads a color JPEG from r and a grayscale alpha mask JPEG
+// from alphaR, as written by [EncodeWithAlpha], and recombines them into a
+// single non-premultiplied image.
+func DecodeWithAlpha(r, alphaR io.Reader) (*image.NRGBA, error) {
+	m, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	am, err := Decode(alphaR)
+	if err != nil {
+		return nil, err
+	}
+	alpha, ok := am.(*image.Gray)
+	if !ok {
+		return nil, errors.New("jpeg: alpha mask is not a grayscale image")
+	}
+	b := m.Bounds()
+	if alpha.Bounds() != b {
+		return nil, errors.New("jpeg: alpha mask and color image bounds differ")
+	}
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = c.R
+			dst.Pix[i+1] = c.G
+			dst.Pix[i+2] = c.B
+			dst.Pix[i+3] = alpha.Pix[alpha.PixOffset(x, y)]
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,41 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeWithAlpha(t *testing.T) {
+	m0 := image.NewNRGBA(image.Rect(0, 0, 40, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			m0.SetNRGBA(x, y, color.NRGBA{uint8(6 * x), uint8(10 * y), 0x80, uint8(6 * x)})
+		}
+	}
+	for _, progressive := range []bool{false, true} {
+		var cbuf, abuf bytes.Buffer
+		var s Session
+		o := &Options{Quality: 90, Progressive: progressive, ScanScript: DefaultColorScanScript(), Session: &s}
+		if err := EncodeWithAlpha(&cbuf, &abuf, m0, o); err != nil {
+			t.Fatal(err)
+		}
+		// The session is that of the color file, not of the alpha one.
+		if len(s.Components) != 3 || s.Size != int64(cbuf.Len()) {
+			t.Errorf("progressive=%t: the session has %d components and %d bytes, want 3 and %d", progressive, len(s.Components), s.Size, cbuf.Len())
+		}
+		m1, err := DecodeWithAlpha(&cbuf, &abuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m1.Bounds() != m0.Bounds() {
+			t.Fatalf("bounds differ: %v and %v", m0.Bounds(), m1.Bounds())
+		}
+		for i := 0; i < len(m0.Pix); i++ {
+			if d := int(m0.Pix[i]) - int(m1.Pix[i]); d < -12 || d > 12 {
+				t.Fatalf("progressive=%t: pixel byte %d: got %d, want %d", progressive, i, m1.Pix[i], m0.Pix[i])
+			}
+		}
+	}
+}
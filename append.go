@@ -0,0 +1,54 @@
+package progjpeg
+
+import "image"
+
+// appendWriter is a writer that appends its output to a byte slice. Flush
+// is a no-op.
+type appendWriter struct {
+	b []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+func (w *appendWriter) WriteByte(c byte) error {
+	w.b = append(w.b, c)
+	return nil
+}
+
+func (w *appendWriter) Flush() error { return nil }
+
+// EncodeAppend appends the Image m, encoded as [Encode] does with the given
+// options, to dst and returns the extended slice. It writes to dst
+// directly, without the buffering of Encode, so that callers reusing dst
+// with [Encoder.EncodeAppend] do not allocate once dst is large enough. On
+// error, it returns dst unchanged.
+func EncodeAppend(dst []byte, m image.Image, o *Options) ([]byte, error) {
+	var e encoder
+	var aw appendWriter
+	return e.encodeAppend(&aw, dst, m, o)
+}
+
+// EncodeAppend appends the Image m to dst as [EncodeAppend] does, reusing
+// the Encoder's buffers. The Encoder's output stream is left unchanged.
+func (enc *Encoder) EncodeAppend(dst []byte, m image.Image, o *Options) ([]byte, error) {
+	e := &enc.e
+	w := e.w
+	e.err = nil
+	e.bits, e.nBits, e.nOut = 0, 0, 0
+	dst, err := e.encodeAppend(&enc.aw, dst, m, o)
+	e.w, enc.aw.b = w, nil
+	return dst, err
+}
+
+// encodeAppend encodes m with aw, appending it to dst.
+func (e *encoder) encodeAppend(aw *appendWriter, dst []byte, m image.Image, o *Options) ([]byte, error) {
+	aw.b = dst
+	e.w = aw
+	if err := e.encode(m, o); err != nil {
+		return dst, err
+	}
+	return aw.b, nil
+}
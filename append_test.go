@@ -0,0 +1,68 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestEncodeAppend(t *testing.T) {
+	m := testimg.Photo(150, 97, 1)
+	for _, o := range []*Options{nil, {Quality: 80, Progressive: true}} {
+		var want bytes.Buffer
+		if err := Encode(&want, m, o); err != nil {
+			t.Fatal(err)
+		}
+		prefix := []byte("prefix")
+		got, err := EncodeAppend(prefix, m, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(got, prefix) || !bytes.Equal(got[len(prefix):], want.Bytes()) {
+			t.Errorf("%+v: got %d bytes, want the %d bytes of Encode after the prefix", o, len(got)-len(prefix), want.Len())
+		}
+
+		var out bytes.Buffer
+		enc := NewEncoder(&out)
+		buf := make([]byte, 0, 2*want.Len())
+		for range 2 {
+			got, err := enc.EncodeAppend(buf[:0], m, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("%+v: Encoder.EncodeAppend: got %d bytes, want %d", o, len(got), want.Len())
+			}
+		}
+		if out.Len() != 0 {
+			t.Errorf("%+v: Encoder.EncodeAppend wrote %d bytes to the output stream", o, out.Len())
+		}
+	}
+}
+
+func TestEncodeAppendError(t *testing.T) {
+	dst := []byte("prefix")
+	got, err := EncodeAppend(dst, testimg.Photo(16, 16, 1), &Options{ChromaCoefficients: 1, ColorMatrix: &ColorMatrix{{100}}})
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	if string(got) != "prefix" {
+		t.Errorf("got %q, want dst unchanged", got)
+	}
+}
+
+func TestEncoderEncodeAppendAllocs(t *testing.T) {
+	m := testimg.Photo(64, 64, 1)
+	enc := NewEncoder(nil)
+	buf := make([]byte, 0, 1<<16)
+	o := &Options{Quality: 80}
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := enc.EncodeAppend(buf[:0], m, o); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per call, want 0", allocs)
+	}
+}
@@ -0,0 +1,143 @@
+package progjpeg
+
+// Successive approximation, described in section G.1.2 of the spec, sends
+// the coefficients of a band in several scans: a first scan, with a
+// SuccessiveApproxHigh of 0, sends them divided by 2^SuccessiveApproxLow,
+// and each refinement scan sends one more bit of every coefficient.
+
+// shiftBlock sets dst to the coefficients of b that the first scan of a
+// successive approximation with a SuccessiveApproxLow of al sends: the DC
+// coefficient shifted right by al bits, and the AC coefficients divided by
+// 2^al, rounded towards zero, as the point transform of section G.1.2.1.
+func shiftBlock(dst, b *block, al int) {
+	dst[0] = b[0] >> al
+	for i := 1; i < blockSize; i++ {
+		if c := b[i]; c < 0 {
+			dst[i] = -(-c >> al)
+		} else {
+			dst[i] = c >> al
+		}
+	}
+}
+
+// refineBlock codes the block (bx, by) of the component c, whose
+// coefficients are b, for the refinement scan s, or only counts its AC
+// symbols in acFreq if count is true. A DC refinement sends the bit al of
+// the DC coefficient, without any Huffman code.
+func (e *encoder) refineBlock(s *scanRun, c, bx, by int, b *block, q quantIndex, count bool, acFreq *[256]int) {
+	if count {
+		if s.zigStart > 0 {
+			refineAC(b, s.zigStart, s.zigEnd, s.al, func(symbol int32, _ int) { acFreq[symbol]++ }, nil)
+		}
+		return
+	}
+	var bands []int64
+	if e.bands != nil {
+		bands = e.bands.Components[c][:]
+	}
+	start := e.bitOffset()
+	if s.zigStart == 0 {
+		e.emit(uint32(b[0]>>s.al)&1, 1)
+		if bands != nil {
+			bands[0] += e.bitOffset() - start
+		}
+	} else {
+		e.writeRefineAC(b, q, s.zigStart, s.zigEnd, s.al, bands)
+	}
+	if e.alloc != nil {
+		e.addBits(c, bx, by, e.bitOffset()-start)
+	}
+}
+
+// writeRefineAC writes the AC refinement of the coefficients zigStart to
+// zigEnd of b, which sends their bit al, as in section G.1.2.3. If bands is
+// non-nil, the bits of every symbol are added to the band of the
+// coefficient that it ends on, as writeBandsBlock does.
+func (e *encoder) writeRefineAC(b *block, q quantIndex, zigStart, zigEnd, al int, bands []int64) {
+	h := huffIndex(2*q + 1)
+	start := e.bitOffset()
+	refineAC(b, zigStart, zigEnd, al, func(symbol int32, zig int) {
+		e.emitHuff(h, symbol)
+		if bands != nil {
+			end := e.bitOffset()
+			bands[bandOf(zig)] += end - start
+			start = end
+		}
+	}, func(bits []uint32, sign int32, zig int) {
+		if sign >= 0 {
+			e.emit(uint32(sign), 1)
+		}
+		for _, bit := range bits {
+			e.emit(bit, 1)
+		}
+		if bands != nil {
+			end := e.bitOffset()
+			bands[bandOf(zig)] += end - start
+			start = end
+		}
+	})
+}
+
+// refineAC walks the AC refinement of the coefficients zigStart to zigEnd
+// of b, which sends their bit al, and calls symbol for every Huffman
+// symbol, with the index of the coefficient that it codes or ends on, and
+// then, if bits is non-nil, bits with the sign bit of a newly non-zero
+// coefficient, or -1, and the correction bits of the coefficients that
+// were already non-zero, which follow the symbol. Every block ends with
+// its own end of block, since the encoder does not code runs of blocks.
+func refineAC(b *block, zigStart, zigEnd, al int, symbol func(symbol int32, zig int), bits func(bits []uint32, sign int32, zig int)) {
+	// abs holds the absolute values of the coefficients shifted by al
+	// bits, and eob is the index of the last newly non-zero coefficient,
+	// whose absolute value is then 1, after which runs of zeroes are left
+	// to the end of block.
+	var abs [blockSize]int32
+	eob := 0
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		c := b[unzig[zig]]
+		if c < 0 {
+			c = -c
+		}
+		abs[zig] = c >> al
+		if abs[zig] == 1 {
+			eob = zig
+		}
+	}
+	// corr holds the correction bits buffered since the last symbol.
+	var corr [blockSize]uint32
+	n, run := 0, int32(0)
+	flush := func(sign int32, zig int) {
+		if bits != nil {
+			bits(corr[:n], sign, zig)
+		}
+		n = 0
+	}
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		a := abs[zig]
+		if a == 0 {
+			run++
+			continue
+		}
+		for run > 15 && zig <= eob {
+			symbol(0xf0, zig)
+			flush(-1, zig)
+			run -= 16
+		}
+		if a > 1 {
+			corr[n] = uint32(a & 1)
+			n++
+			continue
+		}
+		symbol(run<<4|1, zig)
+		sign := int32(0)
+		if b[unzig[zig]] > 0 {
+			sign = 1
+		}
+		flush(sign, zig)
+		run = 0
+	}
+	if run > 0 || n > 0 {
+		zig := min(zigEnd-int(run)+1, zigEnd)
+		symbol(0x00, zig)
+		flush(-1, zig)
+	}
+}
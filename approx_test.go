@@ -0,0 +1,88 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// successiveScript sends the DC coefficients in two bit planes, and the
+// luma AC coefficients in three, with optimized Huffman tables if table is
+// HuffmanOptimized.
+func successiveScript(table HuffmanTable) ScanScript {
+	script := ScanScript{
+		{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxLow: 1},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 5, SuccessiveApproxLow: 2},
+		{Component: 0, SpectralStart: 6, SpectralEnd: 63, SuccessiveApproxLow: 2},
+		{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+		{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+	}
+	for i := range script {
+		script[i].DCTable, script[i].ACTable = table, table
+	}
+	return script
+}
+
+func TestSuccessiveApproximation(t *testing.T) {
+	m := testimg.Photo(67, 45, 1)
+	var want bytes.Buffer
+	if err := Encode(&want, m, &Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	m0, err := jpeg.Decode(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []HuffmanTable{HuffmanDefault, HuffmanOptimized} {
+		script := successiveScript(table)
+		if err := VerifyScanScriptCoverage(script, 3); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Quality: 95, Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+			t.Fatalf("%v: %v", table, err)
+		}
+		// The standard library decodes the same coefficients as those of
+		// the baseline image.
+		m1, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%v: %v", table, err)
+		}
+		if !equalImages(m0, m1) {
+			t.Errorf("%v: the image differs from the baseline image", table)
+		}
+	}
+}
+
+func TestSuccessiveApproximationValidation(t *testing.T) {
+	var m image.Image = testimg.Photo(16, 16, 1)
+	for _, tc := range []struct {
+		ah, al int
+		ok     bool
+	}{
+		{0, 1, true},
+		{0, 13, true},
+		{2, 1, true},
+		{1, 1, false},
+		{2, 0, false},
+		{1, 2, false},
+	} {
+		script := ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: tc.ah, SuccessiveApproxLow: tc.al},
+		}
+		if err := ValidateScanScript(script, 3); (err == nil) != tc.ok {
+			t.Errorf("Ah=%d, Al=%d: ValidateScanScript returned %v", tc.ah, tc.al, err)
+		}
+		err := Encode(new(bytes.Buffer), m, &Options{Progressive: true, ScanScript: script, StrictScanScript: true})
+		if (err == nil) != tc.ok {
+			t.Errorf("Ah=%d, Al=%d: Encode returned %v", tc.ah, tc.al, err)
+		}
+	}
+}
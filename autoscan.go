@@ -0,0 +1,90 @@
+package progjpeg
+
+// autoSplits are the candidate ends of the first AC band of a component: the
+// zig-zag index of the last coefficient of each of the first anti-diagonals.
+var autoSplits = [...]int{2, 5, 9, 14, 20, 27}
+
+// autoFirstBandEnergy is the percentage of a component's AC energy that the
+// first AC band chosen by autoScanScript must carry.
+const autoFirstBandEnergy = 80
+
+// autoStats are the statistics of the AC coefficients of a component that
+// autoScanScript chooses the scan script from.
+type autoStats struct {
+	// energy[zig] is the sum of the squares of the AC coefficients of zig-zag
+	// index zig, weighed by their quantization step to compare their
+	// magnitudes before quantization.
+	energy [blockSize]float64
+	// nonZero is the number of non-zero AC coefficients, in nBlock blocks.
+	nonZero, nBlock int
+}
+
+// addAutoStats adds the statistics of the coefficients in e.coeffs to
+// stats, which has one element per component.
+func (e *encoder) addAutoStats(stats []autoStats) {
+	for c := range stats {
+		p := &e.coeffs[c]
+		q := &e.quant[e.comp[c].q]
+		s := &stats[c]
+		for i := range p.blocks {
+			b := &p.blocks[i]
+			for zig := 1; zig < blockSize; zig++ {
+				if v := b[unzig[zig]]; v != 0 {
+					f := float64(v) * float64(q[zig])
+					s.energy[zig] += f * f
+					s.nonZero++
+				}
+			}
+		}
+		s.nBlock += len(p.blocks)
+	}
+}
+
+// autoScanScript returns a scan script chosen from the statistics of the
+// coefficients of the image, as described in [Options.OptimizeScans].
+func (e *encoder) autoScanScript(stats []autoStats) ScanScript {
+	nComponent := len(e.comp)
+	var script, second ScanScript
+	if nComponent <= maxComponents {
+		script = append(script, ProgressiveScan{Component: -1})
+	} else {
+		for c := 0; c < nComponent; c++ {
+			script = append(script, ProgressiveScan{Component: c})
+		}
+	}
+	for c := 0; c < nComponent; c++ {
+		end := autoSplit(&stats[c])
+		script = append(script, ProgressiveScan{Component: c, SpectralStart: 1, SpectralEnd: end})
+		if end < blockSize-1 {
+			second = append(second, ProgressiveScan{Component: c, SpectralStart: end + 1, SpectralEnd: blockSize - 1})
+		}
+	}
+	return append(script, second...)
+}
+
+// autoSplit returns the zig-zag index of the last coefficient of the first
+// AC band of a component with the given statistics: the first of
+// autoSplits whose band carries at least autoFirstBandEnergy percent of the
+// AC energy, or 63 if the component has less than one non-zero AC
+// coefficient per block on average, in which case splitting would cost more
+// than it saves.
+func autoSplit(s *autoStats) int {
+	if s.nonZero < s.nBlock {
+		return blockSize - 1
+	}
+	var total float64
+	for _, f := range s.energy {
+		total += f
+	}
+	var sum float64
+	zig := 1
+	for _, end := range autoSplits {
+		for ; zig <= end; zig++ {
+			sum += s.energy[zig]
+		}
+		if sum*100 >= total*autoFirstBandEnergy {
+			return end
+		}
+	}
+	return autoSplits[len(autoSplits)-1]
+}
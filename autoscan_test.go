@@ -0,0 +1,76 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestOptimizeScans(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m    image.Image
+	}{
+		{"gradient", testimg.Gradient(96, 80)},
+		{"zoneplate", testimg.ZonePlate(96, 80)},
+		{"noise", testimg.Noise(96, 80, 1)},
+		{"photo", testimg.Photo(96, 80, 1)},
+	} {
+		var want bytes.Buffer
+		if err := Encode(&want, tc.m, &Options{Quality: 90, Progressive: true}); err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		var s Session
+		if err := Encode(&got, tc.m, &Options{Quality: 90, Progressive: true, OptimizeScans: true, Session: &s}); err != nil {
+			t.Fatal(err)
+		}
+		if s.Fallback != "" {
+			t.Errorf("%s: script was rejected: %s", tc.name, s.Fallback)
+		}
+		if err := VerifyScanScriptCoverage(s.ScanScript, len(s.Components)); err != nil {
+			t.Errorf("%s: %v: %v", tc.name, s.ScanScript, err)
+		}
+		// Every script sends the same coefficients, so the pixels do not
+		// depend on the script.
+		m0, err := Decode(&want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, err := Decode(&got)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !equalImages(m0, m1) {
+			t.Errorf("%s: optimized scans decode differently", tc.name)
+		}
+	}
+}
+
+func TestAutoSplit(t *testing.T) {
+	// The first band of a smooth image is shorter than that of noise.
+	split := func(m image.Image) int {
+		var s Session
+		if err := Encode(new(bytes.Buffer), m, &Options{Quality: 90, Progressive: true, OptimizeScans: true, Session: &s}); err != nil {
+			t.Fatal(err)
+		}
+		return s.ScanScript[1].SpectralEnd
+	}
+	smooth, noise := split(testimg.Gradient(256, 256)), split(testimg.Noise(256, 256, 1))
+	if smooth >= noise {
+		t.Errorf("first band of the gradient ends at %d, that of noise at %d", smooth, noise)
+	}
+
+	// A flat image has no AC content to split.
+	var s Session
+	if err := Encode(new(bytes.Buffer), image.NewGray(image.Rect(0, 0, 64, 64)), &Options{Progressive: true, OptimizeScans: true, Session: &s}); err != nil {
+		t.Fatal(err)
+	}
+	want := ScanScript{{Component: -1}, {Component: 0, SpectralStart: 1, SpectralEnd: 63}}
+	if !reflect.DeepEqual(s.ScanScript, want) {
+		t.Errorf("flat image: got %v, want %v", s.ScanScript, want)
+	}
+}
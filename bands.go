@@ -0,0 +1,138 @@
+package progjpeg
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// NumBands is the number of spectral bands of a BandBits.
+const NumBands = 4
+
+// Bands are the spectral bands of a BandBits, as the first and last
+// indexes, in zigzag order, of their coefficients: the DC coefficient, the
+// lowest AC coefficients, the middle ones and the highest ones. They are
+// the usual boundaries of the spectral selections of progressive scans.
+var Bands = [NumBands][2]int{{0, 0}, {1, 5}, {6, 20}, {21, 63}}
+
+// BandBits records how many bits of entropy-coded data each spectral band
+// of each component took, for [Options].BandBits, to split the spectral
+// selections of a custom scan script where the bits are. The bits of a run
+// of zero coefficients count in the band of the coefficient that ends it,
+// and those of an end of block in the band of its first zero coefficient.
+type BandBits struct {
+	// Components holds the bits of each band, in the order of Bands, of
+	// each component, in the order of the frame.
+	Components [][NumBands]int64
+}
+
+// Total returns the bits of all the bands of all the components of b.
+func (b *BandBits) Total() int64 {
+	var n int64
+	for _, c := range b.Components {
+		for _, bits := range c {
+			n += bits
+		}
+	}
+	return n
+}
+
+// WriteBandReport writes b to w as a table, one component per line, with a
+// last line for the percentage of all the bits that each band takes.
+func WriteBandReport(w io.Writer, b *BandBits) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "component\t")
+	for _, band := range Bands {
+		if band[0] == band[1] {
+			fmt.Fprintf(tw, "%d\t", band[0])
+		} else {
+			fmt.Fprintf(tw, "%d-%d\t", band[0], band[1])
+		}
+	}
+	fmt.Fprintln(tw, "total\t")
+	var all [NumBands]int64
+	for i, c := range b.Components {
+		var total int64
+		fmt.Fprintf(tw, "%d\t", i)
+		for j, bits := range c {
+			fmt.Fprintf(tw, "%d\t", bits)
+			all[j] += bits
+			total += bits
+		}
+		fmt.Fprintf(tw, "%d\t\n", total)
+	}
+	total := b.Total()
+	fmt.Fprint(tw, "%\t")
+	for _, bits := range all {
+		pct := 0.0
+		if total > 0 {
+			pct = 100 * float64(bits) / float64(total)
+		}
+		fmt.Fprintf(tw, "%.1f\t", pct)
+	}
+	fmt.Fprintln(tw, "100.0\t")
+	return tw.Flush()
+}
+
+// bandOf returns the band of the coefficient at the index zig, in zigzag
+// order.
+func bandOf(zig int) int {
+	switch {
+	case zig == 0:
+		return 0
+	case zig <= 5:
+		return 1
+	case zig <= 20:
+		return 2
+	}
+	return 3
+}
+
+// writeMeasuredBlock is writeBlock for the block (bx, by) of the component
+// c, which also adds its bits to the BitAllocation and BandBits being
+// recorded.
+func (e *encoder) writeMeasuredBlock(c, bx, by int, b *block, q quantIndex, prevDC int32, zigStart, zigEnd int) int32 {
+	start := e.bitOffset()
+	if e.bands == nil {
+		e.writeBlock(b, q, prevDC, zigStart, zigEnd)
+	} else {
+		e.writeBandsBlock(e.bands.Components[c][:], b, q, prevDC, zigStart, zigEnd)
+	}
+	if e.alloc != nil {
+		e.addBits(c, bx, by, e.bitOffset()-start)
+	}
+	return b[0]
+}
+
+// writeBandsBlock is writeBlock, which adds the bits of each band to bands.
+func (e *encoder) writeBandsBlock(bands []int64, b *block, q quantIndex, prevDC int32, zigStart, zigEnd int) {
+	start := e.bitOffset()
+	if zigStart == 0 {
+		e.emitHuffRLE(huffIndex(2*q+0), 0, b[0]-prevDC)
+		zigStart = 1
+		end := e.bitOffset()
+		bands[0] += end - start
+		start = end
+	}
+	h, runLength := huffIndex(2*q+1), int32(0)
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		ac := b[unzig[zig]]
+		if ac == 0 {
+			runLength++
+			continue
+		}
+		for runLength > 15 {
+			e.emitHuff(h, 0xf0)
+			runLength -= 16
+		}
+		e.emitHuffRLE(h, runLength, ac)
+		runLength = 0
+		end := e.bitOffset()
+		bands[bandOf(zig)] += end - start
+		start = end
+	}
+	if runLength > 0 {
+		e.emitHuff(h, 0x00)
+		bands[bandOf(zigEnd-int(runLength)+1)] += e.bitOffset() - start
+	}
+}
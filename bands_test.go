@@ -0,0 +1,86 @@
+package progjpeg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestBandBits(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, tc := range []struct {
+		name  string
+		o     Options
+		comps int
+	}{
+		{"baseline", Options{Quality: 75}, 3},
+		{"concurrent", Options{Quality: 75, Concurrency: 4}, 3},
+		{"gray", Options{Quality: 75, Grayscale: true}, 1},
+		{"progressive", Options{Quality: 75, Progressive: true}, 3},
+	} {
+		o := tc.o
+		var b BandBits
+		o.BandBits = &b
+		var data bytes.Buffer
+		if err := Encode(&data, src, &o); err != nil {
+			t.Fatal(err)
+		}
+		if len(b.Components) != tc.comps {
+			t.Fatalf("%s: got %d components, want %d", tc.name, len(b.Components), tc.comps)
+		}
+		for i, c := range b.Components {
+			if c[0] == 0 {
+				t.Errorf("%s: component %d: no DC bits", tc.name, i)
+			}
+		}
+		if b.Components[0][1] == 0 {
+			t.Errorf("%s: no bits for the lowest AC coefficients", tc.name)
+		}
+		scans, err := ReportScans(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entropy := 8 * scans[len(scans)-1].Cumulative
+		if total := b.Total(); total > entropy || total < entropy*95/100 {
+			t.Errorf("%s: bands took %d bits, want about %d", tc.name, total, entropy)
+		}
+	}
+}
+
+func TestBandBitsMatchScans(t *testing.T) {
+	// Each scan of a spectral selection script codes one band of one
+	// component, so that the bands add up to the sizes of the scans.
+	var script ScanScript
+	for c := 0; c < 3; c++ {
+		for _, band := range Bands {
+			script = append(script, ProgressiveScan{Component: c, SpectralStart: band[0], SpectralEnd: band[1]})
+		}
+	}
+	var b BandBits
+	var data bytes.Buffer
+	o := &Options{Quality: 75, Progressive: true, ScanScript: script, BandBits: &b}
+	if err := Encode(&data, testimg.Photo(83, 47, 1), o); err != nil {
+		t.Fatal(err)
+	}
+	scans, err := ReportScans(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scans {
+		got, want := b.Components[i/NumBands][i%NumBands], 8*s.Bytes
+		if got > want || got < want-64 {
+			t.Errorf("scan %d: band took %d bits, scan %d", i, got, want)
+		}
+	}
+
+	var report strings.Builder
+	if err := WriteBandReport(&report, &b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "21-63") || !strings.HasPrefix(strings.TrimSpace(lines[4]), "%") {
+		t.Errorf("report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,89 @@
+package progjpeg
+
+import "image"
+
+// A BitAllocation records where the bits of an encoded image go, for
+// [Options].BitAllocation: how many bits of entropy-coded data each 8x8
+// block of pixels took, over all of its components and scans.
+type BitAllocation struct {
+	// Width and Height are the number of 8x8 blocks per row and per column
+	// of the image, the last ones of which may be partial.
+	Width, Height int
+	// Bits holds the bits of the Width*Height blocks, left to right and
+	// top to bottom. The bits of a subsampled chroma block are shared by
+	// the blocks of pixels that it covers, and those of the blocks that
+	// only pad the last MCUs are not counted. Bits include the 0x00 bytes
+	// stuffed after 0xff bytes.
+	Bits []int64
+}
+
+// Heatmap returns the bits of a as a grayscale image of one pixel per
+// block, scaled so that the block that took the most bits is white.
+func (a *BitAllocation) Heatmap() *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, a.Width, a.Height))
+	var most int64
+	for _, b := range a.Bits {
+		most = max(most, b)
+	}
+	if most == 0 {
+		return m
+	}
+	for i, b := range a.Bits {
+		m.Pix[i] = uint8((b*255 + most/2) / most)
+	}
+	return m
+}
+
+// Total returns the bits of all the blocks of a.
+func (a *BitAllocation) Total() int64 {
+	var n int64
+	for _, b := range a.Bits {
+		n += b
+	}
+	return n
+}
+
+// startBitAllocation sets a up to record the bits of the image being
+// encoded, if a is not nil.
+func (e *encoder) startBitAllocation(a *BitAllocation) {
+	e.alloc = a
+	if a == nil {
+		return
+	}
+	a.Width, a.Height = (e.size.X+7)/8, (e.size.Y+7)/8
+	a.Bits = make([]int64, a.Width*a.Height)
+}
+
+// bitOffset returns the number of bits written so far, including those
+// buffered.
+func (e *encoder) bitOffset() int64 {
+	return 8*e.offset() + int64(e.nBits)
+}
+
+// addBits adds the bits of the block (bx, by) of the component c to the
+// blocks of pixels that it covers. The blocks of different MCU rows cover
+// different blocks of pixels, so that the rows can be coded concurrently.
+func (e *encoder) addBits(c, bx, by int, bits int64) {
+	a := e.alloc
+	hmax, vmax := e.maxSampling()
+	sx, sy := hmax/e.comp[c].h, vmax/e.comp[c].v
+	x0, y0 := bx*sx, by*sy
+	x1, y1 := min(x0+sx, a.Width), min(y0+sy, a.Height)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	// The remainder of the division goes to the first blocks, so that the
+	// total is exact.
+	n := int64((x1 - x0) * (y1 - y0))
+	share, extra := bits/n, bits%n
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			b := share
+			if extra > 0 {
+				b++
+				extra--
+			}
+			a.Bits[y*a.Width+x] += b
+		}
+	}
+}
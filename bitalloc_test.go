@@ -0,0 +1,72 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestBitAllocation(t *testing.T) {
+	// The left half is a photo and the right half is flat.
+	src := image.NewRGBA(image.Rect(0, 0, 83, 47))
+	draw.Draw(src, src.Bounds(), image.NewUniform(image.Black), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(0, 0, 40, 47), testimg.Photo(40, 47, 1), image.Point{}, draw.Src)
+	for _, tc := range []struct {
+		name string
+		o    Options
+	}{
+		{"baseline", Options{Quality: 75}},
+		{"concurrent", Options{Quality: 75, Concurrency: 4}},
+		{"gray", Options{Quality: 75, Grayscale: true}},
+		{"progressive", Options{Quality: 75, Progressive: true}},
+		{"optimized", Options{Quality: 75, Progressive: true, OptimizeScans: true}},
+	} {
+		o := tc.o
+		var a BitAllocation
+		o.BitAllocation = &a
+		var data bytes.Buffer
+		if err := Encode(&data, src, &o); err != nil {
+			t.Fatal(err)
+		}
+		if a.Width != 11 || a.Height != 6 || len(a.Bits) != 66 {
+			t.Fatalf("%s: got %dx%d blocks, %d bits, want 11x6, 66", tc.name, a.Width, a.Height, len(a.Bits))
+		}
+		scans, err := ReportScans(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The bits padding the scans and their restart intervals and some of
+		// the stuffed bytes are not in a block.
+		entropy := 8 * scans[len(scans)-1].Cumulative
+		if total := a.Total(); total > entropy || total < entropy*95/100 {
+			t.Errorf("%s: blocks took %d bits, want about %d", tc.name, total, entropy)
+		}
+		var busy, flat int64
+		for y := 0; y < a.Height; y++ {
+			for x := 0; x < a.Width; x++ {
+				if x < 5 {
+					busy += a.Bits[y*a.Width+x]
+				} else if x > 5 {
+					flat += a.Bits[y*a.Width+x]
+				}
+			}
+		}
+		if busy <= 2*flat {
+			t.Errorf("%s: busy blocks took %d bits, flat ones %d", tc.name, busy, flat)
+		}
+		h := a.Heatmap()
+		if h.Bounds() != image.Rect(0, 0, 11, 6) {
+			t.Errorf("%s: heatmap bounds %v", tc.name, h.Bounds())
+		}
+		var white bool
+		for _, p := range h.Pix {
+			white = white || p == 255
+		}
+		if !white {
+			t.Errorf("%s: heatmap has no white pixel", tc.name)
+		}
+	}
+}
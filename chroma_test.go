@@ -0,0 +1,64 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestChromaCoefficients(t *testing.T) {
+	m := testimg.Photo(256, 192, 4)
+	var full, cut bytes.Buffer
+	if err := Encode(&full, m, &Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&cut, m, &Options{Quality: 90, ChromaCoefficients: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if cut.Len() >= full.Len() {
+		t.Errorf("got %d bytes, want less than %d", cut.Len(), full.Len())
+	}
+	d0, err := Decode(&full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := Decode(&cut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The luma is untouched.
+	if !bytes.Equal(d0.(*image.YCbCr).Y, d1.(*image.YCbCr).Y) {
+		t.Error("the luma planes differ")
+	}
+
+	for _, regions := range []bool{false, true} {
+		var e encoder
+		e.setQuality(90)
+		e.init(m.Bounds().Size(), ycbcrComponents)
+		o := &Options{Quality: 90, ChromaCoefficients: 6}
+		if regions {
+			o.Regions = []QualityRegion{{Rect: image.Rect(0, 0, 64, 64), Quality: 40}}
+			e.setRegions(m.Bounds(), o, 90)
+		}
+		e.setQuantOptions(o)
+		e.computeCoefficients(m)
+		nonZero := 0
+		for c, p := range e.coeffs[:3] {
+			for _, b := range p.blocks {
+				for zig := 6; zig < blockSize; zig++ {
+					if b[unzig[zig]] != 0 {
+						nonZero++
+						if c > 0 {
+							t.Fatalf("regions %v: component %d has coefficient %d", regions, c, zig)
+						}
+					}
+				}
+			}
+		}
+		if nonZero == 0 {
+			t.Errorf("regions %v: the luma coefficients were cut too", regions)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// runAnalyze reports the frame, the likely encoder and the scans of a JPEG
+// file.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	in := fs.String("i", "", "Input JPEG file path")
+	markers := fs.Bool("markers", false, "Also list the markers of the file, with their offsets and lengths")
+	fs.Parse(args)
+	if err := fileArgs(fs, in, nil); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return errors.New("input file path must be specified")
+	}
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	p, err := progjpeg.Probe(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cant read input %s: %w", *in, err)
+	}
+	kind := "baseline"
+	if p.Progressive {
+		kind = "progressive"
+	}
+	fmt.Printf("%s: %dx%d, %d components, %s, %s, %d bytes\n", *in, p.Width, p.Height, p.Components, p.SubsampleRatio, kind, p.Size)
+	if m, err := progjpeg.IdentifyEncoder(bytes.NewReader(data)); err == nil {
+		encoder := m.Encoder
+		if encoder == "" {
+			encoder = "unknown"
+		}
+		fmt.Printf("encoder: %s, quality %d, libjpeg equivalent %d\n", encoder, m.Quality, m.EquivalentQuality)
+	}
+	if *markers {
+		ms, err := progjpeg.ParseStructure(bytes.NewReader(data))
+		for _, m := range ms {
+			fmt.Printf("marker %#02x at %d, %d bytes", m.Marker, m.Offset, m.Length)
+			if m.ID != "" {
+				fmt.Printf(", %s", m.ID)
+			}
+			fmt.Println()
+		}
+		if err != nil {
+			return fmt.Errorf("cant parse input %s: %w", *in, err)
+		}
+	}
+	scans, err := progjpeg.ReportScans(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cant read scans of input %s: %w", *in, err)
+	}
+	fmt.Println()
+	return progjpeg.WriteScanReport(os.Stdout, scans)
+}
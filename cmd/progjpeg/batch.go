@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// A job is a file of a batch and the path of its output.
+type job struct {
+	in, out string
+}
+
+// imageExts are the extensions of the files of a directory that a
+// recursive batch encodes, those of the registered decoders.
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// batchJobs returns the jobs of the files that patterns match, in order,
+// without duplicates, with their outputs in the directory dir. A pattern
+// without glob metacharacters is a file name; a glob pattern that matches
+// no file is an error, as the shell would report it. If recursive is set,
+// the image files of the trees of the directories that patterns match are
+// encoded too, each to the same path relative to dir as to its directory.
+func batchJobs(patterns []string, dir string, recursive bool) ([]job, error) {
+	var jobs []job
+	seen := make(map[string]bool)
+	add := func(in, out string) {
+		if !seen[in] {
+			seen[in] = true
+			jobs = append(jobs, job{in, out})
+		}
+	}
+	for _, p := range patterns {
+		if p == "-" {
+			return nil, errors.New("the standard input cannot be part of a batch")
+		}
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(p); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %s", p)
+			}
+		}
+		for _, m := range matches {
+			if fi, err := os.Stat(m); !recursive || err != nil || !fi.IsDir() {
+				add(m, outputPath(filepath.Base(m), dir))
+				continue
+			}
+			err := filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || !imageExts[strings.ToLower(filepath.Ext(path))] {
+					return err
+				}
+				rel, err := filepath.Rel(m, path)
+				if err != nil {
+					return err
+				}
+				add(path, outputPath(rel, dir))
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("cant walk %s: %w", m, err)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// outputPath returns the path in dir of the JPEG file of the input file
+// whose path is rel: rel with a .jpg extension.
+func outputPath(rel, dir string) string {
+	return filepath.Join(dir, strings.TrimSuffix(rel, filepath.Ext(rel))+".jpg")
+}
+
+// batchStats are the aggregate statistics of a batch.
+type batchStats struct {
+	files, failed int
+	// in and out are the sizes of the inputs and outputs of the files that
+	// did not fail.
+	in, out int64
+}
+
+// encodeBatch encodes the files that patterns match into the directory
+// dir, scaled as rs says, with workers files at a time. It goes on after a file fails,
+// reports each failure and, at the end, the statistics of the batch on
+// stderr, and returns an error if any file failed.
+func encodeBatch(patterns []string, dir string, recursive bool, workers int, o *progjpeg.Options, rs resizeSpec) error {
+	if len(patterns) == 0 {
+		return errors.New("no input files")
+	}
+	if workers < 1 {
+		return fmt.Errorf("invalid number of workers %d", workers)
+	}
+	jobs, err := batchJobs(patterns, dir, recursive)
+	if err != nil {
+		return err
+	}
+	// Two inputs of the same name in different formats or directories
+	// would overwrite each other's output.
+	outputs := make(map[string]string)
+	for _, j := range jobs {
+		if prev, ok := outputs[j.out]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", prev, j.in, j.out)
+		}
+		outputs[j.out] = j.in
+	}
+
+	start := time.Now()
+	var (
+		mu    sync.Mutex
+		stats = batchStats{files: len(jobs)}
+		wg    sync.WaitGroup
+		queue = make(chan job)
+	)
+	for range min(workers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				in, out, err := encodeJob(j, o, rs)
+				mu.Lock()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					stats.failed++
+				} else {
+					stats.in += in
+					stats.out += out
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	pct := 0.0
+	if stats.in > 0 {
+		pct = 100 * float64(stats.out) / float64(stats.in)
+	}
+	fmt.Fprintf(os.Stderr, "%d files, %d failed: %d bytes in, %d bytes out (%.1f%%), %s\n",
+		stats.files, stats.failed, stats.in, stats.out, pct, time.Since(start).Round(time.Millisecond))
+	if stats.failed > 0 {
+		return fmt.Errorf("%d of %d files failed", stats.failed, stats.files)
+	}
+	return nil
+}
+
+// encodeJob encodes the file of j, creating the directory of its output if
+// needed, and returns the sizes of its input and output.
+func encodeJob(j job, o *progjpeg.Options, rs resizeSpec) (in, out int64, err error) {
+	if err := os.MkdirAll(filepath.Dir(j.out), 0o777); err != nil {
+		return 0, 0, fmt.Errorf("cant create output directory %s: %w", filepath.Dir(j.out), err)
+	}
+	if err := encodeFile(j.in, j.out, o, rs); err != nil {
+		return 0, 0, err
+	}
+	fi, err := os.Stat(j.in)
+	if err != nil {
+		return 0, 0, err
+	}
+	fo, err := os.Stat(j.out)
+	if err != nil {
+		return 0, 0, err
+	}
+	return fi.Size(), fo.Size(), nil
+}
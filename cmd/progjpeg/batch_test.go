@@ -0,0 +1,157 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates the named files, and their directories, under dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBatchJobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.png", "b.png", "c.gif")
+	out := filepath.Join(dir, "out")
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		want     []job
+	}{
+		{
+			"glob",
+			[]string{in("*.png")},
+			[]job{{in("a.png"), filepath.Join(out, "a.jpg")}, {in("b.png"), filepath.Join(out, "b.jpg")}},
+		},
+		{
+			// A file name is used as it is, even if the file is missing,
+			// so that encoding it reports the error.
+			"file names",
+			[]string{in("c.gif"), in("missing.png")},
+			[]job{{in("c.gif"), filepath.Join(out, "c.jpg")}, {in("missing.png"), filepath.Join(out, "missing.jpg")}},
+		},
+		{
+			"duplicates",
+			[]string{in("b.png"), in("*.png"), in("b.png")},
+			[]job{{in("b.png"), filepath.Join(out, "b.jpg")}, {in("a.png"), filepath.Join(out, "a.jpg")}},
+		},
+	} {
+		got, err := batchJobs(tc.patterns, out, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, patterns := range [][]string{
+		{in("*.jpg")},
+		{in("a.png"), "-"},
+		{in("[")},
+	} {
+		if jobs, err := batchJobs(patterns, out, false); err == nil {
+			t.Errorf("%q: got %v, want an error", patterns, jobs)
+		}
+	}
+}
+
+func TestEncodeBatchSameOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.png", "a.gif")
+	out := filepath.Join(dir, "out")
+	if err := encodeBatch([]string{filepath.Join(dir, "a.*")}, out, false, 1, nil, resizeSpec{}); err == nil {
+		t.Fatal("a.png and a.gif were both encoded to a.jpg")
+	}
+	// Nothing is encoded.
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("the output directory was created: %v", err)
+	}
+}
+
+// writeImages creates the named PNG files, and their directories, under
+// dir.
+func writeImages(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	writeFiles(t, dir, names...)
+	for _, name := range names {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewGray(image.Rect(0, 0, 16, 8)))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEncodeBatchRecursive(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	writeImages(t, in, "a.png", "sub/b.png", "sub/deeper/C.PNG")
+	// Only the files with the extensions of imageExts are picked up.
+	writeFiles(t, in, "notes.txt", "sub/thumbs.db", "sub/png")
+	out := filepath.Join(dir, "out")
+	if err := encodeBatch([]string{in}, out, true, 2, nil, resizeSpec{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err := filepath.WalkDir(out, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(out, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.jpg", "sub/b.jpg", "sub/deeper/C.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got outputs %v, want %v", got, want)
+	}
+}
+
+func TestEncodeBatchWorkers(t *testing.T) {
+	dir := t.TempDir()
+	writeImages(t, dir, "a.png")
+	if err := encodeBatch([]string{filepath.Join(dir, "a.png")}, filepath.Join(dir, "out"), false, 0, nil, resizeSpec{}); err == nil {
+		t.Error("0 workers were accepted")
+	}
+}
+
+func TestEncodeBatchFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeImages(t, dir, "a.png", "c.png")
+	// b.png is not an image.
+	writeFiles(t, dir, "b.png")
+	out := filepath.Join(dir, "out")
+	if err := encodeBatch([]string{filepath.Join(dir, "*.png")}, out, false, 1, nil, resizeSpec{}); err == nil {
+		t.Error("got no error after a file failed")
+	}
+	// The other files are encoded all the same.
+	for _, name := range []string{"a.jpg", "c.jpg"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
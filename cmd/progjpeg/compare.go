@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// runCompare compares two JPEG encodings of an image.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	a := fs.String("a", "", "First JPEG file path")
+	b := fs.String("b", "", "Second JPEG file path")
+	original := fs.String("original", "", "Path of the image that both files encode")
+	fs.Parse(args)
+
+	if *a == "" || *b == "" || *original == "" {
+		return errors.New("both JPEG files and the original image must be specified")
+	}
+	img, err := readImage(*original)
+	if err != nil {
+		return err
+	}
+	if *a == "-" && *b == "-" || *a == "-" && *original == "-" || *b == "-" && *original == "-" {
+		return errors.New("only one input can be the standard input")
+	}
+	fa, err := openInput(*a)
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	fb, err := openInput(*b)
+	if err != nil {
+		return err
+	}
+	defer fb.Close()
+	c, err := progjpeg.CompareEncodings(fa, fb, img)
+	if err != nil {
+		return fmt.Errorf("cant compare %s and %s: %w", *a, *b, err)
+	}
+	fmt.Println(c)
+	return nil
+}
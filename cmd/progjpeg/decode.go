@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// runDecode decodes a JPEG file to PNG.
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	in := fs.String("i", "", "Input JPEG file path")
+	out := fs.String("o", "", "Output PNG file path")
+	n := fs.Int64("bytes", 0, "Decode only the complete scans of the first bytes of the input, as a browser would show them, or 0 for the whole input")
+	fs.Parse(args)
+	if err := fileArgs(fs, in, out); err != nil {
+		return err
+	}
+
+	if *in == "" || *out == "" {
+		return errors.New("input and output file paths must be specified")
+	}
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	var img image.Image
+	if *n > 0 {
+		img, err = progjpeg.RenderAt(bytes.NewReader(data), *n)
+	} else {
+		img, err = progjpeg.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return fmt.Errorf("cant decode input %s: %w", *in, err)
+	}
+	return writeFile(*out, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/dlecorfec/progjpeg"
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// runEncode encodes an image file, or a test image, as a JPEG, or a batch
+// of image files into a directory.
+func runEncode(args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	in := fs.String("i", "", "Input image file path, or glob pattern of input files with -outdir")
+	out := fs.String("o", "", "Output JPEG file path")
+	outDir := fs.String("outdir", "", "Output directory of a batch of inputs, given by -i and the arguments, each written as its name with a .jpg extension")
+	recursive := fs.Bool("r", false, "Encode the image files of the trees of the input directories of a batch, to the same paths in -outdir")
+	workers := fs.Int("j", runtime.NumCPU(), "Number of files of a batch encoded concurrently")
+	quality := fs.Int("q", 90, "JPEG quality, from 1 to 100")
+	baseline := fs.Bool("baseline", false, "Encode a baseline JPEG, with a single scan")
+	progressive := fs.Bool("progressive", true, "Encode a progressive JPEG, with the scans of -preset or -scans")
+	testImage := fs.String("testimg", "", "Generate a test image instead of reading an input ("+strings.Join(testimg.Names, ", ")+")")
+	width := fs.Int("width", 640, "Width of the generated test image")
+	height := fs.Int("height", 480, "Height of the generated test image")
+	scans := fs.String("scans", "", "Scan script file, in cjpeg -scans syntax or JSON, to use instead of the preset")
+	preset := fs.String("preset", "default", "Scan script preset ("+strings.Join(progjpeg.PresetNames, ", ")+")")
+	maxMemory := fs.Int64("max-memory", 0, "Maximum memory for the DCT coefficients, in MB, or 0 for no limit")
+	matrix := fs.String("matrix", "bt601", "RGB to YCbCr matrix (bt601, bt709)")
+	rgb := fs.Bool("rgb", false, "Encode R, G and B components without color transform")
+	resize := fs.String("resize", "", "Scale images to WxH pixels before encoding them, with 0 for either to keep the aspect ratio")
+	maxDim := fs.Int("max-dim", 0, "Shrink images whose width or height exceeds this number of pixels, keeping the aspect ratio")
+	fs.Parse(args)
+
+	if *quality < 1 || *quality > 100 {
+		return fmt.Errorf("quality %d is not between 1 and 100", *quality)
+	}
+	if *baseline {
+		*progressive = false
+	}
+	if !*progressive && *scans != "" {
+		return errors.New("a baseline JPEG has no scan script")
+	}
+
+	rs, err := parseResize(*resize, *maxDim)
+	if err != nil {
+		return err
+	}
+
+	var script progjpeg.ScanScript
+	if *progressive {
+		script, err = progjpeg.Preset(*preset)
+		if err != nil {
+			return fmt.Errorf("cant use preset: %w", err)
+		}
+	}
+	if *scans != "" {
+		script, err = readScanScript(*scans)
+		if err != nil {
+			return fmt.Errorf("cant read scan script %s: %w", *scans, err)
+		}
+	}
+
+	var colorMatrix *progjpeg.ColorMatrix
+	switch *matrix {
+	case "bt601":
+	case "bt709":
+		colorMatrix = &progjpeg.BT709
+	default:
+		return fmt.Errorf("unknown color matrix %s", *matrix)
+	}
+
+	o := &progjpeg.Options{
+		Quality:              *quality,
+		Progressive:          *progressive,
+		ScanScript:           script,
+		MaxCoefficientMemory: *maxMemory << 20,
+		ColorMatrix:          colorMatrix,
+		RGB:                  *rgb,
+	}
+
+	if *outDir != "" {
+		if *out != "" || *testImage != "" {
+			return errors.New("-outdir excludes -o and -testimg")
+		}
+		patterns := fs.Args()
+		if *in != "" {
+			patterns = append([]string{*in}, patterns...)
+		}
+		return encodeBatch(patterns, *outDir, *recursive, *workers, o, rs)
+	}
+
+	if *recursive {
+		return errors.New("-r needs -outdir")
+	}
+	if err := fileArgs(fs, in, out); err != nil {
+		return err
+	}
+	if (*in == "" && *testImage == "") || *out == "" {
+		return errors.New("input and output file paths must be specified")
+	}
+	if *testImage != "" {
+		img, err := testimg.Generate(*testImage, *width, *height, 1)
+		if err != nil {
+			return fmt.Errorf("cant generate test image: %w", err)
+		}
+		img = rs.apply(img)
+		return writeFile(*out, func(w io.Writer) error {
+			return progjpeg.Encode(w, img, o)
+		})
+	}
+	return encodeFile(*in, *out, o, rs)
+}
+
+// encodeFile encodes the image file in, or the standard input if it is
+// "-", scaled as rs says, to the JPEG file out, or the standard output if
+// it is "-".
+func encodeFile(in, out string, o *progjpeg.Options, rs resizeSpec) error {
+	img, err := readImage(in)
+	if err != nil {
+		return err
+	}
+	img = rs.apply(img)
+	return writeFile(out, func(w io.Writer) error {
+		return progjpeg.Encode(w, img, o)
+	})
+}
+
+// readScanScript reads the scan script of the named file, which is either
+// JSON, an array of scans or a string, or in the syntax of cjpeg's -scans
+// option.
+func readScanScript(name string) (progjpeg.ScanScript, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if t := bytes.TrimSpace(data); len(t) > 0 && (t[0] == '[' || t[0] == '"') {
+		var script progjpeg.ScanScript
+		if err := json.Unmarshal(t, &script); err != nil {
+			return nil, err
+		}
+		return script, nil
+	}
+	return progjpeg.ParseScanScript(bytes.NewReader(data))
+}
@@ -1,83 +1,178 @@
-// Command progjpeg is a command-line tool to encode images as progressive JPEGs.
-// It can also serve the generated JPEG over HTTP for testing progressive loading using a browser
-// and its throttling capabilities in dev tools.
+// Command progjpeg is a command-line tool to encode images as progressive JPEGs,
+// or as baseline JPEGs to compare them with, and to decode, analyze, transcode
+// and compare JPEG files. It can also serve a JPEG over HTTP for testing
+// progressive loading using a browser and its throttling capabilities in dev
+// tools.
+//
+// Usage:
+//
+//	progjpeg <command> [flags] [input [output]]
+//
+// The commands are encode, decode, analyze, transcode, compare and serve, and
+// "progjpeg <command> -h" lists the flags of each. The input and output files
+// are given by the -i and -o flags or as arguments, and "-" is the standard
+// input or output, so that the tool composes with pipelines:
+//
+//	curl -s https://example.com/photo.png | progjpeg encode -q 80 - - > photo.jpg
+//
+// Without a command, the flags are those of encode.
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"image"
-	"net/http"
+	"io"
 	"os"
+	"strings"
 
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-
-	"github.com/dlecorfec/progjpeg"
 )
 
-func main() {
-	var in string
-	var out string
-	var hostPort string
-	flag.StringVar(&in, "i", "", "Input image file path")
-	flag.StringVar(&out, "o", "", "Output JPEG file path")
-	flag.StringVar(&hostPort, "http", "", "Host and port for HTTP server serving output")
-	flag.Parse()
+// A command is a subcommand of the tool.
+type command struct {
+	name, summary string
+	// run parses the flags in args and runs the command.
+	run func(args []string) error
+}
+
+var commands = []command{
+	{"encode", "encode an image as a progressive or baseline JPEG", runEncode},
+	{"decode", "decode a JPEG, or the first bytes of one, to PNG", runDecode},
+	{"analyze", "report the structure, scans and encoder of a JPEG", runAnalyze},
+	{"transcode", "crop, rotate, requantize or rescan a JPEG losslessly", runTranscode},
+	{"compare", "compare two encodings of an image", runCompare},
+	{"serve", "serve a JPEG over HTTP", runServe},
+}
 
-	if (in == "" && hostPort == "") || out == "" {
-		fmt.Fprintf(os.Stderr, "Input and output file paths must be specified")
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage()
+		return
+	}
+	cmd := commands[0]
+	if !strings.HasPrefix(args[0], "-") {
+		found := false
+		for _, c := range commands {
+			if c.name == args[0] {
+				cmd, found = c, true
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "unknown command %s\n", args[0])
+			usage()
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "progjpeg %s: %s\n", cmd.name, err)
 		os.Exit(1)
 	}
+}
 
-	// Read input image
-	file, err := os.Open(in)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant open input %s: %s", in, err)
-		os.Exit(1)
+// usage lists the commands on stderr.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: progjpeg <command> [flags] [input [output]]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
 	}
+}
 
-	defer file.Close()
-	img, _, err := image.Decode(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant decode input %s: %s", in, err)
-		os.Exit(1)
+// fileArgs sets *in and *out from the arguments that follow the flags of
+// fs, the input and then the output, which may be given instead of -i and
+// -o. out is nil for the commands that have no output file.
+func fileArgs(fs *flag.FlagSet, in, out *string) error {
+	args := fs.Args()
+	max := 1
+	if out != nil {
+		max = 2
+	}
+	if len(args) > max {
+		return fmt.Errorf("too many arguments: %s", strings.Join(args, " "))
+	}
+	for i, p := range []*string{in, out}[:len(args)] {
+		if *p != "" {
+			return fmt.Errorf("both %s %s and the argument %s given", []string{"-i", "-o"}[i], *p, args[i])
+		}
+		*p = args[i]
 	}
+	return nil
+}
 
-	// Create output file
-	output, err := os.Create(out)
+// openInput opens the input file name, or the standard input if name is
+// "-".
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant open output %s: %s", out, err)
-		os.Exit(1)
+		return nil, fmt.Errorf("cant open input %s: %w", name, err)
 	}
+	return f, nil
+}
 
-	defer output.Close()
+// readInput reads all of the input file name, or of the standard input if
+// name is "-".
+func readInput(name string) ([]byte, error) {
+	r, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cant read input %s: %w", name, err)
+	}
+	return data, nil
+}
 
-	// Encode as progressive JPEG
-	err = progjpeg.Encode(output, img, &progjpeg.Options{
-		Quality:     90,
-		Progressive: true,
-		ScanScript:  progjpeg.DefaultColorScanScript(),
-	})
+// readImage decodes the image file name, or the standard input if name is
+// "-", in any format of the registered decoders.
+func readImage(name string) (image.Image, error) {
+	r, err := openInput(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant encode output %s: %s", out, err)
-		os.Exit(1)
+		return nil, err
+	}
+	defer r.Close()
+	img, _, err := image.Decode(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("cant decode input %s: %w", name, err)
 	}
+	return img, nil
+}
 
-	// test server for progressive loading
-	if hostPort != "" {
-		fmt.Printf("Serving %s on http://%s/\n", out, hostPort)
-		fileServer := func(filename string) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				http.ServeFile(w, r, filename)
-			})
+// writeFile creates the file name and writes it with write, reporting the
+// first error of write and of closing the file. If name is "-", write
+// writes to the standard output, which then carries nothing else.
+func writeFile(name string, write func(w io.Writer) error) error {
+	if name == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		err := write(w)
+		if err == nil {
+			err = w.Flush()
 		}
-		http.Handle("/", fileServer(out))
-		err := http.ListenAndServe(hostPort, nil)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant start http server on %s: %s", hostPort, err)
-			os.Exit(1)
+			return fmt.Errorf("cant write standard output: %w", err)
 		}
+		return nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("cant open output %s: %w", name, err)
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cant write output %s: %w", name, err)
 	}
+	return nil
 }
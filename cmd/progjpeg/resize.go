@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// A resizeSpec is the size to scale images to before encoding them.
+type resizeSpec struct {
+	// width and height are those of -resize, either of which is 0 to keep
+	// the aspect ratio, and maxDim is that of -max-dim. All are 0 to keep
+	// the size of the images.
+	width, height, maxDim int
+}
+
+// parseResize returns the resizeSpec of the -resize and -max-dim flags.
+func parseResize(resize string, maxDim int) (resizeSpec, error) {
+	var s resizeSpec
+	if resize != "" {
+		if maxDim != 0 {
+			return s, fmt.Errorf("-resize and -max-dim are exclusive")
+		}
+		if _, err := fmt.Sscanf(resize, "%dx%d", &s.width, &s.height); err != nil ||
+			s.width < 0 || s.height < 0 || s.width == 0 && s.height == 0 {
+			return s, fmt.Errorf("invalid size %s, want WxH, with 0 for either to keep the aspect ratio", resize)
+		}
+	}
+	if maxDim < 0 {
+		return s, fmt.Errorf("invalid maximum dimension %d", maxDim)
+	}
+	s.maxDim = maxDim
+	return s, nil
+}
+
+// size returns the size that s gives to an image of w x h pixels.
+func (s resizeSpec) size(w, h int) (int, int) {
+	switch {
+	case s.maxDim > 0:
+		if w <= s.maxDim && h <= s.maxDim {
+			return w, h
+		}
+		if w >= h {
+			return s.maxDim, max(1, (h*s.maxDim+w/2)/w)
+		}
+		return max(1, (w*s.maxDim+h/2)/h), s.maxDim
+	case s.width > 0 && s.height > 0:
+		return s.width, s.height
+	case s.width > 0:
+		return s.width, max(1, (h*s.width+w/2)/w)
+	case s.height > 0:
+		return max(1, (w*s.height+h/2)/h), s.height
+	}
+	return w, h
+}
+
+// apply returns m scaled as s says, or m itself if its size does not
+// change.
+func (s resizeSpec) apply(m image.Image) image.Image {
+	b := m.Bounds()
+	w, h := s.size(b.Dx(), b.Dy())
+	if w == b.Dx() && h == b.Dy() {
+		return m
+	}
+	return resample(m, w, h)
+}
+
+// A tap is a source pixel and its weight in a destination pixel.
+type tap struct {
+	src    int
+	weight float64
+}
+
+// filterTaps returns the taps of each of the dst pixels of a row or
+// column of src pixels, for a triangle filter that is widened when
+// shrinking so that every source pixel contributes, as the BiLinear kernel
+// of golang.org/x/image/draw does.
+func filterTaps(src, dst int) [][]tap {
+	scale := float64(src) / float64(dst)
+	support := max(scale, 1)
+	taps := make([][]tap, dst)
+	for i := range taps {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - support))
+		hi := int(math.Floor(center + support))
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			wt := 1 - math.Abs(float64(j)-center)/support
+			if wt <= 0 {
+				continue
+			}
+			taps[i] = append(taps[i], tap{min(max(j, 0), src-1), wt})
+			sum += wt
+		}
+		for k := range taps[i] {
+			taps[i][k].weight /= sum
+		}
+	}
+	return taps
+}
+
+// resample returns m scaled to w x h pixels as an *image.RGBA, filtering
+// the rows and then the columns. The source rows are read and scaled one at
+// a time, and only those that the current destination row needs are kept,
+// so that large images are not held in memory a second time.
+func resample(m image.Image, w, h int) *image.RGBA {
+	b := m.Bounds()
+	xt, yt := filterTaps(b.Dx(), w), filterTaps(b.Dy(), h)
+	// rows holds the premultiplied RGBA of the scaled source rows, the
+	// source row y being at rows[y%len(rows)]. The taps of a destination
+	// row are in increasing order, so it needs at most len(rows)
+	// consecutive source rows.
+	n := 0
+	for _, taps := range yt {
+		n = max(n, taps[len(taps)-1].src-taps[0].src+1)
+	}
+	rows := make([][]uint16, n)
+	for i := range rows {
+		rows[i] = make([]uint16, 4*w)
+	}
+	line := make([]uint16, 4*b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	// next is the next source row to scale, if a destination row needs it.
+	next := 0
+	for y, taps := range yt {
+		for ; next <= taps[len(taps)-1].src; next++ {
+			if next >= taps[0].src {
+				scaleRow(rows[next%n], line, m, b.Min.Y+next, xt)
+			}
+		}
+		for x := 0; x < w; x++ {
+			var p [4]float64
+			for _, t := range taps {
+				s := rows[t.src%n][4*x : 4*x+4]
+				for c := range p {
+					p[c] += float64(s[c]) * t.weight
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{clamp16(p[0]), clamp16(p[1]), clamp16(p[2]), clamp16(p[3])})
+		}
+	}
+	return dst
+}
+
+// scaleRow sets row to the premultiplied RGBA of the row y of m, scaled to
+// len(xt) pixels. line holds the source row.
+func scaleRow(row, line []uint16, m image.Image, y int, xt [][]tap) {
+	b := m.Bounds()
+	for x := 0; x < b.Dx(); x++ {
+		r, g, bl, a := m.At(b.Min.X+x, y).RGBA()
+		line[4*x], line[4*x+1], line[4*x+2], line[4*x+3] = uint16(r), uint16(g), uint16(bl), uint16(a)
+	}
+	for x, taps := range xt {
+		var p [4]float64
+		for _, t := range taps {
+			s := line[4*t.src : 4*t.src+4]
+			for c := range p {
+				p[c] += float64(s[c]) * t.weight
+			}
+		}
+		for c := range p {
+			row[4*x+c] = clamp16(p[c])
+		}
+	}
+}
+
+// clamp16 rounds v to a 16-bit color value.
+func clamp16(v float64) uint16 {
+	return uint16(min(max(math.Round(v), 0), 0xffff))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseResize(t *testing.T) {
+	for _, tc := range []struct {
+		resize string
+		maxDim int
+		want   resizeSpec
+		ok     bool
+	}{
+		{"", 0, resizeSpec{}, true},
+		{"640x480", 0, resizeSpec{width: 640, height: 480}, true},
+		{"640x0", 0, resizeSpec{width: 640}, true},
+		{"0x480", 0, resizeSpec{height: 480}, true},
+		{"", 1024, resizeSpec{maxDim: 1024}, true},
+		{"0x0", 0, resizeSpec{}, false},
+		{"-1x480", 0, resizeSpec{}, false},
+		{"640", 0, resizeSpec{}, false},
+		{"wxh", 0, resizeSpec{}, false},
+		{"640x480", 1024, resizeSpec{}, false},
+		{"", -1, resizeSpec{}, false},
+	} {
+		got, err := parseResize(tc.resize, tc.maxDim)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q, %d: got error %v", tc.resize, tc.maxDim, err)
+			continue
+		}
+		if tc.ok && got != tc.want {
+			t.Errorf("%q, %d: got %+v, want %+v", tc.resize, tc.maxDim, got, tc.want)
+		}
+	}
+}
+
+func TestResizeSize(t *testing.T) {
+	for _, tc := range []struct {
+		spec         resizeSpec
+		w, h         int
+		wantW, wantH int
+	}{
+		{resizeSpec{}, 300, 200, 300, 200},
+		{resizeSpec{width: 100, height: 50}, 300, 200, 100, 50},
+		// Either dimension alone keeps the aspect ratio.
+		{resizeSpec{width: 150}, 300, 200, 150, 100},
+		{resizeSpec{height: 50}, 300, 200, 75, 50},
+		{resizeSpec{width: 100}, 300, 1, 100, 1},
+		// -max-dim scales the largest dimension down to it.
+		{resizeSpec{maxDim: 100}, 300, 200, 100, 67},
+		{resizeSpec{maxDim: 100}, 200, 300, 67, 100},
+		{resizeSpec{maxDim: 100}, 1000, 1, 100, 1},
+		// and leaves smaller images alone.
+		{resizeSpec{maxDim: 100}, 100, 80, 100, 80},
+		{resizeSpec{maxDim: 100}, 30, 20, 30, 20},
+	} {
+		if w, h := tc.spec.size(tc.w, tc.h); w != tc.wantW || h != tc.wantH {
+			t.Errorf("%+v, %dx%d: got %dx%d, want %dx%d", tc.spec, tc.w, tc.h, w, h, tc.wantW, tc.wantH)
+		}
+	}
+}
+
+func TestResizeApply(t *testing.T) {
+	m := image.NewRGBA(image.Rect(10, 20, 130, 100))
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			m.SetRGBA(x, y, color.RGBA{uint8(2 * (x - 10)), 0x80, uint8(3 * (y - 20)), 0xff})
+		}
+	}
+	// An image within -max-dim is returned as it is.
+	if got := (resizeSpec{maxDim: 120}).apply(m); got != image.Image(m) {
+		t.Error("-max-dim scaled an image within the limit")
+	}
+
+	for _, spec := range []resizeSpec{{maxDim: 40}, {width: 360}, {width: 50, height: 200}} {
+		got := spec.apply(m)
+		wantW, wantH := spec.size(120, 80)
+		if b := got.Bounds(); b != image.Rect(0, 0, wantW, wantH) {
+			t.Fatalf("%+v: got bounds %v, want %dx%d", spec, b, wantW, wantH)
+		}
+		// The constant green and alpha stay constant, and the red and blue
+		// gradients keep increasing.
+		prevR, prevB := -1, -1
+		for i := 0; i < min(wantW, wantH); i++ {
+			c := got.At(i*wantW/min(wantW, wantH), i*wantH/min(wantW, wantH)).(color.RGBA)
+			if c.G != 0x80 || c.A != 0xff {
+				t.Fatalf("%+v: pixel %d is %v", spec, i, c)
+			}
+			if int(c.R) < prevR || int(c.B) < prevB {
+				t.Fatalf("%+v: pixel %d is %v, after red %d and blue %d", spec, i, c, prevR, prevB)
+			}
+			prevR, prevB = int(c.R), int(c.B)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	// A constant image stays constant at any size.
+	c := color.RGBA{0x12, 0x9a, 0xfe, 0xff}
+	m := image.NewRGBA(image.Rect(3, 5, 50, 36))
+	for i := 0; i < len(m.Pix); i += 4 {
+		m.Pix[i], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	for _, size := range []image.Point{{47, 31}, {10, 7}, {1, 1}, {120, 33}, {200, 200}} {
+		got := resample(m, size.X, size.Y)
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				if p := got.RGBAAt(x, y); p != c {
+					t.Fatalf("constant image at %v: pixel (%d, %d) is %v, want %v", size, x, y, p, c)
+				}
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		src  []uint8
+		want []uint8
+	}{
+		// At the same size, each pixel is its own only tap.
+		{"identity", []uint8{0, 64, 128, 192, 255}, []uint8{0, 64, 128, 192, 255}},
+		// Halving weighs the pixels with a triangle twice as wide, and
+		// the edges are extended with their pixel.
+		{"halve", []uint8{0, 64, 128, 192}, []uint8{40, 152}},
+		// Doubling interpolates linearly, and repeats the edge pixels.
+		{"double", []uint8{0, 200}, []uint8{0, 50, 150, 200}},
+	} {
+		// The pixels are a row, then a column, of gray levels.
+		n := len(tc.src)
+		row, col := image.NewRGBA(image.Rect(0, 0, n, 1)), image.NewRGBA(image.Rect(0, 0, 1, n))
+		for i, v := range tc.src {
+			row.SetRGBA(i, 0, color.RGBA{v, v, v, 0xff})
+			col.SetRGBA(0, i, color.RGBA{v, v, v, 0xff})
+		}
+		gotRow, gotCol := resample(row, len(tc.want), 1), resample(col, 1, len(tc.want))
+		for i, v := range tc.want {
+			want := color.RGBA{v, v, v, 0xff}
+			if p := gotRow.RGBAAt(i, 0); p != want {
+				t.Errorf("%s: row pixel %d is %v, want %v", tc.name, i, p, want)
+			}
+			if p := gotCol.RGBAAt(0, i); p != want {
+				t.Errorf("%s: column pixel %d is %v, want %v", tc.name, i, p, want)
+			}
+		}
+	}
+}
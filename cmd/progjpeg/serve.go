@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+)
+
+// runServe serves a JPEG file over HTTP.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	in := fs.String("i", "", "JPEG file path")
+	hostPort := fs.String("http", "localhost:8080", "Host and port for HTTP server serving the file")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("input file path must be specified")
+	}
+	fmt.Printf("Serving %s on http://%s/\n", *in, *hostPort)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, *in)
+	})
+	if err := http.ListenAndServe(*hostPort, handler); err != nil {
+		return fmt.Errorf("cant start http server on %s: %w", *hostPort, err)
+	}
+	return nil
+}
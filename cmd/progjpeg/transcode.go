@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// runTranscode edits a JPEG file without decoding it to pixels.
+func runTranscode(args []string) error {
+	fs := flag.NewFlagSet("transcode", flag.ExitOnError)
+	in := fs.String("i", "", "Input JPEG file path")
+	out := fs.String("o", "", "Output JPEG file path")
+	crop := fs.String("crop", "", "Keep the rectangle x,y,width,height, aligned down to the MCU grid")
+	rotate := fs.Int("rotate", 0, "Rotate clockwise by 90, 180 or 270 degrees")
+	gray := fs.Bool("gray", false, "Drop the chroma components")
+	quality := fs.Int("q", 0, "Requantize to this quality, from 1 to 100, if it is lower than that of the input")
+	strip := fs.Bool("strip", false, "Remove the Exif, ICC, XMP and comment segments")
+	baseline := fs.Bool("baseline", false, "Write a baseline JPEG")
+	progressive := fs.Bool("progressive", false, "Write a progressive JPEG with the scans of -preset or -scans")
+	scans := fs.String("scans", "", "Scan script file, in cjpeg -scans syntax or JSON, for -progressive")
+	preset := fs.String("preset", "default", "Scan script preset for -progressive ("+strings.Join(progjpeg.PresetNames, ", ")+")")
+	fs.Parse(args)
+	if err := fileArgs(fs, in, out); err != nil {
+		return err
+	}
+
+	if *in == "" || *out == "" {
+		return errors.New("input and output file paths must be specified")
+	}
+	if *quality != 0 && (*quality < 1 || *quality > 100) {
+		return fmt.Errorf("quality %d is not between 1 and 100", *quality)
+	}
+	if *baseline && *progressive {
+		return errors.New("-baseline and -progressive are exclusive")
+	}
+	file, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tc := progjpeg.NewTranscoder(file)
+	if *crop != "" {
+		var x, y, w, h int
+		if _, err := fmt.Sscanf(*crop, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil {
+			return fmt.Errorf("invalid crop rectangle %s", *crop)
+		}
+		tc.Crop(image.Rect(x, y, x+w, y+h))
+	}
+	if *rotate != 0 {
+		tc.Rotate(*rotate)
+	}
+	if *gray {
+		tc.Grayscale()
+	}
+	if *quality != 0 {
+		tc.Requantize(*quality)
+	}
+	if *strip {
+		tc.StripMetadata(progjpeg.MetadataNone)
+	}
+	switch {
+	case *baseline:
+		tc.Baseline()
+	case *progressive:
+		script, err := progjpeg.Preset(*preset)
+		if err != nil {
+			return fmt.Errorf("cant use preset: %w", err)
+		}
+		if *scans != "" {
+			if script, err = readScanScript(*scans); err != nil {
+				return fmt.Errorf("cant read scan script %s: %w", *scans, err)
+			}
+		}
+		tc.Progressive(script)
+	}
+	return writeFile(*out, func(w io.Writer) error {
+		_, err := tc.WriteTo(w)
+		return err
+	})
+}
@@ -0,0 +1,56 @@
+package progjpeg
+
+import "image"
+
+// cmykComponents is the frame layout of CMYK images: four full resolution
+// components, which all use the luminance tables, as in libjpeg.
+var cmykComponents = []encComponent{
+	{1, 1, quantIndexLuminance},
+	{1, 1, quantIndexLuminance},
+	{1, 1, quantIndexLuminance},
+	{1, 1, quantIndexLuminance},
+}
+
+// cmykToBlocks stores the C, M, Y and K values of the 8x8 region of m whose
+// top-left corner is p in the four blocks of dst. The values are inverted,
+// 255 meaning no ink, as in the files of Adobe applications, which the
+// Adobe APP14 segment tells decoders to expect.
+func cmykToBlocks(m *image.CMYK, p image.Point, dst []block) {
+	b := m.Bounds()
+	xmax := b.Max.X - 1
+	ymax := b.Max.Y - 1
+	for j := 0; j < 8; j++ {
+		offset := (min(p.Y+j, ymax)-b.Min.Y)*m.Stride - b.Min.X*4
+		for i := 0; i < 8; i++ {
+			pix := m.Pix[offset+min(p.X+i, xmax)*4:]
+			dst[0][8*j+i] = 255 - int32(pix[0])
+			dst[1][8*j+i] = 255 - int32(pix[1])
+			dst[2][8*j+i] = 255 - int32(pix[2])
+			dst[3][8*j+i] = 255 - int32(pix[3])
+		}
+	}
+}
+
+// smoothCMYK is smoothImage for CMYK images, whose four channels are
+// smoothed separately.
+func smoothCMYK(m *image.CMYK, factor int) *image.CMYK {
+	b := m.Bounds()
+	dst := image.NewCMYK(b)
+	for c := 0; c < 4; c++ {
+		p := image.NewGray(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			src, d := m.Pix[m.PixOffset(b.Min.X, y):], p.Pix[p.PixOffset(b.Min.X, y):]
+			for x := range b.Dx() {
+				d[x] = src[4*x+c]
+			}
+		}
+		p = smoothPlane(p, factor)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			src, d := p.Pix[p.PixOffset(b.Min.X, y):], dst.Pix[dst.PixOffset(b.Min.X, y):]
+			for x := range b.Dx() {
+				d[4*x+c] = src[x]
+			}
+		}
+	}
+	return dst
+}
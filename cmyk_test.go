@@ -0,0 +1,154 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// cmykPhoto returns a CMYK version of a testimg photo.
+func cmykPhoto(w, h int) *image.CMYK {
+	src := testimg.Photo(w, h, 1)
+	m := image.NewCMYK(src.Bounds())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.Set(x, y, color.CMYKModel.Convert(src.At(x, y)))
+		}
+	}
+	return m
+}
+
+// cmykError returns the mean absolute difference between the channels of
+// two CMYK images of the same bounds.
+func cmykError(m0, m1 *image.CMYK) float64 {
+	sum := 0
+	for i := range m0.Pix {
+		sum += max(int(m0.Pix[i])-int(m1.Pix[i]), int(m1.Pix[i])-int(m0.Pix[i]))
+	}
+	return float64(sum) / float64(len(m0.Pix))
+}
+
+func TestEncodeCMYK(t *testing.T) {
+	m := cmykPhoto(83, 47)
+	for _, o := range []*Options{
+		{Quality: 95},
+		{Quality: 95, Progressive: true},
+		{Quality: 95, Concurrency: 4},
+		{Quality: 95, Smoothing: 10},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		info, err := Probe(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Components != 4 || !info.HasAdobe {
+			t.Errorf("%+v: got %d components, Adobe segment %t, want 4 and true", o, info.Components, info.HasAdobe)
+		}
+		d, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := d.(*image.CMYK)
+		if !ok {
+			t.Fatalf("%+v: got %T, want *image.CMYK", o, d)
+		}
+		if got.Bounds() != m.Bounds() {
+			t.Fatalf("%+v: got bounds %v, want %v", o, got.Bounds(), m.Bounds())
+		}
+		if e := cmykError(got, m); e > 3 {
+			t.Errorf("%+v: mean error %.2f, want at most 3", o, e)
+		}
+	}
+}
+
+func TestEncodeCMYKGrayscale(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, cmykPhoto(32, 32), &Options{Grayscale: true}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*image.Gray); !ok {
+		t.Errorf("got %T, want *image.Gray", d)
+	}
+}
+
+func TestDecodeYCCK(t *testing.T) {
+	// An *image.CMYK whose C, M and Y hold the inverted Y, Cb and Cr of the
+	// photo is stored as Y, Cb, Cr and the inverted K, which is a YCCK file
+	// once its Adobe segment says so. Like the K, the C, M and Y that the
+	// Y, Cb and Cr encode are inverted: they are the R, G and B.
+	src := testimg.Photo(48, 32, 1)
+	ycck := image.NewCMYK(src.Bounds())
+	want := image.NewCMYK(src.Bounds())
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 48; x++ {
+			r, g, b, _ := src.At(x, y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			k := uint8(x * 5)
+			ycck.SetCMYK(x, y, color.CMYK{255 - yy, 255 - cb, 255 - cr, k})
+			rr, gg, bb := color.YCbCrToRGB(yy, cb, cr)
+			want.SetCMYK(x, y, color.CMYK{rr, gg, bb, k})
+		}
+	}
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, ycck, &Options{Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	mw.WriteSegment(app14Marker, []byte("Adobe\x00\x64\x00\x00\x00\x00\x02"))
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	mw.WriteScan(ProgressiveScan{Component: -1, SpectralEnd: blockSize - 1})
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := d.(*image.CMYK)
+	if !ok {
+		t.Fatalf("got %T, want *image.CMYK", d)
+	}
+	if e := cmykError(got, want); e > 2 {
+		t.Errorf("mean error %.2f, want at most 2", e)
+	}
+}
+
+func TestDecodeCMYKFile(t *testing.T) {
+	f, err := os.Open("testdata/video-001.cmyk.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*image.CMYK); !ok {
+		t.Fatalf("got %T, want *image.CMYK", m)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := cmykError(d.(*image.CMYK), m.(*image.CMYK)); e > 3 {
+		t.Errorf("round trip: mean error %.2f, want at most 3", e)
+	}
+}
@@ -0,0 +1,276 @@
+package progjpeg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// A CoefficientPlane holds the quantized DCT coefficients of one component
+// of an image, such as those read from an existing JPEG file by another
+// decoder.
+type CoefficientPlane struct {
+	// H and V are the horizontal and vertical sampling factors of the
+	// component, from 1 to 4.
+	H, V int
+	// Table is the index, in [CoefficientMeta].QuantTables, of the
+	// quantization table of the component. It also selects the Huffman
+	// tables: luminance for 0, chrominance for 1.
+	Table int
+	// Width and Height are the number of blocks per row and per column of
+	// Blocks. They must be at least the number of blocks that the component
+	// needs to cover the image; further blocks are ignored.
+	Width, Height int
+	// Blocks holds the Width*Height blocks of the component, left to right
+	// and top to bottom. The coefficients of a block are in natural
+	// (row-major) order, not in zig-zag order, and are already divided by
+	// the quantization table.
+	Blocks [][blockSize]int32
+}
+
+// CoefficientMeta describes the image whose coefficients are passed to
+// [EncodeCoefficients].
+type CoefficientMeta struct {
+	// Width and Height are the size of the image, in pixels.
+	Width, Height int
+	// QuantTables holds one or two quantization tables, in zig-zag order,
+	// as written in a DQT marker.
+	QuantTables [][blockSize]uint8
+}
+
+// EncodeCoefficients writes a JPEG image made of the given quantized DCT
+// coefficient planes to w, without transforming or quantizing them again:
+// decoding a file and encoding its coefficients is lossless, and lets the
+// caller change the scan script of a file, or edit it in the coefficient
+// domain.
+//
+// The Progressive, ScanScript, OptimizeScans, StrictScanScript, OmitTables,
+// ICCProfile and Session options apply as they do to [Encode]; the options
+// about pixels, such as Quality, Regions and Thumbnail, do not. A nil
+// *[Options] writes a baseline image.
+func EncodeCoefficients(w io.Writer, planes []CoefficientPlane, meta *CoefficientMeta, o *Options) error {
+	var e encoder
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	return e.encodeCoefficients(planes, meta, o)
+}
+
+// encodeCoefficients writes the image made of the given coefficients to
+// e.w with the given options.
+func (e *encoder) encodeCoefficients(planes []CoefficientPlane, meta *CoefficientMeta, o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	if meta == nil {
+		return errors.New("jpeg: missing coefficient metadata")
+	}
+	if meta.Width <= 0 || meta.Height <= 0 || meta.Width >= 1<<16 || meta.Height >= 1<<16 {
+		return fmt.Errorf("jpeg: invalid image size %dx%d", meta.Width, meta.Height)
+	}
+	if err := checkQuantTables(meta.QuantTables); err != nil {
+		return err
+	}
+	if len(planes) == 0 || len(planes) > maxFrameComponents {
+		return fmt.Errorf("jpeg: got %d coefficient planes (must be 1 to %d)", len(planes), maxFrameComponents)
+	}
+	comp := make([]encComponent, len(planes))
+	blocksPerMCU := 0
+	for i, p := range planes {
+		if p.H < 1 || p.H > 4 || p.V < 1 || p.V > 4 {
+			return fmt.Errorf("jpeg: plane %d has invalid sampling factors %dx%d (must be 1 to 4)", i, p.H, p.V)
+		}
+		if p.Table < 0 || p.Table >= len(meta.QuantTables) {
+			return fmt.Errorf("jpeg: plane %d has invalid quantization table %d", i, p.Table)
+		}
+		comp[i] = encComponent{p.H, p.V, quantIndex(p.Table)}
+		blocksPerMCU += p.H * p.V
+	}
+	if len(planes) <= maxComponents && blocksPerMCU > 10 {
+		return fmt.Errorf("jpeg: an MCU of the planes has %d blocks (must be at most 10)", blocksPerMCU)
+	}
+	if o.Progressive && o.StrictScanScript && o.ScanScript != nil {
+		if err := ValidateScanScript(o.ScanScript, len(comp)); err != nil {
+			return err
+		}
+	}
+	e.init(image.Pt(meta.Width, meta.Height), comp)
+	if err := e.loadCoefficients(planes); err != nil {
+		return err
+	}
+	for i := range e.quant {
+		e.quant[i] = meta.QuantTables[min(i, len(meta.QuantTables)-1)]
+	}
+	// The tables do not come from a quality, so the next image encoded from
+	// pixels must compute its own.
+	e.quality = 0
+	e.roi = nil
+	e.written = 0
+	e.ri = 0
+	e.session = nil
+	if o.Session != nil {
+		e.session = o.Session
+		e.startSession(o)
+	}
+
+	// Write the Start Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = soiMarker
+	e.write(e.buf[:2])
+	if len(o.ICCProfile) > 0 {
+		e.writeICC(o.ICCProfile)
+	}
+	tables := !o.OmitTables
+	if tables {
+		e.writeDQT()
+	}
+	if o.Progressive {
+		e.writeSOF(sof2Marker)
+	} else {
+		e.writeSOF(sof0Marker)
+	}
+	if tables {
+		e.writeDHT()
+	}
+	if o.Progressive {
+		e.writeScanScript(o)
+	} else {
+		e.writeBaselineScans()
+	}
+	// Write the End Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = eoiMarker
+	e.write(e.buf[:2])
+	if e.session != nil {
+		e.endSession()
+	}
+	e.flush()
+	return e.err
+}
+
+// checkQuantTables reports whether tables holds one or two quantization
+// tables without zero values, which the encoder can write.
+func checkQuantTables(tables [][blockSize]uint8) error {
+	if len(tables) == 0 || len(tables) > int(nQuantIndex) {
+		return fmt.Errorf("jpeg: got %d quantization tables (must be 1 to %d)", len(tables), nQuantIndex)
+	}
+	for i, t := range tables {
+		for _, q := range t {
+			if q == 0 {
+				return fmt.Errorf("jpeg: quantization table %d has a zero value", i)
+			}
+		}
+	}
+	return nil
+}
+
+// loadCoefficients copies the blocks of planes to e.coeffs, checking that
+// they cover the image and that their coefficients can be entropy-coded.
+// The blocks that only pad the last MCUs repeat the last block of their
+// row or column.
+func (e *encoder) loadCoefficients(planes []CoefficientPlane) error {
+	e.allocCoefficients()
+	for c, p := range planes {
+		bw, bh := e.compBlocks(c)
+		if p.Width < bw || p.Height < bh || len(p.Blocks) != p.Width*p.Height {
+			return fmt.Errorf("jpeg: plane %d has %d blocks of %dx%d (must be at least %dx%d)", c, len(p.Blocks), p.Width, p.Height, bw, bh)
+		}
+		dst := &e.coeffs[c]
+		for by := 0; by < dst.bh; by++ {
+			for bx := 0; bx < dst.bw; bx++ {
+				b := &p.Blocks[min(by, bh-1)*p.Width+min(bx, bw-1)]
+				if bx < bw && by < bh {
+					if err := checkBlock(b); err != nil {
+						return fmt.Errorf("jpeg: plane %d, block (%d, %d): %v", c, bx, by, err)
+					}
+				}
+				*dst.at(bx, by) = *b
+			}
+		}
+	}
+	return nil
+}
+
+// checkBlock reports whether the coefficients of b are within the range of
+// 8-bit JPEG: 11 bits for the DC coefficient, and 10 bits for the AC ones.
+func checkBlock(b *[blockSize]int32) error {
+	if b[0] < -1024 || b[0] > 1023 {
+		return fmt.Errorf("DC coefficient %d out of range", b[0])
+	}
+	for i := 1; i < blockSize; i++ {
+		if b[i] < -1023 || b[i] > 1023 {
+			return fmt.Errorf("AC coefficient %d out of range", b[i])
+		}
+	}
+	return nil
+}
+
+// DecodeCoefficients reads a JPEG image from r and returns its quantized DCT
+// coefficients, as stored in the file, without dequantizing or transforming
+// them: re-encoding them with [EncodeCoefficients] is lossless. This suits
+// transcoders, and analyses that work in the DCT domain.
+//
+// The planes are in the order of the frame's components, and their Width
+// and Height are those of the MCUs that cover the image. The blocks of a
+// non-interleaved scan that are outside the image are zero. The Table of a
+// plane is the destination selector of its quantization table in the file,
+// and meta.QuantTables holds the tables up to the last one defined or used.
+// A file with more than two tables decodes, but EncodeCoefficients rejects
+// its coefficients, and a file with 16-bit tables of values above 255 does
+// not decode.
+func DecodeCoefficients(r io.Reader) ([]CoefficientPlane, *CoefficientMeta, error) {
+	d := decoder{coeffsOnly: true}
+	if _, err := d.decode(r, false); err != nil {
+		return nil, nil, err
+	}
+	return d.coefficients()
+}
+
+// coefficients returns the coefficients decoded by a decoder with
+// coeffsOnly set.
+func (d *decoder) coefficients() ([]CoefficientPlane, *CoefficientMeta, error) {
+	if d.nComp == 0 {
+		return nil, nil, FormatError("missing SOF marker")
+	}
+	// A table is defined if its values are not zero, which DQT forbids.
+	nTables := 0
+	for i, q := range d.quant {
+		if q[0] != 0 {
+			nTables = i + 1
+		}
+	}
+	h0, v0 := d.comp[0].h, d.comp[0].v
+	mxx := (d.width + 8*h0 - 1) / (8 * h0)
+	myy := (d.height + 8*v0 - 1) / (8 * v0)
+	planes := make([]CoefficientPlane, d.nComp)
+	for i, c := range d.comp[:d.nComp] {
+		if !d.hasCoefficients(i) {
+			return nil, nil, FormatError("missing SOS marker")
+		}
+		if d.quant[c.tq][0] == 0 {
+			return nil, nil, FormatError("missing quantization table")
+		}
+		p := &planes[i]
+		p.H, p.V, p.Table = c.h, c.v, int(c.tq)
+		p.Width, p.Height = mxx*c.h, myy*c.v
+		p.Blocks = make([][blockSize]int32, len(d.progCoeffs[i]))
+		for j, b := range d.progCoeffs[i] {
+			p.Blocks[j] = b
+		}
+	}
+	meta := &CoefficientMeta{Width: d.width, Height: d.height}
+	meta.QuantTables = make([][blockSize]uint8, nTables)
+	for i, q := range d.quant[:nTables] {
+		for j, v := range q {
+			if v > 255 {
+				return nil, nil, UnsupportedError("16-bit quantization table")
+			}
+			meta.QuantTables[i][j] = uint8(v)
+		}
+	}
+	return planes, meta, nil
+}
@@ -0,0 +1,183 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// coefficientPlanes returns the coefficients and the quantization tables
+// that Encode computes for m at the given quality.
+func coefficientPlanes(t *testing.T, m image.Image, quality int) ([]CoefficientPlane, *CoefficientMeta) {
+	t.Helper()
+	var e encoder
+	e.setQuality(quality)
+	comp, err := frameComponents(m, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.init(m.Bounds().Size(), comp)
+	e.computeCoefficients(m)
+	planes := make([]CoefficientPlane, len(comp))
+	for c, p := range e.coeffs[:len(comp)] {
+		planes[c] = CoefficientPlane{H: comp[c].h, V: comp[c].v, Table: int(comp[c].q), Width: p.bw, Height: p.bh}
+		for _, b := range p.blocks {
+			planes[c].Blocks = append(planes[c].Blocks, b)
+		}
+	}
+	meta := &CoefficientMeta{Width: m.Bounds().Dx(), Height: m.Bounds().Dy()}
+	for _, q := range e.quant {
+		meta.QuantTables = append(meta.QuantTables, q)
+	}
+	return planes, meta
+}
+
+func TestEncodeCoefficients(t *testing.T) {
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(64, 48, 1), &Options{Quality: 80}},
+		{testimg.Photo(64, 48, 1), &Options{Quality: 80, Progressive: true}},
+		{testimg.Photo(77, 41, 2), &Options{Quality: 90, Progressive: true}},
+		{testimg.ZonePlate(50, 30), &Options{Quality: 70, Progressive: true, ScanScript: DefaultGrayscaleScanScript()}},
+	} {
+		planes, meta := coefficientPlanes(t, tc.m, tc.o.Quality)
+		var want, got bytes.Buffer
+		if err := Encode(&want, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if err := EncodeCoefficients(&got, planes, meta, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%v %+v: the coefficients encode to %d bytes, want the %d bytes of Encode", tc.m.Bounds(), tc.o, got.Len(), want.Len())
+		}
+	}
+}
+
+func TestEncodeCoefficientsMultiplane(t *testing.T) {
+	// Five planes, decoded as a Multiplane image.
+	m := testimg.Photo(40, 24, 3)
+	planes, meta := coefficientPlanes(t, m, 75)
+	// Keep the 5x3 blocks of the luma that cover the image, at full
+	// resolution, in both planes.
+	luma := CoefficientPlane{H: 1, V: 1, Width: 5, Height: 3}
+	for by := 0; by < 3; by++ {
+		luma.Blocks = append(luma.Blocks, planes[0].Blocks[by*planes[0].Width:][:5]...)
+	}
+	planes = []CoefficientPlane{luma, luma, luma, luma, luma}
+	planes[1].Table = 1
+	for _, progressive := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := EncodeCoefficients(&buf, planes, meta, &Options{Progressive: progressive}); err != nil {
+			t.Fatal(err)
+		}
+		info, err := Probe(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Components != 5 {
+			t.Errorf("progressive %t: got %d components, want 5", progressive, info.Components)
+		}
+		d, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("progressive %t: %v", progressive, err)
+		}
+		if mp, ok := d.(*Multiplane); !ok || !equalImages(mp.Planes[0], mp.Planes[4]) {
+			t.Errorf("progressive %t: got %T, want a Multiplane image with identical planes", progressive, d)
+		}
+	}
+}
+
+func TestEncodeCoefficientsErrors(t *testing.T) {
+	m := testimg.Photo(32, 16, 1)
+	for _, tc := range []struct {
+		edit func(planes []CoefficientPlane, meta *CoefficientMeta)
+		want string
+	}{
+		{func(p []CoefficientPlane, m *CoefficientMeta) { m.Width = 0 }, "invalid image size"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { m.QuantTables[1][5] = 0 }, "zero value"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { m.QuantTables = nil }, "quantization tables"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { p[1].H = 5 }, "sampling factors"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { p[0].H, p[0].V = 3, 3 }, "at most 10"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { p[2].Table = 2 }, "quantization table 2"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) {
+			p[0].Height--
+			p[0].Blocks = p[0].Blocks[:p[0].Width*p[0].Height]
+		}, "blocks"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { p[0].Blocks[3][7] = 1024 }, "AC coefficient 1024 out of range"},
+		{func(p []CoefficientPlane, m *CoefficientMeta) { p[1].Blocks[0][0] = -1025 }, "DC coefficient"},
+	} {
+		planes, meta := coefficientPlanes(t, m, 75)
+		tc.edit(planes, meta)
+		err := EncodeCoefficients(&bytes.Buffer{}, planes, meta, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("got %v, want an error containing %q", err, tc.want)
+		}
+	}
+}
+
+func TestDecodeCoefficients(t *testing.T) {
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(64, 48, 1), &Options{Quality: 80}},
+		{testimg.Photo(77, 41, 2), &Options{Quality: 90, Progressive: true}},
+		{testimg.ZonePlate(50, 30), &Options{Quality: 70, Progressive: true, ScanScript: DefaultGrayscaleScanScript()}},
+	} {
+		var want bytes.Buffer
+		if err := Encode(&want, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		planes, meta, err := DecodeCoefficients(bytes.NewReader(want.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantPlanes, wantMeta := coefficientPlanes(t, tc.m, tc.o.Quality)
+		if len(planes) != len(wantPlanes) || meta.Width != wantMeta.Width || meta.Height != wantMeta.Height {
+			t.Fatalf("%v %+v: got %d planes and %+v, want %d planes", tc.m.Bounds(), tc.o, len(planes), meta, len(wantPlanes))
+		}
+		for i, q := range meta.QuantTables {
+			if q != wantMeta.QuantTables[i] {
+				t.Errorf("%v %+v: quantization table %d differs", tc.m.Bounds(), tc.o, i)
+			}
+		}
+		// The blocks that cover the image are those that Encode computed.
+		for c, p := range planes {
+			wp := wantPlanes[c]
+			if p.H != wp.H || p.V != wp.V || p.Table != wp.Table {
+				t.Errorf("%v %+v: plane %d is %dx%d with table %d, want %dx%d with table %d", tc.m.Bounds(), tc.o, c, p.H, p.V, p.Table, wp.H, wp.V, wp.Table)
+			}
+			bw, bh := (meta.Width*p.H/planes[0].H+7)/8, (meta.Height*p.V/planes[0].V+7)/8
+			for by := 0; by < bh; by++ {
+				for bx := 0; bx < bw; bx++ {
+					if p.Blocks[by*p.Width+bx] != wp.Blocks[by*wp.Width+bx] {
+						t.Fatalf("%v %+v: plane %d, block (%d, %d) differs", tc.m.Bounds(), tc.o, c, bx, by)
+					}
+				}
+			}
+		}
+		var got bytes.Buffer
+		if err := EncodeCoefficients(&got, planes, meta, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%v %+v: the decoded coefficients encode to %d bytes, want %d", tc.m.Bounds(), tc.o, got.Len(), want.Len())
+		}
+	}
+}
+
+func TestDecodeCoefficientsTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(64, 48, 1), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecodeCoefficients(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Error("got no error for a truncated file")
+	}
+}
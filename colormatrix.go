@@ -0,0 +1,88 @@
+package progjpeg
+
+import (
+	"fmt"
+	"math"
+)
+
+// A ColorMatrix converts RGB values to YCbCr values. Its rows compute Y, Cb
+// and Cr, in that order, from R, G and B; 128 is added to Cb and Cr, and
+// the results are clamped to [0, 255].
+type ColorMatrix [3][3]float64
+
+// NewColorMatrix returns the full range YCbCr matrix whose luma weights of
+// red and blue are kr and kb, such as those of ITU-R BT.601 or BT.709.
+func NewColorMatrix(kr, kb float64) ColorMatrix {
+	kg := 1 - kr - kb
+	return ColorMatrix{
+		{kr, kg, kb},
+		{-kr / (2 - 2*kb), -kg / (2 - 2*kb), 0.5},
+		{0.5, -kg / (2 - 2*kr), -kb / (2 - 2*kr)},
+	}
+}
+
+var (
+	// BT601 is the matrix of JFIF and of color.RGBToYCbCr, which the
+	// encoder uses if Options.ColorMatrix is nil. The encoder rounds
+	// slightly differently when it is set explicitly.
+	BT601 = NewColorMatrix(0.299, 0.114)
+	// BT709 is the matrix of HD video, for stills taken from it.
+	BT709 = NewColorMatrix(0.2126, 0.0722)
+)
+
+// colorTransform is a ColorMatrix in 16.16 fixed point.
+type colorTransform struct {
+	matrix ColorMatrix
+	k      [3][3]int32
+}
+
+// newColorTransform returns the fixed point version of m, checking that its
+// coefficients are finite and small enough.
+func newColorTransform(m *ColorMatrix) (*colorTransform, error) {
+	t := &colorTransform{matrix: *m}
+	for i, row := range m {
+		for j, c := range row {
+			if math.IsNaN(c) || c < -16 || c > 16 {
+				return nil, fmt.Errorf("jpeg: invalid ColorMatrix coefficient %v (must be -16 to 16)", c)
+			}
+			t.k[i][j] = int32(math.Round(c * (1 << 16)))
+		}
+	}
+	return t, nil
+}
+
+// convert returns the YCbCr values of an RGB color.
+func (t *colorTransform) convert(r, g, b uint8) (y, cb, cr uint8) {
+	ri, gi, bi := int32(r), int32(g), int32(b)
+	y = clampComponent(t.k[0][0]*ri + t.k[0][1]*gi + t.k[0][2]*bi + 1<<15)
+	cb = clampComponent(t.k[1][0]*ri + t.k[1][1]*gi + t.k[1][2]*bi + 128<<16 + 1<<15)
+	cr = clampComponent(t.k[2][0]*ri + t.k[2][1]*gi + t.k[2][2]*bi + 128<<16 + 1<<15)
+	return y, cb, cr
+}
+
+// clampComponent returns the 16.16 fixed point value v as an 8-bit value.
+func clampComponent(v int32) uint8 {
+	return uint8(min(max(v>>16, 0), 255))
+}
+
+// setColorMatrix sets e.cm up for the ColorMatrix of o.
+func (e *encoder) setColorMatrix(o *Options) error {
+	e.cm = nil
+	if o == nil || o.ColorMatrix == nil {
+		return nil
+	}
+	cm, err := newColorTransform(o.ColorMatrix)
+	if err != nil {
+		return err
+	}
+	e.cm = cm
+	return nil
+}
+
+// colorMatrix returns the ColorMatrix of e.cm, or nil.
+func (e *encoder) colorMatrix() *ColorMatrix {
+	if e.cm == nil {
+		return nil
+	}
+	return &e.cm.matrix
+}
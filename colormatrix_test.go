@@ -0,0 +1,119 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestColorMatrixBT601(t *testing.T) {
+	// The explicit BT.601 matrix matches color.RGBToYCbCr, up to rounding.
+	ct, err := newColorTransform(&BT601)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < 256; r += 5 {
+		for g := 0; g < 256; g += 7 {
+			for b := 0; b < 256; b += 3 {
+				y0, cb0, cr0 := color.RGBToYCbCr(uint8(r), uint8(g), uint8(b))
+				y1, cb1, cr1 := ct.convert(uint8(r), uint8(g), uint8(b))
+				if absDiff(y0, y1) > 1 || absDiff(cb0, cb1) > 1 || absDiff(cr0, cr1) > 1 {
+					t.Fatalf("RGB %d,%d,%d: got %d,%d,%d, want %d,%d,%d", r, g, b, y1, cb1, cr1, y0, cb0, cr0)
+				}
+			}
+		}
+	}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestColorMatrixBT709(t *testing.T) {
+	c := color.RGBA{200, 40, 90, 255}
+	m := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	for _, o := range []*Options{
+		{Quality: 100, ColorMatrix: &BT709},
+		{Quality: 100, ColorMatrix: &BT709, Progressive: true},
+		{Quality: 100, ColorMatrix: &BT709, Smoothing: 10},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		d, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := d.(*image.YCbCr).YCbCrAt(16, 16)
+		k := &BT709
+		want := [3]float64{}
+		for i := range want {
+			want[i] = k[i][0]*float64(c.R) + k[i][1]*float64(c.G) + k[i][2]*float64(c.B)
+		}
+		want[1] += 128
+		want[2] += 128
+		for i, v := range [3]uint8{got.Y, got.Cb, got.Cr} {
+			if math.Abs(float64(v)-want[i]) > 2 {
+				t.Errorf("%+v: got YCbCr %v, want %.1f", o, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestColorMatrixIgnored(t *testing.T) {
+	// Gray and YCbCr images are encoded as they are.
+	gray := testimg.ZonePlate(40, 40)
+	ycc := image.NewYCbCr(image.Rect(0, 0, 40, 40), image.YCbCrSubsampleRatio420)
+	copy(ycc.Y, gray.Pix)
+	for _, m := range []image.Image{gray, ycc} {
+		var want, got bytes.Buffer
+		if err := Encode(&want, m, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(&got, m, &Options{Quality: DefaultQuality, ColorMatrix: &BT709}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%T: the color matrix changes the output", m)
+		}
+	}
+}
+
+func TestColorMatrixSession(t *testing.T) {
+	m := testimg.Photo(48, 32, 1)
+	var buf bytes.Buffer
+	var s Session
+	if err := Encode(&buf, m, &Options{Quality: 80, ColorMatrix: &BT709, Session: &s}); err != nil {
+		t.Fatal(err)
+	}
+	if s.ColorMatrix == nil || *s.ColorMatrix != BT709 {
+		t.Fatalf("got session matrix %v", s.ColorMatrix)
+	}
+	var replay bytes.Buffer
+	if _, err := Replay(&replay, m, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replay.Bytes(), buf.Bytes()) {
+		t.Error("the replay differs from the recorded encode")
+	}
+}
+
+func TestColorMatrixInvalid(t *testing.T) {
+	bad := BT709
+	bad[1][2] = math.NaN()
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(16, 16, 1), &Options{ColorMatrix: &bad}); err == nil {
+		t.Error("NaN coefficient: got nil error")
+	}
+}
@@ -0,0 +1,95 @@
+package progjpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+)
+
+// An EncodingReport describes one of the files compared by
+// [CompareEncodings].
+type EncodingReport struct {
+	// Size is the size of the file, and Scans its number of scans.
+	Size  int64
+	Scans int
+	// Curve is the quality of the image after each scan, as [ScanQuality]
+	// returns it; its last point is that of the whole image.
+	Curve []QualityPoint
+	// FirstPaint is the number of bytes needed for the first paint, as in
+	// [PaintMetrics].
+	FirstPaint int64
+}
+
+// A Comparison is the result of [CompareEncodings].
+type Comparison struct {
+	A, B EncodingReport
+	// Threshold is the SSIM that both files reach, the lower of their
+	// final ones, and BytesA and BytesB the number of bytes that each file
+	// needs to reach it.
+	Threshold      float64
+	BytesA, BytesB int64
+	// Winner is "a" or "b", the file that reaches Threshold with fewer
+	// bytes, or "" if they need the same number.
+	Winner string
+}
+
+// String returns a one-line summary of c.
+func (c *Comparison) String() string {
+	a, b := c.A.Curve[len(c.A.Curve)-1], c.B.Curve[len(c.B.Curve)-1]
+	s := fmt.Sprintf("a: %d bytes, %d scans, SSIM %.4f; b: %d bytes, %d scans, SSIM %.4f; SSIM %.4f after %d and %d bytes",
+		c.A.Size, c.A.Scans, a.SSIM, c.B.Size, c.B.Scans, b.SSIM, c.Threshold, c.BytesA, c.BytesB)
+	if c.Winner == "" {
+		return s + ": tie"
+	}
+	return s + ": " + c.Winner + " wins"
+}
+
+// CompareEncodings compares two JPEG files encoded from the image
+// original, such as those of two sets of options of an A/B test. It
+// reports their sizes, scans and quality curves, and picks as the winner
+// the file that reaches, with fewer bytes, the quality that both reach:
+// the smaller of two files of the same quality, the better of two files
+// of the same size, and the one whose scans refine the image faster
+// otherwise.
+func CompareEncodings(a, b io.Reader, original image.Image) (*Comparison, error) {
+	var c Comparison
+	for _, e := range []struct {
+		r   io.Reader
+		rep *EncodingReport
+	}{{a, &c.A}, {b, &c.B}} {
+		data, err := io.ReadAll(e.r)
+		if err != nil {
+			return nil, err
+		}
+		pm, err := MeasurePaint(nil, bytes.NewReader(data), 0)
+		if err != nil {
+			return nil, err
+		}
+		curve, err := ScanQuality(original, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		*e.rep = EncodingReport{Size: int64(len(data)), Scans: len(curve), Curve: curve, FirstPaint: pm.FirstPaint}
+	}
+	c.Threshold = min(c.A.Curve[len(c.A.Curve)-1].SSIM, c.B.Curve[len(c.B.Curve)-1].SSIM)
+	c.BytesA, c.BytesB = bytesToSSIM(c.A.Curve, c.Threshold), bytesToSSIM(c.B.Curve, c.Threshold)
+	switch {
+	case c.BytesA < c.BytesB:
+		c.Winner = "a"
+	case c.BytesB < c.BytesA:
+		c.Winner = "b"
+	}
+	return &c, nil
+}
+
+// bytesToSSIM returns the bytes of the first point of curve whose SSIM is
+// at least ssim. The last point reaches it.
+func bytesToSSIM(curve []QualityPoint, ssim float64) int64 {
+	for _, p := range curve {
+		if p.SSIM >= ssim {
+			return p.Bytes
+		}
+	}
+	return curve[len(curve)-1].Bytes
+}
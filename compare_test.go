@@ -0,0 +1,57 @@
+package progjpeg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestCompareEncodings(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	encode := func(o *Options) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, o); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	q90 := encode(&Options{Quality: 90, Progressive: true})
+	q50 := encode(&Options{Quality: 50, Progressive: true})
+	baseline := encode(&Options{Quality: 90})
+
+	c, err := CompareEncodings(bytes.NewReader(q90), bytes.NewReader(q50), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.A.Size != int64(len(q90)) || c.B.Size != int64(len(q50)) || c.A.Scans != len(DefaultColorScanScript()) || len(c.A.Curve) != c.A.Scans {
+		t.Errorf("got reports %+v and %+v", c.A, c.B)
+	}
+	// Quality 90 reaches the final quality of quality 50 before its end,
+	// but not with fewer bytes.
+	if c.Threshold != c.B.Curve[len(c.B.Curve)-1].SSIM || c.BytesB > c.B.Size-2 || c.BytesA >= c.A.Size-2 || c.Winner != "b" {
+		t.Errorf("got threshold %v after %d and %d bytes, winner %q", c.Threshold, c.BytesA, c.BytesB, c.Winner)
+	}
+
+	// The same pixels in a smaller file win.
+	c, err = CompareEncodings(bytes.NewReader(baseline), bytes.NewReader(q90), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a"
+	if len(q90) < len(baseline) {
+		want = "b"
+	}
+	if c.Winner != want || c.A.Scans != 1 || c.A.FirstPaint != c.BytesA {
+		t.Errorf("got %v, want %s to win", c, want)
+	}
+	if !strings.HasSuffix(c.String(), want+" wins") {
+		t.Errorf("got the summary %q", c.String())
+	}
+
+	c, err = CompareEncodings(bytes.NewReader(q90), bytes.NewReader(q90), src)
+	if err != nil || c.Winner != "" || !strings.HasSuffix(c.String(), "tie") {
+		t.Errorf("the same file twice gives %v (%v)", c, err)
+	}
+}
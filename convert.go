@@ -0,0 +1,68 @@
+package progjpeg
+
+import (
+	"image"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// A ColorConverter converts the 8x8 region of m whose top-left corner is p
+// to Y, Cb and Cr values in [0, 255], stored in y, cb and cr left to right
+// and top to bottom. The region may extend past the bounds of m, in which
+// case the converter must repeat the last column and row of m, as the
+// built-in conversions do.
+type ColorConverter func(m image.Image, p image.Point, y, cb, cr *[64]int32)
+
+var (
+	convertersMu sync.Mutex
+	// converters maps image types to their ColorConverter. It is replaced,
+	// never modified, so that the encoder can read it without locking.
+	converters atomic.Pointer[map[reflect.Type]ColorConverter]
+)
+
+// RegisterColorConverter registers f as the converter of the images of the
+// same type as m, which the encoder then calls instead of reading their
+// pixels one at a time with At. This lets applications encode their own
+// image types, such as Bayer mosaics or planar float images, without
+// converting them to an *image.RGBA first.
+//
+// The built-in types, such as *image.RGBA and *image.YCbCr, have their own
+// conversions, and registering them has no effect. f replaces
+// Options.ColorMatrix for the images it converts, while Options.RGB and
+// thumbnails still read their pixels with At. A nil f removes the converter
+// of the type.
+func RegisterColorConverter(m image.Image, f ColorConverter) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	next := make(map[reflect.Type]ColorConverter)
+	if cur := converters.Load(); cur != nil {
+		for t, c := range *cur {
+			next[t] = c
+		}
+	}
+	if f == nil {
+		delete(next, reflect.TypeOf(m))
+	} else {
+		next[reflect.TypeOf(m)] = f
+	}
+	converters.Store(&next)
+}
+
+// colorConverter returns the converter registered for the type of m, or nil.
+func colorConverter(m image.Image) ColorConverter {
+	cur := converters.Load()
+	if cur == nil {
+		return nil
+	}
+	return (*cur)[reflect.TypeOf(m)]
+}
+
+// convertBlocks converts the 8x8 region of m whose top-left corner is p with
+// f. The converter writes to blocks of its own, so that the callers' blocks,
+// which f might retain, stay on their stacks.
+func convertBlocks(f ColorConverter, m image.Image, p image.Point, yBlock, cbBlock, crBlock *block) {
+	t := new([3][64]int32)
+	f(m, p, &t[0], &t[1], &t[2])
+	*yBlock, *cbBlock, *crBlock = t[0], t[1], t[2]
+}
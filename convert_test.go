@@ -0,0 +1,133 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// floatImage is a planar image with float32 R, G and B values in [0, 1].
+type floatImage struct {
+	r, g, b []float32
+	rect    image.Rectangle
+}
+
+func newFloatImage(m image.Image) *floatImage {
+	b := m.Bounds()
+	f := &floatImage{rect: b}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bb, _ := m.At(x, y).RGBA()
+			f.r = append(f.r, float32(r>>8)/255)
+			f.g = append(f.g, float32(g>>8)/255)
+			f.b = append(f.b, float32(bb>>8)/255)
+		}
+	}
+	return f
+}
+
+func (f *floatImage) ColorModel() color.Model { return color.RGBAModel }
+func (f *floatImage) Bounds() image.Rectangle { return f.rect }
+
+func (f *floatImage) At(x, y int) color.Color {
+	i := f.offset(x, y)
+	return color.RGBA{f.value(f.r[i]), f.value(f.g[i]), f.value(f.b[i]), 0xff}
+}
+
+func (f *floatImage) offset(x, y int) int {
+	return (y-f.rect.Min.Y)*f.rect.Dx() + x - f.rect.Min.X
+}
+
+func (f *floatImage) value(v float32) uint8 {
+	return uint8(v*255 + 0.5)
+}
+
+// convertFloat is the ColorConverter of floatImage.
+func convertFloat(m image.Image, p image.Point, y, cb, cr *[64]int32) {
+	f := m.(*floatImage)
+	for j := 0; j < 8; j++ {
+		for i := 0; i < 8; i++ {
+			o := f.offset(min(p.X+i, f.rect.Max.X-1), min(p.Y+j, f.rect.Max.Y-1))
+			yy, cbb, crr := color.RGBToYCbCr(f.value(f.r[o]), f.value(f.g[o]), f.value(f.b[o]))
+			y[8*j+i], cb[8*j+i], cr[8*j+i] = int32(yy), int32(cbb), int32(crr)
+		}
+	}
+}
+
+func TestRegisterColorConverter(t *testing.T) {
+	src := testimg.Photo(75, 61, 1)
+	rgba := image.NewRGBA(src.Bounds())
+	for y := 0; y < 61; y++ {
+		for x := 0; x < 75; x++ {
+			rgba.Set(x, y, src.At(x, y))
+		}
+	}
+	f := newFloatImage(rgba)
+	calls := 0
+	RegisterColorConverter(f, func(m image.Image, p image.Point, y, cb, cr *[64]int32) {
+		calls++
+		convertFloat(m, p, y, cb, cr)
+	})
+	t.Cleanup(func() { RegisterColorConverter(f, nil) })
+
+	for _, o := range []*Options{
+		{Quality: 80},
+		{Quality: 80, Progressive: true},
+		{Quality: 80, Grayscale: true},
+	} {
+		calls = 0
+		var want, got bytes.Buffer
+		if err := Encode(&want, rgba, o); err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(&got, f, o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%+v: got %d bytes, want the %d bytes of the *image.RGBA", o, got.Len(), want.Len())
+		}
+		if calls == 0 {
+			t.Errorf("%+v: the converter was not called", o)
+		}
+	}
+}
+
+func TestRegisterColorConverterReplace(t *testing.T) {
+	f := newFloatImage(testimg.Photo(32, 32, 1))
+	var plain bytes.Buffer
+	if err := Encode(&plain, f, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A converter that ignores the pixels shows in the output.
+	RegisterColorConverter(f, func(m image.Image, p image.Point, y, cb, cr *[64]int32) {
+		for i := range y {
+			y[i], cb[i], cr[i] = 200, 128, 128
+		}
+	})
+	t.Cleanup(func() { RegisterColorConverter(f, nil) })
+	var buf bytes.Buffer
+	if err := Encode(&buf, f, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yy := d.(*image.YCbCr).YCbCrAt(10, 10).Y; yy < 198 || yy > 202 {
+		t.Errorf("got Y %d, want 200", yy)
+	}
+
+	// Removing the converter restores the default conversion.
+	RegisterColorConverter(f, nil)
+	buf.Reset()
+	if err := Encode(&buf, f, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), plain.Bytes()) {
+		t.Error("the output differs after removing the converter")
+	}
+}
@@ -0,0 +1,56 @@
+package progjpeg
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// Crop reads the JPEG image in r and writes the part of it inside rect to
+// w, as jpegtran -crop does, without decoding or re-encoding any pixel: the
+// blocks inside rect are copied as they are, so the result is exactly the
+// same as the original, and only the dimensions in the SOF marker change.
+// The top-left corner of rect must be on an MCU boundary, a multiple of 8
+// pixels for grayscale images and of 8 times the luma sampling factors
+// otherwise, such as 16 pixels for 4:2:0 images; its bottom-right corner
+// can be anywhere, and is clipped to the image. The result is baseline or
+// progressive like the original, and keeps its APPn and COM segments.
+func Crop(w io.Writer, r io.Reader, rect image.Rectangle) error {
+	return transcode(w, r, nil, func(t *transcoding) error {
+		return t.crop(rect)
+	})
+}
+
+// crop keeps the blocks of t inside rect, and sets the size of the image
+// to that of rect.
+func (t *transcoding) crop(rect image.Rectangle) error {
+	planes, meta := t.planes, t.meta
+	r := rect.Intersect(image.Rect(0, 0, meta.Width, meta.Height))
+	if r.Empty() || r.Min != rect.Min {
+		return fmt.Errorf("jpeg: crop rectangle %v is outside the %dx%d image", rect, meta.Width, meta.Height)
+	}
+	mw, mh := t.mcuSize()
+	if r.Min.X%mw != 0 || r.Min.Y%mh != 0 {
+		return fmt.Errorf("jpeg: crop rectangle %v is not aligned to the %dx%d MCUs", rect, mw, mh)
+	}
+	cropped := make([]CoefficientPlane, len(planes))
+	for i, p := range planes {
+		// Blocks past the bottom-right corner are kept, and ignored by
+		// the encoder.
+		bx0 := r.Min.X / mw * p.H
+		by0 := r.Min.Y / mh * p.V
+		if len(planes) == 1 {
+			bx0, by0 = r.Min.X/8, r.Min.Y/8
+		}
+		c := p
+		c.Width, c.Height = p.Width-bx0, p.Height-by0
+		c.Blocks = make([][blockSize]int32, 0, c.Width*c.Height)
+		for by := by0; by < p.Height; by++ {
+			c.Blocks = append(c.Blocks, p.Blocks[by*p.Width+bx0:(by+1)*p.Width]...)
+		}
+		cropped[i] = c
+	}
+	meta.Width, meta.Height = r.Dx(), r.Dy()
+	t.planes = cropped
+	return nil
+}
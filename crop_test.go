@@ -0,0 +1,84 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestCrop(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, tc := range []struct {
+		o    *Options
+		rect image.Rectangle
+	}{
+		{&Options{Quality: 75}, image.Rect(16, 16, 83, 47)},
+		{&Options{Quality: 75}, image.Rect(32, 0, 50, 29)},
+		{&Options{Quality: 75, Progressive: true}, image.Rect(0, 16, 40, 100)},
+		{&Options{Quality: 75, Grayscale: true}, image.Rect(8, 24, 21, 30)},
+		{&Options{Quality: 75, RGB: true, Progressive: true}, image.Rect(72, 40, 83, 47)},
+	} {
+		var data bytes.Buffer
+		if err := Encode(&data, src, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := Crop(&buf, bytes.NewReader(data.Bytes()), tc.rect); err != nil {
+			t.Fatalf("%v: %v", tc.rect, err)
+		}
+		got, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := tc.rect.Intersect(want.Bounds())
+		if got.Bounds() != image.Rect(0, 0, r.Dx(), r.Dy()) {
+			t.Fatalf("%v: got bounds %v, want %v", tc.rect, got.Bounds(), r.Sub(r.Min))
+		}
+		sub := want.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(r)
+		if !equalImages(got, translate{sub, r.Min}) {
+			t.Errorf("%v: the pixels differ from those of the original", tc.rect)
+		}
+		p, err := Probe(bytes.NewReader(buf.Bytes()))
+		if err != nil || p.Progressive != tc.o.Progressive {
+			t.Errorf("%v: progressive is %v, want %v (%v)", tc.rect, p.Progressive, tc.o.Progressive, err)
+		}
+	}
+
+	var data bytes.Buffer
+	if err := Encode(&data, src, &Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(8, 0, 40, 40),
+		image.Rect(0, 8, 40, 40),
+		image.Rect(96, 0, 120, 40),
+		image.Rect(-16, 0, 40, 40),
+	} {
+		if err := Crop(new(bytes.Buffer), bytes.NewReader(data.Bytes()), rect); err == nil {
+			t.Errorf("%v: cropping a 4:2:0 image did not fail", rect)
+		}
+	}
+}
+
+// translate is an image moved by -off, so that it starts at the origin.
+type translate struct {
+	image.Image
+	off image.Point
+}
+
+func (m translate) Bounds() image.Rectangle {
+	return m.Image.Bounds().Sub(m.off)
+}
+
+func (m translate) At(x, y int) color.Color {
+	return m.Image.At(x+m.off.X, y+m.off.Y)
+}
@@ -0,0 +1,81 @@
+package progjpeg
+
+import (
+	"image"
+	"io"
+)
+
+// DecodeDC reads a JPEG image from r and returns it at 1/8 of its size, with
+// one pixel per 8x8 block: the width and height of the image are rounded up
+// to multiples of 8, then divided by 8. Each pixel is the average of its
+// block, given by the block's DC coefficient, so that no inverse DCT is
+// needed, and the AC scans of progressive images are skipped without being
+// decoded. It is meant for thumbnailing many files quickly.
+//
+// The image has the type that [Decode] would return, with the same
+// subsampling ratio.
+func DecodeDC(r io.Reader) (image.Image, error) {
+	d := decoder{coeffsOnly: true, dcOnly: true}
+	if _, err := d.decode(r, false); err != nil {
+		return nil, err
+	}
+	return d.dcImage()
+}
+
+// dcImage returns the image made of the DC coefficients decoded by a
+// decoder with coeffsOnly set.
+func (d *decoder) dcImage() (image.Image, error) {
+	if d.nComp == 0 {
+		return nil, FormatError("missing SOF marker")
+	}
+	if !d.hasCoefficients(0) {
+		return nil, FormatError("missing SOS marker")
+	}
+	var strides [maxFrameComponents]int
+	for i := range d.comp[:d.nComp] {
+		strides[i] = d.blocksPerRow(i)
+	}
+	// The image is that of a frame 8 times smaller, whose pixels are the
+	// blocks of this one.
+	d.width, d.height = (d.width+7)/8, (d.height+7)/8
+	h0, v0 := d.comp[0].h, d.comp[0].v
+	d.makeImg((d.width+8*h0-1)/(8*h0), (d.height+8*v0-1)/(8*v0))
+	for i, c := range d.comp[:d.nComp] {
+		pix, stride := d.plane(i)
+		w := (d.width*c.h + h0 - 1) / h0
+		h := (d.height*c.v + v0 - 1) / v0
+		q := d.quant[c.tq][0]
+		for y := 0; y < h; y++ {
+			row := pix[y*stride : y*stride+w]
+			for x := range row {
+				// The IDCT of a block whose only coefficient is its DC
+				// coefficient is DC/8, level shifted by 128.
+				v := int32(0)
+				if d.hasCoefficients(i) {
+					v = (d.progCoeffs[i][y*strides[i]+x][0]*q + 4) >> 3
+				}
+				row[x] = uint8(min(max(v+128, 0), 255))
+			}
+		}
+	}
+	return d.image()
+}
+
+// plane returns the pixels and stride of the plane of the component
+// compIndex in the image allocated by makeImg.
+func (d *decoder) plane(compIndex int) ([]byte, int) {
+	switch {
+	case d.img1 != nil:
+		return d.img1.Pix, d.img1.Stride
+	case d.nComp > maxComponents:
+		p := d.imgN.Planes[compIndex]
+		return p.Pix, p.Stride
+	case compIndex == 0:
+		return d.img3.Y, d.img3.YStride
+	case compIndex == 1:
+		return d.img3.Cb, d.img3.CStride
+	case compIndex == 2:
+		return d.img3.Cr, d.img3.CStride
+	}
+	return d.blackPix, d.blackStride
+}
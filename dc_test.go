@@ -0,0 +1,95 @@
+package progjpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeDC(t *testing.T) {
+	src := testimg.Photo(203, 117, 1)
+	var dcs []image.Image
+	for _, o := range []*Options{{Quality: 75}, {Quality: 75, Progressive: true}, {Quality: 75, Concurrency: 3}} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, o); err != nil {
+			t.Fatal(err)
+		}
+		full, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := DecodeDC(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc, ok := m.(*image.YCbCr)
+		if !ok || dc.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+			t.Fatalf("%+v: got %T, want a 4:2:0 *image.YCbCr", o, m)
+		}
+		if want := image.Rect(0, 0, 26, 15); dc.Bounds() != want {
+			t.Fatalf("%+v: got bounds %v, want %v", o, dc.Bounds(), want)
+		}
+		// The luma of each pixel is the average of its block, within the
+		// rounding errors of the IDCT.
+		y := full.(*image.YCbCr)
+		for by := 0; by < 14; by++ {
+			for bx := 0; bx < 25; bx++ {
+				sum := 0
+				for j := 0; j < 8; j++ {
+					for i := 0; i < 8; i++ {
+						sum += int(y.Y[y.YOffset(8*bx+i, 8*by+j)])
+					}
+				}
+				if got, want := int(dc.Y[dc.YOffset(bx, by)]), (sum+32)/64; got < want-2 || got > want+2 {
+					t.Fatalf("%+v: block (%d, %d): got %d, want %d", o, bx, by, got, want)
+				}
+			}
+		}
+		dcs = append(dcs, m)
+	}
+	// The files have the same coefficients.
+	for i := 1; i < len(dcs); i++ {
+		if !equalImages(dcs[i], dcs[0]) {
+			t.Errorf("the DC image of file %d differs from that of the baseline file", i)
+		}
+	}
+}
+
+func TestDecodeDCTypes(t *testing.T) {
+	for _, tc := range []struct {
+		m    image.Image
+		o    *Options
+		want image.Image
+	}{
+		{testimg.Photo(64, 40, 2), &Options{Grayscale: true, Progressive: true}, &image.Gray{}},
+		{testimg.Photo(64, 40, 2), &Options{RGB: true}, &image.RGBA{}},
+		{cmykPhoto(64, 40), &Options{Progressive: true}, &image.CMYK{}},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		m, err := DecodeDC(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprintf("%T", m), fmt.Sprintf("%T", tc.want); got != want || m.Bounds() != image.Rect(0, 0, 8, 5) {
+			t.Errorf("%+v: got %s of bounds %v, want %s of bounds (0,0)-(8,5)", tc.o, got, m.Bounds(), want)
+		}
+	}
+}
+
+func BenchmarkDecodeDC(b *testing.B) {
+	data, err := os.ReadFile("testdata/video-001.progressive.jpeg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		DecodeDC(bytes.NewReader(data))
+	}
+}
@@ -349,9 +349,10 @@ func fdctRows(b *block) {
 // In fdctRows, the same analysis applies, but the initial values are
 // in [-2040, 2040] instead of [-255, 255], so the bound is 2040*3.6246 < 7395.
 
-// idct implements the inverse DCT.
+// idctGeneric implements the inverse DCT in Go. idct uses it on CPUs
+// without a vectorized version.
 // Inputs are UQ8.0; outputs are Q10.3.
-func idct(b *block) {
+func idctGeneric(b *block) {
 	// A 2D IDCT is a 1D IDCT on rows followed by columns.
 	idctRows(b)
 	idctCols(b)
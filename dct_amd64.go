@@ -0,0 +1,48 @@
+//go:build !purego
+
+package progjpeg
+
+// useAVX2 reports whether the CPU and the operating system support AVX2,
+// in which case idct uses idctAVX2.
+var useAVX2 = hasAVX2()
+
+// idct implements the inverse DCT, with AVX2 instructions if possible. The
+// results are those of idctGeneric.
+func idct(b *block) {
+	if useAVX2 {
+		idctAVX2(b)
+		return
+	}
+	idctGeneric(b)
+}
+
+// idctAVX2 is idctGeneric computed with AVX2 instructions, in dct_amd64.s.
+//
+//go:noescape
+func idctAVX2(b *block)
+
+// cpuid executes the CPUID instruction with the given EAX and ECX.
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// xgetbv returns the XCR0 register.
+func xgetbv() (eax, edx uint32)
+
+func hasAVX2() bool {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false
+	}
+	// AVX needs the OSXSAVE and AVX flags of leaf 1, and the operating
+	// system must save the XMM and YMM registers (bits 1 and 2 of XCR0).
+	_, _, ecx1, _ := cpuid(1, 0)
+	const osxsave, avx = 1 << 27, 1 << 28
+	if ecx1&osxsave == 0 || ecx1&avx == 0 {
+		return false
+	}
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	const avx2 = 1 << 5
+	return ebx7&avx2 != 0
+}
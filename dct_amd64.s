@@ -0,0 +1,335 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// The IDCT below is idctRows followed by idctCols, as in dct.go, computed
+// on the eight rows or columns of a block at once: each YMM register holds
+// one of the variables x0..x7 of the eight 1D IDCTs. The rows pass works on
+// the columns of the block, so the block is transposed before it and after
+// it. The operations are those of the Go code, in the same order and on the
+// same 32-bit values, so the results are identical.
+
+// c(sqrt2inv_cos6, 18)
+DATA idct_rowCos6<>+0(SB)/4, $70936
+DATA idct_rowCos6<>+4(SB)/4, $70936
+DATA idct_rowCos6<>+8(SB)/4, $70936
+DATA idct_rowCos6<>+12(SB)/4, $70936
+DATA idct_rowCos6<>+16(SB)/4, $70936
+DATA idct_rowCos6<>+20(SB)/4, $70936
+DATA idct_rowCos6<>+24(SB)/4, $70936
+DATA idct_rowCos6<>+28(SB)/4, $70936
+GLOBL idct_rowCos6<>(SB), RODATA|NOPTR, $32
+
+// -c(sqrt2inv_sin6, 18) - c(sqrt2inv_cos6, 18)
+DATA idct_rowSin6MinusCos6<>+0(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+4(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+8(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+12(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+16(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+20(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+24(SB)/4, $-242190
+DATA idct_rowSin6MinusCos6<>+28(SB)/4, $-242190
+GLOBL idct_rowSin6MinusCos6<>(SB), RODATA|NOPTR, $32
+
+// c(sqrt2inv_cos6, 18) - c(sqrt2inv_sin6, 18)
+DATA idct_rowCos6PlusSin6<>+0(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+4(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+8(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+12(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+16(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+20(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+24(SB)/4, $-100318
+DATA idct_rowCos6PlusSin6<>+28(SB)/4, $-100318
+GLOBL idct_rowCos6PlusSin6<>(SB), RODATA|NOPTR, $32
+
+// c(sqrt2inv, 8)
+DATA idct_rowSqrt2inv<>+0(SB)/4, $181
+DATA idct_rowSqrt2inv<>+4(SB)/4, $181
+DATA idct_rowSqrt2inv<>+8(SB)/4, $181
+DATA idct_rowSqrt2inv<>+12(SB)/4, $181
+DATA idct_rowSqrt2inv<>+16(SB)/4, $181
+DATA idct_rowSqrt2inv<>+20(SB)/4, $181
+DATA idct_rowSqrt2inv<>+24(SB)/4, $181
+DATA idct_rowSqrt2inv<>+28(SB)/4, $181
+GLOBL idct_rowSqrt2inv<>(SB), RODATA|NOPTR, $32
+
+// c(cos3, 12)
+DATA idct_cos3<>+0(SB)/4, $3406
+DATA idct_cos3<>+4(SB)/4, $3406
+DATA idct_cos3<>+8(SB)/4, $3406
+DATA idct_cos3<>+12(SB)/4, $3406
+DATA idct_cos3<>+16(SB)/4, $3406
+DATA idct_cos3<>+20(SB)/4, $3406
+DATA idct_cos3<>+24(SB)/4, $3406
+DATA idct_cos3<>+28(SB)/4, $3406
+GLOBL idct_cos3<>(SB), RODATA|NOPTR, $32
+
+// -c(sin3, 12) - c(cos3, 12)
+DATA idct_sin3MinusCos3<>+0(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+4(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+8(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+12(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+16(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+20(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+24(SB)/4, $-5682
+DATA idct_sin3MinusCos3<>+28(SB)/4, $-5682
+GLOBL idct_sin3MinusCos3<>(SB), RODATA|NOPTR, $32
+
+// c(cos3, 12) - c(sin3, 12)
+DATA idct_cos3PlusSin3<>+0(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+4(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+8(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+12(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+16(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+20(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+24(SB)/4, $1130
+DATA idct_cos3PlusSin3<>+28(SB)/4, $1130
+GLOBL idct_cos3PlusSin3<>(SB), RODATA|NOPTR, $32
+
+// c(cos1, 12)
+DATA idct_cos1<>+0(SB)/4, $4017
+DATA idct_cos1<>+4(SB)/4, $4017
+DATA idct_cos1<>+8(SB)/4, $4017
+DATA idct_cos1<>+12(SB)/4, $4017
+DATA idct_cos1<>+16(SB)/4, $4017
+DATA idct_cos1<>+20(SB)/4, $4017
+DATA idct_cos1<>+24(SB)/4, $4017
+DATA idct_cos1<>+28(SB)/4, $4017
+GLOBL idct_cos1<>(SB), RODATA|NOPTR, $32
+
+// -c(sin1, 12) - c(cos1, 12)
+DATA idct_sin1MinusCos1<>+0(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+4(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+8(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+12(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+16(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+20(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+24(SB)/4, $-4816
+DATA idct_sin1MinusCos1<>+28(SB)/4, $-4816
+GLOBL idct_sin1MinusCos1<>(SB), RODATA|NOPTR, $32
+
+// c(cos1, 12) - c(sin1, 12)
+DATA idct_cos1PlusSin1<>+0(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+4(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+8(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+12(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+16(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+20(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+24(SB)/4, $3218
+DATA idct_cos1PlusSin1<>+28(SB)/4, $3218
+GLOBL idct_cos1PlusSin1<>(SB), RODATA|NOPTR, $32
+
+// c(sqrt2inv_cos6, 12)
+DATA idct_colCos6<>+0(SB)/4, $1108
+DATA idct_colCos6<>+4(SB)/4, $1108
+DATA idct_colCos6<>+8(SB)/4, $1108
+DATA idct_colCos6<>+12(SB)/4, $1108
+DATA idct_colCos6<>+16(SB)/4, $1108
+DATA idct_colCos6<>+20(SB)/4, $1108
+DATA idct_colCos6<>+24(SB)/4, $1108
+DATA idct_colCos6<>+28(SB)/4, $1108
+GLOBL idct_colCos6<>(SB), RODATA|NOPTR, $32
+
+// -c(sqrt2inv_sin6, 12) - c(sqrt2inv_cos6, 12)
+DATA idct_colSin6MinusCos6<>+0(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+4(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+8(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+12(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+16(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+20(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+24(SB)/4, $-3784
+DATA idct_colSin6MinusCos6<>+28(SB)/4, $-3784
+GLOBL idct_colSin6MinusCos6<>(SB), RODATA|NOPTR, $32
+
+// c(sqrt2inv_cos6, 12) - c(sqrt2inv_sin6, 12)
+DATA idct_colCos6PlusSin6<>+0(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+4(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+8(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+12(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+16(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+20(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+24(SB)/4, $-1568
+DATA idct_colCos6PlusSin6<>+28(SB)/4, $-1568
+GLOBL idct_colCos6PlusSin6<>(SB), RODATA|NOPTR, $32
+
+// c(sqrt2inv, 14)
+DATA idct_colSqrt2inv<>+0(SB)/4, $11585
+DATA idct_colSqrt2inv<>+4(SB)/4, $11585
+DATA idct_colSqrt2inv<>+8(SB)/4, $11585
+DATA idct_colSqrt2inv<>+12(SB)/4, $11585
+DATA idct_colSqrt2inv<>+16(SB)/4, $11585
+DATA idct_colSqrt2inv<>+20(SB)/4, $11585
+DATA idct_colSqrt2inv<>+24(SB)/4, $11585
+DATA idct_colSqrt2inv<>+28(SB)/4, $11585
+GLOBL idct_colSqrt2inv<>(SB), RODATA|NOPTR, $32
+
+// 1 << 19
+DATA idct_colRound<>+0(SB)/4, $524288
+DATA idct_colRound<>+4(SB)/4, $524288
+DATA idct_colRound<>+8(SB)/4, $524288
+DATA idct_colRound<>+12(SB)/4, $524288
+DATA idct_colRound<>+16(SB)/4, $524288
+DATA idct_colRound<>+20(SB)/4, $524288
+DATA idct_colRound<>+24(SB)/4, $524288
+DATA idct_colRound<>+28(SB)/4, $524288
+GLOBL idct_colRound<>(SB), RODATA|NOPTR, $32
+// TRANSPOSE transposes the 8x8 matrix of 32-bit values whose rows are
+// a0..a7 into t0..t7, overwriting a0..a7.
+#define TRANSPOSE(a0, a1, a2, a3, a4, a5, a6, a7, t0, t1, t2, t3, t4, t5, t6, t7) \
+	VPUNPCKLDQ a1, a0, t0; \
+	VPUNPCKHDQ a1, a0, t1; \
+	VPUNPCKLDQ a3, a2, t2; \
+	VPUNPCKHDQ a3, a2, t3; \
+	VPUNPCKLDQ a5, a4, t4; \
+	VPUNPCKHDQ a5, a4, t5; \
+	VPUNPCKLDQ a7, a6, t6; \
+	VPUNPCKHDQ a7, a6, t7; \
+	VPUNPCKLQDQ t2, t0, a0; \
+	VPUNPCKHQDQ t2, t0, a1; \
+	VPUNPCKLQDQ t3, t1, a2; \
+	VPUNPCKHQDQ t3, t1, a3; \
+	VPUNPCKLQDQ t6, t4, a4; \
+	VPUNPCKHQDQ t6, t4, a5; \
+	VPUNPCKLQDQ t7, t5, a6; \
+	VPUNPCKHQDQ t7, t5, a7; \
+	VPERM2I128 $0x20, a4, a0, t0; \
+	VPERM2I128 $0x20, a5, a1, t1; \
+	VPERM2I128 $0x20, a6, a2, t2; \
+	VPERM2I128 $0x20, a7, a3, t3; \
+	VPERM2I128 $0x31, a4, a0, t4; \
+	VPERM2I128 $0x31, a5, a1, t5; \
+	VPERM2I128 $0x31, a6, a2, t6; \
+	VPERM2I128 $0x31, a7, a3, t7
+
+// BUTTERFLY sets a, b = a+b, a-b, using t.
+#define BUTTERFLY(a, b, t) \
+	VPADDD b, a, t; \
+	VPSUBD b, a, b; \
+	VMOVDQA t, a
+
+// BOX sets x0, x1 = dctBox(x0, x1, kcos, ksin), given kcos, ksin-kcos and
+// kcos+ksin, using t and u.
+#define BOX(x0, x1, kcos, kdiff, ksum, t, u) \
+	VPADDD x1, x0, t; \
+	VPMULLD kcos, t, t; \
+	VPMULLD ksum, x0, u; \
+	VPMULLD kdiff, x1, x1; \
+	VPADDD x1, t, x0; \
+	VPSUBD u, t, x1
+
+// func idctAVX2(b *block)
+TEXT ·idctAVX2(SB), NOSPLIT, $0-8
+	MOVQ b+0(FP), AX
+	VMOVDQU 0(AX), Y0
+	VMOVDQU 32(AX), Y1
+	VMOVDQU 64(AX), Y2
+	VMOVDQU 96(AX), Y3
+	VMOVDQU 128(AX), Y4
+	VMOVDQU 160(AX), Y5
+	VMOVDQU 192(AX), Y6
+	VMOVDQU 224(AX), Y7
+	TRANSPOSE(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y8, Y9, Y10, Y11, Y12, Y13, Y14, Y15)
+
+	// Rows pass. The columns 0 to 7 of the block are x0 (Y8), x7 (Y9),
+	// x2 (Y10), x5 (Y11), x1 (Y12), x6 (Y13), x3 (Y14) and x4 (Y15).
+	VPSLLD $17, Y8, Y8
+	VPSLLD $17, Y12, Y12
+	BUTTERFLY(Y8, Y12, Y0)
+	BOX(Y10, Y14, idct_rowCos6<>(SB), idct_rowSin6MinusCos6<>(SB), idct_rowCos6PlusSin6<>(SB), Y0, Y1)
+	BUTTERFLY(Y12, Y10, Y0)
+	BUTTERFLY(Y8, Y14, Y0)
+
+	VPSLLD $7, Y15, Y15
+	VPSLLD $7, Y9, Y9
+	BUTTERFLY(Y9, Y15, Y0)
+	VPMULLD idct_rowSqrt2inv<>(SB), Y13, Y13
+	VPMULLD idct_rowSqrt2inv<>(SB), Y11, Y11
+	BUTTERFLY(Y9, Y11, Y0)
+	BUTTERFLY(Y15, Y13, Y0)
+
+	VPSRAD $2, Y15, Y15
+	VPSRAD $2, Y9, Y9
+	BOX(Y15, Y9, idct_cos3<>(SB), idct_sin3MinusCos3<>(SB), idct_cos3PlusSin3<>(SB), Y0, Y1)
+	VPSRAD $2, Y11, Y11
+	VPSRAD $2, Y13, Y13
+	BOX(Y11, Y13, idct_cos1<>(SB), idct_sin1MinusCos1<>(SB), idct_cos1PlusSin1<>(SB), Y0, Y1)
+
+	BUTTERFLY(Y8, Y9, Y0)
+	BUTTERFLY(Y12, Y13, Y0)
+	BUTTERFLY(Y10, Y11, Y0)
+	BUTTERFLY(Y14, Y15, Y0)
+
+	// x0..x7 are the columns 0 to 7 of the result, whose rows are then
+	// in Y0..Y7.
+	TRANSPOSE(Y8, Y12, Y10, Y14, Y15, Y11, Y13, Y9, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+
+	// Columns pass. The rows 0 to 7 of the block are x0 (Y0), x7 (Y1),
+	// x2 (Y2), x5 (Y3), x1 (Y4), x6 (Y5), x3 (Y6) and x4 (Y7).
+	VPADDD idct_colRound<>(SB), Y0, Y0
+	BUTTERFLY(Y0, Y4, Y8)
+	VPSRAD $2, Y0, Y0
+	VPSRAD $2, Y4, Y4
+	VPSRAD $13, Y2, Y2
+	VPSRAD $13, Y6, Y6
+	BOX(Y2, Y6, idct_colCos6<>(SB), idct_colSin6MinusCos6<>(SB), idct_colCos6PlusSin6<>(SB), Y8, Y9)
+	BUTTERFLY(Y4, Y2, Y8)
+	BUTTERFLY(Y0, Y6, Y8)
+
+	BUTTERFLY(Y1, Y7, Y8)
+	VPSRAD $13, Y3, Y3
+	VPMULLD idct_colSqrt2inv<>(SB), Y3, Y3
+	VPSRAD $13, Y5, Y5
+	VPMULLD idct_colSqrt2inv<>(SB), Y5, Y5
+	BUTTERFLY(Y1, Y3, Y8)
+	BUTTERFLY(Y7, Y5, Y8)
+
+	VPSRAD $14, Y7, Y7
+	VPSRAD $14, Y1, Y1
+	BOX(Y7, Y1, idct_cos3<>(SB), idct_sin3MinusCos3<>(SB), idct_cos3PlusSin3<>(SB), Y8, Y9)
+	VPSRAD $14, Y3, Y3
+	VPSRAD $14, Y5, Y5
+	BOX(Y3, Y5, idct_cos1<>(SB), idct_sin1MinusCos1<>(SB), idct_cos1PlusSin1<>(SB), Y8, Y9)
+
+	BUTTERFLY(Y0, Y1, Y8)
+	BUTTERFLY(Y4, Y5, Y8)
+	BUTTERFLY(Y2, Y3, Y8)
+	BUTTERFLY(Y6, Y7, Y8)
+
+	// Store x0..x7 as the rows 0 to 7.
+	VPSRAD $18, Y0, Y0
+	VPSRAD $18, Y4, Y4
+	VPSRAD $18, Y2, Y2
+	VPSRAD $18, Y6, Y6
+	VPSRAD $18, Y7, Y7
+	VPSRAD $18, Y3, Y3
+	VPSRAD $18, Y5, Y5
+	VPSRAD $18, Y1, Y1
+	VMOVDQU Y0, 0(AX)
+	VMOVDQU Y4, 32(AX)
+	VMOVDQU Y2, 64(AX)
+	VMOVDQU Y6, 96(AX)
+	VMOVDQU Y7, 128(AX)
+	VMOVDQU Y3, 160(AX)
+	VMOVDQU Y5, 192(AX)
+	VMOVDQU Y1, 224(AX)
+	VZEROUPPER
+	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
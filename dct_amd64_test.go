@@ -0,0 +1,41 @@
+//go:build !purego
+
+package progjpeg
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIDCTAVX2(t *testing.T) {
+	if !useAVX2 {
+		t.Skip("the CPU does not support AVX2")
+	}
+	blocks := append([]block(nil), testBlocks[:]...)
+	// Dequantized coefficients span much more than the 8-bit inputs that
+	// the IDCT is tuned for, up to the 16-bit extremes of corrupt files.
+	r := rand.New(rand.NewSource(1))
+	for _, limit := range []int32{256, 2048, 1 << 15, 1 << 16} {
+		for i := 0; i < 200; i++ {
+			var b block
+			for j := range b {
+				if r.Intn(4) == 0 {
+					b[j] = r.Int31n(2*limit) - limit
+				}
+			}
+			blocks = append(blocks, b)
+		}
+	}
+	for i, b := range blocks {
+		have, want := b, b
+		idctAVX2(&have)
+		idctGeneric(&want)
+		if have != want {
+			t.Fatalf("block %d:\nsrc\n%s\nhave\n%s\nwant\n%s", i, &b, &have, &want)
+		}
+	}
+}
+
+func BenchmarkIDCTGeneric(b *testing.B) {
+	benchmarkDCT(b, idctGeneric)
+}
@@ -0,0 +1,8 @@
+//go:build !amd64 || purego
+
+package progjpeg
+
+// idct implements the inverse DCT.
+func idct(b *block) {
+	idctGeneric(b)
+}
@@ -0,0 +1,83 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"io"
+)
+
+// DecodeFull reads a JPEG image from r and returns it, as [Decode] does,
+// with all of its metadata: that of [DecodeWithMetadata], and also its
+// comments, JFIF density, Adobe transform, restart interval, scan script
+// and raw APPn segments, which it reads in the same pass.
+func DecodeFull(r io.Reader) (image.Image, *Metadata, error) {
+	d := decoder{meta: &Metadata{}}
+	meta := d.meta
+	// restart is the interval of the last DRI segment.
+	restart := 0
+	d.onSegment = func(marker byte, p []byte) {
+		switch {
+		case marker == comMarker:
+			meta.Comments = append(meta.Comments, string(p))
+		case marker == driMarker && len(p) == 2:
+			restart = int(p[0])<<8 + int(p[1])
+		case marker == sosMarker:
+			meta.Scans = append(meta.Scans, d.scanOf(p, restart))
+			if len(meta.Scans) == 1 {
+				meta.RestartInterval = restart
+			}
+		case app0Marker <= marker && marker <= app15Marker:
+			meta.Segments = append(meta.Segments, Segment{marker, p})
+			if marker == app0Marker && len(p) >= 12 && bytes.HasPrefix(p, jfifID) && !meta.JFIF {
+				meta.JFIF = true
+				meta.DensityUnit = int(p[7])
+				meta.XDensity = int(p[8])<<8 + int(p[9])
+				meta.YDensity = int(p[10])<<8 + int(p[11])
+			}
+			if marker == app14Marker && len(p) >= 12 && bytes.HasPrefix(p, adobeID) && !meta.Adobe {
+				meta.Adobe = true
+				meta.AdobeTransform = int(p[11])
+			}
+		}
+	}
+	m, err := d.decode(r, false)
+	if m == nil {
+		return nil, nil, err
+	}
+	meta.ICC = d.iccProfile()
+	meta.QuantTables = d.quantTables()
+	return m, meta, err
+}
+
+// scanOf returns the scan whose SOS payload is p, and whose restart
+// interval is restart. Malformed payloads, which processSOS rejects, give
+// a zero scan.
+func (d *decoder) scanOf(p []byte, restart int) ProgressiveScan {
+	if len(p) < 1 || len(p) != 1+2*int(p[0])+3 {
+		return ProgressiveScan{}
+	}
+	ns := int(p[0])
+	s := ProgressiveScan{
+		Component:            -1,
+		SpectralStart:        int(p[1+2*ns]),
+		SpectralEnd:          int(p[2+2*ns]),
+		SuccessiveApproxHigh: int(p[3+2*ns] >> 4),
+		SuccessiveApproxLow:  int(p[3+2*ns] & 0x0f),
+		RestartInterval:      restart,
+	}
+	var comps []int
+	for j := 0; j < ns; j++ {
+		for i, c := range d.comp[:d.nComp] {
+			if c.c == p[1+2*j] {
+				comps = append(comps, i)
+			}
+		}
+	}
+	switch {
+	case ns == 1 && len(comps) == 1:
+		s.Component = comps[0]
+	case ns > 1 && ns < d.nComp:
+		s.Components = comps
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package progjpeg
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeFull(t *testing.T) {
+	src := testimg.Photo(72, 40, 1)
+	script := DefaultColorScanScript()
+	script[0].RestartInterval = 3
+	script[2].RestartInterval = 5
+	jfif := []byte("JFIF\x00\x01\x02\x01\x01\x2c\x00\x96\x00\x00")
+	adobe := adobeSegment(adobeTransformYCbCr)
+	custom := []byte("custom")
+
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, src, &Options{Quality: 75, Progressive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	mw.WriteSegment(app0Marker, jfif)
+	mw.WriteSegment(comMarker, []byte("first"))
+	mw.WriteSegment(app14Marker, adobe)
+	mw.WriteSegment(app0Marker+5, custom)
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	for i, s := range script {
+		if i == 1 {
+			mw.WriteSegment(comMarker, []byte("second"))
+		}
+		mw.WriteScan(s)
+	}
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	m, meta, err := DecodeFull(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m, want) {
+		t.Error("the image differs from that of Decode")
+	}
+	if !reflect.DeepEqual(meta.Comments, []string{"first", "second"}) {
+		t.Errorf("got comments %q", meta.Comments)
+	}
+	if !meta.JFIF || meta.DensityUnit != 1 || meta.XDensity != 300 || meta.YDensity != 150 {
+		t.Errorf("got JFIF %t, density %d x %d in unit %d, want 300 x 150 dpi", meta.JFIF, meta.XDensity, meta.YDensity, meta.DensityUnit)
+	}
+	if !meta.Adobe || meta.AdobeTransform != adobeTransformYCbCr {
+		t.Errorf("got Adobe %t and transform %d, want transform 1", meta.Adobe, meta.AdobeTransform)
+	}
+	if meta.RestartInterval != 3 {
+		t.Errorf("got restart interval %d, want 3", meta.RestartInterval)
+	}
+	if !reflect.DeepEqual(meta.Scans, script) {
+		t.Errorf("got scans %+v, want %+v", meta.Scans, script)
+	}
+	wantSegments := []Segment{{app0Marker, jfif}, {app14Marker, adobe}, {app0Marker + 5, custom}}
+	if !reflect.DeepEqual(meta.Segments, wantSegments) {
+		t.Errorf("got segments %q, want %q", meta.Segments, wantSegments)
+	}
+}
+
+func TestDecodeFullBaseline(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(40, 24, 1), &Options{Quality: 75, Thumbnail: 16}); err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := DecodeFull(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Exif segment holds the thumbnail.
+	if meta.Exif == nil || len(meta.Segments) != 1 || meta.Segments[0].Marker != app1Marker {
+		t.Errorf("got %d bytes of Exif data and segments %q, want the Exif segment", len(meta.Exif), meta.Segments)
+	}
+	want := ScanScript{{Component: -1, SpectralEnd: blockSize - 1}}
+	if !reflect.DeepEqual(meta.Scans, want) || meta.JFIF || meta.Adobe || meta.Comments != nil {
+		t.Errorf("got scans %+v, JFIF %t, Adobe %t and comments %q, want one scan and no other metadata", meta.Scans, meta.JFIF, meta.Adobe, meta.Comments)
+	}
+}
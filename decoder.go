@@ -0,0 +1,249 @@
+package progjpeg
+
+import (
+	"encoding/binary"
+	"image"
+	"io"
+	"os"
+)
+
+// A Decoder reads JPEG images. Unlike [Decode], which allocates its byte
+// buffer, Huffman tables and the coefficient buffers of progressive images on
+// every call, a Decoder keeps them between calls, which reduces the garbage
+// collection pressure of services decoding many images. It can also cap the
+// memory used by the coefficient buffers.
+//
+// The zero value is a Decoder without a memory cap, ready to use. A Decoder
+// is not safe for concurrent use by multiple goroutines, but distinct
+// Decoders can be used concurrently, one per goroutine or from a
+// [sync.Pool]. The images returned by Decode do not share memory with the
+// Decoder, and remain valid after later calls.
+type Decoder struct {
+	// MaxCoefficientMemory, if positive, is the maximum number of bytes of
+	// DCT coefficients that a progressive image can keep in memory. Each
+	// 8x8 block takes 256 bytes, so that a 4:2:0 image needs about 384
+	// bytes per 16 pixels.
+	MaxCoefficientMemory int64
+
+	// SpillDir is the directory in which the coefficients that exceed
+	// MaxCoefficientMemory are stored, in temporary files that are removed
+	// before Decode returns. If empty, decoding an image whose coefficients
+	// exceed MaxCoefficientMemory fails instead.
+	SpillDir string
+
+	// d is the decoder state, which is cleared between calls but not
+	// reallocated. free holds the coefficient buffers of previous decodes,
+	// and tables, if non-nil, the tables read by LoadTables.
+	d      decoder
+	free   [][]block
+	tables *decoderTables
+}
+
+// maxFreeCoefficients is the maximum number of coefficient buffers that a
+// Decoder keeps between calls.
+const maxFreeCoefficients = maxComponents
+
+// NewDecoder returns a new Decoder without a memory cap.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Reset releases the buffers that the Decoder keeps between calls, such as
+// those left by an unusually large image, keeping its settings and the
+// tables read by LoadTables.
+func (dec *Decoder) Reset() {
+	dec.free = nil
+}
+
+// Decode reads a JPEG image from r and returns it as an [image.Image], as
+// [Decode] does.
+func (dec *Decoder) Decode(r io.Reader) (image.Image, error) {
+	d := &dec.d
+	d.dec = dec
+	if dec.tables != nil {
+		d.huff, d.quant = dec.tables.huff, dec.tables.quant
+	}
+	defer func() {
+		d.releaseCoefficients()
+		// Drop the references to r and to the image, and leave a clean
+		// state for the next call.
+		*d = decoder{}
+	}()
+	return d.decode(r, false)
+}
+
+// allocCoefficients allocates the coefficient buffer of the component
+// compIndex, of n blocks, in memory if possible or else in a spill file.
+func (d *decoder) allocCoefficients(compIndex, n int) error {
+	size := int64(n) * blockSize * 4
+	if dec := d.dec; dec != nil && dec.MaxCoefficientMemory > 0 && d.coeffMemory+size > dec.MaxCoefficientMemory {
+		if dec.SpillDir == "" {
+			return UnsupportedError("coefficients exceed the memory limit")
+		}
+		// A page holds an MCU row, so that interleaved scans, which
+		// visit the blocks one MCU at a time, only need one page.
+		s, err := newSpillStore(dec.SpillDir, n, d.blocksPerRow(compIndex)*d.comp[compIndex].v)
+		if err != nil {
+			return err
+		}
+		d.spill[compIndex] = s
+		return nil
+	}
+	d.coeffMemory += size
+	if dec := d.dec; dec != nil {
+		for i, p := range dec.free {
+			if cap(p) >= n {
+				dec.free[i] = dec.free[len(dec.free)-1]
+				dec.free = dec.free[:len(dec.free)-1]
+				p = p[:n]
+				clear(p)
+				d.progCoeffs[compIndex] = p
+				return nil
+			}
+		}
+	}
+	d.progCoeffs[compIndex] = make([]block, n)
+	return nil
+}
+
+// blocksPerRow returns the number of blocks per row of the coefficient
+// buffer of the component compIndex.
+func (d *decoder) blocksPerRow(compIndex int) int {
+	h0 := d.comp[0].h
+	mxx := (d.width + 8*h0 - 1) / (8 * h0)
+	return mxx * d.comp[compIndex].h
+}
+
+// loadCoefficients returns the block i of the coefficient buffer of the
+// component compIndex.
+func (d *decoder) loadCoefficients(compIndex, i int) (block, error) {
+	if s := d.spill[compIndex]; s != nil {
+		return s.load(i)
+	}
+	return d.progCoeffs[compIndex][i], nil
+}
+
+// storeCoefficients sets the block i of the coefficient buffer of the
+// component compIndex.
+func (d *decoder) storeCoefficients(compIndex, i int, b *block) error {
+	if s := d.spill[compIndex]; s != nil {
+		return s.store(i, b)
+	}
+	d.progCoeffs[compIndex][i] = *b
+	return nil
+}
+
+// hasCoefficients reports whether the component compIndex has a coefficient
+// buffer, which is the case once a scan has included it.
+func (d *decoder) hasCoefficients(compIndex int) bool {
+	return d.progCoeffs[compIndex] != nil || d.spill[compIndex] != nil
+}
+
+// releaseCoefficients returns the coefficient buffers to the Decoder, if
+// any, and removes the spill files.
+func (d *decoder) releaseCoefficients() {
+	for i := 0; i < d.nComp; i++ {
+		if p := d.progCoeffs[i]; p != nil && d.dec != nil && len(d.dec.free) < maxFreeCoefficients {
+			d.dec.free = append(d.dec.free, p)
+		}
+		d.progCoeffs[i] = nil
+		if s := d.spill[i]; s != nil {
+			s.close()
+			d.spill[i] = nil
+		}
+	}
+}
+
+// spillStore is a coefficient buffer stored in a temporary file. It caches
+// one page of pageBlocks blocks at a time, which suits the row by row order
+// in which scans visit the blocks.
+type spillStore struct {
+	f          *os.File
+	n          int
+	pageBlocks int
+	// page is the index of the cached page, or -1, and buf holds its
+	// encoded blocks. dirty reports whether buf has to be written back.
+	page  int
+	buf   []byte
+	dirty bool
+	err   error
+}
+
+// spillBlockSize is the size of a block in a spill file.
+const spillBlockSize = blockSize * 4
+
+func newSpillStore(dir string, n, pageBlocks int) (*spillStore, error) {
+	f, err := os.CreateTemp(dir, "progjpeg-*.coeffs")
+	if err != nil {
+		return nil, err
+	}
+	// The file starts out sparse and reads as zeros, as a new buffer does.
+	if err := f.Truncate(int64(n) * spillBlockSize); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &spillStore{
+		f:          f,
+		n:          n,
+		pageBlocks: pageBlocks,
+		page:       -1,
+		buf:        make([]byte, pageBlocks*spillBlockSize),
+	}, nil
+}
+
+// seek makes the page holding block i the cached page, and returns the
+// offset of the block in s.buf.
+func (s *spillStore) seek(i int) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	page := i / s.pageBlocks
+	if page != s.page {
+		if s.dirty {
+			if _, s.err = s.f.WriteAt(s.pageBytes(s.page), int64(s.page*s.pageBlocks)*spillBlockSize); s.err != nil {
+				return 0, s.err
+			}
+			s.dirty = false
+		}
+		if _, s.err = s.f.ReadAt(s.pageBytes(page), int64(page*s.pageBlocks)*spillBlockSize); s.err != nil {
+			return 0, s.err
+		}
+		s.page = page
+	}
+	return (i - page*s.pageBlocks) * spillBlockSize, nil
+}
+
+// pageBytes returns the part of s.buf that holds the given page, which is
+// shorter than s.buf for the last page if n is not a multiple of pageBlocks.
+func (s *spillStore) pageBytes(page int) []byte {
+	return s.buf[:min(s.pageBlocks, s.n-page*s.pageBlocks)*spillBlockSize]
+}
+
+func (s *spillStore) load(i int) (b block, err error) {
+	off, err := s.seek(i)
+	if err != nil {
+		return b, err
+	}
+	for k := range b {
+		b[k] = int32(binary.LittleEndian.Uint32(s.buf[off+4*k:]))
+	}
+	return b, nil
+}
+
+func (s *spillStore) store(i int, b *block) error {
+	off, err := s.seek(i)
+	if err != nil {
+		return err
+	}
+	for k, v := range b {
+		binary.LittleEndian.PutUint32(s.buf[off+4*k:], uint32(v))
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *spillStore) close() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
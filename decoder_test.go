@@ -0,0 +1,148 @@
+package progjpeg
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	var dec Decoder
+	for _, filename := range []string{
+		"testdata/video-001.progressive.jpeg",
+		"testdata/video-001.q50.420.progressive.jpeg",
+		"testdata/video-005.gray.q50.progressive.jpeg",
+		"testdata/video-001.q50.420.jpeg",
+		"testdata/video-001.progressive.jpeg",
+	} {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dec.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if !equalImages(got, want) {
+			t.Errorf("%s: pooled decode differs from Decode", filename)
+		}
+	}
+	if len(dec.free) == 0 {
+		t.Error("no coefficient buffers were kept")
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	data, err := os.ReadFile("testdata/video-001.progressive.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder()
+	m0, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec.Reset()
+	if len(dec.free) != 0 {
+		t.Errorf("Reset kept %d coefficient buffers", len(dec.free))
+	}
+	m1, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m1) {
+		t.Error("decode after Reset differs")
+	}
+	// A failed decode must not affect the next one.
+	if _, err := dec.Decode(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Fatal("decoding a truncated image did not fail")
+	}
+	m2, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m2) {
+		t.Error("decode after a failed decode differs")
+	}
+}
+
+func TestDecoderConcurrent(t *testing.T) {
+	data, err := os.ReadFile("testdata/video-001.q50.420.progressive.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := sync.Pool{New: func() any { return NewDecoder() }}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				dec := pool.Get().(*Decoder)
+				m, err := dec.Decode(bytes.NewReader(data))
+				pool.Put(dec)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !equalImages(m, want) {
+					t.Error("concurrent decode differs from Decode")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDecoderMemoryLimit(t *testing.T) {
+	data, err := os.ReadFile("testdata/video-001.q50.420.progressive.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The limit fits the luma coefficients only.
+	b := want.Bounds()
+	limit := int64((b.Dx()+15)/16*(b.Dy()+15)/16) * 4 * 256
+	dec := Decoder{MaxCoefficientMemory: limit}
+	if _, err := dec.Decode(bytes.NewReader(data)); err == nil {
+		t.Fatal("decoding beyond the memory limit did not fail")
+	}
+	dir := t.TempDir()
+	dec.SpillDir = dir
+	got, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(got, want) {
+		t.Error("spilled decode differs from Decode")
+	}
+	if files, err := os.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("spill files were not removed: %v, %v", files, err)
+	}
+}
+
+func BenchmarkDecoderProgressive(b *testing.B) {
+	data, err := os.ReadFile("testdata/video-001.progressive.jpeg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var dec Decoder
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec.Decode(bytes.NewReader(data))
+	}
+}
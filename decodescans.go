@@ -0,0 +1,104 @@
+package progjpeg
+
+import (
+	"errors"
+	"image"
+	"io"
+	"slices"
+)
+
+// A ScanSnapshot is the image decoded after one of the scans of a JPEG
+// file, as returned by [DecodeScans].
+type ScanSnapshot struct {
+	// Image is the image decoded so far. The components of a progressive
+	// image that no scan has included yet are mid-gray.
+	Image image.Image
+	// Start is the offset in the input of the scan's SOS marker, and End
+	// that of the marker that follows its entropy-coded data, so that the
+	// scan, header included, is input[Start:End].
+	Start, End int64
+}
+
+// DecodeScans reads a JPEG image from r and returns the images decoded after
+// each of its scans, in order, with the byte range of each scan: the last
+// one is the image that [Decode] returns. It shows how a progressive image
+// looks as it loads, and which parts of the file each step costs. Each
+// image is a separate copy.
+//
+// If the data ends in the middle of the image, DecodeScans returns the
+// snapshots of the complete scans and that of the partial last one, whose
+// End is the size of the input, with [ErrTruncated].
+func DecodeScans(r io.Reader) ([]ScanSnapshot, error) {
+	cr := &countingReader{r: r}
+	var (
+		scans []ScanSnapshot
+		open  bool // whether the End of the last scan is unknown yet.
+	)
+	d := decoder{}
+	d.onMarker = func(marker byte) {
+		// The marker's 2 bytes are the last ones read from d.bytes.
+		off := cr.n - int64(d.bytes.j-d.bytes.i) - 2
+		if open {
+			scans[len(scans)-1].End = off
+			open = false
+		}
+		if marker == sosMarker {
+			scans = append(scans, ScanSnapshot{Start: off})
+			open = true
+		}
+	}
+	d.onScan = func(_ int, m image.Image) {
+		// The images share memory with the decoder's.
+		scans[len(scans)-1].Image = cloneImage(m)
+	}
+	m, err := d.decode(cr, false)
+	if errors.Is(err, ErrTruncated) && len(scans) > 0 {
+		last := &scans[len(scans)-1]
+		if last.Image == nil {
+			last.Image = m
+		}
+		if open {
+			last.End = cr.n
+		}
+		return scans, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scans, nil
+}
+
+// cloneImage returns a copy of an image returned by the decoder's snapshot.
+// The other types it returns, such as *image.RGBA and *image.CMYK, are
+// converted anew for every snapshot, and are returned as they are.
+func cloneImage(m image.Image) image.Image {
+	switch m := m.(type) {
+	case *image.Gray:
+		c := *m
+		c.Pix = slices.Clone(m.Pix)
+		return &c
+	case *image.YCbCr:
+		c := *m
+		c.Y, c.Cb, c.Cr = slices.Clone(m.Y), slices.Clone(m.Cb), slices.Clone(m.Cr)
+		return &c
+	case *Multiplane:
+		c := &Multiplane{Planes: make([]*image.Gray, len(m.Planes)), Rect: m.Rect}
+		for i, p := range m.Planes {
+			c.Planes[i] = cloneImage(p).(*image.Gray)
+		}
+		return c
+	}
+	return m
+}
+
+// countingReader forwards reads to r, counting the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,130 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeScans(t *testing.T) {
+	for _, o := range []*Options{
+		{Progressive: true},
+		{Progressive: true, Grayscale: true},
+		nil,
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, testimg.Photo(80, 56, 1), o); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		info, err := Probe(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scans, err := DecodeScans(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scans) != info.Scans {
+			t.Fatalf("%+v: got %d snapshots, want %d", o, len(scans), info.Scans)
+		}
+		end := int64(0)
+		for i, s := range scans {
+			if s.Start < end || s.End <= s.Start || data[s.Start] != 0xff || data[s.Start+1] != sosMarker || data[s.End] != 0xff {
+				t.Errorf("%+v: scan %d: bad range [%d, %d)", o, i, s.Start, s.End)
+			}
+			end = s.End
+			// The snapshot is the image of the file cut after the scan.
+			cut := append(append([]byte(nil), data[:s.End]...), 0xff, eoiMarker)
+			want, err := Decode(bytes.NewReader(cut))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalImages(s.Image, want) {
+				t.Errorf("%+v: scan %d: the snapshot differs from the image of the file cut after it", o, i)
+			}
+		}
+		if len(scans) > 1 && equalImages(scans[0].Image, scans[len(scans)-1].Image) {
+			t.Errorf("%+v: the first snapshot is the final image", o)
+		}
+	}
+}
+
+func TestDecodeScansTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(80, 56, 1), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	all, err := DecodeScans(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the data in the middle of the third scan.
+	cut := data[:(all[2].Start+all[2].End)/2]
+	scans, err := DecodeScans(bytes.NewReader(cut))
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got error %v, want ErrTruncated", err)
+	}
+	if len(scans) != 3 || scans[2].Image == nil || scans[2].End != int64(len(cut)) {
+		t.Fatalf("got %d snapshots, want 3 with a partial last one", len(scans))
+	}
+	for i := range 2 {
+		if scans[i].Start != all[i].Start || scans[i].End != all[i].End || !equalImages(scans[i].Image, all[i].Image) {
+			t.Errorf("scan %d differs from that of the whole file", i)
+		}
+	}
+}
+
+func TestDecodeMaxScans(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(80, 56, 1), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	scans, err := DecodeScans(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n <= len(scans); n++ {
+		// The data after the scan n, except for the marker that ends it,
+		// is not needed.
+		m, err := DecodeWithOptions(bytes.NewReader(data[:scans[n-1].End+2]), &DecodeOptions{MaxScans: n})
+		if err != nil {
+			t.Fatalf("%d scans: %v", n, err)
+		}
+		if !equalImages(m, scans[n-1].Image) {
+			t.Errorf("%d scans: the image differs from the snapshot of DecodeScans", n)
+		}
+	}
+	m, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{MaxScans: len(scans) + 1})
+	if err != nil || !equalImages(m, scans[len(scans)-1].Image) {
+		t.Errorf("more scans than the file has: got error %v or a different image", err)
+	}
+	// A component that no decoded scan included is mid-gray, like the
+	// chroma of the first scan of the mozjpeg script, which is a luma DC
+	// scan.
+	script, _ := Preset("mozjpeg")
+	buf.Reset()
+	if err := Encode(&buf, testimg.Photo(80, 56, 1), &Options{Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	m, err = DecodeWithOptions(bytes.NewReader(buf.Bytes()), &DecodeOptions{MaxScans: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ycc, ok := m.(*image.YCbCr)
+	if !ok {
+		t.Fatalf("got %T, want *image.YCbCr", m)
+	}
+	for y := 0; y < 56; y++ {
+		for x := 0; x < 80; x++ {
+			if i := ycc.COffset(x, y); ycc.Cb[i] != 0x80 || ycc.Cr[i] != 0x80 {
+				t.Fatalf("luma DC scan only: chroma at (%d, %d) is (%d, %d), want mid-gray", x, y, ycc.Cb[i], ycc.Cr[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package progjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"io"
+)
+
+// SourceInfo describes the encoded input of [DetectAndDecode].
+type SourceInfo struct {
+	// Format is the format name, such as "jpeg", "png" or "gif", as
+	// registered with [image.RegisterFormat].
+	Format string
+	// Progressive reports whether the input was already a progressive JPEG.
+	Progressive bool
+}
+
+// magic numbers of the formats recognized by DetectAndDecode.
+var (
+	jpegMagic  = []byte("\xff\xd8")
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+	gif87Magic = []byte("GIF87a")
+	gif89Magic = []byte("GIF89a")
+)
+
+// DetectAndDecode sniffs the format of the JPEG, PNG or GIF image in r,
+// decodes it and reports the source format, for example to decide whether an
+// uploaded file needs to be re-encoded as a progressive JPEG. Other formats
+// are rejected with [image.ErrFormat].
+//
+// JPEG input is decoded by this package. PNG and GIF input is decoded with
+// [image.Decode], so those decoders must have been registered, typically by
+// importing image/png or image/gif.
+func DetectAndDecode(r io.Reader) (image.Image, SourceInfo, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(pngMagic))
+	if err != nil && err != io.EOF {
+		return nil, SourceInfo{}, err
+	}
+	switch sniffFormat(header) {
+	case "":
+		return nil, SourceInfo{}, image.ErrFormat
+	case "jpeg":
+		var d decoder
+		m, err := d.decode(br, false)
+		if err != nil {
+			return nil, SourceInfo{}, err
+		}
+		return m, SourceInfo{Format: "jpeg", Progressive: d.progressive}, nil
+	}
+	m, format, err := image.Decode(br)
+	if err != nil {
+		return nil, SourceInfo{}, err
+	}
+	return m, SourceInfo{Format: format}, nil
+}
+
+// sniffFormat returns the name of the format whose magic number begins b, or
+// "" if b is not a JPEG, PNG or GIF header.
+func sniffFormat(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, jpegMagic):
+		return "jpeg"
+	case bytes.HasPrefix(b, pngMagic):
+		return "png"
+	case bytes.HasPrefix(b, gif87Magic), bytes.HasPrefix(b, gif89Magic):
+		return "gif"
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package progjpeg
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDetectAndDecode(t *testing.T) {
+	testCases := []struct {
+		filename    string
+		format      string
+		progressive bool
+	}{
+		{"testdata/video-001.jpeg", "jpeg", false},
+		{"testdata/video-001.progressive.jpeg", "jpeg", true},
+		{"testdata/video-001.png", "png", false},
+		{"testdata/video-001.gif", "gif", false},
+	}
+	for _, tc := range testCases {
+		f, err := os.Open(tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, info, err := DetectAndDecode(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tc.filename, err)
+			continue
+		}
+		if info.Format != tc.format || info.Progressive != tc.progressive {
+			t.Errorf("%s: got %+v, want format %q, progressive %t", tc.filename, info, tc.format, tc.progressive)
+		}
+		if m.Bounds() != image.Rect(0, 0, 150, 103) {
+			t.Errorf("%s: bad bounds: %v", tc.filename, m.Bounds())
+		}
+	}
+
+	if _, _, err := DetectAndDecode(strings.NewReader("BM not a supported format")); err != image.ErrFormat {
+		t.Errorf("got %v, want %v", err, image.ErrFormat)
+	}
+}
@@ -0,0 +1,47 @@
+package progjpeg
+
+// ditherZigs is the number of coefficients, in zig-zag order, that are
+// dithered: the DC coefficient, whose rounding makes the steps between
+// flat blocks, and the two lowest AC coefficients, which ramp the blocks
+// across the steps.
+const ditherZigs = 3
+
+// blockID identifies the block i, in the order of an interleaved scan, of
+// the MCU (mx, my), to seed its dither noise.
+func (e *encoder) blockID(mx, my, i int) uint32 {
+	return uint32(my*e.mxx+mx)<<8 | uint32(i)
+}
+
+// ditherBlock adds noise to the lowest coefficients of the transformed
+// block b, before they are quantized with the steps in zig-zag order, if
+// the block is smooth: if none of its AC coefficients reach a quantization
+// step, as is the case in the gradients of skies and vignettes. The noise
+// has a triangular distribution of up to e.dither percent of a step either
+// way, so that the rounding of neighboring blocks differs where a gradient
+// crosses a step, and their average follows the gradient. id seeds the
+// noise, which only depends on the block's position.
+func (e *encoder) ditherBlock(b *block, steps *[blockSize]byte, id uint32) {
+	for zig := 1; zig < blockSize; zig++ {
+		if c := b[unzig[zig]]; c >= 8*int32(steps[zig]) || c <= -8*int32(steps[zig]) {
+			return
+		}
+	}
+	for zig := 0; zig < ditherZigs; zig++ {
+		r := hash32(id*ditherZigs + uint32(zig))
+		// The sum of two uniform values in [0, 1<<15] is triangular.
+		n := int32(r&0x7fff) + int32(r>>17) - 1<<15
+		step := 8 * int32(steps[zig])
+		b[unzig[zig]] += int32(int64(n) * int64(step) * int64(e.dither) / (100 << 15))
+	}
+}
+
+// hash32 returns a pseudo-random value computed from x, with the finalizer
+// of MurmurHash3.
+func hash32(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
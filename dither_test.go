@@ -0,0 +1,76 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// gradientError returns the mean absolute error between the columns of m,
+// averaged over every row, and the gradient g.
+func gradientError(m *image.Gray, g func(x int) float64) float64 {
+	b := m.Bounds()
+	sum := 0.0
+	for x := b.Min.X; x < b.Max.X; x++ {
+		col := 0.0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			col += float64(m.GrayAt(x, y).Y)
+		}
+		d := col/float64(b.Dy()) - g(x)
+		sum += max(d, -d)
+	}
+	return sum / float64(b.Dx())
+}
+
+func TestDither(t *testing.T) {
+	// A shallow horizontal gradient, which low qualities quantize to bands
+	// of flat blocks.
+	g := func(x int) float64 { return 100 + 30*float64(x)/512 }
+	m := image.NewGray(image.Rect(0, 0, 512, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 512; x++ {
+			m.Pix[y*m.Stride+x] = uint8(g(x) + 0.5)
+		}
+	}
+	errors := map[int]float64{}
+	for _, dither := range []int{0, 100} {
+		var buf bytes.Buffer
+		o := &Options{Quality: 15, Dither: dither}
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		var again bytes.Buffer
+		if err := Encode(&again, m, o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+			t.Errorf("dither %d: the output is not deterministic", dither)
+		}
+		d, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errors[dither] = gradientError(d.(*image.Gray), g)
+	}
+	if errors[100] >= errors[0]/2 {
+		t.Errorf("got an average error of %.2f with dithering, %.2f without, want less than half", errors[100], errors[0])
+	}
+}
+
+func TestDitherDetail(t *testing.T) {
+	// Blocks with detail are not dithered.
+	m := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i * 37 % 256)
+	}
+	var want, got bytes.Buffer
+	if err := Encode(&want, m, &Options{Quality: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&got, m, &Options{Quality: 50, Dither: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("dithering changes an image without smooth blocks")
+	}
+}
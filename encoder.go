@@ -0,0 +1,50 @@
+package progjpeg
+
+import (
+	"bufio"
+	"image"
+	"io"
+)
+
+// An Encoder writes JPEG images to an output stream. Unlike [Encode], which
+// allocates its buffers, quantization tables and scratch space on every
+// call, an Encoder keeps them between calls, so that servers encoding many
+// images can reuse one Encoder per goroutine.
+//
+// An Encoder is not safe for concurrent use by multiple goroutines.
+type Encoder struct {
+	e  encoder
+	bw *bufio.Writer
+	aw appendWriter
+}
+
+// NewEncoder returns a new Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	enc := &Encoder{}
+	enc.Reset(w)
+	return enc
+}
+
+// Reset discards any state and switches the Encoder to write to w, keeping
+// its buffers for reuse.
+func (enc *Encoder) Reset(w io.Writer) {
+	if ww, ok := w.(writer); ok {
+		enc.e.w = ww
+		return
+	}
+	if enc.bw == nil {
+		enc.bw = bufio.NewWriter(w)
+	} else {
+		enc.bw.Reset(w)
+	}
+	enc.e.w = enc.bw
+}
+
+// Encode writes the Image m to the Encoder's output stream with the given
+// options, as [Encode] does.
+func (enc *Encoder) Encode(m image.Image, o *Options) error {
+	e := &enc.e
+	e.err = nil
+	e.bits, e.nBits, e.nOut = 0, 0, 0
+	return e.encode(m, o)
+}
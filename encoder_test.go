@@ -0,0 +1,61 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+)
+
+func TestEncoderReuse(t *testing.T) {
+	m0, err := readPng("testdata/video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 37, 21))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	testCases := []struct {
+		m image.Image
+		o *Options
+	}{
+		{m0, nil},
+		{m0, &Options{Quality: 30, Progressive: true}},
+		{gray, &Options{Quality: 90, Progressive: true}},
+		{m0, &Options{Quality: 90}},
+		{gray, nil},
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i, tc := range testCases {
+		var want bytes.Buffer
+		if err := Encode(&want, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		enc.Reset(&buf)
+		if err := enc.Encode(tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Errorf("test case %d: Encoder output differs from Encode", i)
+		}
+	}
+}
+
+func BenchmarkEncoderRGBA(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	b.SetBytes(640 * 480 * 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	options := &Options{Quality: 90, Progressive: true}
+	enc := NewEncoder(io.Discard)
+	for i := 0; i < b.N; i++ {
+		enc.Reset(io.Discard)
+		enc.Encode(img, options)
+	}
+}
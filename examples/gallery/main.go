@@ -0,0 +1,299 @@
+// Command gallery is an example web application built on progjpeg. It
+// accepts image uploads, re-encodes them as baseline and progressive JPEGs,
+// shows both side by side under a selectable bandwidth limit to compare how
+// they load, lists the scans of the progressive file, and offers it for
+// download.
+//
+// Usage:
+//
+//	go run ./examples/gallery -http localhost:8080
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"rate": formatRate,
+}).ParseFS(templateFS, "templates/*.html"))
+
+// maxUploadSize is the maximum size of an uploaded image, in bytes.
+const maxUploadSize = 32 << 20
+
+// rates are the bandwidth limits offered by the viewer, in bytes per
+// second. 0 means no limit.
+var rates = []int{0, 1 << 20, 256 << 10, 64 << 10, 16 << 10}
+
+// An entry is an uploaded image and its encodings.
+type entry struct {
+	ID     int
+	Name   string
+	Source progjpeg.SourceInfo
+	// Baseline and Progressive are the encoded files, and Session is the
+	// record of the progressive encode.
+	Baseline, Progressive []byte
+	Session               progjpeg.Session
+	Frame                 progjpeg.FrameInfo
+	Probe                 progjpeg.ProbeResult
+}
+
+// A gallery holds the uploaded images in memory.
+type gallery struct {
+	mu      sync.Mutex
+	entries []*entry
+	quality int
+}
+
+func main() {
+	var hostPort string
+	var quality int
+	flag.StringVar(&hostPort, "http", "localhost:8080", "Host and port to listen on")
+	flag.IntVar(&quality, "quality", 85, "Quality of the encoded images")
+	flag.Parse()
+
+	g := &gallery{quality: quality}
+	log.Printf("Serving the gallery on http://%s/", hostPort)
+	log.Fatal(http.ListenAndServe(hostPort, g.handler()))
+}
+
+// handler returns the HTTP handler of the application.
+func (g *gallery) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", g.serveIndex)
+	mux.HandleFunc("POST /upload", g.serveUpload)
+	mux.HandleFunc("GET /view/{id}", g.serveView)
+	mux.HandleFunc("GET /image/{id}/{kind}", g.serveImage)
+	mux.HandleFunc("GET /download/{id}", g.serveDownload)
+	return mux
+}
+
+func (g *gallery) serveIndex(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	entries := append([]*entry(nil), g.entries...)
+	g.mu.Unlock()
+	render(w, "index.html", entries)
+}
+
+func (g *gallery) serveUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	var script progjpeg.ScanScript
+	if text := strings.TrimSpace(r.FormValue("scans")); text != "" {
+		script, err = progjpeg.ParseScanScript(strings.NewReader(text))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	e, err := g.add(header.Filename, file, script)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/view/%d", e.ID), http.StatusSeeOther)
+}
+
+// add decodes the image in r, encodes it and adds it to the gallery. A nil
+// script selects the default scan script.
+func (g *gallery) add(name string, r io.Reader, script progjpeg.ScanScript) (*entry, error) {
+	m, source, err := progjpeg.DetectAndDecode(r)
+	if err != nil {
+		return nil, fmt.Errorf("cant decode %s: %v", name, err)
+	}
+	e := &entry{Name: name, Source: source}
+
+	var buf bytes.Buffer
+	if err := progjpeg.Encode(&buf, m, &progjpeg.Options{Quality: g.quality}); err != nil {
+		return nil, err
+	}
+	e.Baseline = bytes.Clone(buf.Bytes())
+
+	buf.Reset()
+	err = progjpeg.Encode(&buf, m, &progjpeg.Options{
+		Quality:          g.quality,
+		Progressive:      true,
+		ScanScript:       script,
+		StrictScanScript: true,
+		Session:          &e.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.Progressive = bytes.Clone(buf.Bytes())
+
+	// Check the output the way a client would see it.
+	if e.Frame, err = progjpeg.Inspect(bytes.NewReader(e.Progressive)); err != nil {
+		return nil, err
+	}
+	if e.Probe, err = progjpeg.Probe(bytes.NewReader(e.Progressive)); err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	e.ID = len(g.entries)
+	g.entries = append(g.entries, e)
+	return e, nil
+}
+
+// lookup returns the entry whose ID is the id path value of r.
+func (g *gallery) lookup(r *http.Request) (*entry, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, errors.New("invalid image id")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id < 0 || id >= len(g.entries) {
+		return nil, errors.New("no such image")
+	}
+	return g.entries[id], nil
+}
+
+// parseRate returns the rate form value of r, which must be one of rates,
+// or 0 if it is missing.
+func parseRate(r *http.Request) (int, error) {
+	v := r.FormValue("rate")
+	if v == "" {
+		return 0, nil
+	}
+	rate, err := strconv.Atoi(v)
+	if err != nil || !slices.Contains(rates, rate) {
+		return 0, fmt.Errorf("invalid rate %q", v)
+	}
+	return rate, nil
+}
+
+func (g *gallery) serveView(w http.ResponseWriter, r *http.Request) {
+	e, err := g.lookup(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	rate, err := parseRate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	render(w, "view.html", struct {
+		*entry
+		Rate  int
+		Rates []int
+		// Nonce makes the browser fetch the images again when the page
+		// is reloaded, so that their loading can be watched again.
+		Nonce int64
+	}{e, rate, rates, time.Now().UnixNano()})
+}
+
+func (g *gallery) serveImage(w http.ResponseWriter, r *http.Request) {
+	e, err := g.lookup(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var data []byte
+	switch r.PathValue("kind") {
+	case "baseline":
+		data = e.Baseline
+	case "progressive":
+		data = e.Progressive
+	default:
+		http.Error(w, "unknown image kind", http.StatusNotFound)
+		return
+	}
+	rate, err := parseRate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	writeThrottled(w, data, rate)
+}
+
+func (g *gallery) serveDownload(w http.ResponseWriter, r *http.Request) {
+	e, err := g.lookup(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	name := strings.TrimSuffix(e.Name, path.Ext(e.Name))
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".progressive.jpg"))
+	w.Write(e.Progressive)
+}
+
+// throttleChunk is the number of bytes written at once by writeThrottled.
+const throttleChunk = 1 << 10
+
+// writeThrottled writes data to w at about rate bytes per second, flushing
+// every chunk so that the client receives the scans as they arrive. A rate
+// of 0 or less writes data at once.
+func writeThrottled(w http.ResponseWriter, data []byte, rate int) {
+	if rate <= 0 {
+		w.Write(data)
+		return
+	}
+	rc := http.NewResponseController(w)
+	delay := time.Second * throttleChunk / time.Duration(rate)
+	for len(data) > 0 {
+		n := min(throttleChunk, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			return
+		}
+		rc.Flush()
+		data = data[n:]
+		time.Sleep(delay)
+	}
+}
+
+// formatRate formats a bandwidth limit for the viewer.
+func formatRate(rate int) string {
+	switch {
+	case rate <= 0:
+		return "unlimited"
+	case rate >= 1<<20:
+		return fmt.Sprintf("%d MiB/s", rate>>20)
+	}
+	return fmt.Sprintf("%d KiB/s", rate>>10)
+}
+
+// render executes the named template, and writes its output to w once it
+// is complete.
+func render(w http.ResponseWriter, name string, data any) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg"
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// upload posts the PNG encoding of a test image to the gallery, with the
+// given scan script, and returns the response.
+func upload(t *testing.T, srv *httptest.Server, scans string) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(fw, testimg.Photo(96, 64, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.WriteField("scans", scans); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+	resp, err := srv.Client().Post(srv.URL+"/upload", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// get returns the body of the page at path, which must be served with the
+// status 200.
+func get(t *testing.T, srv *httptest.Server, path string) []byte {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s: %s", path, resp.Status, data)
+	}
+	return data
+}
+
+func TestGallery(t *testing.T) {
+	srv := httptest.NewServer((&gallery{quality: 80}).handler())
+	defer srv.Close()
+
+	resp := upload(t, srv, "0,1,2: 0 0 0 0; 0: 1 63 0 0; 1: 1 63 0 0; 2: 1 63 0 0;")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/view/0" {
+		t.Fatalf("upload: %s, redirected to %s", resp.Status, resp.Request.URL.Path)
+	}
+
+	page := string(get(t, srv, "/view/0?rate=65536"))
+	for _, want := range []string{"photo.png", "64 KiB/s", "/image/0/progressive?rate=65536", "96x64"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("view page does not contain %q", want)
+		}
+	}
+	if !strings.Contains(string(get(t, srv, "/")), `href="/view/0"`) {
+		t.Error("index page does not link to the image")
+	}
+
+	for _, path := range []string{"/image/0/baseline", "/image/0/progressive?rate=1048576", "/download/0"} {
+		data := get(t, srv, path)
+		info, err := progjpeg.Probe(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if info.Width != 96 || info.Height != 64 {
+			t.Errorf("%s: got %dx%d, want 96x64", path, info.Width, info.Height)
+		}
+		if progressive := path != "/image/0/baseline"; info.Progressive != progressive || progressive && info.Scans != 4 {
+			t.Errorf("%s: got progressive %t with %d scans", path, info.Progressive, info.Scans)
+		}
+		if _, err := progjpeg.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestGalleryErrors(t *testing.T) {
+	srv := httptest.NewServer((&gallery{quality: 80}).handler())
+	defer srv.Close()
+
+	for _, scans := range []string{"0: 1 5 0;", "3: 0 0 0 0;"} {
+		resp := upload(t, srv, scans)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("scan script %q: got %s, want 400", scans, resp.Status)
+		}
+	}
+	for _, path := range []string{"/view/0", "/image/x/baseline", "/download/-1"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: got %s, want 404", path, resp.Status)
+		}
+	}
+	// Only the rates offered by the viewer are accepted, so that a tiny
+	// rate cannot hold a connection open for hours.
+	upload(t, srv, "").Body.Close()
+	for _, path := range []string{"/image/0/progressive?rate=1", "/image/0/baseline?rate=-1024", "/image/0/baseline?rate=fast", "/view/0?rate=1000"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s: got %s, want 400", path, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"time"
+)
+
+// Metadata is the metadata of a JPEG image returned by [DecodeWithMetadata]
+// and [DecodeFull].
+type Metadata struct {
+	// Exif is the TIFF structure of the first APP1 Exif segment, without
+	// the "Exif\x00\x00" identifier that precedes it, or nil if the image
+	// has none. It can be given as it is to a full Exif parser.
+	Exif []byte
+	// Orientation is the Exif orientation of the image, from 1 to 8: 1 is
+	// upright, and 6 means that the image must be rotated 90° clockwise to
+	// be displayed. It is 0 if the Exif data does not say.
+	Orientation int
+	// DateTime is the date and time at which the image was last changed,
+	// and DateTimeOriginal the one at which it was taken. They are zero if
+	// the Exif data does not say. Exif dates have no time zone: they are in
+	// the time zone of their Exif offset fields if present, or else in UTC.
+	DateTime, DateTimeOriginal time.Time
+	// ICC is the ICC color profile of the image, reassembled from its APP2
+	// "ICC_PROFILE" segments, or nil if the image has none or if some of
+	// its segments are missing. It can be written back with
+	// Options.ICCProfile.
+	ICC []byte
+	// Images are the images of a Multi-Picture Format (MPO) file, such as
+	// the views of a stereo camera or the frames of a burst, as listed by
+	// the MPF APP2 segment of its first image, or nil if it has none. The
+	// first one is the image that is decoded.
+	Images []MPImage
+	// QuantTables are the quantization tables of the image, in zig-zag
+	// order and by destination selector, up to the last one defined, which
+	// Options.QuantTables takes to re-encode the image with the same
+	// steps. The values of 16-bit tables are clipped to 255.
+	QuantTables [][blockSize]uint8
+
+	// The fields below are only set by [DecodeFull].
+
+	// Comments are the texts of the COM segments, in file order.
+	Comments []string
+	// JFIF reports whether the image has a JFIF APP0 segment, whose pixel
+	// density is XDensity by YDensity in DensityUnit: 0 for an aspect ratio
+	// only, 1 for dots per inch and 2 for dots per centimeter.
+	JFIF               bool
+	DensityUnit        int
+	XDensity, YDensity int
+	// Adobe reports whether the image has an Adobe APP14 segment, whose
+	// color transform flag is AdobeTransform: 0 for RGB or CMYK, 1 for YCbCr
+	// and 2 for YCCK.
+	Adobe          bool
+	AdobeTransform int
+	// RestartInterval is the restart interval of the first scan, in MCUs, or
+	// 0 if it has none.
+	RestartInterval int
+	// Scans is the scan script of the image, with one scan per SOS segment.
+	// Scans of several components have the Component -1, and the Huffman
+	// tables of every scan are HuffmanDefault.
+	Scans ScanScript
+	// Segments are the APPn segments of the image, in file order, including
+	// the JFIF, Exif, ICC and Adobe ones.
+	Segments []Segment
+}
+
+// Segment is a segment of a JPEG file.
+type Segment struct {
+	// Marker is the second byte of the segment's marker, such as 0xe1 for
+	// APP1.
+	Marker byte
+	// Data is the payload of the segment, after its length.
+	Data []byte
+}
+
+// DecodeWithMetadata reads a JPEG image from r and returns it, as [Decode]
+// does, with its metadata, which it reads in the same pass. Malformed
+// metadata is not an error: the fields that cannot be decoded are left zero.
+func DecodeWithMetadata(r io.Reader) (image.Image, *Metadata, error) {
+	d := decoder{meta: &Metadata{}}
+	m, err := d.decode(r, false)
+	if m == nil {
+		return nil, nil, err
+	}
+	d.meta.ICC = d.iccProfile()
+	d.meta.QuantTables = d.quantTables()
+	return m, d.meta, err
+}
+
+// quantTables returns the quantization tables defined by the DQT segments
+// read so far, up to the last one, for Metadata.QuantTables.
+func (d *decoder) quantTables() [][blockSize]uint8 {
+	// A table is defined if its values are not zero, which DQT forbids.
+	n := 0
+	for i, q := range d.quant {
+		if q[0] != 0 {
+			n = i + 1
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	tables := make([][blockSize]uint8, n)
+	for i, q := range d.quant[:n] {
+		for j, v := range q {
+			tables[i][j] = uint8(min(v, 255))
+		}
+	}
+	return tables
+}
+
+// processApp1Marker reads an APP1 segment, which holds Exif data if it
+// starts with exifID. The segment is ignored unless d.meta is set.
+func (d *decoder) processApp1Marker(n int) error {
+	if d.meta == nil || d.meta.Exif != nil || n < len(exifID) {
+		return d.ignore(n)
+	}
+	p := make([]byte, n)
+	if err := d.readFull(p); err != nil {
+		return err
+	}
+	if bytes.HasPrefix(p, exifID) {
+		d.meta.Exif = p[len(exifID):]
+		parseExif(d.meta)
+	}
+	return nil
+}
+
+// Exif tags, as specified in the Exif 2.32 standard.
+const (
+	exifTagOrientation        = 0x0112
+	exifTagDateTime           = 0x0132
+	exifTagExifIFD            = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTime         = 0x9010
+	exifTagOffsetTimeOriginal = 0x9011
+)
+
+// Exif field types.
+const (
+	exifASCII = 2
+	exifShort = 3
+	exifLong  = 4
+)
+
+// exifIFD is an Image File Directory of a TIFF structure.
+type exifIFD struct {
+	tiff  []byte
+	order binary.ByteOrder
+	// entries holds the 12-byte entries of the directory.
+	entries []byte
+}
+
+// tiffByteOrder returns the byte order of the TIFF structure tiff, or nil
+// if its header is not valid.
+func tiffByteOrder(tiff []byte) binary.ByteOrder {
+	if len(tiff) < 8 {
+		return nil
+	}
+	switch string(tiff[:4]) {
+	case "II\x2a\x00":
+		return binary.LittleEndian
+	case "MM\x00\x2a":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// readIFD returns the directory at offset off of tiff, or false if it does
+// not fit.
+func readIFD(tiff []byte, order binary.ByteOrder, off uint32) (exifIFD, bool) {
+	if uint64(off)+2 > uint64(len(tiff)) {
+		return exifIFD{}, false
+	}
+	n := int(order.Uint16(tiff[off:]))
+	start := int(off) + 2
+	if start+12*n > len(tiff) {
+		return exifIFD{}, false
+	}
+	return exifIFD{tiff, order, tiff[start : start+12*n]}, true
+}
+
+// value returns the type, count and value bytes of the field tag, or false
+// if the directory has no such field or if its value does not fit.
+func (ifd exifIFD) value(tag uint16) (typ uint16, count uint32, v []byte, ok bool) {
+	for e := ifd.entries; len(e) >= 12; e = e[12:] {
+		if ifd.order.Uint16(e) != tag {
+			continue
+		}
+		typ, count = ifd.order.Uint16(e[2:]), ifd.order.Uint32(e[4:])
+		size := uint64(count)
+		switch typ {
+		case exifShort:
+			size *= 2
+		case exifLong:
+			size *= 4
+		}
+		if size <= 4 {
+			return typ, count, e[8 : 8+size], true
+		}
+		off := uint64(ifd.order.Uint32(e[8:]))
+		if off+size > uint64(len(ifd.tiff)) {
+			return 0, 0, nil, false
+		}
+		return typ, count, ifd.tiff[off : off+size], true
+	}
+	return 0, 0, nil, false
+}
+
+// uint returns the value of the SHORT or LONG field tag.
+func (ifd exifIFD) uint(tag uint16) (uint32, bool) {
+	typ, count, v, ok := ifd.value(tag)
+	if !ok || count < 1 {
+		return 0, false
+	}
+	switch typ {
+	case exifShort:
+		return uint32(ifd.order.Uint16(v)), true
+	case exifLong:
+		return ifd.order.Uint32(v), true
+	}
+	return 0, false
+}
+
+// string returns the value of the ASCII field tag, without its NUL
+// terminator.
+func (ifd exifIFD) string(tag uint16) (string, bool) {
+	typ, _, v, ok := ifd.value(tag)
+	if !ok || typ != exifASCII {
+		return "", false
+	}
+	if i := bytes.IndexByte(v, 0); i >= 0 {
+		v = v[:i]
+	}
+	return string(v), true
+}
+
+// time returns the date and time of the ASCII field tag, in the time zone
+// of the ASCII offset field offsetTag of exif if it is present.
+func (ifd exifIFD) time(tag uint16, exif exifIFD, offsetTag uint16) time.Time {
+	s, ok := ifd.string(tag)
+	if !ok {
+		return time.Time{}
+	}
+	loc := time.UTC
+	if o, ok := exif.string(offsetTag); ok {
+		if z, err := time.Parse("-07:00", o); err == nil {
+			_, offset := z.Zone()
+			loc = time.FixedZone(o, offset)
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseExif decodes the fields of m that come from the TIFF structure in
+// m.Exif.
+func parseExif(m *Metadata) {
+	tiff := m.Exif
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return
+	}
+	ifd0, ok := readIFD(tiff, order, order.Uint32(tiff[4:]))
+	if !ok {
+		return
+	}
+	if o, ok := ifd0.uint(exifTagOrientation); ok && 1 <= o && o <= 8 {
+		m.Orientation = int(o)
+	}
+	// The Exif IFD holds the offsets and the original date.
+	var exif exifIFD
+	if off, ok := ifd0.uint(exifTagExifIFD); ok {
+		exif, _ = readIFD(tiff, order, off)
+	}
+	m.DateTime = ifd0.time(exifTagDateTime, exif, exifTagOffsetTime)
+	m.DateTimeOriginal = exif.time(exifTagDateTimeOriginal, exif, exifTagOffsetTimeOriginal)
+}
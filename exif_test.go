@@ -0,0 +1,169 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// bigEndianExif returns a big-endian TIFF structure with an orientation, a
+// date and an Exif IFD holding an original date and its offset.
+func bigEndianExif() []byte {
+	be := binary.BigEndian
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	entry := func(tag, typ uint16, count, value uint32) {
+		tiff = be.AppendUint16(tiff, tag)
+		tiff = be.AppendUint16(tiff, typ)
+		tiff = be.AppendUint32(tiff, count)
+		tiff = be.AppendUint32(tiff, value)
+	}
+	// IFD0, at 8, has 3 entries and ends at 8+2+3*12+4 = 50. Its date is
+	// at 50, and the Exif IFD at 70.
+	tiff = be.AppendUint16(tiff, 3)
+	entry(exifTagOrientation, exifShort, 1, 6<<16)
+	entry(exifTagDateTime, exifASCII, 20, 50)
+	entry(exifTagExifIFD, exifLong, 1, 70)
+	tiff = be.AppendUint32(tiff, 0)
+	tiff = append(tiff, "2024:05:06 07:08:09\x00"...)
+	// The Exif IFD has 2 entries and ends at 70+2+2*12+4 = 100, where its
+	// original date is.
+	tiff = be.AppendUint16(tiff, 2)
+	entry(exifTagDateTimeOriginal, exifASCII, 20, 100)
+	entry(exifTagOffsetTimeOriginal, exifASCII, 4, 0)
+	copy(tiff[len(tiff)-4:], "+02:")
+	tiff = be.AppendUint32(tiff, 0)
+	tiff = append(tiff, "2023:12:31 23:59:58\x00"...)
+	return tiff
+}
+
+// encodeWithSegment encodes m with an APPn segment after the SOI marker.
+func encodeWithSegment(t *testing.T, m image.Image, marker byte, data []byte) []byte {
+	t.Helper()
+	return encodeWithOptionsAndSegment(t, m, nil, marker, data)
+}
+
+// encodeWithOptionsAndSegment is encodeWithSegment with the options o.
+func encodeWithOptionsAndSegment(t *testing.T, m image.Image, o *Options, marker byte, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, m, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	if err := mw.WriteSegment(marker, data); err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	mw.WriteScan(ProgressiveScan{Component: -1, SpectralEnd: blockSize - 1})
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeWithMetadata(t *testing.T) {
+	src := testimg.Photo(40, 24, 1)
+	tiff := bigEndianExif()
+	// The offset field has 4 bytes, without a NUL terminator, so it only
+	// holds "+02:": the original date stays in UTC.
+	data := encodeWithSegment(t, src, app1Marker, append([]byte("Exif\x00\x00"), tiff...))
+	m, meta, err := DecodeWithMetadata(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m, want) {
+		t.Error("the image differs from that of Decode")
+	}
+	if !bytes.Equal(meta.Exif, tiff) {
+		t.Errorf("got %d bytes of Exif data, want %d", len(meta.Exif), len(tiff))
+	}
+	if meta.Orientation != 6 {
+		t.Errorf("got orientation %d, want 6", meta.Orientation)
+	}
+	if w := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC); !meta.DateTime.Equal(w) {
+		t.Errorf("got date %v, want %v", meta.DateTime, w)
+	}
+	if w := time.Date(2023, 12, 31, 23, 59, 58, 0, time.UTC); !meta.DateTimeOriginal.Equal(w) {
+		t.Errorf("got original date %v, want %v", meta.DateTimeOriginal, w)
+	}
+}
+
+func TestDecodeWithMetadataOffset(t *testing.T) {
+	tiff := bigEndianExif()
+	// Point the offset field at a complete "+02:00" value, in the unused
+	// space after the original date.
+	tiff = append(tiff, "+02:00\x00"...)
+	i := bytes.Index(tiff, []byte("+02:"))
+	binary.BigEndian.PutUint32(tiff[i-4:], 7)
+	binary.BigEndian.PutUint32(tiff[i:], uint32(len(tiff)-7))
+	data := encodeWithSegment(t, testimg.Photo(16, 16, 1), app1Marker, append([]byte("Exif\x00\x00"), tiff...))
+	_, meta, err := DecodeWithMetadata(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := time.Date(2023, 12, 31, 23, 59, 58, 0, time.FixedZone("", 2*3600))
+	if !meta.DateTimeOriginal.Equal(w) {
+		t.Errorf("got original date %v, want %v", meta.DateTimeOriginal, w)
+	}
+	if _, off := meta.DateTimeOriginal.Zone(); off != 2*3600 {
+		t.Errorf("got a zone offset of %ds, want 7200", off)
+	}
+}
+
+func TestDecodeWithMetadataThumbnail(t *testing.T) {
+	// The Exif segment of a thumbnail is little-endian.
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(64, 48, 1), &Options{Thumbnail: 32}); err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := DecodeWithMetadata(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Exif == nil || meta.Orientation != 1 || !meta.DateTime.IsZero() {
+		t.Errorf("got %d bytes of Exif data, orientation %d and date %v, want orientation 1 and no date", len(meta.Exif), meta.Orientation, meta.DateTime)
+	}
+}
+
+func TestDecodeWithMetadataMalformed(t *testing.T) {
+	src := testimg.Photo(16, 16, 1)
+	for _, tiff := range [][]byte{
+		[]byte("MM\x00\x2a\xff\xff\xff\xff"),
+		[]byte("II\x2a\x00\x08\x00\x00\x00\xff\xff"),
+		[]byte("XX"),
+		bigEndianExif()[:60],
+	} {
+		data := encodeWithSegment(t, src, app1Marker, append([]byte("Exif\x00\x00"), tiff...))
+		m, meta, err := DecodeWithMetadata(bytes.NewReader(data))
+		if err != nil || m == nil {
+			t.Fatalf("%q: %v", tiff, err)
+		}
+		if !bytes.Equal(meta.Exif, tiff) {
+			t.Errorf("%q: got Exif data %q", tiff, meta.Exif)
+		}
+	}
+
+	// An image without Exif data has none.
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := DecodeWithMetadata(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Exif != nil || meta.Orientation != 0 {
+		t.Errorf("got %d bytes of Exif data and orientation %d, want none", len(meta.Exif), meta.Orientation)
+	}
+}
@@ -0,0 +1,101 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+)
+
+// ErrNoThumbnail is returned by [DecodeExifThumbnail] for images whose Exif
+// data has no JPEG thumbnail.
+var ErrNoThumbnail = errors.New("jpeg: no Exif thumbnail")
+
+// Exif tags of the JPEG thumbnail in IFD1.
+const (
+	exifTagThumbnailOffset = 0x0201 // JPEGInterchangeFormat.
+	exifTagThumbnailLength = 0x0202 // JPEGInterchangeFormatLength.
+)
+
+// DecodeExifThumbnail reads the JPEG image in r up to its first scan and
+// returns the JPEG thumbnail of the IFD1 of its Exif segment, decoded, such
+// as the preview that cameras and Options.Thumbnail embed. It reads none of
+// the image's scan data, which makes it the fastest preview of camera
+// files. It returns [ErrNoThumbnail] if the image has no Exif thumbnail.
+func DecodeExifThumbnail(r io.Reader) (image.Image, error) {
+	tiff, err := readExifSegment(r)
+	if err != nil {
+		return nil, err
+	}
+	thumb := ifd1Thumbnail(tiff)
+	if thumb == nil {
+		return nil, ErrNoThumbnail
+	}
+	return Decode(bytes.NewReader(thumb))
+}
+
+// readExifSegment returns the TIFF structure of the first APP1 Exif segment
+// of the JPEG image in r, or nil if there is none before the first scan.
+func readExifSegment(r io.Reader) ([]byte, error) {
+	s := newMarkerScanner(r)
+	if err := s.readSOI(); err != nil {
+		return nil, err
+	}
+	for {
+		marker, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case marker == eoiMarker || marker == sosMarker:
+			return nil, nil
+		case !hasLength(marker):
+			continue
+		}
+		n, err := s.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if marker != app1Marker || n < len(exifID) {
+			if err := s.skip(n); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p := make([]byte, n)
+		if err := s.readFull(p); err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(p, exifID) {
+			return p[len(exifID):], nil
+		}
+	}
+}
+
+// ifd1Thumbnail returns the JPEG thumbnail of the IFD1 of the TIFF
+// structure tiff, or nil if it has none or if it does not fit.
+func ifd1Thumbnail(tiff []byte) []byte {
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return nil
+	}
+	// The offset of IFD1 follows the entries of IFD0.
+	ifd0, ok := readIFD(tiff, order, order.Uint32(tiff[4:]))
+	if !ok {
+		return nil
+	}
+	next := uint64(order.Uint32(tiff[4:])) + 2 + uint64(len(ifd0.entries))
+	if next+4 > uint64(len(tiff)) {
+		return nil
+	}
+	ifd1, ok := readIFD(tiff, order, order.Uint32(tiff[next:]))
+	if !ok {
+		return nil
+	}
+	off, ok1 := ifd1.uint(exifTagThumbnailOffset)
+	n, ok2 := ifd1.uint(exifTagThumbnailLength)
+	if !ok1 || !ok2 || n == 0 || uint64(off)+uint64(n) > uint64(len(tiff)) {
+		return nil
+	}
+	return tiff[off : off+n]
+}
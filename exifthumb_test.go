@@ -0,0 +1,46 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeExifThumbnail(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(300, 200, 1), &Options{Quality: 75, Progressive: true, Thumbnail: 160}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	want, err := Decode(bytes.NewReader(exifThumbnail(t, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing after the Exif segment, which follows the SOI marker, is
+	// read.
+	end := 4 + int(binary.BigEndian.Uint16(data[4:]))
+	got, err := DecodeExifThumbnail(bytes.NewReader(data[:end]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(got, want) {
+		t.Error("the thumbnail differs from that of the Exif segment")
+	}
+
+	// Images without Exif data, and Exif data without IFD1, have no
+	// thumbnail.
+	buf.Reset()
+	if err := Encode(&buf, testimg.Photo(32, 32, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{
+		buf.Bytes(),
+		encodeWithSegment(t, testimg.Photo(32, 32, 1), app1Marker, append([]byte("Exif\x00\x00"), bigEndianExif()...)),
+	} {
+		if m, err := DecodeExifThumbnail(bytes.NewReader(data)); err != ErrNoThumbnail {
+			t.Errorf("got %T and error %v, want ErrNoThumbnail", m, err)
+		}
+	}
+}
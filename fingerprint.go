@@ -0,0 +1,241 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+)
+
+// Encoder families recognized by [IdentifyEncoder].
+const (
+	// EncoderLibjpeg is the IJG libjpeg and its derivatives, such as
+	// libjpeg-turbo, ImageMagick, Go's image/jpeg and this package, which
+	// scale the tables of Annex K of the JPEG standard by a quality from 1
+	// to 100.
+	EncoderLibjpeg = "libjpeg"
+	// EncoderMozjpeg is mozjpeg, which scales the tables of N. Robidoux
+	// for ImageMagick in the same way.
+	EncoderMozjpeg = "mozjpeg"
+	// EncoderPhotoshopWeb is the "Save for Web" export of Adobe Photoshop,
+	// recognized by its APP12 "Ducky" segment, which holds its quality
+	// from 0 to 100.
+	EncoderPhotoshopWeb = "photoshop-save-for-web"
+	// EncoderPhotoshop is the "Save As" of Adobe Photoshop, recognized by
+	// its APP13 "Photoshop 3.0" segment. Its quality, from 0 to 12, cannot
+	// be told.
+	EncoderPhotoshop = "photoshop"
+)
+
+// An EncoderMatch is the result of [IdentifyEncoder].
+type EncoderMatch struct {
+	// Encoder is the family of the encoder that most likely wrote the
+	// file, one of the Encoder constants, or "" if it is unknown.
+	Encoder string
+	// Quality is the quality setting of Encoder, on its own scale, or -1
+	// if it cannot be told.
+	Quality int
+	// Exact reports whether the quantization tables are exactly those of
+	// Encoder at Quality. Photoshop's tables do not follow a formula, so
+	// they are only recognized by their metadata segments, which other
+	// programs may copy, and Exact is false.
+	Exact bool
+	// EquivalentQuality is the libjpeg quality whose tables are the
+	// closest to those of the file, an estimate of the quality of any
+	// encoder on a common scale, and Distance is the mean relative
+	// difference between the steps of those tables and of the file's, 0
+	// if they are the same.
+	EquivalentQuality int
+	Distance          float64
+}
+
+// robidouxQuant is the quantization table of N. Robidoux, which mozjpeg
+// uses for both luminance and chrominance, in natural order.
+var robidouxQuant = [blockSize]int{
+	16, 16, 16, 18, 25, 37, 56, 85,
+	16, 17, 20, 27, 34, 40, 53, 75,
+	16, 20, 24, 31, 43, 62, 91, 135,
+	18, 27, 31, 40, 53, 74, 106, 156,
+	25, 34, 43, 53, 69, 94, 131, 189,
+	37, 40, 62, 74, 94, 124, 169, 238,
+	56, 53, 91, 106, 131, 169, 226, 311,
+	85, 75, 135, 156, 189, 238, 311, 418,
+}
+
+// duckyID is the identifier of the APP12 segment of Photoshop's "Save for
+// Web", and photoshopID that of the APP13 segment of its "Save As".
+var (
+	duckyID     = []byte("Ducky")
+	photoshopID = []byte("Photoshop 3.0\x00")
+)
+
+// IdentifyEncoder reads the JPEG file in r up to its first scan and guesses
+// which encoder wrote it, and with which quality, from its quantization
+// tables and metadata segments, to audit the sources of the images of a
+// pipeline. The tables of the first two components, luminance and
+// chrominance, are compared with those of libjpeg and mozjpeg at every
+// quality, and an exact match wins over the metadata, which survives the
+// re-encoding of an image by programs that copy it.
+func IdentifyEncoder(r io.Reader) (EncoderMatch, error) {
+	m := EncoderMatch{Quality: -1}
+	s := newMarkerScanner(r)
+	if err := s.readSOI(); err != nil {
+		return m, err
+	}
+	var (
+		tables    [maxTq + 1]*QuantTableInfo
+		frame     *FrameInfo
+		ducky     = -1
+		photoshop bool
+	)
+segments:
+	for {
+		marker, err := s.next()
+		if err != nil {
+			return m, err
+		}
+		if marker == eoiMarker {
+			return m, FormatError("missing SOS marker")
+		}
+		if !hasLength(marker) {
+			continue
+		}
+		n, err := s.readLength()
+		if err != nil {
+			return m, err
+		}
+		if marker == sosMarker {
+			break segments
+		}
+		if !isSOF(marker) && marker != dqtMarker && marker != app12Marker && marker != app13Marker {
+			if err := s.skip(n); err != nil {
+				return m, err
+			}
+			continue
+		}
+		p := make([]byte, n)
+		if err := s.readFull(p); err != nil {
+			return m, err
+		}
+		switch {
+		case isSOF(marker):
+			fi, err := parseFrame(marker, p)
+			if err != nil {
+				return m, err
+			}
+			frame = &fi
+		case marker == dqtMarker:
+			dqt, err := parseDQT(p)
+			if err != nil {
+				return m, err
+			}
+			for _, t := range dqt {
+				if t.Index <= maxTq {
+					tables[t.Index] = &t
+				}
+			}
+		case marker == app12Marker:
+			if q, ok := duckyQuality(p); ok {
+				ducky = q
+			}
+		case marker == app13Marker:
+			photoshop = photoshop || bytes.HasPrefix(p, photoshopID)
+		}
+	}
+	if frame == nil {
+		return m, FormatError("missing SOF marker")
+	}
+
+	// steps are the tables of the luminance and chrominance components, and
+	// limit the largest step that they can hold.
+	var steps []*QuantTableInfo
+	limit := 255
+	for i, c := range frame.Components[:min(len(frame.Components), 2)] {
+		if c.Tq > maxTq || tables[c.Tq] == nil {
+			return m, FormatError("undefined quantization table")
+		}
+		t := tables[c.Tq]
+		if i == 1 && len(frame.Components) != 3 {
+			break
+		}
+		steps = append(steps, t)
+		if t.Precision == 16 {
+			limit = 32767
+		}
+	}
+	var robidoux [blockSize]int
+	for i := range robidoux {
+		robidoux[i] = robidouxQuant[unzig[i]]
+	}
+	var annexK [nQuantIndex][blockSize]int
+	for i := range annexK {
+		for j := range annexK[i] {
+			annexK[i][j] = int(unscaledQuant[i][j])
+		}
+	}
+	m.Distance = -1
+	for q := 1; q <= 100; q++ {
+		var libjpeg, mozjpeg float64
+		for i, t := range steps {
+			libjpeg += quantDistance(t, &annexK[i], q, limit)
+			mozjpeg += quantDistance(t, &robidoux, q, limit)
+		}
+		libjpeg /= float64(len(steps))
+		if m.Distance < 0 || libjpeg < m.Distance {
+			m.EquivalentQuality, m.Distance = q, libjpeg
+		}
+		switch {
+		case libjpeg == 0 && !m.Exact:
+			m.Encoder, m.Quality, m.Exact = EncoderLibjpeg, q, true
+		case mozjpeg == 0 && !m.Exact:
+			m.Encoder, m.Quality, m.Exact = EncoderMozjpeg, q, true
+		}
+	}
+	switch {
+	case m.Exact:
+	case ducky >= 0:
+		m.Encoder, m.Quality = EncoderPhotoshopWeb, ducky
+	case photoshop:
+		m.Encoder = EncoderPhotoshop
+	}
+	return m, nil
+}
+
+// quantDistance returns the mean relative difference between the steps of
+// t and those of the table base, in zig-zag order, scaled for the quality
+// as libjpeg does, and clipped to limit.
+func quantDistance(t *QuantTableInfo, base *[blockSize]int, quality, limit int) float64 {
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var d float64
+	for i, v := range t.Values {
+		x := min(max((base[i]*scale+50)/100, 1), limit)
+		if diff := int(v) - x; diff != 0 {
+			d += float64(max(diff, -diff)) / float64(x)
+		}
+	}
+	return d / blockSize
+}
+
+// duckyQuality returns the quality of the payload p of an APP12 "Ducky"
+// segment, which is a list of tags, each made of a 16-bit identifier, a
+// 16-bit length and a value, up to a zero identifier. The quality is the
+// 32-bit value of the tag 1.
+func duckyQuality(p []byte) (int, bool) {
+	if !bytes.HasPrefix(p, duckyID) {
+		return 0, false
+	}
+	p = p[len(duckyID):]
+	for len(p) >= 4 {
+		id, n := int(p[0])<<8|int(p[1]), int(p[2])<<8|int(p[3])
+		p = p[4:]
+		if id == 0 || len(p) < n {
+			break
+		}
+		if id == 1 && n == 4 {
+			return int(p[0])<<24 | int(p[1])<<16 | int(p[2])<<8 | int(p[3]), true
+		}
+		p = p[n:]
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// scaledTables returns the tables of natural-order base, for luminance and
+// chrominance, scaled for the quality as libjpeg does, in zig-zag order.
+func scaledTables(base *[blockSize]int, quality int) [][blockSize]uint8 {
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var t [blockSize]uint8
+	for i := range t {
+		t[i] = uint8(min(max((base[unzig[i]]*scale+50)/100, 1), 255))
+	}
+	return [][blockSize]uint8{t, t}
+}
+
+func TestIdentifyEncoder(t *testing.T) {
+	src := testimg.Photo(40, 24, 1)
+	for _, q := range []int{1, 10, 50, 75, 90, 100} {
+		for _, gray := range []bool{false, true} {
+			var data bytes.Buffer
+			if err := Encode(&data, src, &Options{Quality: q, Grayscale: gray}); err != nil {
+				t.Fatal(err)
+			}
+			m, err := IdentifyEncoder(bytes.NewReader(data.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := EncoderMatch{Encoder: EncoderLibjpeg, Quality: q, Exact: true, EquivalentQuality: q}
+			if m != want {
+				t.Errorf("quality %d, gray %t: got %+v, want %+v", q, gray, m, want)
+			}
+		}
+	}
+
+	// Like mozjpeg at quality 80.
+	var data bytes.Buffer
+	o := &Options{QuantTables: scaledTables(&robidouxQuant, 80)}
+	if err := Encode(&data, src, o); err != nil {
+		t.Fatal(err)
+	}
+	m, err := IdentifyEncoder(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Encoder != EncoderMozjpeg || m.Quality != 80 || !m.Exact || m.Distance == 0 {
+		t.Errorf("mozjpeg: got %+v", m)
+	}
+
+	// Tables of neither library, with and without Photoshop's segments.
+	var odd [blockSize]int
+	for i := range odd {
+		odd[i] = 3 + i/2
+	}
+	o = &Options{QuantTables: scaledTables(&odd, 50)}
+	ducky := append([]byte("Ducky\x00\x01\x00\x04\x00\x00\x00\x3c"), 0, 0)
+	for _, tc := range []struct {
+		name    string
+		marker  byte
+		segment []byte
+		want    string
+		quality int
+	}{
+		{"unknown", comMarker, []byte("hello"), "", -1},
+		{"save for web", app12Marker, ducky, EncoderPhotoshopWeb, 60},
+		{"save as", app13Marker, []byte("Photoshop 3.0\x008BIM"), EncoderPhotoshop, -1},
+	} {
+		data := encodeWithOptionsAndSegment(t, src, o, tc.marker, tc.segment)
+		m, err := IdentifyEncoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Encoder != tc.want || m.Quality != tc.quality || m.Exact {
+			t.Errorf("%s: got %+v", tc.name, m)
+		}
+		if m.Distance == 0 || m.EquivalentQuality < 80 {
+			t.Errorf("%s: equivalent quality %d, distance %g", tc.name, m.EquivalentQuality, m.Distance)
+		}
+	}
+
+	if _, err := IdentifyEncoder(bytes.NewReader([]byte("not a jpeg"))); err == nil {
+		t.Error("no error for a non-JPEG input")
+	}
+}
+
+func TestIdentifyEncoderBadTq(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(16, 16, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	sof := bytes.Index(data, []byte{0xff, sof0Marker})
+	// The Tq of the first component follows the marker, the length, the
+	// precision, the size, the number of components, the component ID and
+	// its sampling factors.
+	data[sof+12] = 236
+	if _, err := IdentifyEncoder(bytes.NewReader(data)); err == nil {
+		t.Error("no error for an undefined quantization table")
+	}
+}
@@ -0,0 +1,34 @@
+package progjpeg
+
+import (
+	"errors"
+	"io"
+)
+
+// TranscodeGrayscale reads the YCbCr or grayscale JPEG image in r and
+// writes it to w as a grayscale image, as jpegtran -grayscale does: the
+// chroma components are dropped, and the luma coefficients are copied as
+// they are, so the result is exactly the luma of the original, in a
+// smaller file. It is baseline or progressive like the original, and
+// keeps its APPn and COM segments but the ICC profile, which describes
+// color. RGB and CMYK images have no luma component, and are rejected.
+func TranscodeGrayscale(w io.Writer, r io.Reader) error {
+	return transcode(w, r, nil, func(t *transcoding) error {
+		return t.grayscale()
+	})
+}
+
+// grayscale drops the chroma planes of t.
+func (t *transcoding) grayscale() error {
+	if n := len(t.planes); n != 1 && (n != 3 || t.d.isRGB()) {
+		return errors.New("jpeg: only YCbCr and grayscale images can be converted to grayscale")
+	}
+	// A single-component frame has no sampling factors, and a single
+	// table.
+	y := t.planes[0]
+	t.meta.QuantTables = t.meta.QuantTables[y.Table : y.Table+1]
+	y.H, y.V, y.Table = 1, 1, 0
+	t.planes = []CoefficientPlane{y}
+	t.keepMetadata(MetadataAll &^ MetadataICC)
+	return nil
+}
@@ -0,0 +1,70 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestTranscodeGrayscale(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, o := range []*Options{
+		{Quality: 75, ICCProfile: []byte("not really a profile")},
+		{Quality: 75, Progressive: true},
+		{Quality: 75, Grayscale: true},
+	} {
+		var data bytes.Buffer
+		if err := Encode(&data, src, o); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := TranscodeGrayscale(&buf, bytes.NewReader(data.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if !o.Grayscale && buf.Len() >= data.Len() {
+			t.Errorf("got %d bytes, want fewer than %d", buf.Len(), data.Len())
+		}
+		m, err := Decode(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, meta, err := DecodeWithMetadata(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, ok := got.(*image.Gray)
+		if !ok {
+			t.Fatalf("got a %T, want an *image.Gray", got)
+		}
+		// The luma of the original, unchanged.
+		var want []byte
+		var stride int
+		switch m := m.(type) {
+		case *image.YCbCr:
+			want, stride = m.Y, m.YStride
+		case *image.Gray:
+			want, stride = m.Pix, m.Stride
+		}
+		for y := 0; y < 47; y++ {
+			if !bytes.Equal(g.Pix[y*g.Stride:y*g.Stride+83], want[y*stride:y*stride+83]) {
+				t.Fatalf("row %d differs from the luma of the original", y)
+			}
+		}
+		if meta.ICC != nil {
+			t.Error("the ICC profile was kept")
+		}
+		if p, err := Probe(bytes.NewReader(buf.Bytes())); err != nil || p.Progressive != o.Progressive {
+			t.Errorf("progressive is %v, want %v (%v)", p.Progressive, o.Progressive, err)
+		}
+	}
+
+	var rgb bytes.Buffer
+	if err := Encode(&rgb, src, &Options{Quality: 75, RGB: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := TranscodeGrayscale(new(bytes.Buffer), bytes.NewReader(rgb.Bytes())); err == nil {
+		t.Error("converting an RGB image did not fail")
+	}
+}
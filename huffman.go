@@ -131,46 +131,73 @@ func (d *decoder) processDHT(n int) error {
 		if err := d.readFull(h.vals[:h.nCodes]); err != nil {
 			return err
 		}
+		h.derive(&nCodes)
+	}
+	return nil
+}
 
-		// Derive the look-up table.
-		clear(h.lut[:])
-		var x, code uint32
-		for i := uint32(0); i < lutSize; i++ {
-			code <<= 1
-			for j := int32(0); j < nCodes[i]; j++ {
-				// The codeLength is 1+i, so shift code by 8-(1+i) to
-				// calculate the high bits for every 8-bit sequence
-				// whose codeLength's high bits matches code.
-				// The high 8 bits of lutValue are the encoded value.
-				// The low 8 bits are 1 plus the codeLength.
-				base := uint8(code << (7 - i))
-				lutValue := uint16(h.vals[x])<<8 | uint16(2+i)
-				for k := uint8(0); k < 1<<(7-i); k++ {
-					h.lut[base|k] = lutValue
-				}
-				code++
-				x++
+// derive initializes the look-up tables of h from the number of codes of
+// each length, nCodes, and from h.vals.
+func (h *huffman) derive(nCodes *[maxCodeLength]int32) {
+	// Derive the look-up table.
+	clear(h.lut[:])
+	var x, code uint32
+	for i := uint32(0); i < lutSize; i++ {
+		code <<= 1
+		for j := int32(0); j < nCodes[i]; j++ {
+			// The codeLength is 1+i, so shift code by 8-(1+i) to
+			// calculate the high bits for every 8-bit sequence
+			// whose codeLength's high bits matches code.
+			// The high 8 bits of lutValue are the encoded value.
+			// The low 8 bits are 1 plus the codeLength.
+			base := uint8(code << (7 - i))
+			lutValue := uint16(h.vals[x])<<8 | uint16(2+i)
+			for k := uint8(0); k < 1<<(7-i); k++ {
+				h.lut[base|k] = lutValue
 			}
+			code++
+			x++
 		}
+	}
 
-		// Derive minCodes, maxCodes, and valsIndices.
-		var c, index int32
-		for i, n := range nCodes {
-			if n == 0 {
-				h.minCodes[i] = -1
-				h.maxCodes[i] = -1
-				h.valsIndices[i] = -1
-			} else {
-				h.minCodes[i] = c
-				h.maxCodes[i] = c + n - 1
-				h.valsIndices[i] = index
-				c += n
-				index += n
-			}
-			c <<= 1
+	// Derive minCodes, maxCodes, and valsIndices.
+	var c, index int32
+	for i, n := range nCodes {
+		if n == 0 {
+			h.minCodes[i] = -1
+			h.maxCodes[i] = -1
+			h.valsIndices[i] = -1
+		} else {
+			h.minCodes[i] = c
+			h.maxCodes[i] = c + n - 1
+			h.valsIndices[i] = index
+			c += n
+			index += n
 		}
+		c <<= 1
+	}
+}
+
+// loadDefaultHuffmanTables sets the tables of destinations 0 and 1 that no
+// DHT segment has defined to the tables of section K.3 of the spec, which
+// Motion JPEG frames, such as those of AVI1 streams and of many webcams,
+// imply rather than store.
+func (d *decoder) loadDefaultHuffmanTables() {
+	for i, spec := range theHuffmanSpec {
+		// theHuffmanSpec holds the luminance DC and AC tables, then the
+		// chrominance ones.
+		h := &d.huff[i%2][i/2]
+		if h.nCodes != 0 {
+			continue
+		}
+		var nCodes [maxCodeLength]int32
+		for j, n := range spec.count {
+			nCodes[j] = int32(n)
+			h.nCodes += nCodes[j]
+		}
+		copy(h.vals[:], spec.value)
+		h.derive(&nCodes)
 	}
-	return nil
 }
 
 // decodeHuffman returns the next Huffman-coded value from the bit-stream,
@@ -0,0 +1,84 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+)
+
+// iccChunkSize is the largest part of an ICC profile that an APP2 segment
+// holds, after its identifier and its sequence number and count.
+const iccChunkSize = 0xffff - 2 - 12 - 2
+
+// writeICC writes the ICC profile as a sequence of APP2 "ICC_PROFILE"
+// segments, as specified in section B.4 of the ICC specification. A
+// profile needs one segment every iccChunkSize bytes, 255 at most.
+func (e *encoder) writeICC(profile []byte) {
+	n := (len(profile) + iccChunkSize - 1) / iccChunkSize
+	if n > 255 {
+		if e.err == nil {
+			e.err = errors.New("jpeg: ICC profile is too large")
+		}
+		return
+	}
+	for i := 0; i < n; i++ {
+		chunk := profile[i*iccChunkSize : min((i+1)*iccChunkSize, len(profile))]
+		e.writeMarkerHeader(app2Marker, 2+len(iccID)+2+len(chunk))
+		e.write(iccID)
+		e.writeByte(byte(i + 1))
+		e.writeByte(byte(n))
+		e.write(chunk)
+	}
+}
+
+// processApp2Marker reads an APP2 segment, which holds a chunk of an ICC
+// profile if it starts with iccID, or the Multi-Picture Format index if it
+// starts with mpfID. The segment is ignored unless d.meta is set.
+func (d *decoder) processApp2Marker(n int) error {
+	if d.meta == nil || n < len(iccID)+2 {
+		return d.ignore(n)
+	}
+	p := make([]byte, n)
+	if err := d.readFull(p); err != nil {
+		return err
+	}
+	if bytes.HasPrefix(p, mpfID) {
+		if d.meta.Images == nil {
+			// The offsets of the images are relative to the MP header, which
+			// follows mpfID.
+			parseMPF(d.meta, p[len(mpfID):], d.offset()-int64(n)+int64(len(mpfID)))
+		}
+		return nil
+	}
+	if !bytes.HasPrefix(p, iccID) {
+		return nil
+	}
+	// The chunks are numbered from 1, and all of them give their count.
+	seq, count := int(p[len(iccID)]), int(p[len(iccID)+1])
+	if d.icc == nil && count > 0 {
+		d.icc = make([][]byte, count)
+	}
+	if 1 <= seq && seq <= len(d.icc) && count == len(d.icc) && d.icc[seq-1] == nil {
+		d.icc[seq-1] = p[len(iccID)+2:]
+	}
+	return nil
+}
+
+// iccProfile returns the ICC profile reassembled from the chunks of
+// d.icc, or nil if there are none or if some are missing.
+func (d *decoder) iccProfile() []byte {
+	if len(d.icc) == 0 {
+		return nil
+	}
+	size := 0
+	for _, c := range d.icc {
+		if c == nil {
+			return nil
+		}
+		size += len(c)
+	}
+	profile := make([]byte, 0, size)
+	for _, c := range d.icc {
+		profile = append(profile, c...)
+	}
+	return profile
+}
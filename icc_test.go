@@ -0,0 +1,102 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// testProfile returns n bytes standing for an ICC profile.
+func testProfile(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i * 7)
+	}
+	return p
+}
+
+func TestICCProfile(t *testing.T) {
+	m := testimg.Photo(48, 32, 1)
+	for _, n := range []int{1, 3144, iccChunkSize, iccChunkSize + 1, 3*iccChunkSize + 100} {
+		profile := testProfile(n)
+		for _, o := range []*Options{
+			{ICCProfile: profile},
+			{ICCProfile: profile, Progressive: true},
+		} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, m, o); err != nil {
+				t.Fatal(err)
+			}
+			want := (n + iccChunkSize - 1) / iccChunkSize
+			if got := bytes.Count(buf.Bytes(), iccID); got != want {
+				t.Errorf("%d bytes: got %d ICC_PROFILE segments, want %d", n, got, want)
+			}
+			info, err := Probe(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.HasICC {
+				t.Errorf("%d bytes: Probe finds no ICC profile", n)
+			}
+			_, meta, err := DecodeWithMetadata(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(meta.ICC, profile) {
+				t.Errorf("%d bytes, progressive %t: got a profile of %d bytes", n, o.Progressive, len(meta.ICC))
+			}
+		}
+	}
+}
+
+func TestICCProfileChunks(t *testing.T) {
+	m := testimg.Photo(16, 16, 1)
+	chunk := func(seq, count byte, data string) []byte {
+		return append(append(bytes.Clone(iccID), seq, count), data...)
+	}
+	for _, tc := range []struct {
+		chunks [][]byte
+		want   []byte
+	}{
+		// The chunks may be in any order.
+		{[][]byte{chunk(2, 3, "cd"), chunk(1, 3, "ab"), chunk(3, 3, "e")}, []byte("abcde")},
+		// A missing chunk discards the profile.
+		{[][]byte{chunk(1, 3, "ab"), chunk(3, 3, "e")}, nil},
+		// So does an inconsistent count.
+		{[][]byte{chunk(1, 2, "ab"), chunk(2, 3, "cd")}, nil},
+		// A repeated chunk is ignored.
+		{[][]byte{chunk(1, 2, "ab"), chunk(1, 2, "xy"), chunk(2, 2, "cd")}, []byte("abcd")},
+	} {
+		var buf bytes.Buffer
+		mw, err := NewMarkerWriter(&buf, m, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mw.WriteSOI()
+		for _, c := range tc.chunks {
+			mw.WriteSegment(app2Marker, c)
+		}
+		mw.WriteDQT()
+		mw.WriteSOF()
+		mw.WriteDHT()
+		mw.WriteScan(ProgressiveScan{Component: -1, SpectralEnd: blockSize - 1})
+		if err := mw.WriteEOI(); err != nil {
+			t.Fatal(err)
+		}
+		_, meta, err := DecodeWithMetadata(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(meta.ICC, tc.want) {
+			t.Errorf("%q: got profile %q, want %q", tc.chunks, meta.ICC, tc.want)
+		}
+	}
+}
+
+func TestICCProfileTooLarge(t *testing.T) {
+	err := Encode(&bytes.Buffer{}, testimg.Photo(16, 16, 1), &Options{ICCProfile: testProfile(255*iccChunkSize + 1)})
+	if err == nil {
+		t.Error("got no error for a profile of more than 255 segments")
+	}
+}
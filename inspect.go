@@ -0,0 +1,93 @@
+package progjpeg
+
+import "io"
+
+// ComponentInfo describes one component of a JPEG frame, as declared in its
+// SOF segment.
+type ComponentInfo struct {
+	// ID is the component identifier, such as 1, 2 and 3 for the Y, Cb and
+	// Cr components of a JFIF image.
+	ID int
+	// H and V are the horizontal and vertical sampling factors.
+	H, V int
+	// Tq is the index of the component's quantization table.
+	Tq int
+}
+
+// FrameInfo is the result of [Inspect].
+type FrameInfo struct {
+	// Width and Height are the image dimensions, and Precision is the sample
+	// precision in bits.
+	Width, Height, Precision int
+	// Progressive reports whether the image is a progressive JPEG.
+	Progressive bool
+	// Components lists the frame's components, in SOF order.
+	Components []ComponentInfo
+}
+
+// Inspect reads the JPEG image in r up to its SOF segment and reports the
+// frame's parameters, including the metadata of every component. Unlike
+// [DecodeConfig], it accepts any number of components and any SOF type, even
+// those that [Decode] does not support.
+func Inspect(r io.Reader) (FrameInfo, error) {
+	var fi FrameInfo
+	s := newMarkerScanner(r)
+	if err := s.readSOI(); err != nil {
+		return fi, err
+	}
+	for {
+		marker, err := s.next()
+		if err != nil {
+			return fi, err
+		}
+		switch {
+		case marker == eoiMarker:
+			return fi, FormatError("missing SOF marker")
+		case !hasLength(marker):
+			continue
+		}
+		n, err := s.readLength()
+		if err != nil {
+			return fi, err
+		}
+		if !isSOF(marker) {
+			if err := s.skip(n); err != nil {
+				return fi, err
+			}
+			continue
+		}
+		p := make([]byte, n)
+		if err := s.readFull(p); err != nil {
+			return fi, err
+		}
+		return parseFrame(marker, p)
+	}
+}
+
+// parseFrame parses the payload p of the SOFn segment of the given marker.
+func parseFrame(marker byte, p []byte) (FrameInfo, error) {
+	var fi FrameInfo
+	if len(p) < 6 {
+		return fi, FormatError("SOF has wrong length")
+	}
+	fi.Precision = int(p[0])
+	fi.Height = int(p[1])<<8 + int(p[2])
+	fi.Width = int(p[3])<<8 + int(p[4])
+	fi.Progressive = marker == sof2Marker || marker == sof6Marker ||
+		marker == sof10Marker || marker == sof14Marker
+	nComp := int(p[5])
+	if len(p) != 6+3*nComp {
+		return fi, FormatError("SOF has wrong length")
+	}
+	fi.Components = make([]ComponentInfo, nComp)
+	for i := range fi.Components {
+		b := p[6+3*i:]
+		fi.Components[i] = ComponentInfo{
+			ID: int(b[0]),
+			H:  int(b[1] >> 4),
+			V:  int(b[1] & 0x0f),
+			Tq: int(b[2]),
+		}
+	}
+	return fi, nil
+}
@@ -0,0 +1,70 @@
+package progjpeg
+
+import (
+	"image"
+	"io"
+)
+
+// DecodeInto reads a JPEG image from r, as [Decode] does, and stores it in
+// dst if dst can hold it, which avoids allocating a new image for every
+// frame of a video or every file of a thumbnailing loop. dst can hold
+// grayscale images if it is an *image.Gray, and YCbCr images if it is an
+// *image.YCbCr of the same subsampling ratio, as long as its bounds are
+// those of the image, with their top-left corner at the origin. Other
+// images, including a nil dst, are decoded into a new image, as [Decode]
+// would return it.
+//
+// DecodeInto returns the image it decoded into, so that it can be given
+// back on the next call:
+//
+//	m, err = progjpeg.DecodeInto(r, m)
+//
+// If the data ends in the middle of the image, the pixels of dst that were
+// not decoded keep their previous values.
+func DecodeInto(r io.Reader, dst image.Image) (image.Image, error) {
+	d := decoder{into: dst}
+	return d.decode(r, false)
+}
+
+// DecodeInto is [DecodeInto] for a Decoder, which also reuses its buffers.
+func (dec *Decoder) DecodeInto(r io.Reader, dst image.Image) (image.Image, error) {
+	dec.d.into = dst
+	return dec.Decode(r)
+}
+
+// intoGray returns d.into if the grayscale image b can be decoded into it.
+func (d *decoder) intoGray(b image.Rectangle) *image.Gray {
+	m, ok := d.into.(*image.Gray)
+	if !ok || !d.canDecodeInto(m.Rect, b) || !planeFits(m.Pix, m.Stride, b.Dx(), b.Dy()) {
+		return nil
+	}
+	return m
+}
+
+// intoYCbCr returns d.into if the YCbCr image b, of the given subsampling
+// ratio, can be decoded into it.
+func (d *decoder) intoYCbCr(b image.Rectangle, ratio image.YCbCrSubsampleRatio) *image.YCbCr {
+	m, ok := d.into.(*image.YCbCr)
+	if !ok || m.SubsampleRatio != ratio || !d.canDecodeInto(m.Rect, b) {
+		return nil
+	}
+	fx, fy := subsampleFactors(ratio)
+	cw, ch := (b.Dx()+fx-1)/fx, (b.Dy()+fy-1)/fy
+	if !planeFits(m.Y, m.YStride, b.Dx(), b.Dy()) || !planeFits(m.Cb, m.CStride, cw, ch) || !planeFits(m.Cr, m.CStride, cw, ch) {
+		return nil
+	}
+	return m
+}
+
+// canDecodeInto reports whether the image b can be decoded into an image of
+// bounds r. Images that are converted after decoding, such as RGB or CMYK
+// ones, or upsampled, are not decoded into d.into, and neither are regions.
+func (d *decoder) canDecodeInto(r, b image.Rectangle) bool {
+	return r == b && b == image.Rect(0, 0, d.width, d.height) && d.upsampler == nil
+}
+
+// planeFits reports whether the plane pix, of the given stride, holds w by
+// h pixels.
+func planeFits(pix []byte, stride, w, h int) bool {
+	return w <= stride && (h-1)*stride+w <= len(pix)
+}
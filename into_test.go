@@ -0,0 +1,122 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeInto(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m    image.Image
+		o    *Options
+		dst  image.Image
+	}{
+		{"4:2:0", testimg.Photo(64, 48, 1), nil, image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)},
+		{"4:2:0 odd", testimg.Photo(61, 37, 1), nil, image.NewYCbCr(image.Rect(0, 0, 61, 37), image.YCbCrSubsampleRatio420)},
+		{"4:2:0 progressive", testimg.Photo(61, 37, 1), &Options{Progressive: true}, image.NewYCbCr(image.Rect(0, 0, 61, 37), image.YCbCrSubsampleRatio420)},
+		{"4:2:2", toYCbCr422(testimg.Photo(45, 30, 2)), nil, image.NewYCbCr(image.Rect(0, 0, 45, 30), image.YCbCrSubsampleRatio422)},
+		{"gray", testimg.Photo(45, 30, 3), &Options{Grayscale: true, Progressive: true}, image.NewGray(image.Rect(0, 0, 45, 30))},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeInto(bytes.NewReader(buf.Bytes()), tc.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.dst {
+			t.Errorf("%s: got a new %T, want dst", tc.name, got)
+		}
+		if !equalImages(got, want) {
+			t.Errorf("%s: the image differs from that of Decode", tc.name)
+		}
+		// The image returned by Decode can be reused too.
+		again, err := DecodeInto(bytes.NewReader(buf.Bytes()), want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != want || !equalImages(again, got) {
+			t.Errorf("%s: the image returned by Decode was not reused", tc.name)
+		}
+	}
+}
+
+func TestDecodeIntoMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(64, 48, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dst := range []image.Image{
+		nil,
+		image.NewYCbCr(image.Rect(0, 0, 48, 64), image.YCbCrSubsampleRatio420),
+		image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio422),
+		image.NewYCbCr(image.Rect(8, 8, 72, 56), image.YCbCrSubsampleRatio420),
+		image.NewGray(image.Rect(0, 0, 64, 48)),
+		image.NewRGBA(image.Rect(0, 0, 64, 48)),
+		&image.YCbCr{Rect: image.Rect(0, 0, 64, 48), SubsampleRatio: image.YCbCrSubsampleRatio420},
+	} {
+		got, err := DecodeInto(bytes.NewReader(buf.Bytes()), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dst != nil && got == dst {
+			t.Errorf("%T %v: got dst, want a new image", dst, dst.Bounds())
+		}
+		if !equalImages(got, want) {
+			t.Errorf("%T: the image differs from that of Decode", dst)
+		}
+	}
+
+	// RGB images are converted after decoding, so dst is not used.
+	buf.Reset()
+	if err := Encode(&buf, testimg.Photo(64, 48, 1), &Options{RGB: true}); err != nil {
+		t.Fatal(err)
+	}
+	dst := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio444)
+	got, err := DecodeInto(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*image.RGBA); !ok {
+		t.Errorf("got %T, want *image.RGBA", got)
+	}
+	if dst.Y[0] != 0 {
+		t.Error("dst was written to")
+	}
+}
+
+func TestDecoderDecodeIntoAllocs(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(128, 96, 1), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	var dec Decoder
+	m, err := dec.DecodeInto(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(data)
+		if _, err := dec.DecodeInto(r, m); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("got %v allocations per call, want 0", allocs)
+	}
+}
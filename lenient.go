@@ -0,0 +1,41 @@
+package progjpeg
+
+// ErrCorruptScan is the error returned with the image of a lenient decode,
+// as set by DecodeOptions.Lenient, if some of its scans could not be
+// decoded and were skipped.
+var ErrCorruptScan = FormatError("corrupt scans skipped")
+
+// backupCoefficients saves the coefficients of the components of the scan
+// about to be decoded, so that abandonScan can restore them. Only lenient
+// decodes of progressive images save them: the blocks of sequential images
+// are reconstructed as they are decoded.
+func (d *decoder) backupCoefficients(compIndex int) {
+	if !d.lenient || !d.progressive || d.progCoeffs[compIndex] == nil {
+		return
+	}
+	d.backup[compIndex] = append(d.backup[compIndex][:0], d.progCoeffs[compIndex]...)
+	d.scanComps = append(d.scanComps, compIndex)
+}
+
+// abandonScan reports whether the scan that failed with err can be skipped,
+// which is the case for the format errors of lenient decodes once the image
+// is allocated. If so, it restores the coefficients that the scan changed
+// and resets the decoder state, so that decoding resumes at the next
+// marker.
+func (d *decoder) abandonScan(err error) bool {
+	if _, ok := err.(FormatError); !ok || !d.lenient || d.img1 == nil && d.img3 == nil && d.imgN == nil {
+		return false
+	}
+	for _, i := range d.scanComps {
+		copy(d.progCoeffs[i], d.backup[i])
+	}
+	d.scanComps = d.scanComps[:0]
+	// The marker that ended the scan may have been read already.
+	if d.bytes.nUnreadable != 0 {
+		d.unreadByteStuffedByte()
+	}
+	d.bits = bits{}
+	d.eobRun = 0
+	d.corruptScans++
+	return true
+}
@@ -0,0 +1,93 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// scanFile returns the progressive encoding of a photo, and the offsets at
+// which each of its scans starts and ends. Past the tables, 0xff bytes are
+// followed by 0x00 or by a marker, so SOS markers are found by searching.
+func scanFile(t *testing.T) (data []byte, scans [][2]int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(96, 64, 1), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data = buf.Bytes()
+	sos := []byte{0xff, sosMarker}
+	for i := bytes.Index(data, sos); i >= 0; {
+		j := bytes.Index(data[i+2:], sos)
+		if j < 0 {
+			scans = append(scans, [2]int{i, len(data) - 2})
+			break
+		}
+		scans = append(scans, [2]int{i, i + 2 + j})
+		i += 2 + j
+	}
+	return data, scans
+}
+
+func TestDecodeLenient(t *testing.T) {
+	data, scans := scanFile(t)
+	for _, k := range []int{1, 3, len(scans) - 2} {
+		s := scans[k]
+		// Decoding the corrupt file skips the scan k, as if it were not
+		// there.
+		without := append(append([]byte(nil), data[:s[0]]...), data[s[1]:]...)
+		want, err := Decode(bytes.NewReader(without))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The entropy-coded data follows the SOS segment.
+		start := s[0] + 2 + int(data[s[0]+2])<<8 + int(data[s[0]+3])
+		mid := (start + s[1]) / 2
+		for name, corrupt := range map[string][]byte{
+			"cut":    append(append([]byte(nil), data[:mid]...), data[s[1]:]...),
+			"marker": append(append(append([]byte(nil), data[:mid]...), 0xff, 0xd5), data[mid+2:]...),
+		} {
+			m, err := DecodeWithOptions(bytes.NewReader(corrupt), &DecodeOptions{Lenient: true})
+			if err != ErrCorruptScan {
+				t.Errorf("scan %d, %s: got error %v, want ErrCorruptScan", k, name, err)
+				continue
+			}
+			if !equalImages(m, want) {
+				t.Errorf("scan %d, %s: the image differs from that of the file without the scan", k, name)
+			}
+			if _, err := Decode(bytes.NewReader(corrupt)); err == nil || err == ErrCorruptScan {
+				t.Errorf("scan %d, %s: got error %v without Lenient", k, name, err)
+			}
+		}
+	}
+
+	// Lenient decodes of valid files return no error.
+	m, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Decode(bytes.NewReader(data))
+	if !equalImages(m, want) {
+		t.Error("the image differs from that of Decode")
+	}
+}
+
+func TestDecodeLenientBaseline(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(96, 64, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// A corrupt scan followed by the EOI marker keeps the blocks decoded
+	// before the error.
+	mid := len(data) / 2
+	corrupt := append(append(append([]byte(nil), data[:mid]...), 0xff, 0xd5), data[mid+2:]...)
+	m, err := DecodeWithOptions(bytes.NewReader(corrupt), &DecodeOptions{Lenient: true})
+	if err != ErrCorruptScan || m == nil {
+		t.Fatalf("got image %v and error %v, want an image and ErrCorruptScan", m != nil, err)
+	}
+	if m.Bounds().Dx() != 96 || m.Bounds().Dy() != 64 {
+		t.Errorf("got bounds %v", m.Bounds())
+	}
+}
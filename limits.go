@@ -0,0 +1,45 @@
+package progjpeg
+
+// Errors returned when a decode exceeds the limits of its DecodeOptions.
+var (
+	errPixelLimit  = UnsupportedError("image exceeds the pixel limit")
+	errMemoryLimit = UnsupportedError("image exceeds the memory limit")
+	errScanLimit   = UnsupportedError("too many scans")
+)
+
+// checkLimits checks the frame header just read against d.maxPixels and
+// d.maxMemory, before any buffer of the image is allocated.
+func (d *decoder) checkLimits() error {
+	if d.maxPixels > 0 && int64(d.width)*int64(d.height) > d.maxPixels {
+		return errPixelLimit
+	}
+	if d.maxMemory > 0 && d.memoryNeeded() > d.maxMemory {
+		return errMemoryLimit
+	}
+	return nil
+}
+
+// memoryNeeded returns the approximate number of bytes that decoding the
+// frame allocates: the planes of its pixels, the coefficients of
+// progressive images, and the image that its pixels are converted to, if
+// any.
+func (d *decoder) memoryNeeded() int64 {
+	h0, v0 := d.comp[0].h, d.comp[0].v
+	mcus := int64((d.width+8*h0-1)/(8*h0)) * int64((d.height+8*v0-1)/(8*v0))
+	var blocks int64
+	for _, c := range d.comp[:d.nComp] {
+		blocks += mcus * int64(c.h*c.v)
+	}
+	n := blocks * blockSize
+	if d.progressive || d.coeffsOnly {
+		n += blocks * blockSize * 4
+	}
+	pixels := int64(d.width) * int64(d.height)
+	switch {
+	case d.nComp == 4 || d.nComp == 3 && d.isRGB():
+		n += 4 * pixels
+	case d.nComp == 3 && d.upsampler != nil:
+		n += 3 * pixels
+	}
+	return n
+}
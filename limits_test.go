@@ -0,0 +1,52 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	src := testimg.Photo(80, 56, 1)
+	var baseline, progressive bytes.Buffer
+	if err := Encode(&baseline, src, &Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&progressive, src, &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	scans, err := DecodeScans(bytes.NewReader(progressive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The 4:2:0 image has 20 MCUs of 6 blocks: its planes take 7680 bytes,
+	// and its coefficients 30720 more.
+	for _, tc := range []struct {
+		data []byte
+		o    DecodeOptions
+		err  error
+	}{
+		{baseline.Bytes(), DecodeOptions{MaxPixels: 80 * 56}, nil},
+		{baseline.Bytes(), DecodeOptions{MaxPixels: 80*56 - 1}, errPixelLimit},
+		{baseline.Bytes(), DecodeOptions{MaxMemory: 7680}, nil},
+		{baseline.Bytes(), DecodeOptions{MaxMemory: 7679}, errMemoryLimit},
+		{progressive.Bytes(), DecodeOptions{MaxMemory: 7680}, errMemoryLimit},
+		{progressive.Bytes(), DecodeOptions{MaxMemory: 7680 + 30720}, nil},
+		{progressive.Bytes(), DecodeOptions{ScanLimit: len(scans)}, nil},
+		{progressive.Bytes(), DecodeOptions{ScanLimit: len(scans) - 1}, errScanLimit},
+		{baseline.Bytes(), DecodeOptions{ScanLimit: 1}, nil},
+	} {
+		m, err := DecodeWithOptions(bytes.NewReader(tc.data), &tc.o)
+		if err != tc.err {
+			t.Errorf("%+v: got error %v, want %v", tc.o, err, tc.err)
+			continue
+		}
+		if err == nil && m.Bounds() != src.Bounds() {
+			t.Errorf("%+v: got bounds %v, want %v", tc.o, m.Bounds(), src.Bounds())
+		}
+		if err != nil && m != nil {
+			t.Errorf("%+v: got an image with error %v", tc.o, err)
+		}
+	}
+}
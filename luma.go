@@ -0,0 +1,18 @@
+package progjpeg
+
+import (
+	"image"
+	"image/draw"
+)
+
+// grayImage returns m, decoded with DecodeOptions.LumaOnly, as an
+// *image.Gray: the decoder returns the luma of YCbCr images as one, and
+// the other color images are converted.
+func grayImage(m image.Image) *image.Gray {
+	if g, ok := m.(*image.Gray); ok {
+		return g
+	}
+	g := image.NewGray(m.Bounds())
+	draw.Draw(g, g.Rect, m, g.Rect.Min, draw.Src)
+	return g
+}
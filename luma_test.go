@@ -0,0 +1,92 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeLumaOnly(t *testing.T) {
+	src := testimg.Photo(77, 45, 1)
+	for _, o := range []*Options{
+		{Quality: 75},
+		{Quality: 75, Progressive: true},
+		{Quality: 75, Progressive: true, Downsampler: BoxDownsampler{}},
+		{Quality: 75, ChromaCoefficients: 1},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := DecodeWithOptions(bytes.NewReader(buf.Bytes()), &DecodeOptions{LumaOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := m.(*image.Gray)
+		if !ok {
+			t.Fatalf("%+v: got %T, want *image.Gray", o, m)
+		}
+		y := want.(*image.YCbCr)
+		if got.Bounds() != y.Bounds() {
+			t.Fatalf("%+v: got bounds %v, want %v", o, got.Bounds(), y.Bounds())
+		}
+		for j := 0; j < 45; j++ {
+			for i := 0; i < 77; i++ {
+				if g, w := got.GrayAt(i, j).Y, y.Y[y.YOffset(i, j)]; g != w {
+					t.Fatalf("%+v: pixel (%d, %d) is %d, want the luma %d", o, i, j, g, w)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeLumaOnlyOthers(t *testing.T) {
+	// Grayscale, RGB and CMYK images are decoded as usual, then converted.
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(40, 24, 1), &Options{Quality: 75, Grayscale: true}},
+		{testimg.Photo(40, 24, 1), &Options{Quality: 75, RGB: true}},
+		{cmykPhoto(40, 24), &Options{Quality: 75}},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := DecodeWithOptions(bytes.NewReader(buf.Bytes()), &DecodeOptions{LumaOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := m.(*image.Gray)
+		if !ok {
+			t.Fatalf("%+v: got %T, want *image.Gray", tc.o, m)
+		}
+		if !equalImages(got, grayImage(want)) {
+			t.Errorf("%+v: the image differs from the converted decode", tc.o)
+		}
+	}
+}
+
+func BenchmarkDecodeLumaOnly(b *testing.B) {
+	data, err := os.ReadFile("testdata/video-001.progressive.jpeg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	o := &DecodeOptions{LumaOnly: true}
+	b.ReportAllocs()
+	for b.Loop() {
+		DecodeWithOptions(bytes.NewReader(data), o)
+	}
+}
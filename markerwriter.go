@@ -0,0 +1,151 @@
+package progjpeg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// A MarkerWriter writes a JPEG datastream one marker segment at a time, for
+// callers that need files [Encode] does not write, such as with their own
+// marker order or with metadata between the scans. NewMarkerWriter
+// transforms and quantizes the image once, and every WriteScan then
+// entropy-codes a scan of its coefficients.
+//
+// A MarkerWriter does not check that the segments make a valid file: the
+// caller must write them in an order that decoders accept, such as SOI,
+// DQT, SOF, DHT, the scans and EOI.
+type MarkerWriter struct {
+	e           encoder
+	progressive bool
+	sof         bool
+}
+
+// NewMarkerWriter returns a MarkerWriter that writes the image m to w, with
+// the options that apply to its coefficients: Quality, Grayscale, RGB,
+// ColorMatrix, Smoothing, Downsampler, Regions, QualityMask,
+// ChromaCoefficients, Dither, BlockQuant, Concurrency and Deterministic.
+// Progressive selects the frame type written by WriteSOF. The options that
+// are about the file's layout, such as ScanScript, Thumbnail and
+// OmitTables, do not apply, nor does Session.
+func NewMarkerWriter(w io.Writer, m image.Image, o *Options) (*MarkerWriter, error) {
+	mw := &MarkerWriter{}
+	e := &mw.e
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	m, err := e.setup(m, o)
+	if err != nil {
+		return nil, err
+	}
+	if n := o.concurrency(); n > 1 {
+		e.computeCoefficientsParallel(m, n)
+	} else {
+		e.computeCoefficients(m)
+	}
+	mw.progressive = o != nil && o.Progressive
+	return mw, e.err
+}
+
+// WriteSOI writes the Start Of Image marker.
+func (mw *MarkerWriter) WriteSOI() error {
+	mw.writeMarker(soiMarker)
+	return mw.e.err
+}
+
+// WriteSegment writes a marker segment holding data, such as an APPn
+// segment with metadata, or a COM segment. marker must be an APPn marker,
+// from 0xe0 to 0xef, or the COM marker, 0xfe.
+func (mw *MarkerWriter) WriteSegment(marker byte, data []byte) error {
+	if (marker < app0Marker || marker > app15Marker) && marker != comMarker {
+		return fmt.Errorf("jpeg: invalid segment marker 0x%02x (must be APPn or COM)", marker)
+	}
+	if len(data) > 0xffff-2 {
+		return fmt.Errorf("jpeg: segment of %d bytes is too large", len(data))
+	}
+	mw.e.writeMarkerHeader(marker, 2+len(data))
+	mw.e.write(data)
+	return mw.e.err
+}
+
+// WriteDQT writes the Define Quantization Table segment of the tables used
+// by the frame.
+func (mw *MarkerWriter) WriteDQT() error {
+	mw.e.writeDQT()
+	return mw.e.err
+}
+
+// WriteSOF writes the Start Of Frame segment: baseline, or progressive if
+// the Progressive option was set.
+func (mw *MarkerWriter) WriteSOF() error {
+	if mw.progressive {
+		mw.e.writeSOF(sof2Marker)
+	} else {
+		mw.e.writeSOF(sof0Marker)
+	}
+	mw.sof = true
+	return mw.e.err
+}
+
+// WriteDHT writes the Define Huffman Table segment of the default tables
+// used by the frame's components. The scans that select optimized tables
+// write their own.
+func (mw *MarkerWriter) WriteDHT() error {
+	mw.e.writeDHT()
+	return mw.e.err
+}
+
+// WriteScan writes a scan of the image's coefficients, preceded by the
+// segments it needs: a DRI segment if its restart interval differs from the
+// previous scan's, and a DHT segment if it selects optimized Huffman
+// tables. The scans of a progressive frame follow the rules of
+// [ValidateScanScript]; the scans of a baseline frame hold every
+// coefficient of one or more components, without successive
+// approximation.
+func (mw *MarkerWriter) WriteScan(scan ProgressiveScan) error {
+	if !mw.sof {
+		return errors.New("jpeg: WriteScan called before WriteSOF")
+	}
+	n := len(mw.e.comp)
+	if mw.progressive {
+		if err := ValidateScanScript(ScanScript{scan}, n); err != nil {
+			return err
+		}
+	} else {
+		if scan.Component < -1 || scan.Component >= n || scan.Component == -1 && n > maxComponents {
+			return fmt.Errorf("jpeg: invalid scan component %d", scan.Component)
+		}
+		if scan.SpectralStart != 0 || scan.SpectralEnd != blockSize-1 || scan.SuccessiveApproxHigh != 0 || scan.SuccessiveApproxLow != 0 {
+			return errors.New("jpeg: a baseline scan must hold every coefficient, without successive approximation")
+		}
+		if err := scan.validateComponents(0, n); err != nil {
+			return err
+		}
+		if err := scan.validateTables(0); err != nil {
+			return err
+		}
+		if scan.RestartInterval < 0 || scan.RestartInterval > 0xffff {
+			return fmt.Errorf("jpeg: invalid restart interval %d", scan.RestartInterval)
+		}
+	}
+	mw.e.writeProgressiveSOS(scan)
+	return mw.e.err
+}
+
+// WriteEOI writes the End Of Image marker and flushes the output.
+func (mw *MarkerWriter) WriteEOI() error {
+	mw.writeMarker(eoiMarker)
+	mw.e.flush()
+	return mw.e.err
+}
+
+// writeMarker writes a marker without a segment.
+func (mw *MarkerWriter) writeMarker(marker byte) {
+	mw.e.buf[0] = 0xff
+	mw.e.buf[1] = marker
+	mw.e.write(mw.e.buf[:2])
+}
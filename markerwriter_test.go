@@ -0,0 +1,107 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// writeMarkers writes m with a MarkerWriter, calling between after the
+// frame header and after every scan.
+func writeMarkers(t *testing.T, m image.Image, o *Options, script ScanScript, between func(mw *MarkerWriter)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, m, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []func() error{mw.WriteSOI, mw.WriteDQT, mw.WriteSOF, mw.WriteDHT} {
+		if err := f(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, scan := range script {
+		between(mw)
+		if err := mw.WriteScan(scan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMarkerWriter(t *testing.T) {
+	m := testimg.Photo(150, 97, 1)
+	mozjpeg, err := Preset("mozjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		o      *Options
+		script ScanScript
+	}{
+		{&Options{Quality: 80}, ScanScript{{Component: -1, SpectralEnd: 63}}},
+		{&Options{Quality: 80, Grayscale: true}, ScanScript{{Component: 0, SpectralEnd: 63}}},
+		{&Options{Quality: 80, Progressive: true}, DefaultColorScanScript()},
+		{&Options{Quality: 80, Progressive: true, ScanScript: mozjpeg}, mozjpeg},
+	} {
+		var want bytes.Buffer
+		if err := Encode(&want, m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		got := writeMarkers(t, m, tc.o, tc.script, func(*MarkerWriter) {})
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%+v: got %d bytes, want the %d bytes of Encode", tc.o, len(got), want.Len())
+		}
+	}
+}
+
+func TestMarkerWriterSegments(t *testing.T) {
+	m := testimg.Photo(64, 48, 1)
+	o := &Options{Quality: 80, Progressive: true}
+	var want bytes.Buffer
+	if err := Encode(&want, m, o); err != nil {
+		t.Fatal(err)
+	}
+	got := writeMarkers(t, m, o, DefaultColorScanScript(), func(mw *MarkerWriter) {
+		if err := mw.WriteSegment(comMarker, []byte("between scans")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	d0, err := Decode(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := Decode(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mse := meanSquaredError(d0, d1, d0.Bounds()); mse != 0 {
+		t.Errorf("got MSE %.2f, want the image of Encode", mse)
+	}
+}
+
+func TestMarkerWriterErrors(t *testing.T) {
+	m := testimg.Photo(16, 16, 1)
+	mw, err := NewMarkerWriter(&bytes.Buffer{}, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.WriteScan(ProgressiveScan{Component: -1, SpectralEnd: 63}); err == nil {
+		t.Error("WriteScan before WriteSOF: got nil error")
+	}
+	if err := mw.WriteSegment(sosMarker, nil); err == nil {
+		t.Error("WriteSegment(SOS): got nil error")
+	}
+	mw.WriteSOF()
+	if err := mw.WriteScan(ProgressiveScan{Component: 0, SpectralEnd: 9}); err == nil {
+		t.Error("partial baseline scan: got nil error")
+	}
+	if err := mw.WriteScan(ProgressiveScan{Component: 3, SpectralEnd: 63}); err == nil {
+		t.Error("invalid component: got nil error")
+	}
+}
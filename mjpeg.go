@@ -0,0 +1,128 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+)
+
+// MJPEGOptions are the encoding parameters of an [MJPEGWriter].
+type MJPEGOptions struct {
+	// Options are the encoding parameters of every frame. All frames share
+	// the quantization and Huffman tables of Options.Quality.
+	Options
+	// AVI selects the framing of Motion JPEG in AVI files: every frame
+	// starts with an AVI1 APP0 segment and omits the Huffman tables, which
+	// are implied to be those of section K.3 of the spec, and frames are
+	// written one after the other, for the caller to wrap in the chunks of
+	// the container. Otherwise, frames are the parts of a
+	// multipart/x-mixed-replace stream, as served to web browsers.
+	AVI bool
+	// Boundary is the boundary between the parts of a multipart stream. A
+	// random boundary is used if it is empty.
+	Boundary string
+}
+
+// An MJPEGWriter writes a sequence of frames as a Motion JPEG stream. It
+// reuses one [Encoder], and its buffers, for all of the frames.
+//
+// An MJPEGWriter is not safe for concurrent use by multiple goroutines.
+type MJPEGWriter struct {
+	w   io.Writer
+	o   MJPEGOptions
+	enc *Encoder
+	// buf holds the frame being encoded, whose length is needed before the
+	// frame is written to a multipart stream.
+	buf bytes.Buffer
+	mw  *multipart.Writer
+	err error
+}
+
+// NewMJPEGWriter returns a new MJPEGWriter writing to w. Default parameters
+// are used if a nil *[MJPEGOptions] is passed.
+func NewMJPEGWriter(w io.Writer, o *MJPEGOptions) (*MJPEGWriter, error) {
+	mj := &MJPEGWriter{w: w}
+	if o != nil {
+		mj.o = *o
+	} else {
+		mj.o.Quality = DefaultQuality
+	}
+	mj.enc = NewEncoder(&mj.buf)
+	mj.enc.e.avi = mj.o.AVI
+	if !mj.o.AVI {
+		mj.mw = multipart.NewWriter(w)
+		if mj.o.Boundary != "" {
+			if err := mj.mw.SetBoundary(mj.o.Boundary); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return mj, nil
+}
+
+// ContentType returns the HTTP Content-Type of a multipart stream,
+// including its boundary, or "video/x-motion-jpeg" for AVI frames.
+func (mj *MJPEGWriter) ContentType() string {
+	if mj.mw == nil {
+		return "video/x-motion-jpeg"
+	}
+	return "multipart/x-mixed-replace; boundary=" + mj.mw.Boundary()
+}
+
+// WriteFrame encodes m and writes it as the next frame of the stream. If
+// the underlying writer has a Flush method, such as an
+// [net/http.ResponseWriter] that implements [net/http.Flusher], it is
+// called after every frame so that the frame is sent right away.
+func (mj *MJPEGWriter) WriteFrame(m image.Image) error {
+	if mj.err != nil {
+		return mj.err
+	}
+	mj.buf.Reset()
+	if err := mj.enc.Encode(m, &mj.o.Options); err != nil {
+		return err
+	}
+	w := mj.w
+	if mj.mw != nil {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", "image/jpeg")
+		h.Set("Content-Length", strconv.Itoa(mj.buf.Len()))
+		if w, mj.err = mj.mw.CreatePart(h); mj.err != nil {
+			return mj.err
+		}
+	}
+	if _, mj.err = w.Write(mj.buf.Bytes()); mj.err != nil {
+		return mj.err
+	}
+	switch f := mj.w.(type) {
+	case interface{ Flush() error }:
+		mj.err = f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return mj.err
+}
+
+// Close ends a multipart stream with its closing boundary. It does not
+// close the underlying writer. Frames cannot be written after Close.
+func (mj *MJPEGWriter) Close() error {
+	if mj.err != nil {
+		return mj.err
+	}
+	mj.err = errors.New("jpeg: MJPEGWriter is closed")
+	if mj.mw != nil {
+		return mj.mw.Close()
+	}
+	return nil
+}
+
+// writeAVI1 writes the APP0 segment that identifies the frames of Motion
+// JPEG in AVI files: the "AVI1" identifier, a polarity of 0 for frames that
+// are not interlaced, a reserved byte, and the field sizes, left as 0.
+func (e *encoder) writeAVI1() {
+	e.writeMarkerHeader(app0Marker, 2+14)
+	e.write([]byte("AVI1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+}
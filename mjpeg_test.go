@@ -0,0 +1,134 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestMJPEGWriterMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mj, err := NewMJPEGWriter(&buf, &MJPEGOptions{
+		Options:  Options{Quality: 80, Progressive: true},
+		Boundary: "frame",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const nFrames = 3
+	for i := 0; i < nFrames; i++ {
+		if err := mj.WriteFrame(testimg.Photo(64, 48, int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mj.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mj.WriteFrame(testimg.Photo(64, 48, 0)); err == nil {
+		t.Error("WriteFrame after Close: got nil error")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(mj.ContentType())
+	if err != nil || mediaType != "multipart/x-mixed-replace" || params["boundary"] != "frame" {
+		t.Fatalf("ContentType: got %q", mj.ContentType())
+	}
+	mr := multipart.NewReader(&buf, params["boundary"])
+	n := 0
+	for ; ; n++ {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := p.Header.Get("Content-Type"); ct != "image/jpeg" {
+			t.Errorf("frame %d: got Content-Type %q", n, ct)
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cl := p.Header.Get("Content-Length"); cl != strconv.Itoa(len(data)) {
+			t.Errorf("frame %d: got Content-Length %s, want %d", n, cl, len(data))
+		}
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("frame %d: %v", n, err)
+		}
+		if m.Bounds() != image.Rect(0, 0, 64, 48) {
+			t.Errorf("frame %d: got bounds %v", n, m.Bounds())
+		}
+	}
+	if n != nFrames {
+		t.Errorf("got %d frames, want %d", n, nFrames)
+	}
+}
+
+func TestMJPEGWriterAVI(t *testing.T) {
+	var buf bytes.Buffer
+	o := &MJPEGOptions{Options: Options{Quality: 75}, AVI: true}
+	mj, err := NewMJPEGWriter(&buf, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames [][]byte
+	for i := 0; i < 2; i++ {
+		start := buf.Len()
+		if err := mj.WriteFrame(testimg.Photo(32, 32, int64(i))); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, buf.Bytes()[start:])
+	}
+	if err := mj.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables bytes.Buffer
+	if err := WriteTables(&tables, &o.Options); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder()
+	if err := dec.LoadTables(&tables); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range frames {
+		if !bytes.HasPrefix(data, []byte("\xff\xd8\xff\xe0\x00\x10AVI1")) {
+			t.Errorf("frame %d does not start with an AVI1 segment: % x", i, data[:12])
+		}
+		info, err := Probe(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Width != 32 || info.Height != 32 {
+			t.Errorf("frame %d: got %dx%d", i, info.Width, info.Height)
+		}
+		if bytes.Contains(data, []byte{0xff, dhtMarker}) {
+			t.Errorf("frame %d has Huffman tables", i)
+		}
+		m, err := dec.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+		// Without loaded tables, the frames are decoded with the tables of
+		// section K.3, which are those of the encoder.
+		m1, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("frame %d without tables: %v", i, err)
+		} else if !equalImages(m, m1) {
+			t.Errorf("frame %d without tables: the image differs from that decoded with the tables", i)
+		}
+	}
+}
+
+func TestMJPEGWriterBoundary(t *testing.T) {
+	if _, err := NewMJPEGWriter(io.Discard, &MJPEGOptions{Boundary: "bad boundary\n"}); err == nil {
+		t.Error("invalid boundary: got nil error")
+	}
+}
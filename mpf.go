@@ -0,0 +1,51 @@
+package progjpeg
+
+// MPImage is an image of a Multi-Picture Format file, which stores its
+// images one after the other as complete JPEG files, as specified in CIPA
+// DC-007. An image can be decoded from an io.SectionReader of the file:
+//
+//	img, err := progjpeg.Decode(io.NewSectionReader(f, mp.Offset, mp.Size))
+type MPImage struct {
+	// Offset is the position of the image in the file, from the SOI marker
+	// of the first image, and Size its length in bytes.
+	Offset, Size int64
+	// Type is the MP type code of the image, such as 0x030000 for the
+	// primary image, 0x010001 and 0x010002 for large thumbnails, 0x020001
+	// for a panorama frame, 0x020002 for a stereo view and 0x020003 for a
+	// multi-angle frame.
+	Type int
+}
+
+// MPF tags, as specified in CIPA DC-007.
+const mpfTagMPEntry = 0xb002
+
+// mpEntrySize is the size of an entry of the MP Entry field.
+const mpEntrySize = 16
+
+// parseMPF sets m.Images from the MP header mp, a TIFF structure which is
+// at the position base of the file. Malformed headers leave m.Images nil.
+func parseMPF(m *Metadata, mp []byte, base int64) {
+	order := tiffByteOrder(mp)
+	if order == nil {
+		return
+	}
+	ifd, ok := readIFD(mp, order, order.Uint32(mp[4:]))
+	if !ok {
+		return
+	}
+	_, _, entries, ok := ifd.value(mpfTagMPEntry)
+	if !ok || len(entries) < mpEntrySize {
+		return
+	}
+	for e := entries; len(e) >= mpEntrySize; e = e[mpEntrySize:] {
+		img := MPImage{
+			Size: int64(order.Uint32(e[4:])),
+			Type: int(order.Uint32(e) & 0xffffff),
+		}
+		// The first image, which holds the MP header, has the offset 0.
+		if off := int64(order.Uint32(e[8:])); off != 0 {
+			img.Offset = base + off
+		}
+		m.Images = append(m.Images, img)
+	}
+}
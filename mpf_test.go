@@ -0,0 +1,91 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// mpHeader returns a little-endian MP header whose MP Entry field lists
+// images of the given sizes, offsets and types.
+func mpHeader(sizes, offsets []uint32, types []uint32) []byte {
+	le := binary.LittleEndian
+	mp := []byte("II\x2a\x00\x08\x00\x00\x00")
+	// The IFD, at 8, has 1 entry and ends at 8+2+12+4 = 26, where the MP
+	// entries are.
+	mp = le.AppendUint16(mp, 1)
+	mp = le.AppendUint16(mp, mpfTagMPEntry)
+	mp = le.AppendUint16(mp, 7) // UNDEFINED.
+	mp = le.AppendUint32(mp, uint32(mpEntrySize*len(sizes)))
+	mp = le.AppendUint32(mp, 26)
+	mp = le.AppendUint32(mp, 0)
+	for i := range sizes {
+		mp = le.AppendUint32(mp, types[i])
+		mp = le.AppendUint32(mp, sizes[i])
+		mp = le.AppendUint32(mp, offsets[i])
+		mp = le.AppendUint32(mp, 0)
+	}
+	return mp
+}
+
+func TestDecodeMPO(t *testing.T) {
+	left, right := testimg.Photo(48, 32, 1), testimg.Photo(48, 32, 2)
+	var second bytes.Buffer
+	if err := Encode(&second, right, &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	// The MP header of the first image is after its SOI marker, the APP2
+	// marker, its length and mpfID, and its size does not depend on the
+	// values of its entries.
+	const headerPos = 2 + 4 + 4
+	types := []uint32{0x020002, 0x020002}
+	first := encodeWithSegment(t, left, app2Marker, append(bytes.Clone(mpfID), mpHeader([]uint32{0, 0}, []uint32{0, 0}, types)...))
+	header := mpHeader([]uint32{uint32(len(first)), uint32(second.Len())}, []uint32{0, uint32(len(first) - headerPos)}, types)
+	first = encodeWithSegment(t, left, app2Marker, append(bytes.Clone(mpfID), header...))
+	if !bytes.Equal(first[headerPos:headerPos+len(header)], header) {
+		t.Fatal("the MP header is not where expected")
+	}
+	file := append(first, second.Bytes()...)
+
+	for _, decode := range []func(io.Reader) (*Metadata, error){
+		func(r io.Reader) (*Metadata, error) { _, meta, err := DecodeWithMetadata(r); return meta, err },
+		func(r io.Reader) (*Metadata, error) { _, meta, err := DecodeFull(r); return meta, err },
+	} {
+		meta, err := decode(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []MPImage{{0, int64(len(first)), 0x020002}, {int64(len(first)), int64(second.Len()), 0x020002}}
+		if len(meta.Images) != len(want) {
+			t.Fatalf("got images %+v, want %+v", meta.Images, want)
+		}
+		for i, mp := range meta.Images {
+			if mp != want[i] {
+				t.Errorf("image %d: got %+v, want %+v", i, mp, want[i])
+			}
+		}
+		for i, src := range [][]byte{first, second.Bytes()} {
+			mp := meta.Images[i]
+			got, err := Decode(io.NewSectionReader(bytes.NewReader(file), mp.Offset, mp.Size))
+			if err != nil {
+				t.Fatalf("image %d: %v", i, err)
+			}
+			w, err := Decode(bytes.NewReader(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalImages(got, w) {
+				t.Errorf("image %d differs", i)
+			}
+		}
+	}
+
+	// A file without an MPF segment has no images.
+	_, meta, err := DecodeWithMetadata(bytes.NewReader(second.Bytes()))
+	if err != nil || meta.Images != nil {
+		t.Errorf("got images %+v and error %v, want none", meta.Images, err)
+	}
+}
@@ -0,0 +1,128 @@
+package progjpeg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Multiplane is an image made of an arbitrary number of 8-bit planes. It is
+// what [Decode] returns for JPEG images with more than 4 components, such
+// as the multispectral images written by some scientific and remote sensing
+// encoders, and it can be passed to [Encode] to write such images. A
+// progressive frame holds at most 4 components, so Encode returns an error
+// for a progressive encode of more than 4 planes.
+//
+// Each plane holds one component. A subsampled component has a smaller
+// plane than the image: for example, a component whose horizontal sampling
+// factor is half of the largest one is half as wide as the image, rounded
+// up.
+type Multiplane struct {
+	Planes []*image.Gray
+	Rect   image.Rectangle
+}
+
+// NewMultiplane returns a new Multiplane image with the given bounds and n
+// full resolution planes.
+func NewMultiplane(r image.Rectangle, n int) *Multiplane {
+	m := &Multiplane{Planes: make([]*image.Gray, n), Rect: r}
+	for i := range m.Planes {
+		m.Planes[i] = image.NewGray(r)
+	}
+	return m
+}
+
+// ColorModel returns [color.GrayModel]: without knowing what its planes
+// represent, a Multiplane image is displayed as its first plane.
+func (m *Multiplane) ColorModel() color.Model { return color.GrayModel }
+
+func (m *Multiplane) Bounds() image.Rectangle { return m.Rect }
+
+// At returns the color of the first plane at (x, y), taking subsampling
+// into account.
+func (m *Multiplane) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(m.Rect)) || len(m.Planes) == 0 {
+		return color.Gray{}
+	}
+	return m.PlaneAt(0, x, y)
+}
+
+// PlaneAt returns the value of the plane i at (x, y), in the image's
+// coordinate space, taking the plane's subsampling into account.
+func (m *Multiplane) PlaneAt(i, x, y int) color.Gray {
+	p := m.Planes[i]
+	pb := p.Bounds()
+	// The plane covers the same area as the image, at a possibly lower
+	// resolution.
+	px := pb.Min.X + (x-m.Rect.Min.X)*pb.Dx()/max(m.Rect.Dx(), 1)
+	py := pb.Min.Y + (y-m.Rect.Min.Y)*pb.Dy()/max(m.Rect.Dy(), 1)
+	return p.GrayAt(px, py)
+}
+
+// makeMultiplane allocates the destination image for frames with more than
+// 4 components. Like the Y, Cb and Cr planes of a YCbCr image, each plane
+// is allocated to cover the MCUs in d.mcus, and then sliced to the
+// component's size.
+func (d *decoder) makeMultiplane(b image.Rectangle) {
+	h0, v0 := d.comp[0].h, d.comp[0].v
+	m := &Multiplane{
+		Planes: make([]*image.Gray, d.nComp),
+		Rect:   b,
+	}
+	for i := range m.Planes {
+		h, v := d.comp[i].h, d.comp[i].v
+		p := image.NewGray(image.Rect(8*h*d.mcus.Min.X, 8*v*d.mcus.Min.Y, 8*h*d.mcus.Max.X, 8*v*d.mcus.Max.Y))
+		w := (d.width*h + h0 - 1) / h0
+		ht := (d.height*v + v0 - 1) / v0
+		m.Planes[i] = p.SubImage(image.Rect(0, 0, w, ht)).(*image.Gray)
+	}
+	d.imgN = m
+}
+
+// multiplaneComponents returns the frame layout used to encode m: one full
+// resolution component per plane, all using the luminance tables.
+func multiplaneComponents(m *Multiplane) ([]encComponent, error) {
+	if len(m.Planes) == 0 || len(m.Planes) > maxFrameComponents {
+		return nil, fmt.Errorf("jpeg: cannot encode an image with %d planes (must be 1 to %d)", len(m.Planes), maxFrameComponents)
+	}
+	comp := make([]encComponent, len(m.Planes))
+	for i, p := range m.Planes {
+		if p == nil || p.Bounds() != m.Rect {
+			return nil, errors.New("jpeg: cannot encode a Multiplane image with subsampled planes")
+		}
+		comp[i] = encComponent{1, 1, quantIndexLuminance}
+	}
+	return comp, nil
+}
+
+// writeSOSChunked writes the image data of a baseline image with more than 4
+// components. A scan can only hold 4 components, so the components are coded
+// as several interleaved scans of up to 4 components each.
+func (e *encoder) writeSOSChunked(m image.Image) {
+	e.computeCoefficients(m)
+	e.writeBaselineScans()
+}
+
+// writeBaselineScans writes the scans of a baseline image from the
+// coefficients in e.coeffs, as interleaved scans of up to 4 components.
+func (e *encoder) writeBaselineScans() {
+	comps := e.allComponents()
+	for i := 0; i < len(comps); i += maxComponents {
+		e.writeCoefficientScan(comps[i:min(i+maxComponents, len(comps))], 0, blockSize-1, 0, 0)
+	}
+}
+
+// multiplaneScanScript returns the default progressive scan script for an
+// image with 2 or 4 components: the DC coefficients of every component,
+// then their AC coefficients, one component per scan.
+func multiplaneScanScript(nComponent int) ScanScript {
+	script := make(ScanScript, 0, 2*nComponent)
+	for c := 0; c < nComponent; c++ {
+		script = append(script, ProgressiveScan{Component: c, SpectralStart: 0, SpectralEnd: 0})
+	}
+	for c := 0; c < nComponent; c++ {
+		script = append(script, ProgressiveScan{Component: c, SpectralStart: 1, SpectralEnd: 63})
+	}
+	return script
+}
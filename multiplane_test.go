@@ -0,0 +1,95 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestMultiplaneRoundTrip(t *testing.T) {
+	const n = 7
+	m0 := NewMultiplane(image.Rect(0, 0, 37, 21), n)
+	for i, p := range m0.Planes {
+		for y := 0; y < 21; y++ {
+			for x := 0; x < 37; x++ {
+				p.Pix[p.PixOffset(x, y)] = uint8(2*x + 3*y + 20*i)
+			}
+		}
+	}
+	for _, progressive := range []bool{false, true} {
+		var buf bytes.Buffer
+		err := Encode(&buf, m0, &Options{Quality: 95, Progressive: progressive})
+		if progressive {
+			// A progressive frame has at most 4 components.
+			if err == nil {
+				t.Fatalf("progressive: got no error for %d planes", n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := Inspect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Width != 37 || fi.Height != 21 || fi.Precision != 8 || fi.Progressive != progressive || len(fi.Components) != n {
+			t.Fatalf("progressive=%t: Inspect: got %+v", progressive, fi)
+		}
+		for i, c := range fi.Components {
+			if want := (ComponentInfo{ID: i + 1, H: 1, V: 1, Tq: 0}); c != want {
+				t.Fatalf("progressive=%t: component %d: got %+v, want %+v", progressive, i, c, want)
+			}
+		}
+		cfg, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != 37 || cfg.Height != 21 {
+			t.Fatalf("progressive=%t: DecodeConfig: got %dx%d", progressive, cfg.Width, cfg.Height)
+		}
+		m, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, ok := m.(*Multiplane)
+		if !ok {
+			t.Fatalf("progressive=%t: got %T, want *Multiplane", progressive, m)
+		}
+		if m1.Bounds() != m0.Bounds() || len(m1.Planes) != n {
+			t.Fatalf("progressive=%t: got %v with %d planes", progressive, m1.Bounds(), len(m1.Planes))
+		}
+		for i := range m0.Planes {
+			for y := 0; y < 21; y++ {
+				for x := 0; x < 37; x++ {
+					g0, g1 := m0.PlaneAt(i, x, y).Y, m1.PlaneAt(i, x, y).Y
+					if d := int(g0) - int(g1); d < -4 || d > 4 {
+						t.Fatalf("progressive=%t: plane %d at (%d, %d): got %d, want %d", progressive, i, x, y, g1, g0)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	f, err := os.Open("testdata/video-001.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := Inspect(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ComponentInfo{{1, 1, 1, 0}, {2, 1, 1, 1}, {3, 1, 1, 1}}
+	if fi.Width != 150 || fi.Height != 103 || fi.Progressive || len(fi.Components) != 3 {
+		t.Fatalf("got %+v", fi)
+	}
+	for i, c := range fi.Components {
+		if c != want[i] {
+			t.Errorf("component %d: got %+v, want %+v", i, c, want[i])
+		}
+	}
+}
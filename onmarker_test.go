@@ -0,0 +1,84 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// segment is a segment of a JPEG file.
+type segment struct {
+	marker  byte
+	payload []byte
+}
+
+// segments returns the segments of the JPEG file data, skipping the
+// entropy-coded data after each scan header.
+func segments(data []byte) []segment {
+	var segs []segment
+	for i := 2; i+4 <= len(data); {
+		marker := data[i+1]
+		if marker == eoiMarker {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		segs = append(segs, segment{marker, data[i+4 : i+2+n]})
+		i += 2 + n
+		if marker != sosMarker {
+			continue
+		}
+		// Skip to the next marker that is not a restart marker.
+		for ; i+1 < len(data); i++ {
+			if m := data[i+1]; data[i] == 0xff && m != 0 && (m < rst0Marker || m > rst7Marker) {
+				break
+			}
+		}
+	}
+	return segs
+}
+
+func TestDecodeOnMarker(t *testing.T) {
+	src := testimg.Photo(64, 40, 1)
+	var progressive bytes.Buffer
+	if err := Encode(&progressive, src, &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	exif := append([]byte("Exif\x00\x00"), orientationExif(6)...)
+	for _, data := range [][]byte{
+		progressive.Bytes(),
+		encodeWithSegment(t, src, app0Marker+5, []byte("custom data")),
+		encodeWithSegment(t, src, app1Marker, exif),
+	} {
+		var got []segment
+		o := &DecodeOptions{
+			AutoOrient: true,
+			OnMarker: func(marker byte, payload []byte) {
+				got = append(got, segment{marker, payload})
+			},
+		}
+		m, err := DecodeWithOptions(bytes.NewReader(data), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := segments(data)
+		if len(got) != len(want) {
+			t.Fatalf("got %d segments, want %d", len(got), len(want))
+		}
+		for i := range got {
+			if got[i].marker != want[i].marker || !bytes.Equal(got[i].payload, want[i].payload) {
+				t.Errorf("segment %d: got marker %#x and %d bytes, want %#x and %d bytes", i, got[i].marker, len(got[i].payload), want[i].marker, len(want[i].payload))
+			}
+		}
+		// The segments are still processed as without the callback.
+		o.OnMarker = nil
+		m1, err := DecodeWithOptions(bytes.NewReader(data), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalImages(m, m1) {
+			t.Error("the image differs from that decoded without OnMarker")
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package progjpeg
+
+import "image"
+
+// orient returns the decoded image m transformed as the Exif orientation o
+// says, so that it is upright: mirrored for 2 and 4, rotated by 180° for 3,
+// transposed for 5, rotated by 90° clockwise for 6, transversed for 7 and
+// rotated by 90° counterclockwise for 8. Other values return m as it is.
+// The returned image's top-left corner is at the origin.
+func orient(m image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return m
+	}
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	switch m := m.(type) {
+	case *image.Gray:
+		dst := image.NewGray(image.Rect(0, 0, dw, dh))
+		orientPlane(dst.Pix, dst.Stride, m.Pix[m.PixOffset(b.Min.X, b.Min.Y):], m.Stride, w, h, 1, o)
+		return dst
+	case *image.RGBA:
+		dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		orientPlane(dst.Pix, dst.Stride, m.Pix[m.PixOffset(b.Min.X, b.Min.Y):], m.Stride, w, h, 4, o)
+		return dst
+	case *image.CMYK:
+		dst := image.NewCMYK(image.Rect(0, 0, dw, dh))
+		orientPlane(dst.Pix, dst.Stride, m.Pix[m.PixOffset(b.Min.X, b.Min.Y):], m.Stride, w, h, 4, o)
+		return dst
+	case *image.YCbCr:
+		return orientYCbCr(m, o)
+	case *Multiplane:
+		// Subsampled planes are transformed at their own resolution.
+		dst := &Multiplane{Planes: make([]*image.Gray, len(m.Planes)), Rect: image.Rect(0, 0, dw, dh)}
+		for i, p := range m.Planes {
+			dst.Planes[i] = orient(p, o).(*image.Gray)
+		}
+		return dst
+	}
+	return m
+}
+
+// orientYCbCr is orient for YCbCr images. Their chroma planes are
+// transformed as they are if the chroma samples keep covering the same
+// luma pixels, and after being upsampled to 4:4:4 otherwise.
+func orientYCbCr(m *image.YCbCr, o int) *image.YCbCr {
+	b := m.Bounds()
+	fx, fy := subsampleFactors(m.SubsampleRatio)
+	ratio := m.SubsampleRatio
+	if o >= 5 {
+		switch ratio {
+		case image.YCbCrSubsampleRatio422:
+			ratio = image.YCbCrSubsampleRatio440
+		case image.YCbCrSubsampleRatio440:
+			ratio = image.YCbCrSubsampleRatio422
+		case image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410:
+			// A 4:1:1 or 4:1:0 image transposed has no YCbCr ratio.
+			ratio = -1
+		}
+	}
+	if ratio < 0 || b.Min.X%fx != 0 || b.Min.Y%fy != 0 || b.Dx()%fx != 0 || b.Dy()%fy != 0 {
+		m = upsampleYCbCr(m, NearestUpsampler{})
+		b = m.Bounds()
+		fx, fy, ratio = 1, 1, image.YCbCrSubsampleRatio444
+	}
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewYCbCr(image.Rect(0, 0, dw, dh), ratio)
+	orientPlane(dst.Y, dst.YStride, m.Y[m.YOffset(b.Min.X, b.Min.Y):], m.YStride, w, h, 1, o)
+	co := m.COffset(b.Min.X, b.Min.Y)
+	orientPlane(dst.Cb, dst.CStride, m.Cb[co:], m.CStride, w/fx, h/fy, 1, o)
+	orientPlane(dst.Cr, dst.CStride, m.Cr[co:], m.CStride, w/fx, h/fy, 1, o)
+	return dst
+}
+
+// orientPlane stores in dst the w by h plane src, of bpp bytes per pixel,
+// transformed as the Exif orientation o says. dst is h by w for the
+// orientations 5 to 8, which swap the axes.
+func orientPlane(dst []byte, dstStride int, src []byte, srcStride, w, h, bpp, o int) {
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	for y := 0; y < dh; y++ {
+		d := dst[y*dstStride:]
+		for x := 0; x < dw; x++ {
+			// (sx, sy) is the pixel of src that ends up at (x, y).
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(d[x*bpp:(x+1)*bpp], src[sy*srcStride+sx*bpp:])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// orientationExif returns an APP1 Exif payload holding only the orientation
+// o.
+func orientationExif(o int) []byte {
+	le := binary.LittleEndian
+	p := []byte("Exif\x00\x00II\x2a\x00\x08\x00\x00\x00\x01\x00")
+	p = le.AppendUint16(p, exifTagOrientation)
+	p = le.AppendUint16(p, exifShort)
+	p = le.AppendUint32(p, 1)
+	p = le.AppendUint32(p, uint32(o))
+	return le.AppendUint32(p, 0)
+}
+
+// orientedAt returns the pixel of m, w by h, that orientation o moves to
+// (x, y).
+func orientedAt(m image.Image, w, h, o, x, y int) color.Color {
+	sx, sy := x, y
+	switch o {
+	case 2:
+		sx, sy = w-1-x, y
+	case 3:
+		sx, sy = w-1-x, h-1-y
+	case 4:
+		sx, sy = x, h-1-y
+	case 5:
+		sx, sy = y, x
+	case 6:
+		sx, sy = y, h-1-x
+	case 7:
+		sx, sy = w-1-y, h-1-x
+	case 8:
+		sx, sy = w-1-y, x
+	}
+	return m.At(sx, sy)
+}
+
+func TestAutoOrient(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m    image.Image
+		o    *Options
+	}{
+		{"4:2:0", testimg.Photo(64, 48, 1), nil},
+		{"4:2:0 odd", testimg.Photo(61, 37, 1), nil},
+		{"4:2:2", toYCbCr422(testimg.Photo(64, 48, 2)), nil},
+		{"gray", testimg.Photo(40, 24, 3), &Options{Grayscale: true}},
+		{"rgb", testimg.Photo(40, 24, 3), &Options{RGB: true}},
+	} {
+		for o := 1; o <= 8; o++ {
+			data := encodeWithOptionsAndSegment(t, tc.m, tc.o, app1Marker, orientationExif(o))
+			src, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{AutoOrient: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, h := src.Bounds().Dx(), src.Bounds().Dy()
+			want := image.Rect(0, 0, w, h)
+			if o >= 5 {
+				want = image.Rect(0, 0, h, w)
+			}
+			if got.Bounds() != want {
+				t.Errorf("%s, orientation %d: got bounds %v, want %v", tc.name, o, got.Bounds(), want)
+				continue
+			}
+		loop:
+			for y := 0; y < want.Dy(); y++ {
+				for x := 0; x < want.Dx(); x++ {
+					g := color.NRGBAModel.Convert(got.At(x, y))
+					if s := color.NRGBAModel.Convert(orientedAt(src, w, h, o, x, y)); g != s {
+						t.Errorf("%s, orientation %d: got %v at (%d, %d), want %v", tc.name, o, g, x, y, s)
+						break loop
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOrientCMYK(t *testing.T) {
+	// MarkerWriter does not write the Adobe segment that CMYK files need, so
+	// orient is tested directly.
+	src := cmykPhoto(40, 24)
+	for o := 1; o <= 8; o++ {
+		got := orient(src, o)
+		if o >= 5 && got.Bounds() != image.Rect(0, 0, 24, 40) {
+			t.Errorf("orientation %d: got bounds %v", o, got.Bounds())
+			continue
+		}
+	loop:
+		for y := 0; y < got.Bounds().Dy(); y++ {
+			for x := 0; x < got.Bounds().Dx(); x++ {
+				if g, s := got.At(x, y), orientedAt(src, 40, 24, o, x, y); g != s {
+					t.Errorf("orientation %d: got %v at (%d, %d), want %v", o, g, x, y, s)
+					break loop
+				}
+			}
+		}
+	}
+}
+
+func TestAutoOrientOff(t *testing.T) {
+	data := encodeWithOptionsAndSegment(t, testimg.Photo(64, 48, 1), nil, app1Marker, orientationExif(6))
+	m, err := DecodeWithOptions(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 64, 48) {
+		t.Errorf("got bounds %v, want the stored ones", m.Bounds())
+	}
+}
+
+// toYCbCr422 returns a 4:2:2 copy of m.
+func toYCbCr422(m image.Image) *image.YCbCr {
+	b := m.Bounds()
+	dst := image.NewYCbCr(b, image.YCbCrSubsampleRatio422)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bb, _ := m.At(x, y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bb>>8))
+			dst.Y[dst.YOffset(x, y)] = yy
+			dst.Cb[dst.COffset(x, y)] = cb
+			dst.Cr[dst.COffset(x, y)] = cr
+		}
+	}
+	return dst
+}
@@ -0,0 +1,77 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"io"
+)
+
+// PaintMetrics are the download milestones of a JPEG file, as returned by
+// [MeasurePaint], in bytes from the start of the file.
+type PaintMetrics struct {
+	// FirstPaint is the number of bytes needed to display the whole image
+	// for the first time: the End, as reported by [ReportScans], of the
+	// first scan after which every component has its DC coefficients, from
+	// which [RenderAt] renders it. It is the end of the only scan of a
+	// baseline image.
+	FirstPaint int64
+	// Threshold is the number of bytes needed to display the image at the
+	// SSIM threshold of MeasurePaint, or -1 if the whole file does not
+	// reach it or no original is given.
+	Threshold int64
+}
+
+// MeasurePaint reads the JPEG file in r, encoded from the image original,
+// and reports the number of bytes that a browser needs to paint it for
+// the first time, and to display it with an [SSIM] of at least minSSIM
+// against original, such as 0.95, for web performance budgets. Since SSIM
+// compares the luma, the threshold can come before the first paint if the
+// luma of the image is sent first. If original is nil, only FirstPaint is
+// measured.
+func MeasurePaint(original image.Image, r io.Reader, minSSIM float64) (PaintMetrics, error) {
+	pm := PaintMetrics{FirstPaint: -1, Threshold: -1}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return pm, err
+	}
+	markers, err := ParseStructure(bytes.NewReader(data))
+	if err != nil {
+		return pm, err
+	}
+	// dc holds the identifiers of the components whose DC coefficients
+	// have been sent, and n the number of components of the frame.
+	dc := make(map[int]bool)
+	n := 0
+	for _, m := range markers {
+		if m.Frame != nil {
+			n = len(m.Frame.Components)
+		}
+		if m.Scan == nil || m.Scan.SpectralStart != 0 {
+			continue
+		}
+		for _, c := range m.Scan.Components {
+			dc[c.ID] = true
+		}
+		if len(dc) >= n {
+			pm.FirstPaint = m.scanEnd()
+			break
+		}
+	}
+	if pm.FirstPaint < 0 {
+		return pm, FormatError("missing DC scan")
+	}
+	if original == nil {
+		return pm, nil
+	}
+	points, err := ScanQuality(original, bytes.NewReader(data))
+	if err != nil {
+		return pm, err
+	}
+	for _, p := range points {
+		if p.SSIM >= minSSIM {
+			pm.Threshold = p.Bytes
+			break
+		}
+	}
+	return pm, nil
+}
@@ -0,0 +1,77 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestMeasurePaint(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, tc := range []struct {
+		o *Options
+		// firstPaint is the index of the scan whose end is the first
+		// paint.
+		firstPaint int
+	}{
+		{&Options{Quality: 90}, 0},
+		{&Options{Quality: 90, Progressive: true}, 0},
+		{&Options{Quality: 90, Progressive: true, ScanScript: ScanScript{
+			{Component: 0, SpectralEnd: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63},
+			{Component: 1, SpectralEnd: 0},
+			{Component: 2, SpectralEnd: 0},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+		}}, 3},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		scans, err := ReportScans(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm, err := MeasurePaint(src, bytes.NewReader(buf.Bytes()), 0.95)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := scans[tc.firstPaint].End; pm.FirstPaint != want {
+			t.Errorf("%d scans: got first paint at %d, want %d", len(scans), pm.FirstPaint, want)
+		}
+		// RenderAt renders the image, chroma included, from the bytes of
+		// the first paint, and nothing from one byte less if they end the
+		// first scan.
+		m, err := RenderAt(bytes.NewReader(buf.Bytes()), pm.FirstPaint)
+		if err != nil {
+			t.Fatalf("%d scans: %v", len(scans), err)
+		}
+		if ycc, ok := m.(*image.YCbCr); ok {
+			if c := ycc.COffset(40, 20); ycc.Cb[c] == 0x80 && ycc.Cr[c] == 0x80 {
+				t.Errorf("%d scans: the first paint has no chroma", len(scans))
+			}
+		}
+		if tc.firstPaint == 0 {
+			if _, err := RenderAt(bytes.NewReader(buf.Bytes()), pm.FirstPaint-1); err == nil {
+				t.Errorf("%d scans: rendered before the first paint", len(scans))
+			}
+		}
+		// SSIM only compares the luma, which the first scan of the last
+		// script holds.
+		if pm.Threshold < scans[0].End || pm.Threshold > int64(buf.Len()) {
+			t.Errorf("%d scans: got threshold at %d, want between %d and %d", len(scans), pm.Threshold, scans[0].End, buf.Len())
+		}
+
+		pm, err = MeasurePaint(src, bytes.NewReader(buf.Bytes()), 1.1)
+		if err != nil || pm.Threshold != -1 {
+			t.Errorf("%d scans: an unreachable threshold gives %d (%v)", len(scans), pm.Threshold, err)
+		}
+		pm, err = MeasurePaint(nil, bytes.NewReader(buf.Bytes()), 0.95)
+		if err != nil || pm.FirstPaint != scans[tc.firstPaint].End || pm.Threshold != -1 {
+			t.Errorf("%d scans: without an original, got %+v (%v)", len(scans), pm, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"sync"
+)
+
+// bufferWriter is a writer that accumulates its output in memory. Flush is a
+// no-op.
+type bufferWriter struct {
+	bytes.Buffer
+}
+
+func (w *bufferWriter) Flush() error { return nil }
+
+// writeDRI writes the Define Restart Interval marker, which applies to the
+// following scans.
+func (e *encoder) writeDRI(ri int) {
+	e.ri = ri
+	e.writeMarkerHeader(driMarker, 4)
+	e.buf[0] = uint8(ri >> 8)
+	e.buf[1] = uint8(ri & 0xff)
+	e.write(e.buf[:2])
+}
+
+// writeRST ends a restart interval of the entropy-coded data, with the RST
+// marker of the given restart interval number, modulo 8.
+func (e *encoder) writeRST(n int) {
+	e.padBits()
+	e.buf[0] = 0xff
+	e.buf[1] = rst0Marker + uint8(n%8)
+	e.write(e.buf[:2])
+}
+
+// writeMCURow writes the entropy-coded data of the MCU row my of a baseline
+// image, as a stand-alone restart interval: the DC predictions start from
+// zero and the last byte is padded.
+func (e *encoder) writeMCURow(m image.Image, my int, mcu []block) {
+	var prevDC [maxComponents]int32
+	for mx := 0; mx < e.mxx; mx++ {
+		e.writeMCU(m, mx, my, mcu, &prevDC)
+	}
+	// Pad the last byte with 1's.
+	e.padBits()
+}
+
+// writeSOSParallel is like writeSOS, but codes the MCU rows concurrently on
+// n goroutines. Every row is a restart interval of its own, so the rows can
+// be coded independently and then written out in order, separated by RST
+// markers. The output does not depend on n.
+func (e *encoder) writeSOSParallel(m image.Image, n int) {
+	e.writeDRI(e.mxx)
+	if e.session != nil {
+		e.session.RestartInterval = e.mxx
+	}
+	e.writeSOSHeader(e.allComponents(), 0, blockSize-1, 0, 0)
+
+	type row struct {
+		w    bufferWriter
+		err  error
+		done chan struct{}
+	}
+	rows := make([]row, e.myy)
+	for i := range rows {
+		rows[i].done = make(chan struct{})
+	}
+	var (
+		mu   sync.Mutex
+		next int
+		// tmpl is a snapshot of the encoder's state, taken before e is
+		// modified again by writing out the rows.
+		tmpl = *e
+	)
+	for range n {
+		go func() {
+			mcu := make([]block, e.blocksPerMCU())
+			for {
+				mu.Lock()
+				my := next
+				next++
+				mu.Unlock()
+				if my >= e.myy {
+					return
+				}
+				re := tmpl
+				re.w, re.err = &rows[my].w, nil
+				re.writeMCURow(m, my, mcu)
+				re.flushEntropy()
+				rows[my].err = re.err
+				close(rows[my].done)
+			}
+		}()
+	}
+	for my := range rows {
+		<-rows[my].done
+		if e.err == nil {
+			e.err = rows[my].err
+		}
+		e.write(rows[my].w.Bytes())
+		rows[my].w = bufferWriter{}
+		if my < e.myy-1 {
+			e.buf[0] = 0xff
+			e.buf[1] = rst0Marker + uint8(my%8)
+			e.write(e.buf[:2])
+		}
+	}
+}
+
+// computeCoefficientsParallel is like computeCoefficients, but transforms
+// the MCU rows concurrently on n goroutines.
+func (e *encoder) computeCoefficientsParallel(m image.Image, n int) {
+	e.allocCoefficients()
+	var wg sync.WaitGroup
+	rows := make(chan int)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mcu := make([]block, e.blocksPerMCU())
+			for my := range rows {
+				e.computeMCURow(m, my, mcu)
+			}
+		}()
+	}
+	for my := 0; my < e.myy; my++ {
+		rows <- my
+	}
+	close(rows)
+	wg.Wait()
+}
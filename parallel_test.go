@@ -0,0 +1,79 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestEncodeConcurrency(t *testing.T) {
+	m0, err := readPng("testdata/video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, progressive := range []bool{false, true} {
+		var want image.Image
+		var out [][]byte
+		for _, n := range []int{1, 2, 7} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, &Options{Quality: 80, Progressive: progressive, Concurrency: n}); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, buf.Bytes())
+			m1, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("progressive=%t, concurrency=%d: %v", progressive, n, err)
+			}
+			if want == nil {
+				want = m1
+			} else if d := averageDelta(want, m1); d != 0 {
+				t.Errorf("progressive=%t, concurrency=%d: average delta %d, want 0", progressive, n, d)
+			}
+		}
+		if !bytes.Equal(out[1], out[2]) {
+			t.Errorf("progressive=%t: output depends on the number of goroutines", progressive)
+		}
+	}
+}
+
+func BenchmarkEncodeRGBAConcurrency4(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	b.SetBytes(640 * 480 * 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	options := &Options{Quality: 90, Concurrency: 4}
+	for i := 0; i < b.N; i++ {
+		Encode(io.Discard, img, options)
+	}
+}
+
+func TestEncodeDeterministic(t *testing.T) {
+	m := testimg.Photo(150, 97, 1)
+	for _, o := range []Options{
+		{Quality: 80},
+		{Quality: 80, Progressive: true, OptimizeScans: true},
+		{Quality: 30, Dither: 50, Regions: []QualityRegion{{image.Rect(10, 10, 60, 60), 90}}},
+	} {
+		var want bytes.Buffer
+		if err := Encode(&want, m, &o); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{0, 4, 8, 4} {
+			oo := o
+			oo.Concurrency, oo.Deterministic = n, true
+			var got bytes.Buffer
+			if err := Encode(&got, m, &oo); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("%+v: got %d bytes, want the %d bytes of a sequential encode", oo, got.Len(), want.Len())
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package progjpeg
+
+import "fmt"
+
+// PresetNames lists the names accepted by [Preset], in a stable order.
+var PresetNames = []string{"default", "default-gray", "dc-then-full", "screenshot", "mozjpeg", "libjpeg", "successive-approximation"}
+
+// Preset returns a new copy of the named scan script. All presets but
+// "default-gray" are meant for color images:
+//
+//   - "default" is [DefaultColorScanScript], and "default-gray" is
+//     [DefaultGrayscaleScanScript].
+//   - "dc-then-full" sends the DC coefficients of all components, then the
+//     AC coefficients of each component in one scan: a blurry preview
+//     followed by the full image, in 4 scans.
+//   - "screenshot" is meant for synthetic content such as screenshots,
+//     charts and UI captures, where sharp luma edges make text legible and
+//     color matters little: it sends all of the luma AC coefficients, in
+//     two scans, before any chroma AC coefficient.
+//   - "mozjpeg" is the 10-scan progression of mozjpeg's cjpeg, taken from
+//     jpgcrush: separate luma and chroma DC scans, low frequency AC scans,
+//     and the luma high frequencies in successive approximation.
+//   - "libjpeg" is the 10-scan progression of libjpeg's
+//     jpeg_simple_progression, which uses successive approximation.
+//   - "successive-approximation" sends every coefficient in two or three bit
+//     planes, for smooth refinement of the whole image.
+//
+// All presets pass [ValidateScanScript] and [VerifyScanScriptCoverage].
+func Preset(name string) (ScanScript, error) {
+	switch name {
+	case "default":
+		return DefaultColorScanScript(), nil
+	case "default-gray":
+		return DefaultGrayscaleScanScript(), nil
+	case "dc-then-full":
+		return ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+		}, nil
+	case "screenshot":
+		return ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 9},
+			{Component: 0, SpectralStart: 10, SpectralEnd: 63},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+		}, nil
+	case "mozjpeg":
+		return ScanScript{
+			{Component: 0, SpectralStart: 0, SpectralEnd: 0},
+			{Component: -1, Components: []int{1, 2}, SpectralStart: 0, SpectralEnd: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 8, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 8},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 8},
+			{Component: 0, SpectralStart: 9, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 1, SpectralStart: 9, SpectralEnd: 63},
+			{Component: 2, SpectralStart: 9, SpectralEnd: 63},
+		}, nil
+	case "libjpeg":
+		return ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 5, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 6, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+		}, nil
+	case "successive-approximation":
+		return ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 1, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 2, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+		}, nil
+	}
+	return nil, fmt.Errorf("jpeg: unknown scan script preset %q", name)
+}
@@ -0,0 +1,77 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestPreset(t *testing.T) {
+	for _, name := range PresetNames {
+		script, err := Preset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m image.Image = testimg.Photo(48, 40, 1)
+		nComponent := 3
+		if name == "default-gray" {
+			m, nComponent = testimg.ZonePlate(48, 40), 1
+		}
+		if err := VerifyScanScriptCoverage(script, nComponent); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := ValidateScanScript(script, nComponent); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		info, err := Probe(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Scans != len(script) {
+			t.Errorf("%s: got %d scans, want %d", name, info.Scans, len(script))
+		}
+		_, meta, err := DecodeFull(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(ScanScript(meta.Scans), script) {
+			t.Errorf("%s: decoded scans %v, want %v", name, meta.Scans, script)
+		}
+	}
+	if _, err := Preset("nonexistent"); err == nil {
+		t.Error("unknown preset did not fail")
+	}
+}
+
+func TestPresetCopy(t *testing.T) {
+	s0, _ := Preset("mozjpeg")
+	s0[0].Component = 2
+	s1, _ := Preset("mozjpeg")
+	if s1[0].Component != 0 {
+		t.Error("modifying a preset changed the next copy")
+	}
+}
+
+func TestPresetScreenshot(t *testing.T) {
+	script, err := Preset("screenshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Once a chroma AC scan is sent, no luma scan may follow.
+	chroma := false
+	for _, scan := range script {
+		switch {
+		case scan.Component > 0 && scan.SpectralStart > 0:
+			chroma = true
+		case scan.Component == 0 && chroma:
+			t.Fatalf("luma scan %v follows chroma AC scans", scan)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package progjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"io"
+)
+
+// ProbeResult is the result of [Probe].
+type ProbeResult struct {
+	// Width and Height are the image dimensions, and Components is the
+	// number of color components (1 for grayscale, 3 for YCbCr, 4 for CMYK).
+	Width, Height, Components int
+	// Progressive reports whether the image is a progressive JPEG, and Scans
+	// is the number of SOS markers, which is 1 for most baseline images.
+	Progressive bool
+	Scans       int
+	// Precision is the sample precision in bits, 8 for almost all images.
+	Precision int
+	// SubsampleRatio is the chroma subsampling ratio of 3-component images
+	// whose sampling factors have one, and 4:4:4 for other images.
+	SubsampleRatio image.YCbCrSubsampleRatio
+	// RestartInterval is the number of MCUs between restart markers, as set
+	// by the last DRI segment before the first scan, or 0 if there are no
+	// restart markers.
+	RestartInterval int
+	// The Has fields report the presence of common metadata segments.
+	HasJFIF    bool // APP0 "JFIF".
+	HasEXIF    bool // APP1 "Exif".
+	HasXMP     bool // APP1 XMP packet.
+	HasICC     bool // APP2 "ICC_PROFILE".
+	HasAdobe   bool // APP14 "Adobe".
+	HasComment bool // COM.
+	// SHA256 is the SHA-256 digest of the whole input, and Size is its length
+	// in bytes, including any data after the EOI marker.
+	SHA256 [sha256.Size]byte
+	Size   int64
+}
+
+// Segment identifiers found at the start of APPn payloads.
+var (
+	jfifID   = []byte("JFIF\x00")
+	exifID   = []byte("Exif\x00\x00")
+	xmpID    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtID = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccID    = []byte("ICC_PROFILE\x00")
+	mpfID    = []byte("MPF\x00")
+	adobeID  = []byte("Adobe")
+)
+
+// Probe reads the JPEG image in r in a single pass and reports its
+// dimensions, structure and metadata, along with the digest and size of the
+// input. It is a richer [DecodeConfig], which also tells whether the image
+// is progressive, its subsampling ratio and restart interval, and which
+// metadata segments it has. Unlike [Decode], it does not decode the entropy-coded data, and its
+// memory usage does not depend on the size of the image, which makes it
+// suitable for cataloging large numbers of files.
+func Probe(r io.Reader) (ProbeResult, error) {
+	var res ProbeResult
+	h := sha256.New()
+	cw := &countingWriter{w: h}
+	s := newMarkerScanner(io.TeeReader(r, cw))
+	if err := s.readSOI(); err != nil {
+		return res, err
+	}
+	var id [32]byte
+loop:
+	for {
+		marker, err := s.next()
+		if err != nil {
+			return res, err
+		}
+		switch {
+		case marker == eoiMarker:
+			break loop
+		case !hasLength(marker):
+			continue
+		}
+		n, err := s.readLength()
+		if err != nil {
+			return res, err
+		}
+		switch {
+		case isSOF(marker):
+			if n < 6 {
+				return res, FormatError("SOF has wrong length")
+			}
+			if err := s.readFull(id[:6]); err != nil {
+				return res, err
+			}
+			n -= 6
+			res.Height = int(id[1])<<8 + int(id[2])
+			res.Width = int(id[3])<<8 + int(id[4])
+			res.Components = int(id[5])
+			res.Precision = int(id[0])
+			res.Progressive = marker == sof2Marker || marker == sof6Marker ||
+				marker == sof10Marker || marker == sof14Marker
+			// The sampling factors of the first two components give the
+			// subsampling ratio.
+			if res.Components == 3 && n >= 6 {
+				if err := s.readFull(id[:6]); err != nil {
+					return res, err
+				}
+				n -= 6
+				h0, v0, h1, v1 := int(id[1]>>4), int(id[1]&0x0f), int(id[4]>>4), int(id[4]&0x0f)
+				if h1 > 0 && v1 > 0 && h0%h1 == 0 && v0%v1 == 0 {
+					res.SubsampleRatio, _ = ycbcrRatio(h0/h1, v0/v1)
+				}
+			}
+		case marker == driMarker:
+			if n >= 2 && res.Scans == 0 {
+				if err := s.readFull(id[:2]); err != nil {
+					return res, err
+				}
+				n -= 2
+				res.RestartInterval = int(id[0])<<8 + int(id[1])
+			}
+		case marker == sosMarker:
+			res.Scans++
+		case marker == comMarker:
+			res.HasComment = true
+		case app0Marker <= marker && marker <= app15Marker:
+			k := min(n, len(id))
+			if err := s.readFull(id[:k]); err != nil {
+				return res, err
+			}
+			n -= k
+			p := id[:k]
+			switch marker {
+			case app0Marker:
+				res.HasJFIF = res.HasJFIF || bytes.HasPrefix(p, jfifID)
+			case app1Marker:
+				res.HasEXIF = res.HasEXIF || bytes.HasPrefix(p, exifID)
+				res.HasXMP = res.HasXMP || bytes.HasPrefix(p, xmpID)
+			case app2Marker:
+				res.HasICC = res.HasICC || bytes.HasPrefix(p, iccID)
+			case app14Marker:
+				res.HasAdobe = res.HasAdobe || bytes.HasPrefix(p, adobeID)
+			}
+		}
+		if err := s.skip(n); err != nil {
+			return res, err
+		}
+	}
+	// Hash whatever follows the EOI marker, too.
+	if _, err := io.Copy(io.Discard, s.r); err != nil {
+		return res, err
+	}
+	copy(res.SHA256[:], h.Sum(nil))
+	res.Size = cw.n
+	return res, nil
+}
+
+// countingWriter forwards writes to w, counting the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return w.w.Write(p)
+}
+
+// markerScanner walks the marker segments of a JPEG stream without decoding
+// the entropy-coded data in between. It keeps track of its offset in the
+// stream.
+type markerScanner struct {
+	r   *bufio.Reader
+	off int64
+}
+
+func newMarkerScanner(r io.Reader) *markerScanner {
+	return &markerScanner{r: bufio.NewReader(r)}
+}
+
+func (s *markerScanner) readByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		s.off++
+	}
+	return c, err
+}
+
+func (s *markerScanner) readFull(p []byte) error {
+	n, err := io.ReadFull(s.r, p)
+	s.off += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (s *markerScanner) skip(n int) error {
+	m, err := s.r.Discard(n)
+	s.off += int64(m)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readSOI checks for the Start Of Image marker.
+func (s *markerScanner) readSOI() error {
+	var b [2]byte
+	if err := s.readFull(b[:]); err != nil {
+		return err
+	}
+	if b[0] != 0xff || b[1] != soiMarker {
+		return FormatError("missing SOI marker")
+	}
+	return nil
+}
+
+// next returns the next marker. Fill bytes, byte-stuffed "\xff\x00"
+// sequences, RST markers and any other data between segments, such as the
+// entropy-coded data following an SOS segment, are skipped.
+func (s *markerScanner) next() (byte, error) {
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != 0xff {
+			continue
+		}
+		for c == 0xff {
+			if c, err = s.readByte(); err != nil {
+				return 0, err
+			}
+		}
+		if c != 0 && (c < rst0Marker || rst7Marker < c) {
+			return c, nil
+		}
+	}
+}
+
+// readLength reads the 16-bit length of a marker segment, returning the
+// number of remaining bytes in the segment.
+func (s *markerScanner) readLength() (int, error) {
+	var b [2]byte
+	if err := s.readFull(b[:]); err != nil {
+		return 0, err
+	}
+	n := int(b[0])<<8 + int(b[1]) - 2
+	if n < 0 {
+		return 0, FormatError("short segment length")
+	}
+	return n, nil
+}
+
+// hasLength reports whether the marker is followed by a length and a
+// payload. Table B.1 of the spec lists the stand-alone markers.
+func hasLength(marker byte) bool {
+	return marker != soiMarker && marker != eoiMarker && marker != temMarker &&
+		(marker < rst0Marker || rst7Marker < marker)
+}
+
+// isSOF reports whether the marker is one of the Start Of Frame markers.
+// 0xc4, 0xc8 and 0xcc are DHT, JPG and DAC, not SOF markers.
+func isSOF(marker byte) bool {
+	return 0xc0 <= marker && marker <= 0xcf &&
+		marker != dhtMarker && marker != jpgMarker && marker != dacMarker
+}
@@ -0,0 +1,76 @@
+package progjpeg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestProbe(t *testing.T) {
+	testCases := []struct {
+		filename    string
+		components  int
+		progressive bool
+		scans       int
+	}{
+		{"testdata/video-001.jpeg", 3, false, 1},
+		{"testdata/video-001.progressive.jpeg", 3, true, 10},
+		{"testdata/video-005.gray.q50.progressive.jpeg", 1, true, 6},
+		{"testdata/video-001.cmyk.jpeg", 4, false, 1},
+	}
+	for _, tc := range testCases {
+		b, err := os.ReadFile(tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := Probe(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("%s: %v", tc.filename, err)
+			continue
+		}
+		if res.Width != 150 || res.Height != 103 {
+			t.Errorf("%s: got %dx%d, want 150x103", tc.filename, res.Width, res.Height)
+		}
+		if res.Components != tc.components || res.Progressive != tc.progressive || res.Scans != tc.scans {
+			t.Errorf("%s: got %d components, progressive %t, %d scans, want %d, %t, %d", tc.filename,
+				res.Components, res.Progressive, res.Scans, tc.components, tc.progressive, tc.scans)
+		}
+		if res.Size != int64(len(b)) || res.SHA256 != sha256.Sum256(b) {
+			t.Errorf("%s: bad size or digest", tc.filename)
+		}
+	}
+}
+
+func TestProbeFrame(t *testing.T) {
+	testCases := []struct {
+		name  string
+		m     image.Image
+		o     *Options
+		ratio image.YCbCrSubsampleRatio
+		ri    int
+	}{
+		{"4:2:0", testimg.Photo(64, 48, 1), nil, image.YCbCrSubsampleRatio420, 0},
+		{"4:2:2", toYCbCr422(testimg.Photo(64, 48, 1)), &Options{Progressive: true}, image.YCbCrSubsampleRatio422, 0},
+		// Concurrent encodes restart every MCU row, of 4 MCUs here.
+		{"restarts", testimg.Photo(64, 48, 1), &Options{Concurrency: 2}, image.YCbCrSubsampleRatio420, 4},
+		{"gray", testimg.Photo(64, 48, 1), &Options{Grayscale: true}, image.YCbCrSubsampleRatio444, 0},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		res, err := Probe(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Precision != 8 || res.SubsampleRatio != tc.ratio || res.RestartInterval != tc.ri {
+			t.Errorf("%s: got precision %d, ratio %v, restart interval %d, want 8, %v, %d", tc.name,
+				res.Precision, res.SubsampleRatio, res.RestartInterval, tc.ratio, tc.ri)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package progjpeg
+
+import "io"
+
+// Progress is the progress of a decode.
+type Progress struct {
+	// Bytes is the number of bytes of the file consumed so far, and
+	// TotalBytes the size of the file, or 0 if it is not known. A JPEG
+	// file does not declare how many scans it has, so Bytes/TotalBytes is
+	// the fraction of the decode that is done.
+	Bytes, TotalBytes int64
+	// Scans is the number of complete scans.
+	Scans int
+	// Done reports whether the End Of Image marker has been read.
+	Done bool
+}
+
+// A ProgressReporter is told of the progress of a decode, such as to show
+// a progress bar for the multi-second decodes of large images. It is given
+// to [DecodeOptions] or to a [StreamDecoder].
+type ProgressReporter interface {
+	ReportProgress(p Progress)
+}
+
+// reportProgress tells d.progress of the progress of the decode.
+func (d *decoder) reportProgress(done bool) {
+	d.progress.ReportProgress(Progress{
+		Bytes:      d.offset(),
+		TotalBytes: d.totalBytes,
+		Scans:      d.scans,
+		Done:       done,
+	})
+}
+
+// readerSize returns the number of bytes left in r if r can tell, as
+// bytes.Reader, strings.Reader, bytes.Buffer and io.SectionReader can, or
+// else 0.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case *io.SectionReader:
+		n, _ := r.Seek(0, io.SeekCurrent)
+		return r.Size() - n
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// progressLog is a ProgressReporter that records the reports.
+type progressLog []Progress
+
+func (l *progressLog) ReportProgress(p Progress) {
+	*l = append(*l, p)
+}
+
+// check checks that the reports of l advance, and end with the decode of
+// the scans of the n bytes of data.
+func (l progressLog) check(t *testing.T, n int64, total int64, scans int) {
+	t.Helper()
+	if len(l) == 0 {
+		t.Fatal("no progress reported")
+	}
+	for i := 1; i < len(l); i++ {
+		if l[i].Bytes < l[i-1].Bytes || l[i].Scans < l[i-1].Scans || l[i-1].Done {
+			t.Fatalf("report %d is %+v, after %+v", i, l[i], l[i-1])
+		}
+	}
+	if last := l[len(l)-1]; last != (Progress{n, total, scans, true}) {
+		t.Errorf("got the last report %+v, want %d bytes of %d, %d scans and done", last, n, total, scans)
+	}
+}
+
+func TestDecodeProgress(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(160, 120, 1), &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	scans, err := DecodeScans(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int64(len(data))
+
+	var log progressLog
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Progress: &log}); err != nil {
+		t.Fatal(err)
+	}
+	log.check(t, n, n, len(scans))
+	// The scans report their MCU rows too.
+	if len(log) <= len(scans) {
+		t.Errorf("got %d reports for %d scans", len(log), len(scans))
+	}
+
+	// The size of readers that do not tell it is unknown.
+	log = nil
+	if _, err := DecodeWithOptions(io.MultiReader(bytes.NewReader(data)), &DecodeOptions{Progress: &log}); err != nil {
+		t.Fatal(err)
+	}
+	log.check(t, n, 0, len(scans))
+
+	log = nil
+	sd := NewStreamDecoder()
+	sd.SetProgressReporter(&log, n)
+	for i := 0; i < len(data); i += 100 {
+		if _, err := sd.Write(data[i:min(i+100, len(data))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.check(t, n, n, len(scans))
+}
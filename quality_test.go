@@ -0,0 +1,68 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestScanQuality(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, &Options{Quality: 90, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	points, err := ScanQuality(src, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scans, err := ReportScans(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(scans) {
+		t.Fatalf("got %d points, want %d", len(points), len(scans))
+	}
+	for i, p := range points {
+		if p.Bytes != scans[i].End {
+			t.Errorf("point %d: got %d bytes, want %d", i, p.Bytes, scans[i].End)
+		}
+		if p.SSIM <= 0 || p.SSIM > 1 || p.PSNR <= 0 {
+			t.Errorf("point %d: got %+v", i, p)
+		}
+		// The point is the quality of the image that RenderAt renders
+		// from its bytes.
+		m, err := RenderAt(bytes.NewReader(buf.Bytes()), p.Bytes)
+		if err != nil {
+			t.Fatalf("point %d: %v", i, err)
+		}
+		if ssim := SSIM(src, m); ssim != p.SSIM {
+			t.Errorf("point %d: RenderAt gives an SSIM of %g, want %g", i, ssim, p.SSIM)
+		}
+	}
+	// The image only gets better, and the complete one is good.
+	first, last := points[0], points[len(points)-1]
+	if last.PSNR <= first.PSNR || last.SSIM <= first.SSIM {
+		t.Errorf("the quality goes from %+v to %+v", first, last)
+	}
+	if last.PSNR < 25 || last.SSIM < 0.95 {
+		t.Errorf("got a final quality of %+v", last)
+	}
+	m, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, s := PSNR(src, m), SSIM(src, m); p != last.PSNR || s != last.SSIM {
+		t.Errorf("PSNR and SSIM give %v and %v, want %v and %v", p, s, last.PSNR, last.SSIM)
+	}
+
+	if p, s := PSNR(src, src), SSIM(src, src); !math.IsInf(p, 1) || math.Abs(s-1) > 1e-9 {
+		t.Errorf("an image against itself gives PSNR %v and SSIM %v", p, s)
+	}
+	if _, err := ScanQuality(image.NewGray(image.Rect(0, 0, 10, 10)), bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("an original of another size did not fail")
+	}
+}
@@ -0,0 +1,74 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestEncodeQuantTables(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	// Flat tables, which no quality gives.
+	var flat [blockSize]uint8
+	for i := range flat {
+		flat[i] = 12
+	}
+	var first bytes.Buffer
+	if err := Encode(&first, src, &Options{QuantTables: [][blockSize]uint8{flat}}); err != nil {
+		t.Fatal(err)
+	}
+	m, meta, err := DecodeWithMetadata(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.QuantTables) != 2 || meta.QuantTables[0] != flat || meta.QuantTables[1] != flat {
+		t.Fatalf("got tables %v, want two flat ones", meta.QuantTables)
+	}
+	want, _, err := DecodeCoefficients(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-encoding the decoded image with the same tables gives back most
+	// of its coefficients, unlike a quality that gives other tables.
+	same := func(o *Options) float64 {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		planes, _, err := DecodeCoefficients(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, total := 0, 0
+		for i, p := range planes {
+			for j, b := range p.Blocks {
+				for k := range b {
+					if b[k] == want[i].Blocks[j][k] {
+						n++
+					}
+					total++
+				}
+			}
+		}
+		return float64(n) / float64(total)
+	}
+	if r := same(&Options{QuantTables: meta.QuantTables}); r < 0.95 {
+		t.Errorf("%.1f%% of the coefficients are the same, want at least 95%%", 100*r)
+	}
+	if r, q := same(&Options{QuantTables: meta.QuantTables}), same(&Options{Quality: 87}); r <= q {
+		t.Errorf("%.1f%% of the coefficients are the same with the original tables, and %.1f%% with quality 87", 100*r, 100*q)
+	}
+
+	for _, o := range []*Options{
+		{QuantTables: [][blockSize]uint8{flat, flat, flat}},
+		{QuantTables: [][blockSize]uint8{{}}},
+		{QuantTables: [][blockSize]uint8{flat}, Regions: []QualityRegion{{image.Rect(0, 0, 16, 16), 90}}},
+	} {
+		if err := Encode(new(bytes.Buffer), src, o); err == nil {
+			t.Errorf("%d tables, %d regions: got no error", len(o.QuantTables), len(o.Regions))
+		}
+	}
+}
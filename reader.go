@@ -41,25 +41,39 @@ const (
 	maxTq   = 3
 
 	maxComponents = 4
+	// maxFrameComponents is the maximum number of components in a frame,
+	// as per table B.2. A scan has at most maxComponents components.
+	maxFrameComponents = 255
 )
 
 const (
-	sof0Marker = 0xc0 // Start Of Frame (Baseline Sequential).
-	sof1Marker = 0xc1 // Start Of Frame (Extended Sequential).
-	sof2Marker = 0xc2 // Start Of Frame (Progressive).
-	dhtMarker  = 0xc4 // Define Huffman Table.
-	rst0Marker = 0xd0 // ReSTart (0).
-	rst7Marker = 0xd7 // ReSTart (7).
-	soiMarker  = 0xd8 // Start Of Image.
-	eoiMarker  = 0xd9 // End Of Image.
-	sosMarker  = 0xda // Start Of Scan.
-	dqtMarker  = 0xdb // Define Quantization Table.
-	driMarker  = 0xdd // Define Restart Interval.
-	comMarker  = 0xfe // COMment.
+	sof0Marker  = 0xc0 // Start Of Frame (Baseline Sequential).
+	sof1Marker  = 0xc1 // Start Of Frame (Extended Sequential).
+	sof2Marker  = 0xc2 // Start Of Frame (Progressive).
+	dhtMarker   = 0xc4 // Define Huffman Table.
+	sof6Marker  = 0xc6 // Start Of Frame (Differential Progressive).
+	jpgMarker   = 0xc8 // Reserved for JPEG extensions.
+	sof10Marker = 0xca // Start Of Frame (Progressive, arithmetic coding).
+	dacMarker   = 0xcc // Define Arithmetic Coding conditioning.
+	sof14Marker = 0xce // Start Of Frame (Differential Progressive, arithmetic).
+	rst0Marker  = 0xd0 // ReSTart (0).
+	rst7Marker  = 0xd7 // ReSTart (7).
+	soiMarker   = 0xd8 // Start Of Image.
+	eoiMarker   = 0xd9 // End Of Image.
+	sosMarker   = 0xda // Start Of Scan.
+	dqtMarker   = 0xdb // Define Quantization Table.
+	dnlMarker   = 0xdc // Define Number of Lines.
+	driMarker   = 0xdd // Define Restart Interval.
+	comMarker   = 0xfe // COMment.
+	temMarker   = 0x01 // TEMporary private use in arithmetic coding.
 	// "APPlication specific" markers aren't part of the JPEG spec per se,
 	// but in practice, their use is described at
 	// https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/JPEG.html
 	app0Marker  = 0xe0
+	app1Marker  = 0xe1
+	app2Marker  = 0xe2
+	app12Marker = 0xec
+	app13Marker = 0xed
 	app14Marker = 0xee
 	app15Marker = 0xef
 )
@@ -115,6 +129,8 @@ type decoder struct {
 		// nUnreadable is the number of bytes to back up i after
 		// overshooting. It can be 0, 1 or 2.
 		nUnreadable int
+		// n is the number of bytes read from the underlying io.Reader.
+		n int64
 	}
 	width, height int
 
@@ -122,6 +138,22 @@ type decoder struct {
 	img3        *image.YCbCr
 	blackPix    []byte
 	blackStride int
+	// imgN holds the planes of images with more than 4 components.
+	imgN *Multiplane
+	// upsampler, if non-nil, restores the full resolution of img3's
+	// chroma planes.
+	upsampler Upsampler
+	// into, if non-nil, is the image given to DecodeInto, which img1 or
+	// img3 reuse if it fits.
+	into image.Image
+	// lenient, if true, skips the scans that fail to decode, as set by
+	// DecodeOptions.Lenient. backup holds the coefficients of the
+	// components in scanComps as they were before the current scan, and
+	// corruptScans counts the skipped scans.
+	lenient      bool
+	backup       [maxFrameComponents][]block
+	scanComps    []int
+	corruptScans int
 
 	ri    int // Restart Interval.
 	nComp int
@@ -139,11 +171,64 @@ type decoder struct {
 	adobeTransform      uint8
 	eobRun              uint16 // End-of-Band run, specified in section G.1.2.2.
 
-	comp       [maxComponents]component
-	progCoeffs [maxComponents][]block // Saved state between progressive-mode scans.
-	huff       [maxTc + 1][maxTh + 1]huffman
-	quant      [maxTq + 1]block // Quantization tables, in zig-zag order.
-	tmp        [2 * blockSize]byte
+	comp       [maxFrameComponents]component
+	progCoeffs [maxFrameComponents][]block // Saved state between progressive-mode scans.
+	// spill holds the coefficients of the components that are stored on
+	// disk rather than in progCoeffs. dec, if non-nil, is the Decoder that
+	// provides the coefficient buffers and limits, and coeffMemory is the
+	// size of the buffers in progCoeffs.
+	spill       [maxFrameComponents]*spillStore
+	dec         *Decoder
+	coeffMemory int64
+	huff        [maxTc + 1][maxTh + 1]huffman
+	// onScan, if non-nil, is called with the image decoded so far after
+	// every scan, and scans counts them. maxScans, if positive, is the
+	// number of scans after which decoding stops, as set by
+	// DecodeOptions.MaxScans.
+	onScan   func(scan int, m image.Image)
+	scans    int
+	maxScans int
+	// maxPixels, maxMemory and scanLimit, if positive, are the limits set
+	// by DecodeOptions.
+	maxPixels, maxMemory int64
+	scanLimit            int
+	// onMarker, if non-nil, is called with every marker read, before its
+	// segment.
+	onMarker func(marker byte)
+	// onSegment, if non-nil, is called with the marker and the payload of
+	// every segment, as set by DecodeOptions.OnMarker. The payload is then
+	// read again from segment, which readByte, readFull and ignore consume
+	// before d.bytes.
+	onSegment func(marker byte, payload []byte)
+	segment   []byte
+	// coeffsOnly, if true, keeps the coefficients of every image in
+	// progCoeffs, as if it were progressive, and reconstructs no pixels.
+	// dcOnly, if also true, skips the scans of AC coefficients.
+	coeffsOnly bool
+	dcOnly     bool
+	// progress, if non-nil, is told of the progress of the decode after
+	// every segment and every MCU row of the scans, as set by
+	// DecodeOptions.Progress, and totalBytes is the size of the file, if
+	// known.
+	progress   ProgressReporter
+	totalBytes int64
+	// restarts, if non-nil, counts the restart markers, as set by
+	// DecodeOptions.Restarts.
+	restarts *RestartStats
+	// lumaOnly, if true, decodes the luma of YCbCr images into img1 and
+	// skips their chroma, as set by DecodeOptions.LumaOnly.
+	lumaOnly bool
+	// region, if not empty, is the part of the image that DecodeRegion
+	// returns, and mcus is the rectangle, in units of MCUs, of the MCUs
+	// that the decoder reconstructs: all of them, or those covering region.
+	region, mcus image.Rectangle
+	// meta, if non-nil, receives the metadata of DecodeWithMetadata, and
+	// icc holds the chunks of its ICC profile, in order.
+	meta *Metadata
+	icc  [][]byte
+
+	quant [maxTq + 1]block // Quantization tables, in zig-zag order.
+	tmp   [2 * blockSize]byte
 }
 
 // fill fills up the d.bytes.buf buffer from the underlying io.Reader. It
@@ -162,6 +247,7 @@ func (d *decoder) fill() error {
 	// Fill in the rest of the buffer.
 	n, err := d.r.Read(d.bytes.buf[d.bytes.j:])
 	d.bytes.j += n
+	d.bytes.n += int64(n)
 	if n > 0 {
 		return nil
 	}
@@ -189,6 +275,10 @@ func (d *decoder) unreadByteStuffedByte() {
 // readByte returns the next byte, whether buffered or not buffered. It does
 // not care about byte stuffing.
 func (d *decoder) readByte() (x byte, err error) {
+	if len(d.segment) > 0 {
+		x, d.segment = d.segment[0], d.segment[1:]
+		return x, nil
+	}
 	for d.bytes.i == d.bytes.j {
 		if err = d.fill(); err != nil {
 			return 0, err
@@ -202,7 +292,9 @@ func (d *decoder) readByte() (x byte, err error) {
 
 // errMissingFF00 means that readByteStuffedByte encountered an 0xff byte (a
 // marker byte) that wasn't the expected byte-stuffed sequence 0xff, 0x00.
-var errMissingFF00 = FormatError("missing 0xff00 sequence")
+// It is declared as an error so that returning it, at the end of every scan,
+// does not allocate.
+var errMissingFF00 error = FormatError("missing 0xff00 sequence")
 
 // readByteStuffedByte is like readByte but is for byte-stuffed Huffman data.
 func (d *decoder) readByteStuffedByte() (x byte, err error) {
@@ -244,6 +336,12 @@ func (d *decoder) readByteStuffedByte() (x byte, err error) {
 	return 0xff, nil
 }
 
+// offset returns the position in the underlying io.Reader of the next byte
+// to be read.
+func (d *decoder) offset() int64 {
+	return d.bytes.n - int64(d.bytes.j-d.bytes.i) - int64(len(d.segment))
+}
+
 // readFull reads exactly len(p) bytes into p. It does not care about byte
 // stuffing.
 func (d *decoder) readFull(p []byte) error {
@@ -254,6 +352,11 @@ func (d *decoder) readFull(p []byte) error {
 		}
 		d.bytes.nUnreadable = 0
 	}
+	if len(d.segment) > 0 {
+		n := copy(p, d.segment)
+		d.segment = d.segment[n:]
+		p = p[n:]
+	}
 
 	for {
 		n := copy(p, d.bytes.buf[d.bytes.i:d.bytes.j])
@@ -278,6 +381,11 @@ func (d *decoder) ignore(n int) error {
 		}
 		d.bytes.nUnreadable = 0
 	}
+	if len(d.segment) > 0 {
+		m := min(n, len(d.segment))
+		d.segment = d.segment[m:]
+		n -= m
+	}
 
 	for {
 		m := d.bytes.j - d.bytes.i
@@ -309,23 +417,35 @@ func (d *decoder) processSOF(n int) error {
 	case 6 + 3*4: // YCbCrK or CMYK image.
 		d.nComp = 4
 	default:
-		return UnsupportedError("number of components")
+		// Images with more than 4 components, such as multispectral images,
+		// are decoded as a Multiplane image.
+		if n < 6+3*5 || 6+3*maxFrameComponents < n || (n-6)%3 != 0 {
+			return UnsupportedError("number of components")
+		}
+		d.nComp = (n - 6) / 3
 	}
-	if err := d.readFull(d.tmp[:n]); err != nil {
+	tmp := d.tmp[:]
+	if n > len(tmp) {
+		tmp = make([]byte, n)
+	}
+	if err := d.readFull(tmp[:n]); err != nil {
 		return err
 	}
 	// We only support 8-bit precision.
-	if d.tmp[0] != 8 {
+	if tmp[0] != 8 {
 		return UnsupportedError("precision")
 	}
-	d.height = int(d.tmp[1])<<8 + int(d.tmp[2])
-	d.width = int(d.tmp[3])<<8 + int(d.tmp[4])
-	if int(d.tmp[5]) != d.nComp {
+	d.height = int(tmp[1])<<8 + int(tmp[2])
+	d.width = int(tmp[3])<<8 + int(tmp[4])
+	if err := d.clipRegion(); err != nil {
+		return err
+	}
+	if int(tmp[5]) != d.nComp {
 		return FormatError("SOF has wrong length")
 	}
 
 	for i := 0; i < d.nComp; i++ {
-		d.comp[i].c = d.tmp[6+3*i]
+		d.comp[i].c = tmp[6+3*i]
 		// Section B.2.2 states that "the value of C_i shall be different from
 		// the values of C_1 through C_(i-1)".
 		for j := 0; j < i; j++ {
@@ -334,12 +454,12 @@ func (d *decoder) processSOF(n int) error {
 			}
 		}
 
-		d.comp[i].tq = d.tmp[8+3*i]
+		d.comp[i].tq = tmp[8+3*i]
 		if d.comp[i].tq > maxTq {
 			return FormatError("bad Tq value")
 		}
 
-		hv := d.tmp[7+3*i]
+		hv := tmp[7+3*i]
 		h, v := int(hv>>4), int(hv&0x0f)
 		if h < 1 || 4 < h || v < 1 || 4 < v {
 			return FormatError("luma/chroma subsampling ratio")
@@ -412,12 +532,22 @@ func (d *decoder) processSOF(n int) error {
 					return errUnsupportedSubsamplingRatio
 				}
 			}
+
+		default:
+			// For images with more than 4 components, we only require that
+			// the first component has the largest sampling factors, as for
+			// the other images, so that it determines the MCU size.
+			if i > 0 && (d.comp[0].h%h != 0 || d.comp[0].v%v != 0) {
+				return errUnsupportedSubsamplingRatio
+			}
 		}
 
 		d.comp[i].h = h
 		d.comp[i].v = v
 	}
-	return nil
+	// Only the chroma of YCbCr images can be skipped.
+	d.lumaOnly = d.lumaOnly && d.nComp == 3 && !d.isRGB()
+	return d.checkLimits()
 }
 
 // Specified in section B.2.4.1.
@@ -518,20 +648,136 @@ func (d *decoder) processApp14Marker(n int) error {
 // decode reads a JPEG image from r and returns it as an image.Image.
 func (d *decoder) decode(r io.Reader, configOnly bool) (image.Image, error) {
 	d.r = r
+	if err := d.readSOI(); err != nil {
+		return nil, err
+	}
+	// Process the remaining segments until the End Of Image marker, or
+	// until maxScans scans, in which case stopped is set.
+	stopped := false
+	for {
+		marker, err := d.nextMarker()
+		if err != nil {
+			return d.truncated(err, configOnly)
+		}
+		if d.onMarker != nil {
+			d.onMarker(marker)
+		}
+		if marker == eoiMarker { // End Of Image.
+			if d.progress != nil {
+				d.reportProgress(true)
+			}
+			break
+		}
+		if done, err := d.processSegment(marker, configOnly); done || err != nil {
+			if marker == sosMarker && err != nil && d.abandonScan(err) {
+				continue
+			}
+			if err != nil {
+				return d.truncated(err, configOnly)
+			}
+			return nil, nil
+		}
+		if marker == sosMarker {
+			d.scans++
+		}
+		if d.progress != nil {
+			d.reportProgress(false)
+		}
+		if marker != sosMarker {
+			continue
+		}
+		if d.onScan != nil {
+			m, err := d.snapshot(true)
+			if err != nil {
+				return nil, err
+			}
+			d.onScan(d.scans, m)
+		}
+		if d.maxScans > 0 && d.scans == d.maxScans {
+			// The rest of the data is not read.
+			stopped = true
+			break
+		}
+	}
+	if d.coeffsOnly {
+		return nil, nil
+	}
+	if stopped {
+		// The components that no decoded scan included are mid-gray, as
+		// in the previews of partially decoded images.
+		return d.snapshot(true)
+	}
+	if d.progressive {
+		if err := d.reconstructProgressiveImage(); err != nil {
+			return nil, err
+		}
+	}
+	return d.image()
+}
 
-	// Check for the Start Of Image marker.
-	if err := d.readFull(d.tmp[:2]); err != nil {
+// ErrTruncated is the error returned with the partially decoded image of a
+// file that ends before its End Of Image marker, once its first scan has
+// started. Progressive images are meant to be useful when truncated: the
+// image holds every coefficient decoded so far. The returned error wraps
+// both ErrTruncated and the error that ended the decode, such as
+// [io.ErrUnexpectedEOF], so it is checked with [errors.Is].
+var ErrTruncated = FormatError("truncated image")
+
+// truncated returns the error err of a decode. If the data ended after the
+// first scan started, it returns the image decoded so far, with
+// ErrTruncated wrapping err: the blocks of a baseline image that were not
+// decoded are zero, and so are the coefficients of a progressive image,
+// whose components that no scan has included yet are mid-gray.
+func (d *decoder) truncated(err error, configOnly bool) (image.Image, error) {
+	if configOnly || err != io.ErrUnexpectedEOF && err != errShortHuffmanData {
 		return nil, err
 	}
+	if d.img1 == nil && d.img3 == nil && d.imgN == nil {
+		return nil, err
+	}
+	m, err2 := d.snapshot(true)
+	if err2 != nil {
+		return nil, err
+	}
+	return m, truncatedError{err}
+}
+
+// truncatedError is the error of a truncated decode: ErrTruncated,
+// wrapping the error err that ended the decode.
+type truncatedError struct {
+	err error
+}
+
+// Error returns the message of ErrTruncated followed by that of err,
+// without repeating the prefix of a FormatError.
+func (e truncatedError) Error() string {
+	cause := e.err.Error()
+	if fe, ok := e.err.(FormatError); ok {
+		cause = string(fe)
+	}
+	return ErrTruncated.Error() + ": " + cause
+}
+
+func (e truncatedError) Unwrap() []error { return []error{ErrTruncated, e.err} }
+
+// readSOI checks for the Start Of Image marker.
+func (d *decoder) readSOI() error {
+	if err := d.readFull(d.tmp[:2]); err != nil {
+		return err
+	}
 	if d.tmp[0] != 0xff || d.tmp[1] != soiMarker {
-		return nil, FormatError("missing SOI marker")
+		return FormatError("missing SOI marker")
 	}
+	return nil
+}
 
-	// Process the remaining segments until the End Of Image marker.
+// nextMarker reads the next marker, skipping extraneous data and fill
+// bytes.
+func (d *decoder) nextMarker() (byte, error) {
 	for {
 		err := d.readFull(d.tmp[:2])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 		for d.tmp[0] != 0xff {
 			// Strictly speaking, this is a format error. However, libjpeg is
@@ -557,7 +803,7 @@ func (d *decoder) decode(r io.Reader, configOnly bool) (image.Image, error) {
 			d.tmp[0] = d.tmp[1]
 			d.tmp[1], err = d.readByte()
 			if err != nil {
-				return nil, err
+				return 0, err
 			}
 		}
 		marker := d.tmp[1]
@@ -570,95 +816,139 @@ func (d *decoder) decode(r io.Reader, configOnly bool) (image.Image, error) {
 			// number of fill bytes, which are bytes assigned code X'FF'".
 			marker, err = d.readByte()
 			if err != nil {
-				return nil, err
+				return 0, err
 			}
 		}
-		if marker == eoiMarker { // End Of Image.
-			break
-		}
-		if rst0Marker <= marker && marker <= rst7Marker {
-			// Figures B.2 and B.16 of the specification suggest that restart markers should
-			// only occur between Entropy Coded Segments and not after the final ECS.
-			// However, some encoders may generate incorrect JPEGs with a final restart
-			// marker. That restart marker will be seen here instead of inside the processSOS
-			// method, and is ignored as a harmless error. Restart markers have no extra data,
-			// so we check for this before we read the 16-bit length of the segment.
-			continue
+		return marker, nil
+	}
+}
+
+// processSegment processes the segment of marker, which is not EOI. If
+// configOnly is true, it only reads the frame header, and done reports
+// whether the configuration is known.
+func (d *decoder) processSegment(marker byte, configOnly bool) (done bool, err error) {
+	if rst0Marker <= marker && marker <= rst7Marker {
+		// Figures B.2 and B.16 of the specification suggest that restart markers should
+		// only occur between Entropy Coded Segments and not after the final ECS.
+		// However, some encoders may generate incorrect JPEGs with a final restart
+		// marker. That restart marker will be seen here instead of inside the processSOS
+		// method, and is ignored as a harmless error. Restart markers have no extra data,
+		// so we check for this before we read the 16-bit length of the segment.
+		return false, nil
+	}
+
+	// Read the 16-bit length of the segment. The value includes the 2 bytes for the
+	// length itself, so we subtract 2 to get the number of remaining bytes.
+	if err = d.readFull(d.tmp[:2]); err != nil {
+		return false, err
+	}
+	n := int(d.tmp[0])<<8 + int(d.tmp[1]) - 2
+	if n < 0 {
+		return false, FormatError("short segment length")
+	}
+	if d.onSegment != nil {
+		p := make([]byte, n)
+		if err = d.readFull(p); err != nil {
+			return false, err
 		}
+		d.onSegment(marker, p)
+		d.segment = p
+		defer func() { d.segment = nil }()
+	}
 
-		// Read the 16-bit length of the segment. The value includes the 2 bytes for the
-		// length itself, so we subtract 2 to get the number of remaining bytes.
-		if err = d.readFull(d.tmp[:2]); err != nil {
-			return nil, err
+	switch marker {
+	case sof0Marker, sof1Marker, sof2Marker:
+		d.baseline = marker == sof0Marker
+		d.progressive = marker == sof2Marker
+		err = d.processSOF(n)
+		if configOnly && d.jfif {
+			return true, err
 		}
-		n := int(d.tmp[0])<<8 + int(d.tmp[1]) - 2
-		if n < 0 {
-			return nil, FormatError("short segment length")
+	case dhtMarker:
+		if configOnly {
+			err = d.ignore(n)
+		} else {
+			err = d.processDHT(n)
 		}
-
-		switch marker {
-		case sof0Marker, sof1Marker, sof2Marker:
-			d.baseline = marker == sof0Marker
-			d.progressive = marker == sof2Marker
-			err = d.processSOF(n)
-			if configOnly && d.jfif {
-				return nil, err
-			}
-		case dhtMarker:
-			if configOnly {
-				err = d.ignore(n)
-			} else {
-				err = d.processDHT(n)
-			}
-		case dqtMarker:
-			if configOnly {
-				err = d.ignore(n)
-			} else {
-				err = d.processDQT(n)
-			}
-		case sosMarker:
-			if configOnly {
-				return nil, nil
-			}
-			err = d.processSOS(n)
-		case driMarker:
-			if configOnly {
-				err = d.ignore(n)
-			} else {
-				err = d.processDRI(n)
-			}
-		case app0Marker:
-			err = d.processApp0Marker(n)
-		case app14Marker:
-			err = d.processApp14Marker(n)
-		default:
-			if app0Marker <= marker && marker <= app15Marker || marker == comMarker {
-				err = d.ignore(n)
-			} else if marker < 0xc0 { // See Table B.1 "Marker code assignments".
-				err = FormatError("unknown marker")
-			} else {
-				err = UnsupportedError("unknown marker")
-			}
+	case dqtMarker:
+		if configOnly {
+			err = d.ignore(n)
+		} else {
+			err = d.processDQT(n)
 		}
-		if err != nil {
-			return nil, err
+	case sosMarker:
+		if configOnly {
+			return true, nil
+		}
+		if d.scanLimit > 0 && d.scans+d.corruptScans >= d.scanLimit {
+			return false, errScanLimit
+		}
+		err = d.processSOS(n)
+	case driMarker:
+		if configOnly {
+			err = d.ignore(n)
+		} else {
+			err = d.processDRI(n)
+		}
+	case app0Marker:
+		err = d.processApp0Marker(n)
+	case app1Marker:
+		err = d.processApp1Marker(n)
+	case app2Marker:
+		err = d.processApp2Marker(n)
+	case app14Marker:
+		err = d.processApp14Marker(n)
+	default:
+		if app0Marker <= marker && marker <= app15Marker || marker == comMarker {
+			err = d.ignore(n)
+		} else if marker < 0xc0 { // See Table B.1 "Marker code assignments".
+			err = FormatError("unknown marker")
+		} else {
+			err = UnsupportedError("unknown marker")
 		}
 	}
+	return false, err
+}
 
+// snapshot returns the image decoded so far. The coefficients of a
+// progressive image are reconstructed first, with the components that no
+// scan has included yet set to mid-gray if missing is true.
+func (d *decoder) snapshot(missing bool) (image.Image, error) {
 	if d.progressive {
-		if err := d.reconstructProgressiveImage(); err != nil {
+		if err := d.reconstructComponents(missing); err != nil {
 			return nil, err
 		}
 	}
+	return d.image()
+}
+
+// image returns the decoded image, converted as its metadata says, and
+// cropped to the region of DecodeRegion.
+func (d *decoder) image() (image.Image, error) {
+	m, err := d.frameImage()
+	if err != nil {
+		return nil, err
+	}
+	return d.crop(m), nil
+}
+
+// frameImage returns the decoded image, converted as its metadata says.
+func (d *decoder) frameImage() (image.Image, error) {
 	if d.img1 != nil {
 		return d.img1, nil
 	}
+	if d.imgN != nil {
+		return d.imgN, nil
+	}
 	if d.img3 != nil {
 		if d.blackPix != nil {
 			return d.applyBlack()
 		} else if d.isRGB() {
 			return d.convertToRGB()
 		}
+		if d.upsampler != nil && d.img3.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+			return upsampleYCbCr(d.img3, d.upsampler), nil
+		}
 		return d.img3, nil
 	}
 	return nil, FormatError("missing SOS marker")
@@ -736,14 +1026,21 @@ func (d *decoder) applyBlack() (image.Image, error) {
 	return img, nil
 }
 
+// isRGB returns whether the three components of the image are R, G and B
+// rather than Y, Cb and Cr. As in libjpeg's jdapimin.c, a JFIF segment means
+// YCbCr, and an Adobe segment decides by its transform, whatever the
+// component identifiers say; only files with neither are RGB because of
+// their 'R', 'G' and 'B' identifiers.
 func (d *decoder) isRGB() bool {
 	if d.jfif {
 		return false
 	}
-	if d.adobeTransformValid && d.adobeTransform == adobeTransformUnknown {
+	if d.adobeTransformValid {
 		// https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/JPEG.html#Adobe
 		// says that 0 means Unknown (and in practice RGB) and 1 means YCbCr.
-		return true
+		// libjpeg also decodes the invalid 2, YCCK, of 3-component files as
+		// YCbCr.
+		return d.adobeTransform == adobeTransformUnknown
 	}
 	return d.comp[0].c == 'R' && d.comp[1].c == 'G' && d.comp[2].c == 'B'
 }
@@ -766,7 +1063,9 @@ func (d *decoder) convertToRGB() (image.Image, error) {
 	return img, nil
 }
 
-// Decode reads a JPEG image from r and returns it as an [image.Image].
+// Decode reads a JPEG image from r and returns it as an [image.Image]. If r
+// ends in the middle of the image data, Decode returns the image decoded so
+// far with [ErrTruncated].
 func Decode(r io.Reader) (image.Image, error) {
 	var d decoder
 	return d.decode(r, false)
@@ -803,6 +1102,13 @@ func DecodeConfig(r io.Reader) (image.Config, error) {
 			Height:     d.height,
 		}, nil
 	}
+	if d.nComp > maxComponents {
+		return image.Config{
+			ColorModel: color.GrayModel,
+			Width:      d.width,
+			Height:     d.height,
+		}, nil
+	}
 	return image.Config{}, FormatError("missing SOF marker")
 }
 
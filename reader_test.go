@@ -7,6 +7,7 @@ package progjpeg
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -570,3 +571,98 @@ func BenchmarkDecodeBaseline(b *testing.B) {
 func BenchmarkDecodeProgressive(b *testing.B) {
 	benchmarkDecode(b, "testdata/video-001.progressive.jpeg")
 }
+
+// TestRegisteredFormat tests that the decoder is registered with the image
+// package, so that image.Decode reads progressive files with it.
+func TestRegisteredFormat(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 40, 24))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Quality: 90, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "jpeg" || cfg.Width != 40 || cfg.Height != 24 || cfg.ColorModel != color.GrayModel {
+		t.Errorf("DecodeConfig: got %q, %+v", name, cfg)
+	}
+	got, name, err := image.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "jpeg" || !bytes.Equal(got.(*image.Gray).Pix, want.(*image.Gray).Pix) {
+		t.Errorf("Decode: got format %q and different pixels", name)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i*7 + i/64*13)
+	}
+	for _, progressive := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Quality: 90, Progressive: progressive}); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		want, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sos := bytes.Index(data, []byte{0xff, sosMarker})
+		// Cut the data in the middle of the first scan.
+		got, err := Decode(bytes.NewReader(data[:sos+(len(data)-sos)/4]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("progressive %v: got error %v, want ErrTruncated", progressive, err)
+		}
+		if got == nil || got.Bounds() != want.Bounds() {
+			t.Fatalf("progressive %v: got image %v", progressive, got)
+		}
+		if !progressive {
+			// The first rows are decoded.
+			r := image.Rect(0, 0, 64, 8)
+			if mse := meanSquaredError(got, want, r); mse != 0 {
+				t.Errorf("baseline: the first row of blocks has an MSE of %.2f", mse)
+			}
+		}
+		// Only missing the End Of Image marker loses nothing.
+		got, err = Decode(bytes.NewReader(data[:len(data)-2]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("progressive %v, no EOI: got error %v, want ErrTruncated", progressive, err)
+		}
+		// The error that ended the decode is still reported.
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("progressive %v, no EOI: got error %v, want io.ErrUnexpectedEOF", progressive, err)
+		}
+		if want := "invalid JPEG format: truncated image: unexpected EOF"; err.Error() != want {
+			t.Errorf("progressive %v, no EOI: got error %q, want %q", progressive, err, want)
+		}
+		if mse := meanSquaredError(got, want, want.Bounds()); mse != 0 {
+			t.Errorf("progressive %v, no EOI: got an MSE of %.2f", progressive, mse)
+		}
+		// Truncated data before the first scan is still an error.
+		if got, err := Decode(bytes.NewReader(data[:sos])); got != nil || err != io.ErrUnexpectedEOF {
+			t.Errorf("progressive %v, no scan: got %T, %v", progressive, got, err)
+		}
+	}
+}
+
+func TestTruncatedError(t *testing.T) {
+	// The prefix of a FormatError is not repeated.
+	err := error(truncatedError{errShortHuffmanData})
+	if want := "invalid JPEG format: truncated image: short Huffman data"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, errShortHuffmanData) {
+		t.Errorf("%v does not wrap ErrTruncated and its cause", err)
+	}
+}
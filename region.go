@@ -0,0 +1,135 @@
+package progjpeg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// DecodeRegion reads a JPEG image from r and returns the part of it inside
+// rect, in the coordinates of the whole image, for viewers that show tiles
+// of images too large to decode at once. Only the MCUs that cover rect are
+// reconstructed and kept in memory.
+//
+// The whole entropy-coded data is still read, except that of the restart
+// intervals of a sequential image that have no MCU in rect, which are
+// skipped without decoding them: images written with a restart interval,
+// such as one per MCU row, decode faster. The coefficients of progressive
+// images depend on those of the previous scans, so all of them are decoded
+// and kept.
+//
+// The bounds of the returned image are rect intersected with the bounds of
+// the image. It is an error if they are empty.
+func DecodeRegion(r io.Reader, rect image.Rectangle) (image.Image, error) {
+	if rect.Empty() {
+		return nil, errors.New("jpeg: empty region")
+	}
+	d := decoder{region: rect}
+	return d.decode(r, false)
+}
+
+// clipRegion clips d.region to the bounds of the image, once they are
+// known.
+func (d *decoder) clipRegion() error {
+	if d.region.Empty() {
+		return nil
+	}
+	r := d.region.Intersect(image.Rect(0, 0, d.width, d.height))
+	if r.Empty() {
+		return fmt.Errorf("jpeg: region %v is outside the %dx%d image", d.region, d.width, d.height)
+	}
+	d.region = r
+	return nil
+}
+
+// regionMCUs returns the rectangle, in units of MCUs, of the mxx by myy
+// MCUs of the image that cover d.region, or all of them if d.region is
+// empty.
+func (d *decoder) regionMCUs(mxx, myy int) image.Rectangle {
+	all := image.Rect(0, 0, mxx, myy)
+	if d.region.Empty() {
+		return all
+	}
+	w, h := 8*d.comp[0].h, 8*d.comp[0].v
+	r := d.region
+	return image.Rect(r.Min.X/w, r.Min.Y/h, (r.Max.X+w-1)/w, (r.Max.Y+h-1)/h).Intersect(all)
+}
+
+// inMCUs reports whether the block (bx, by) of the component compIndex is
+// in one of the MCUs that the decoder reconstructs.
+func (d *decoder) inMCUs(bx, by, compIndex int) bool {
+	h, v := d.comp[compIndex].h, d.comp[compIndex].v
+	return d.mcus.Min.X*h <= bx && bx < d.mcus.Max.X*h && d.mcus.Min.Y*v <= by && by < d.mcus.Max.Y*v
+}
+
+// runInRect reports whether a run of n cells starting at cell a, in a grid
+// of width w traversed left to right and top to bottom, has a cell in r.
+// The cells are the MCUs or blocks that a restart interval covers.
+func runInRect(a, n, w int, r image.Rectangle) bool {
+	y0, y1 := a/w, (a+n-1)/w
+	for y := max(y0, r.Min.Y); y <= min(y1, r.Max.Y-1); y++ {
+		x0, x1 := 0, w
+		if y == y0 {
+			x0 = a % w
+		}
+		if y == y1 {
+			x1 = (a+n-1)%w + 1
+		}
+		if max(x0, r.Min.X) < min(x1, r.Max.X) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipToMarker skips the entropy-coded data up to the next marker, such as
+// the RST marker that ends a restart interval, and leaves the marker
+// unread. It must be called at the start of a restart interval, when no
+// bits are buffered.
+func (d *decoder) skipToMarker() error {
+	for {
+		x, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		if x != 0xff {
+			continue
+		}
+		for x == 0xff {
+			if x, err = d.readByte(); err != nil {
+				return err
+			}
+		}
+		if x != 0x00 {
+			// fill keeps the last 2 bytes of the buffer, which are the
+			// marker.
+			d.bytes.i -= 2
+			return nil
+		}
+	}
+}
+
+// crop returns the part of m inside d.region, if it is not empty.
+func (d *decoder) crop(m image.Image) image.Image {
+	if d.region.Empty() {
+		return m
+	}
+	switch m := m.(type) {
+	case *Multiplane:
+		h0, v0 := d.comp[0].h, d.comp[0].v
+		r := d.region
+		c := &Multiplane{Planes: make([]*image.Gray, len(m.Planes)), Rect: r}
+		for i, p := range m.Planes {
+			h, v := d.comp[i].h, d.comp[i].v
+			pr := image.Rect(r.Min.X*h/h0, r.Min.Y*v/v0, (r.Max.X*h+h0-1)/h0, (r.Max.Y*v+v0-1)/v0)
+			c.Planes[i] = p.SubImage(pr).(*image.Gray)
+		}
+		return c
+	case interface {
+		SubImage(image.Rectangle) image.Image
+	}:
+		return m.SubImage(d.region)
+	}
+	return m
+}
@@ -0,0 +1,155 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// regionView is the part of an image inside r.
+type regionView struct {
+	image.Image
+	r image.Rectangle
+}
+
+func (v regionView) Bounds() image.Rectangle { return v.r }
+
+// baselineRestartScans writes m as a baseline image with one scan per
+// component, every one with restart intervals of n blocks.
+func baselineRestartScans(t *testing.T, m image.Image, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, m, &Options{Quality: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	for c := 0; c < 3; c++ {
+		if err := mw.WriteScan(ProgressiveScan{Component: c, SpectralEnd: blockSize - 1, RestartInterval: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeRegion(t *testing.T) {
+	photo := testimg.Photo(131, 77, 1)
+	planes := NewMultiplane(photo.Bounds(), 5)
+	for y := 0; y < 77; y++ {
+		for x := 0; x < 131; x++ {
+			for i, p := range planes.Planes {
+				p.Pix[p.PixOffset(x, y)] = uint8(x*(i+1) + y)
+			}
+		}
+	}
+	encode := func(m image.Image, o *Options) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	script := DefaultColorScanScript()
+	for i := range script {
+		script[i].RestartInterval = 3
+	}
+	files := map[string][]byte{
+		"baseline":                encode(photo, &Options{Quality: 80}),
+		"baseline restarts":       encode(photo, &Options{Quality: 80, Concurrency: 4}),
+		"baseline block restarts": baselineRestartScans(t, photo, 5),
+		"grayscale":               encode(photo, &Options{Quality: 80, Grayscale: true, Concurrency: 4}),
+		"progressive":             encode(photo, &Options{Quality: 80, Progressive: true}),
+		"progressive restarts":    encode(photo, &Options{Quality: 80, Progressive: true, ScanScript: script}),
+		"multiplane":              encode(planes, &Options{Quality: 80}),
+	}
+	for name, data := range files {
+		full, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, r := range []image.Rectangle{
+			image.Rect(0, 0, 131, 77),
+			image.Rect(0, 0, 16, 16),
+			image.Rect(37, 21, 70, 50),
+			image.Rect(100, 60, 200, 100),
+			image.Rect(-10, 40, 5, 41),
+		} {
+			m, err := DecodeRegion(bytes.NewReader(data), r)
+			if err != nil {
+				t.Fatalf("%s %v: %v", name, r, err)
+			}
+			want := r.Intersect(full.Bounds())
+			if m.Bounds() != want {
+				t.Errorf("%s %v: got bounds %v, want %v", name, r, m.Bounds(), want)
+				continue
+			}
+			if !equalImages(m, regionView{full, want}) {
+				t.Errorf("%s %v: the region differs from the decoded image", name, r)
+			}
+		}
+	}
+}
+
+func TestDecodeRegionSkipsIntervals(t *testing.T) {
+	// With Concurrency, every MCU row is a restart interval.
+	m := testimg.Photo(64, 64, 2)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Quality: 80, Concurrency: 4}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	want, err := DecodeRegion(bytes.NewReader(data), image.Rect(0, 40, 64, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the interval of the second MCU row, which the region does
+	// not need.
+	i := bytes.Index(data, []byte{0xff, rst0Marker})
+	j := bytes.Index(data, []byte{0xff, rst0Marker + 1})
+	if i < 0 || j < 0 {
+		t.Fatal("missing RST markers")
+	}
+	bad := bytes.Clone(data)
+	for k := i + 2; k < j; k++ {
+		bad[k] = 0
+	}
+	clean, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full, err := Decode(bytes.NewReader(bad)); err == nil && equalImages(full, clean) {
+		t.Fatal("the corruption does not change the decoded image")
+	}
+	got, err := DecodeRegion(bytes.NewReader(bad), image.Rect(0, 40, 64, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(got, want) {
+		t.Error("a skipped interval changes the region")
+	}
+}
+
+func TestDecodeRegionErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(32, 32, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []image.Rectangle{
+		{},
+		image.Rect(32, 0, 40, 8),
+		image.Rect(-8, -8, 0, 0),
+	} {
+		if _, err := DecodeRegion(bytes.NewReader(buf.Bytes()), r); err == nil {
+			t.Errorf("%v: got no error", r)
+		}
+	}
+}
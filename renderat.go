@@ -0,0 +1,43 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+)
+
+// errNoCompleteScan is returned by RenderAt when no scan fits in the bytes
+// that it reads.
+var errNoCompleteScan = errors.New("jpeg: no complete scan")
+
+// RenderAt decodes the JPEG image in r as a browser would display it after
+// downloading its first n bytes: from the scans that they hold completely,
+// as [DecodeOptions].MaxScans does. A scan is complete once its
+// entropy-coded data ends, without the marker that follows it, so calling
+// RenderAt at the End of each of the scans that [ReportScans] returns
+// shows how a scan script refines an image during a download. If n bytes
+// do not hold the first scan, which for a baseline image is the whole
+// image, RenderAt returns an error; a decode with [DecodeOptions].Lenient
+// shows the rows of a partial scan instead.
+func RenderAt(r io.Reader, n int64) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	scans := completeScans(data)
+	if scans == 0 {
+		return nil, errNoCompleteScan
+	}
+	return DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{MaxScans: scans})
+}
+
+// completeScans returns the number of scans whose entropy-coded data ends
+// within data: those that the decoder reads up to their last MCU.
+func completeScans(data []byte) int {
+	// The decoder only counts the scans that it processes without error,
+	// and a truncated scan ends with an error.
+	d := decoder{coeffsOnly: true}
+	d.decode(bytes.NewReader(data), false)
+	return d.scans
+}
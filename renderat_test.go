@@ -0,0 +1,73 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestRenderAt(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	scans, err := ReportScans(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scans {
+		want, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{MaxScans: i + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The marker that ends the scan is not needed, and the bytes of
+		// the next scan do not change the image.
+		for _, n := range []int64{s.End, s.End + 2, s.End + s.Bytes/2} {
+			if i+1 < len(scans) && n >= scans[i+1].End {
+				continue
+			}
+			got, err := RenderAt(bytes.NewReader(data), n)
+			if err != nil {
+				t.Fatalf("scan %d, %d bytes: %v", i, n, err)
+			}
+			if !equalImages(got, want) {
+				t.Errorf("scan %d, %d bytes: the image differs from that of %d scans", i, n, i+1)
+			}
+		}
+	}
+	full, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RenderAt(bytes.NewReader(data), int64(len(data))+100)
+	if err != nil || !equalImages(got, full) {
+		t.Errorf("the whole file does not render the image (%v)", err)
+	}
+
+	if _, err := RenderAt(bytes.NewReader(data), scans[0].End-1); err == nil {
+		t.Error("rendering before the end of the first scan did not fail")
+	}
+
+	// The chroma of the mozjpeg script, whose first scan is a luma DC
+	// scan, is mid-gray until its own DC scan.
+	script, _ := Preset("mozjpeg")
+	buf.Reset()
+	if err := Encode(&buf, src, &Options{Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	if scans, err = ReportScans(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	m, err := RenderAt(bytes.NewReader(buf.Bytes()), scans[0].End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ycc := m.(*image.YCbCr)
+	if c := ycc.COffset(40, 20); ycc.Cb[c] != 0x80 || ycc.Cr[c] != 0x80 {
+		t.Errorf("luma DC scan only: got chroma (%d, %d), want mid-gray", ycc.Cb[c], ycc.Cr[c])
+	}
+}
@@ -0,0 +1,153 @@
+package progjpeg
+
+import (
+	"fmt"
+	"io"
+)
+
+// A Transform is a lossless rotation or flip of [Reorient]. Its values are
+// those of the Exif orientations that it undoes, as in [Metadata]: an image
+// whose orientation is 6 is upright once rotated by 90° clockwise.
+type Transform int
+
+const (
+	FlipHorizontal Transform = 2 // Mirror left and right.
+	Rotate180      Transform = 3 // Rotate by 180°.
+	FlipVertical   Transform = 4 // Mirror top and bottom.
+	Transpose      Transform = 5 // Mirror along the top-left to bottom-right diagonal.
+	Rotate90       Transform = 6 // Rotate by 90° clockwise.
+	Transverse     Transform = 7 // Mirror along the top-right to bottom-left diagonal.
+	Rotate270      Transform = 8 // Rotate by 90° counterclockwise.
+)
+
+// Reorient reads the JPEG image in r and writes it to w rotated or flipped
+// as t says, as jpegtran -rotate, -flip, -transpose and -transverse do. The
+// blocks are moved, and their coefficients transposed or negated, without
+// decoding any pixel, so nothing is quantized again: undoing the transform
+// gives back the original coefficients, and the pixels only differ from
+// those of the original transformed by the rounding of the IDCT, by one or
+// two levels. The transforms that swap the axes also swap the
+// sampling factors, making a 4:2:2 image 4:4:0, and transpose the
+// quantization tables.
+//
+// The partial MCUs on the right and bottom edges cannot be moved to the
+// other side, so they are dropped when t mirrors their axis, as
+// jpegtran -trim does: rotating a 4:2:0 image 100 pixels wide by 180°
+// gives an image 96 pixels wide. The result is baseline or progressive like
+// the original, and keeps its APPn and COM segments as they are, including
+// the Exif orientation, which the caller may need to update.
+func Reorient(w io.Writer, r io.Reader, t Transform) error {
+	if t < FlipHorizontal || t > Rotate270 {
+		return fmt.Errorf("jpeg: invalid transform %d", t)
+	}
+	return transcode(w, r, nil, func(tc *transcoding) error {
+		return tc.reorient(int(t))
+	})
+}
+
+// reorient transforms the blocks of t as the Exif orientation o says, and
+// updates the size and quantization tables of the image.
+func (t *transcoding) reorient(o int) error {
+	planes, meta := t.planes, t.meta
+	mw, mh := t.mcuSize()
+	// The source pixel of the destination pixel (x, y) is at w-1-x or
+	// h-1-y on the mirrored axes, which must hold whole MCUs.
+	w, h := meta.Width, meta.Height
+	switch o {
+	case 2, 8:
+		w -= w % mw
+	case 4, 6:
+		h -= h % mh
+	case 3, 7:
+		w -= w % mw
+		h -= h % mh
+	}
+	if w == 0 || h == 0 {
+		return fmt.Errorf("jpeg: cannot transform a %dx%d image without partial MCUs", meta.Width, meta.Height)
+	}
+	transposed := o >= 5
+	out := make([]CoefficientPlane, len(planes))
+	for i, p := range planes {
+		// bw and bh are the number of blocks of the source plane kept.
+		bw, bh := (w+7)/8, (h+7)/8
+		if len(planes) > 1 {
+			bw, bh = (w+mw-1)/mw*p.H, (h+mh-1)/mh*p.V
+		}
+		q := CoefficientPlane{H: p.H, V: p.V, Table: p.Table, Width: bw, Height: bh}
+		if transposed {
+			q.H, q.V, q.Width, q.Height = p.V, p.H, bh, bw
+		}
+		q.Blocks = make([][blockSize]int32, q.Width*q.Height)
+		for y := 0; y < q.Height; y++ {
+			for x := 0; x < q.Width; x++ {
+				sx, sy := orientSource(x, y, bw, bh, o)
+				reorientBlock(&q.Blocks[y*q.Width+x], &p.Blocks[sy*p.Width+sx], o)
+			}
+		}
+		out[i] = q
+	}
+	meta.Width, meta.Height = w, h
+	if transposed {
+		meta.Width, meta.Height = h, w
+		for i := range meta.QuantTables {
+			t := &meta.QuantTables[i]
+			var natural [blockSize]uint8
+			for zig, v := range t {
+				natural[unzig[zig]] = v
+			}
+			for zig := range t {
+				u := unzig[zig]
+				t[zig] = natural[u%8*8+u/8]
+			}
+		}
+	}
+	t.planes = out
+	return nil
+}
+
+// orientSource returns the position in a w by h source of the position
+// (x, y) of its transform by the Exif orientation o, as orientPlane does.
+func orientSource(x, y, w, h, o int) (sx, sy int) {
+	switch o {
+	case 2:
+		return w - 1 - x, y
+	case 3:
+		return w - 1 - x, h - 1 - y
+	case 4:
+		return x, h - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, h - 1 - x
+	case 7:
+		return w - 1 - y, h - 1 - x
+	case 8:
+		return w - 1 - y, x
+	}
+	return x, y
+}
+
+// reorientBlock stores in dst the coefficients of the block src transformed
+// as the Exif orientation o says. Mirroring a block negates the
+// coefficients of the odd frequencies along the mirrored axis, and
+// transposing it transposes its coefficients.
+func reorientBlock(dst, src *[blockSize]int32, o int) {
+	// negRow and negCol are the destination frequencies that change sign.
+	negRow := o == 3 || o == 4 || o == 7 || o == 8
+	negCol := o == 2 || o == 3 || o == 6 || o == 7
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			v := src[r*8+c]
+			if o >= 5 {
+				v = src[c*8+r]
+			}
+			if negRow && r%2 == 1 {
+				v = -v
+			}
+			if negCol && c%2 == 1 {
+				v = -v
+			}
+			dst[r*8+c] = v
+		}
+	}
+}
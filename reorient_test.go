@@ -0,0 +1,144 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestReorient(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, tc := range []struct {
+		name string
+		m    image.Image
+		o    *Options
+	}{
+		{"4:2:0", src, &Options{Quality: 75}},
+		{"4:2:2", toYCbCr422(src), &Options{Quality: 75, Progressive: true}},
+		{"gray", src, &Options{Quality: 75, Grayscale: true, Progressive: true}},
+		{"RGB", src, &Options{Quality: 75, RGB: true}},
+	} {
+		var data bytes.Buffer
+		if err := Encode(&data, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for tr := FlipHorizontal; tr <= Rotate270; tr++ {
+			var buf bytes.Buffer
+			if err := Reorient(&buf, bytes.NewReader(data.Bytes()), tr); err != nil {
+				t.Fatalf("%s, %d: %v", tc.name, tr, err)
+			}
+			got, err := Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s, %d: %v", tc.name, tr, err)
+			}
+			// The decoded image, trimmed of the partial MCUs that the
+			// transform mirrors, and transformed in the pixel domain. The
+			// IDCT rounds a transformed block differently.
+			mw, mh := 16, 16
+			switch tc.name {
+			case "4:2:2":
+				mh = 8
+			case "gray", "RGB":
+				mw, mh = 8, 8
+			}
+			w, h := 83, 47
+			if tr == FlipHorizontal || tr == Rotate180 || tr == Transverse || tr == Rotate270 {
+				w -= w % mw
+			}
+			if tr == FlipVertical || tr == Rotate180 || tr == Rotate90 || tr == Transverse {
+				h -= h % mh
+			}
+			trimmed := m.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(image.Rect(0, 0, w, h))
+			want := orient(trimmed, int(tr))
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("%s, %d: got bounds %v, want %v", tc.name, tr, got.Bounds(), want.Bounds())
+			}
+			if d := maxChannelDiff(got, want); d > 3 {
+				t.Errorf("%s, %d: the pixels differ by up to %d", tc.name, tr, d)
+			}
+			p, err := Probe(bytes.NewReader(buf.Bytes()))
+			if err != nil || p.Progressive != tc.o.Progressive {
+				t.Errorf("%s, %d: progressive is %v, want %v (%v)", tc.name, tr, p.Progressive, tc.o.Progressive, err)
+			}
+		}
+	}
+
+	// Undoing a transform of an image of whole MCUs gives back its
+	// coefficients.
+	var aligned bytes.Buffer
+	if err := Encode(&aligned, toYCbCr422(testimg.Photo(48, 32, 1)), &Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := DecodeCoefficients(bytes.NewReader(aligned.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range [][2]Transform{
+		{FlipHorizontal, FlipHorizontal},
+		{Rotate180, Rotate180},
+		{FlipVertical, FlipVertical},
+		{Transpose, Transpose},
+		{Rotate90, Rotate270},
+		{Transverse, Transverse},
+		{Rotate270, Rotate90},
+	} {
+		var once, twice bytes.Buffer
+		if err := Reorient(&once, bytes.NewReader(aligned.Bytes()), tr[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := Reorient(&twice, bytes.NewReader(once.Bytes()), tr[1]); err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := DecodeCoefficients(bytes.NewReader(twice.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			if got[i].H != want[i].H || got[i].V != want[i].V || got[i].Width != want[i].Width || got[i].Height != want[i].Height {
+				t.Fatalf("%v: plane %d is %dx%d blocks sampled %dx%d, want %dx%d sampled %dx%d", tr, i,
+					got[i].Width, got[i].Height, got[i].H, got[i].V, want[i].Width, want[i].Height, want[i].H, want[i].V)
+			}
+			for j := range want[i].Blocks {
+				if got[i].Blocks[j] != want[i].Blocks[j] {
+					t.Errorf("%v: plane %d, block %d differs", tr, i, j)
+					break
+				}
+			}
+		}
+	}
+
+	var data bytes.Buffer
+	if err := Encode(&data, testimg.Photo(12, 40, 1), &Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reorient(new(bytes.Buffer), bytes.NewReader(data.Bytes()), Rotate180); err == nil {
+		t.Error("rotating an image narrower than an MCU did not fail")
+	}
+	if err := Reorient(new(bytes.Buffer), bytes.NewReader(data.Bytes()), 1); err == nil {
+		t.Error("an invalid transform did not fail")
+	}
+}
+
+// maxChannelDiff returns the largest difference between the red, green and
+// blue values of the pixels of a and b, which have the same bounds.
+func maxChannelDiff(a, b image.Image) int {
+	d := 0
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := color.NRGBAModel.Convert(a.At(x, y)).(color.NRGBA)
+			q := color.NRGBAModel.Convert(b.At(x, y)).(color.NRGBA)
+			d = max(d, int(absDiff(p.R, q.R)), int(absDiff(p.G, q.G)), int(absDiff(p.B, q.B)))
+		}
+	}
+	return d
+}
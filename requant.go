@@ -0,0 +1,51 @@
+package progjpeg
+
+import "io"
+
+// Requantize reads the JPEG image in r and writes it to w with the
+// quantization tables of the given quality, clipped to [1, 100] as in
+// [Options], dividing its coefficients again instead of decoding and
+// re-encoding its pixels: the only loss is that of the coarser tables, not
+// that of a second IDCT, color conversion and DCT. A step of the new tables
+// that would be finer than that of the original keeps its value, since it
+// could not restore what the original lost, so requantizing an image to a
+// quality higher than its own changes nothing but its size, if it was not
+// made with the standard tables. The result is baseline or progressive
+// like the original, and keeps its APPn and COM segments.
+func Requantize(w io.Writer, r io.Reader, quality int) error {
+	return transcode(w, r, nil, func(t *transcoding) error {
+		t.requantize(quality)
+		return nil
+	})
+}
+
+// requantize divides the coefficients of t again by the tables of the
+// given quality, where they are coarser than those of the image.
+func (t *transcoding) requantize(quality int) {
+	var std [nQuantIndex][blockSize]byte
+	quantTables(&std, min(max(quality, 1), 100))
+	// scale[i][k] is the ratio of the old to the new step of the
+	// coefficient k, in natural order, of the table i.
+	type ratio struct{ old, new int32 }
+	scale := make([][blockSize]ratio, len(t.meta.QuantTables))
+	for i := range t.meta.QuantTables {
+		q := &t.meta.QuantTables[i]
+		for zig, old := range q {
+			n := max(old, std[min(i, len(std)-1)][zig])
+			scale[i][unzig[zig]] = ratio{int32(old), int32(n)}
+			q[zig] = n
+		}
+	}
+	for _, p := range t.planes {
+		s := &scale[p.Table]
+		for j := range p.Blocks {
+			b := &p.Blocks[j]
+			for k, c := range b {
+				if s[k].old == s[k].new {
+					continue
+				}
+				b[k] = div(c*s[k].old, s[k].new)
+			}
+		}
+	}
+}
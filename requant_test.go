@@ -0,0 +1,94 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// padding reports whether the block j of planes[i], of an 83x47 image, only
+// pads the last MCUs. EncodeCoefficients repeats the last block of the row
+// or column there, instead of the padding pixels of Encode.
+func padding(planes []CoefficientPlane, i, j int) bool {
+	p := planes[i]
+	bw := (83*p.H/planes[0].H + 7) / 8
+	bh := (47*p.V/planes[0].V + 7) / 8
+	return j%p.Width >= bw || j/p.Width >= bh
+}
+
+func TestRequantize(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, o := range []*Options{
+		{Quality: 95},
+		{Quality: 95, Progressive: true},
+		{Quality: 95, Grayscale: true},
+	} {
+		var data bytes.Buffer
+		if err := Encode(&data, src, o); err != nil {
+			t.Fatal(err)
+		}
+		orig, origMeta, err := DecodeCoefficients(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := Requantize(&buf, bytes.NewReader(data.Bytes()), 50); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= data.Len() {
+			t.Errorf("got %d bytes, want fewer than %d", buf.Len(), data.Len())
+		}
+		planes, meta, err := DecodeCoefficients(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var std [nQuantIndex][blockSize]byte
+		quantTables(&std, 50)
+		for i, q := range meta.QuantTables {
+			if q != std[i] {
+				t.Errorf("table %d is not that of quality 50", i)
+			}
+		}
+		for i, p := range planes {
+			old, q := origMeta.QuantTables[p.Table], meta.QuantTables[p.Table]
+			for j, b := range p.Blocks {
+				if padding(planes, i, j) {
+					continue
+				}
+				for zig := range b {
+					k := unzig[zig]
+					if want := div(orig[i].Blocks[j][k]*int32(old[zig]), int32(q[zig])); b[k] != want {
+						t.Fatalf("plane %d, block %d, coefficient %d: got %d, want %d", i, j, k, b[k], want)
+					}
+				}
+			}
+		}
+		if p, err := Probe(bytes.NewReader(buf.Bytes())); err != nil || p.Progressive != o.Progressive {
+			t.Errorf("progressive is %v, want %v (%v)", p.Progressive, o.Progressive, err)
+		}
+
+		// Finer tables keep those of the image, and its coefficients.
+		buf.Reset()
+		if err := Requantize(&buf, bytes.NewReader(data.Bytes()), 100); err != nil {
+			t.Fatal(err)
+		}
+		planes, meta, err = DecodeCoefficients(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, q := range meta.QuantTables {
+			if q != origMeta.QuantTables[i] {
+				t.Errorf("quality 100: table %d changed", i)
+			}
+		}
+		for i, p := range planes {
+			for j := range p.Blocks {
+				if !padding(planes, i, j) && p.Blocks[j] != orig[i].Blocks[j] {
+					t.Fatalf("quality 100: plane %d, block %d changed", i, j)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package progjpeg
+
+import (
+	"image"
+	"io"
+)
+
+// A Downsampler reduces the resolution of the chroma planes of an image
+// before encoding. Downsample writes to dst the plane src reduced by a
+// factor of fx horizontally and fy vertically: the dst pixel (x, y) covers
+// the src pixels (x*fx, y*fy) to (x*fx+fx-1, y*fy+fy-1), relative to the
+// planes' top-left corners. dst is (src.Dx()+fx-1)/fx pixels wide and
+// (src.Dy()+fy-1)/fy pixels high, so the last column and row of dst may
+// cover fewer src pixels than the others.
+type Downsampler interface {
+	Downsample(dst, src *image.Gray, fx, fy int)
+}
+
+// An Upsampler restores the resolution of subsampled chroma planes after
+// decoding. Upsample writes to dst the plane src enlarged by a factor of fx
+// horizontally and fy vertically, with the same pixel correspondence as for
+// [Downsampler]. dst may be smaller than fx*src.Dx() by fy*src.Dy().
+type Upsampler interface {
+	Upsample(dst, src *image.Gray, fx, fy int)
+}
+
+// BoxDownsampler is a [Downsampler] that averages the pixels covered by each
+// destination pixel, repeating the last column and row of the source where
+// needed. It is the encoder's built-in filter.
+type BoxDownsampler struct{}
+
+func (BoxDownsampler) Downsample(dst, src *image.Gray, fx, fy int) {
+	sb, db := src.Bounds(), dst.Bounds()
+	n := fx * fy
+	for y := 0; y < db.Dy(); y++ {
+		for x := 0; x < db.Dx(); x++ {
+			sum := 0
+			for j := 0; j < fy; j++ {
+				row := src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+min(y*fy+j, sb.Dy()-1)):]
+				for i := 0; i < fx; i++ {
+					sum += int(row[min(x*fx+i, sb.Dx()-1)])
+				}
+			}
+			dst.Pix[dst.PixOffset(db.Min.X+x, db.Min.Y+y)] = uint8((sum + n/2) / n)
+		}
+	}
+}
+
+// TriangleDownsampler is a [Downsampler] that applies a triangle (tent)
+// low-pass filter twice as wide as the reduction factor, centered on each
+// destination pixel, before decimating. For a factor of 2, each destination
+// pixel is a 1-3-3-1 weighted sum of 4 source pixels in both directions,
+// instead of the 1-1 sum of [BoxDownsampler], which reduces the color
+// fringes around sharp color edges. The edge pixels are repeated as needed.
+type TriangleDownsampler struct{}
+
+func (TriangleDownsampler) Downsample(dst, src *image.Gray, fx, fy int) {
+	sb, db := src.Bounds(), dst.Bounds()
+	xs := triangleTaps(db.Dx(), fx, sb.Dx())
+	ys := triangleTaps(db.Dy(), fy, sb.Dy())
+	for y, ty := range ys {
+		drow := dst.Pix[dst.PixOffset(db.Min.X, db.Min.Y+y):]
+		for x, tx := range xs {
+			sum := 0
+			for j, wy := range ty.w {
+				srow := src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+ty.i[j]):]
+				for i, wx := range tx.w {
+					sum += int(srow[tx.i[i]]) * wx * wy
+				}
+			}
+			n := tx.sum * ty.sum
+			drow[x] = uint8((sum + n/2) / n)
+		}
+	}
+}
+
+// triangleTap holds the source pixel indexes and weights of one destination
+// pixel.
+type triangleTap struct {
+	i, w []int
+	sum  int
+}
+
+// triangleTaps returns the taps of the n destination pixels of a triangle
+// filter reducing ns source pixels by a factor of f. In units of half source
+// pixels, the center of the destination pixel x is at 2*x*f+f-1 and the
+// filter extends 2*f on each side of it. The indexes are clamped to the
+// source.
+func triangleTaps(n, f, ns int) []triangleTap {
+	taps := make([]triangleTap, n)
+	for x := range taps {
+		c := 2*x*f + f - 1
+		t := &taps[x]
+		for i := (c - 2*f + 1) / 2; 2*i < c+2*f; i++ {
+			d := 2*i - c
+			if d < 0 {
+				d = -d
+			}
+			w := 2*f - d
+			if w <= 0 {
+				continue
+			}
+			t.i = append(t.i, min(max(i, 0), ns-1))
+			t.w = append(t.w, w)
+			t.sum += w
+		}
+	}
+	return taps
+}
+
+// NearestUpsampler is an [Upsampler] that repeats each source pixel. It is
+// equivalent to what [image.YCbCr] does when converting subsampled pixels to
+// RGB.
+type NearestUpsampler struct{}
+
+func (NearestUpsampler) Upsample(dst, src *image.Gray, fx, fy int) {
+	sb, db := src.Bounds(), dst.Bounds()
+	for y := 0; y < db.Dy(); y++ {
+		srow := src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+min(y/fy, sb.Dy()-1)):]
+		drow := dst.Pix[dst.PixOffset(db.Min.X, db.Min.Y+y):]
+		for x := 0; x < db.Dx(); x++ {
+			drow[x] = srow[min(x/fx, sb.Dx()-1)]
+		}
+	}
+}
+
+// LinearUpsampler is an [Upsampler] that interpolates linearly between the
+// centers of the source pixels, like libjpeg's "fancy upsampling". It avoids
+// the blocky color edges of [NearestUpsampler] at a modest cost.
+type LinearUpsampler struct{}
+
+func (LinearUpsampler) Upsample(dst, src *image.Gray, fx, fy int) {
+	sb, db := src.Bounds(), dst.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	// The center of the dst pixel x is at (x+0.5)/fx in src coordinates, or
+	// at u/(2*fx) - 0.5 relative to the src pixel centers, with u = 2*x+1.
+	// The weights are in units of 1/(2*fx) and 1/(2*fy).
+	xs := make([]struct{ x0, x1, w int }, db.Dx())
+	for x := range xs {
+		xs[x].x0, xs[x].x1, xs[x].w = linearTap(2*x+1-fx, 2*fx, sw)
+	}
+	for y := 0; y < db.Dy(); y++ {
+		y0, y1, wy := linearTap(2*y+1-fy, 2*fy, sh)
+		r0 := src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+y0):]
+		r1 := src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+y1):]
+		drow := dst.Pix[dst.PixOffset(db.Min.X, db.Min.Y+y):]
+		n := 2 * fx * 2 * fy
+		for x, t := range xs {
+			v := (int(r0[t.x0])*(2*fx-t.w)+int(r0[t.x1])*t.w)*(2*fy-wy) +
+				(int(r1[t.x0])*(2*fx-t.w)+int(r1[t.x1])*t.w)*wy
+			drow[x] = uint8((v + n/2) / n)
+		}
+	}
+}
+
+// linearTap returns the two source pixels surrounding the position p/d, in
+// units of source pixels relative to the center of the first one, and the
+// weight, out of d, of the second pixel. Positions outside of the n source
+// pixels are clamped.
+func linearTap(p, d, n int) (i0, i1, w int) {
+	if p <= 0 {
+		return 0, 0, 0
+	}
+	i0, w = p/d, p%d
+	if i0 >= n-1 {
+		return n - 1, n - 1, 0
+	}
+	return i0, i0 + 1, w
+}
+
+// downsampleYCbCr converts m to a 4:2:0 YCbCr image with the color transform
+// cm, using ds to compute the chroma planes from their full resolution
+// values. The result has the same size as m, with its top-left corner at the
+// origin.
+func downsampleYCbCr(m image.Image, ds Downsampler, cm *colorTransform) *image.YCbCr {
+	y, cb, cr := toYCbCrPlanes(m, cm)
+	r := y.Bounds()
+	dst := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	for j := 0; j < r.Max.Y; j++ {
+		copy(dst.Y[j*dst.YStride:], y.Pix[j*y.Stride:(j+1)*y.Stride])
+	}
+	cr2 := image.Rect(0, 0, (r.Dx()+1)/2, (r.Dy()+1)/2)
+	ds.Downsample(&image.Gray{Pix: dst.Cb, Stride: dst.CStride, Rect: cr2}, cb, 2, 2)
+	ds.Downsample(&image.Gray{Pix: dst.Cr, Stride: dst.CStride, Rect: cr2}, cr, 2, 2)
+	return dst
+}
+
+// toYCbCrPlanes converts m to full resolution Y, Cb and Cr planes with the
+// color transform cm, if m is not a YCbCr image. The planes have the same
+// size as m, with their top-left corner at the origin.
+func toYCbCrPlanes(m image.Image, cm *colorTransform) (y, cb, cr *image.Gray) {
+	b := m.Bounds()
+	r := image.Rect(0, 0, b.Dx(), b.Dy())
+	y, cb, cr = image.NewGray(r), image.NewGray(r), image.NewGray(r)
+	var yb, cbb, crb block
+	for j0 := 0; j0 < r.Max.Y; j0 += 8 {
+		for i0 := 0; i0 < r.Max.X; i0 += 8 {
+			p := image.Pt(b.Min.X+i0, b.Min.Y+j0)
+			switch m := m.(type) {
+			case *image.RGBA:
+				rgbaToYCbCr(m, p, cm, &yb, &cbb, &crb)
+			case *image.YCbCr:
+				yCbCrToYCbCr(m, p, &yb, &cbb, &crb)
+			default:
+				toYCbCr(m, p, cm, &yb, &cbb, &crb)
+			}
+			for j := 0; j < min(8, r.Max.Y-j0); j++ {
+				for i := 0; i < min(8, r.Max.X-i0); i++ {
+					o := y.PixOffset(i0+i, j0+j)
+					y.Pix[o] = uint8(yb[8*j+i])
+					cb.Pix[o] = uint8(cbb[8*j+i])
+					cr.Pix[o] = uint8(crb[8*j+i])
+				}
+			}
+		}
+	}
+	return y, cb, cr
+}
+
+// upsampleYCbCr returns a 4:4:4 copy of the subsampled image m, using us to
+// compute the full resolution chroma planes. m's top-left corner must be at
+// the origin, as for the images returned by the decoder.
+func upsampleYCbCr(m *image.YCbCr, us Upsampler) *image.YCbCr {
+	b := m.Bounds()
+	dst := image.NewYCbCr(b, image.YCbCrSubsampleRatio444)
+	for y := 0; y < b.Dy(); y++ {
+		copy(dst.Y[y*dst.YStride:(y+1)*dst.YStride], m.Y[y*m.YStride:])
+	}
+	fx, fy := subsampleFactors(m.SubsampleRatio)
+	cr := image.Rect(0, 0, (b.Dx()+fx-1)/fx, (b.Dy()+fy-1)/fy)
+	us.Upsample(&image.Gray{Pix: dst.Cb, Stride: dst.CStride, Rect: b},
+		&image.Gray{Pix: m.Cb, Stride: m.CStride, Rect: cr}, fx, fy)
+	us.Upsample(&image.Gray{Pix: dst.Cr, Stride: dst.CStride, Rect: b},
+		&image.Gray{Pix: m.Cr, Stride: m.CStride, Rect: cr}, fx, fy)
+	return dst
+}
+
+// subsampleFactors returns the horizontal and vertical chroma subsampling
+// factors of r.
+func subsampleFactors(r image.YCbCrSubsampleRatio) (fx, fy int) {
+	switch r {
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 1, 1
+}
+
+// DecodeOptions are the decoding parameters.
+type DecodeOptions struct {
+	// Upsampler, if non-nil, is used to restore the full resolution of the
+	// chroma planes of subsampled YCbCr images, which are then returned as
+	// 4:4:4 [image.YCbCr] images. If nil, the chroma planes are returned as
+	// stored in the file.
+	Upsampler Upsampler
+
+	// AutoOrient applies the Exif orientation of the image, if any, to the
+	// returned image, so that it is upright: a portrait photo that a camera
+	// stored sideways is returned rotated, with its width and height
+	// swapped. Subsampled YCbCr images whose chroma samples would not
+	// cover whole pixels once transformed, such as those of odd sizes, are
+	// then returned upsampled to 4:4:4.
+	AutoOrient bool
+
+	// Lenient skips the scans whose entropy-coded data cannot be decoded,
+	// instead of failing: a progressive image keeps the coefficients of
+	// the other scans, as if the corrupt scan were missing, and a
+	// sequential image the blocks decoded before the error. Decoding
+	// resumes at the next marker, and the image is returned with
+	// ErrCorruptScan. Lenient decodes of progressive images keep a copy of
+	// the coefficients of each scan's components.
+	Lenient bool
+
+	// MaxScans, if positive, stops decoding after that many scans, for fast
+	// previews: the first scans of a progressive image, such as its DC
+	// scan, hold a coarse version of it. The rest of the data is not read,
+	// and the components that no decoded scan has included are mid-gray.
+	// Sequential images usually have a single scan.
+	MaxScans int
+
+	// MaxPixels, MaxMemory and ScanLimit, if positive, limit the resources
+	// that decoding untrusted input can use. Images of more than MaxPixels
+	// pixels, or whose buffers would take more than about MaxMemory bytes,
+	// are rejected once their frame header is read, before anything is
+	// allocated; the coefficients of progressive images take 4 bytes per
+	// sample, on top of the pixels. Files of more than ScanLimit scans are
+	// rejected when the next scan starts. These errors are
+	// UnsupportedErrors, and no image is returned with them.
+	MaxPixels int64
+	MaxMemory int64
+	ScanLimit int
+
+	// OnMarker, if non-nil, is called with the marker and the payload of
+	// every segment of the file as it is read, before the decoder processes
+	// it: the payload follows the segment's length, and that of an SOS
+	// segment is the scan header, without the entropy-coded data. It lets
+	// applications capture APPn or COM data, or log the structure of the
+	// file, in the same pass as the decode. The callback may keep payload
+	// but must not modify it.
+	OnMarker func(marker byte, payload []byte)
+
+	// LumaOnly returns an [image.Gray] of the luma of color images. The
+	// chroma of YCbCr images is not reconstructed, and their chroma scans
+	// are skipped, which makes the decode of pipelines that only need
+	// luminance, such as feature extraction or OCR, about twice as fast.
+	// Other color images are decoded, then converted.
+	LumaOnly bool
+
+	// Restarts, if non-nil, is filled with the statistics of the restart
+	// markers of the file, so that tools can assess the damage of a stream
+	// rather than only whether it decodes.
+	Restarts *RestartStats
+
+	// Progress, if non-nil, is told of the progress of the decode after
+	// every segment, and after every MCU row of the scans.
+	Progress ProgressReporter
+}
+
+// DecodeWithOptions is like [Decode], with the given options. Default
+// parameters are used if a nil *[DecodeOptions] is passed.
+func DecodeWithOptions(r io.Reader, o *DecodeOptions) (image.Image, error) {
+	var d decoder
+	if o != nil {
+		d.upsampler = o.Upsampler
+		if o.AutoOrient {
+			d.meta = &Metadata{}
+		}
+		d.lenient = o.Lenient
+		d.maxScans = o.MaxScans
+		d.maxPixels, d.maxMemory, d.scanLimit = o.MaxPixels, o.MaxMemory, o.ScanLimit
+		d.onSegment = o.OnMarker
+		d.lumaOnly = o.LumaOnly
+		if d.progress = o.Progress; d.progress != nil {
+			d.totalBytes = readerSize(r)
+		}
+		if d.restarts = o.Restarts; d.restarts != nil {
+			*d.restarts = RestartStats{}
+		}
+	}
+	m, err := d.decode(r, false)
+	if err == nil && d.corruptScans > 0 {
+		err = ErrCorruptScan
+	}
+	if m != nil && o != nil && o.LumaOnly {
+		m = grayImage(m)
+	}
+	if m != nil && d.meta != nil {
+		m = orient(m, d.meta.Orientation)
+	}
+	return m, err
+}
@@ -0,0 +1,165 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// halfBoxDownsampler is a 2x2 box filter that rounds down, to check that a
+// custom Downsampler is actually used.
+type halfBoxDownsampler struct{}
+
+func (halfBoxDownsampler) Downsample(dst, src *image.Gray, fx, fy int) {
+	BoxDownsampler{}.Downsample(dst, src, fx, fy)
+	for i := range dst.Pix {
+		dst.Pix[i] /= 2
+	}
+}
+
+func TestDownsampler(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(rnd.Intn(256))
+	}
+	// The built-in filter is a 2x2 box filter, so BoxDownsampler must give
+	// the same output as the default.
+	var want, got, half bytes.Buffer
+	if err := Encode(&want, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&got, m, &Options{Quality: DefaultQuality, Downsampler: BoxDownsampler{}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("BoxDownsampler and the built-in filter give different outputs")
+	}
+	if err := Encode(&half, m, &Options{Quality: DefaultQuality, Downsampler: halfBoxDownsampler{}}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(half.Bytes(), want.Bytes()) {
+		t.Error("custom Downsampler was not used")
+	}
+}
+
+func TestUpsampler(t *testing.T) {
+	data, err := os.ReadFile("testdata/video-001.q50.420.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m0, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ycc0 := m0.(*image.YCbCr)
+	for _, us := range []Upsampler{NearestUpsampler{}, LinearUpsampler{}} {
+		m1, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Upsampler: us})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ycc1, ok := m1.(*image.YCbCr)
+		if !ok || ycc1.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+			t.Fatalf("%T: got %T, want a 4:4:4 *image.YCbCr", us, m1)
+		}
+		if ycc1.Bounds() != ycc0.Bounds() {
+			t.Fatalf("%T: bounds differ: %v and %v", us, ycc0.Bounds(), ycc1.Bounds())
+		}
+		b := ycc0.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c0, c1 := ycc0.YCbCrAt(x, y), ycc1.YCbCrAt(x, y)
+				if c0.Y != c1.Y {
+					t.Fatalf("%T: luma at (%d, %d): got %d, want %d", us, x, y, c1.Y, c0.Y)
+				}
+				if _, ok := us.(NearestUpsampler); ok && c0 != c1 {
+					t.Fatalf("%T: at (%d, %d): got %v, want %v", us, x, y, c1, c0)
+				}
+				if d := int(c0.Cb) - int(c1.Cb); d < -48 || d > 48 {
+					t.Fatalf("%T: Cb at (%d, %d): got %d, want about %d", us, x, y, c1.Cb, c0.Cb)
+				}
+			}
+		}
+	}
+}
+
+func TestLinearUpsampler(t *testing.T) {
+	src := &image.Gray{Pix: []byte{0, 100, 200}, Stride: 3, Rect: image.Rect(0, 0, 3, 1)}
+	dst := image.NewGray(image.Rect(0, 0, 6, 1))
+	LinearUpsampler{}.Upsample(dst, src, 2, 1)
+	want := []byte{0, 25, 75, 125, 175, 200}
+	if !bytes.Equal(dst.Pix, want) {
+		t.Errorf("got %v, want %v", dst.Pix, want)
+	}
+}
+
+func TestTriangleDownsampler(t *testing.T) {
+	// A step edge between columns 3 and 4 is kept sharp by the box filter,
+	// and spread over the neighboring pixels by the triangle filter.
+	src := image.NewGray(image.Rect(0, 0, 8, 2))
+	for y := 0; y < 2; y++ {
+		for x := 4; x < 8; x++ {
+			src.SetGray(x, y, color.Gray{200})
+		}
+	}
+	for _, tc := range []struct {
+		ds   Downsampler
+		want []byte
+	}{
+		{BoxDownsampler{}, []byte{0, 0, 200, 200}},
+		{TriangleDownsampler{}, []byte{0, 25, 175, 200}},
+	} {
+		dst := image.NewGray(image.Rect(0, 0, 4, 1))
+		tc.ds.Downsample(dst, src, 2, 2)
+		if !bytes.Equal(dst.Pix, tc.want) {
+			t.Errorf("%T: got %v, want %v", tc.ds, dst.Pix, tc.want)
+		}
+	}
+	// Taps with odd sizes and edge clamping.
+	taps := triangleTaps(2, 2, 3)
+	if got := taps[1].i; len(got) != 4 || got[0] != 1 || got[3] != 2 {
+		t.Errorf("last taps: got %v", got)
+	}
+}
+
+func benchmarkDownsample(b *testing.B, ds Downsampler) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	rnd := rand.New(rand.NewSource(123))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	b.SetBytes(640 * 480 * 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	options := &Options{Quality: 90, Downsampler: ds}
+	for i := 0; i < b.N; i++ {
+		Encode(io.Discard, img, options)
+	}
+}
+
+func BenchmarkDownsampleBuiltin(b *testing.B)  { benchmarkDownsample(b, nil) }
+func BenchmarkDownsampleBox(b *testing.B)      { benchmarkDownsample(b, BoxDownsampler{}) }
+func BenchmarkDownsampleTriangle(b *testing.B) { benchmarkDownsample(b, TriangleDownsampler{}) }
+
+func benchmarkUpsample(b *testing.B, us Upsampler) {
+	data, err := os.ReadFile("testdata/video-001.q50.420.jpeg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	o := &DecodeOptions{Upsampler: us}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DecodeWithOptions(bytes.NewReader(data), o)
+	}
+}
+
+func BenchmarkUpsampleNone(b *testing.B)    { benchmarkUpsample(b, nil) }
+func BenchmarkUpsampleNearest(b *testing.B) { benchmarkUpsample(b, NearestUpsampler{}) }
+func BenchmarkUpsampleLinear(b *testing.B)  { benchmarkUpsample(b, LinearUpsampler{}) }
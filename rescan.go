@@ -0,0 +1,30 @@
+package progjpeg
+
+import (
+	"errors"
+	"io"
+)
+
+// Rescan reads the progressive JPEG image in r and writes it to w with the
+// scans in the order and with the parameters that edit returns, given the
+// scans of the original, for example to send the chroma later or to split
+// a scan into successive approximation passes. As with [Transcode], only
+// the coefficients are decoded, and they are re-encoded as they are, so
+// the new script must still send all of them; the APPn and COM segments
+// are copied. The scans given to edit are those that [DecodeFull] reports,
+// and edit may change them in place.
+func Rescan(w io.Writer, r io.Reader, edit func(scans ScanScript) ScanScript) error {
+	return transcode(w, r, nil, func(t *transcoding) error {
+		return t.rescan(edit)
+	})
+}
+
+// rescan sets the scan script of t to the one that edit returns from the
+// scans of the original.
+func (t *transcoding) rescan(edit func(scans ScanScript) ScanScript) error {
+	if !t.d.progressive {
+		return errors.New("jpeg: cannot rescan a baseline image (use Transcode)")
+	}
+	t.o = &Options{Progressive: true, ScanScript: edit(t.scans), StrictScanScript: true}
+	return nil
+}
@@ -0,0 +1,75 @@
+package progjpeg
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestRescan(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	var data bytes.Buffer
+	if err := Encode(&data, src, &Options{Quality: 90, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	want, wantMeta, err := DecodeFull(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send the chroma scans after all the luma ones.
+	var script ScanScript
+	var buf bytes.Buffer
+	err = Rescan(&buf, bytes.NewReader(data.Bytes()), func(scans ScanScript) ScanScript {
+		if len(scans) != len(wantMeta.Scans) {
+			t.Errorf("got %d scans, want %d", len(scans), len(wantMeta.Scans))
+		}
+		var chroma ScanScript
+		for _, s := range scans {
+			if s.Component > 0 {
+				chroma = append(chroma, s)
+			} else {
+				script = append(script, s)
+			}
+		}
+		script = append(script, chroma...)
+		return script
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, meta, err := DecodeFull(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(got, want) {
+		t.Error("the pixels differ from those of the original")
+	}
+	if len(meta.Scans) != len(script) {
+		t.Fatalf("got %d scans, want %d", len(meta.Scans), len(script))
+	}
+	for i, s := range meta.Scans {
+		if !reflect.DeepEqual(s, script[i]) {
+			t.Errorf("scan %d: got %+v, want %+v", i, s, script[i])
+		}
+	}
+
+	// A script that misses coefficients is rejected.
+	err = Rescan(new(bytes.Buffer), bytes.NewReader(data.Bytes()), func(scans ScanScript) ScanScript {
+		return scans[:len(scans)-1]
+	})
+	if err == nil {
+		t.Error("a script without the last scan did not fail")
+	}
+
+	// Baseline images are rejected.
+	var baseline bytes.Buffer
+	if err := Encode(&baseline, src, &Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rescan(new(bytes.Buffer), bytes.NewReader(baseline.Bytes()), func(s ScanScript) ScanScript { return s }); err == nil {
+		t.Error("rescanning a baseline image did not fail")
+	}
+}
@@ -0,0 +1,79 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestScanRestartInterval(t *testing.T) {
+	m := testimg.Photo(200, 120, 3)
+	var plain, rst bytes.Buffer
+	if err := Encode(&plain, m, &Options{Quality: 85, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	script := DefaultColorScanScript()
+	script[0].RestartInterval = 4
+	script[0].DCTable = HuffmanOptimized
+	script[1].RestartInterval = 7
+	var s Session
+	if err := Encode(&rst, m, &Options{Quality: 85, Progressive: true, ScanScript: script, StrictScanScript: true, Session: &s}); err != nil {
+		t.Fatal(err)
+	}
+
+	// DRI markers define intervals of 4 and 7 MCUs, then disable them.
+	data := rst.Bytes()
+	if n := bytes.Count(data, []byte{0xff, driMarker}); n != 3 {
+		t.Errorf("got %d DRI markers, want 3", n)
+	}
+	// The 13x8 MCUs of the DC scan make 26 intervals, and the 25x15 luma
+	// blocks of the first AC scan make 54.
+	if n := bytes.Count(data, []byte{0xff, rst0Marker}); n != 4+7 {
+		t.Errorf("got %d RST0 markers, want %d", n, 4+7)
+	}
+	for i, want := range []int{4, 7, 0, 0, 0, 0} {
+		if got := s.Scans[i].RestartInterval; got != want {
+			t.Errorf("scan %d: got restart interval %d, want %d", i, got, want)
+		}
+	}
+
+	m0, err := Decode(bytes.NewReader(plain.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m1) {
+		t.Error("restart intervals change the decoded image")
+	}
+
+	// image/jpeg only decodes the restart markers of interleaved and chroma
+	// scans.
+	script[1].RestartInterval = 0
+	script[3].RestartInterval = 5
+	rst.Reset()
+	if err := Encode(&rst, m, &Options{Quality: 85, Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := jpeg.Decode(bytes.NewReader(rst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m2) {
+		t.Error("image/jpeg decodes a different image")
+	}
+}
+
+func TestScanRestartIntervalInvalid(t *testing.T) {
+	script := ScanScript{{Component: 0, RestartInterval: 1 << 16}, {Component: 0, SpectralStart: 1, SpectralEnd: 63}}
+	if err := ValidateScanScript(script, 1); err == nil {
+		t.Error("ValidateScanScript: got nil error")
+	}
+	if err := VerifyScanScriptCoverage(script, 1); err == nil {
+		t.Error("VerifyScanScriptCoverage: got nil error")
+	}
+}
@@ -0,0 +1,14 @@
+package progjpeg
+
+// RestartStats are the statistics of the restart markers of a decode, as
+// reported by DecodeOptions.Restarts.
+type RestartStats struct {
+	// Markers is the number of RST markers found at the end of restart
+	// intervals, including those that a resync found.
+	Markers int
+	// Resyncs are the positions in the file, in order, of the restart
+	// intervals that were not followed by the expected RST marker, and
+	// after which the decoder had to search the data for it. The data
+	// between a position and the marker is corrupt.
+	Resyncs []int64
+}
@@ -0,0 +1,49 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestDecodeRestartStats(t *testing.T) {
+	// The 13x8 MCUs of the DC scan make 26 intervals of 4 MCUs, which 25
+	// RST markers separate.
+	script := DefaultColorScanScript()
+	script[0].RestartInterval = 4
+	var buf bytes.Buffer
+	if err := Encode(&buf, testimg.Photo(200, 120, 3), &Options{Quality: 85, Progressive: true, ScanScript: script}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats RestartStats
+	o := &DecodeOptions{Restarts: &stats}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), o); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Markers != 25 || stats.Resyncs != nil {
+		t.Errorf("got %+v, want 25 markers and no resyncs", stats)
+	}
+
+	// Garbage before the third RST marker, RST2, of the DC scan makes the
+	// decoder resync there.
+	sos := bytes.Index(data, []byte{0xff, sosMarker})
+	pos := sos + bytes.Index(data[sos:], []byte{0xff, rst0Marker + 2})
+	corrupt := append(bytes.Clone(data[:pos]), "\x12\x34"...)
+	corrupt = append(corrupt, data[pos:]...)
+	m, err := DecodeWithOptions(bytes.NewReader(corrupt), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Markers != 25 || len(stats.Resyncs) != 1 || stats.Resyncs[0] < int64(pos) || stats.Resyncs[0] > int64(pos)+2 {
+		t.Errorf("got %+v, want 25 markers and a resync at %d", stats, pos)
+	}
+	if m.Bounds() != want.Bounds() {
+		t.Errorf("got bounds %v, want %v", m.Bounds(), want.Bounds())
+	}
+}
@@ -0,0 +1,100 @@
+package progjpeg
+
+import "image"
+
+// rgbComponents is the frame layout of RGB images: three full resolution
+// components, which all use the luminance tables, as in libjpeg.
+var rgbComponents = []encComponent{
+	{1, 1, quantIndexLuminance},
+	{1, 1, quantIndexLuminance},
+	{1, 1, quantIndexLuminance},
+}
+
+// rgbFrame returns whether m is encoded as an RGB image, with the rgb and
+// grayscale options: color images are, but not grayscale ones and not
+// *Multiplane images, which have their own layout.
+func rgbFrame(m image.Image, grayscale, rgb bool) bool {
+	if !rgb || grayscale {
+		return false
+	}
+	switch m := m.(type) {
+	case *image.Gray, *Multiplane:
+		return false
+	case *rowImage:
+		return !m.gray
+	}
+	return true
+}
+
+// writeAdobe writes an Adobe APP14 segment whose transform flag is 0, which
+// tells decoders that the three components are R, G and B rather than Y, Cb
+// and Cr, or that the four components are C, M, Y and K rather than Y, Cb,
+// Cr and K.
+func (e *encoder) writeAdobe() {
+	e.writeMarkerHeader(app14Marker, 2+12)
+	// The DCTEncode version is 100, with no flags.
+	e.write([]byte("Adobe\x00\x64\x00\x00\x00\x00"))
+	e.writeByte(adobeTransformUnknown)
+}
+
+// rgbaToRGB stores the R, G and B values of the 8x8 region of m whose
+// top-left corner is p in the three blocks of dst.
+func rgbaToRGB(m *image.RGBA, p image.Point, dst []block) {
+	b := m.Bounds()
+	xmax := b.Max.X - 1
+	ymax := b.Max.Y - 1
+	for j := 0; j < 8; j++ {
+		offset := (min(p.Y+j, ymax)-b.Min.Y)*m.Stride - b.Min.X*4
+		for i := 0; i < 8; i++ {
+			pix := m.Pix[offset+min(p.X+i, xmax)*4:]
+			dst[0][8*j+i] = int32(pix[0])
+			dst[1][8*j+i] = int32(pix[1])
+			dst[2][8*j+i] = int32(pix[2])
+		}
+	}
+}
+
+// toRGB is the general version of rgbaToRGB, for any image.
+func toRGB(m image.Image, p image.Point, dst []block) {
+	b := m.Bounds()
+	xmax := b.Max.X - 1
+	ymax := b.Max.Y - 1
+	for j := 0; j < 8; j++ {
+		for i := 0; i < 8; i++ {
+			r, g, b, _ := m.At(min(p.X+i, xmax), min(p.Y+j, ymax)).RGBA()
+			dst[0][8*j+i] = int32(r >> 8)
+			dst[1][8*j+i] = int32(g >> 8)
+			dst[2][8*j+i] = int32(b >> 8)
+		}
+	}
+}
+
+// rgbPlanes returns the R, G and B planes of m, as a *Multiplane image with
+// its top-left corner at the origin.
+func rgbPlanes(m image.Image) *Multiplane {
+	b := m.Bounds()
+	r := image.Rect(0, 0, b.Dx(), b.Dy())
+	dst := &Multiplane{Rect: r}
+	for i := 0; i < 3; i++ {
+		dst.Planes = append(dst.Planes, image.NewGray(r))
+	}
+	var blocks [3]block
+	for y := 0; y < r.Max.Y; y += 8 {
+		for x := 0; x < r.Max.X; x += 8 {
+			p := image.Pt(b.Min.X+x, b.Min.Y+y)
+			if rgba, ok := m.(*image.RGBA); ok {
+				rgbaToRGB(rgba, p, blocks[:])
+			} else {
+				toRGB(m, p, blocks[:])
+			}
+			for c, plane := range dst.Planes {
+				for j := 0; j < min(8, r.Max.Y-y); j++ {
+					for i := 0; i < min(8, r.Max.X-x); i++ {
+						plane.Pix[plane.PixOffset(x+i, y+j)] = uint8(blocks[c][8*j+i])
+					}
+				}
+			}
+		}
+	}
+	return dst
+}
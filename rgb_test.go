@@ -0,0 +1,96 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestEncodeRGB(t *testing.T) {
+	m := testimg.Photo(61, 43, 1)
+	for _, o := range []*Options{
+		{Quality: 95, RGB: true},
+		{Quality: 95, RGB: true, Progressive: true},
+		{Quality: 95, RGB: true, Smoothing: 5},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		if !bytes.Contains(data, []byte("\xff\xee\x00\x0eAdobe\x00\x64\x00\x00\x00\x00\x00")) {
+			t.Errorf("%+v: no Adobe segment with transform 0", o)
+		}
+		info, err := Inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range info.Components {
+			if c.H != 1 || c.V != 1 || c.Tq != 0 {
+				t.Errorf("%+v: component %d is %+v, want full resolution luminance", o, i, c)
+			}
+		}
+		for _, decode := range []func() (image.Image, error){
+			func() (image.Image, error) { return Decode(bytes.NewReader(data)) },
+			func() (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) },
+		} {
+			d, err := decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := d.(*image.RGBA); !ok {
+				t.Errorf("%+v: decoded a %T, want an *image.RGBA", o, d)
+			}
+			if got, want := averageDelta(m, d), int64(3<<8); got > want {
+				t.Errorf("%+v: average delta %d, want <= %d", o, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeRGBIgnored(t *testing.T) {
+	// Grayscale output and grayscale images have a single component.
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(32, 32, 1), &Options{Quality: 75, RGB: true, Grayscale: true}},
+		{testimg.ZonePlate(32, 32), &Options{Quality: 75, RGB: true}},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(buf.Bytes(), []byte("Adobe")) {
+			t.Errorf("%T, %+v: got an Adobe segment", tc.m, tc.o)
+		}
+		info, err := Probe(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Components != 1 {
+			t.Errorf("%T, %+v: got %d components", tc.m, tc.o, info.Components)
+		}
+	}
+}
+
+func TestEncodeRGBReplay(t *testing.T) {
+	m := testimg.Photo(40, 24, 2)
+	var buf, replay bytes.Buffer
+	var s Session
+	if err := Encode(&buf, m, &Options{Quality: 80, Progressive: true, RGB: true, Session: &s}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.RGB {
+		t.Error("the session does not record RGB")
+	}
+	if _, err := Replay(&replay, m, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replay.Bytes(), buf.Bytes()) {
+		t.Error("the replay differs from the recorded encode")
+	}
+}
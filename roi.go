@@ -0,0 +1,104 @@
+package progjpeg
+
+import "image"
+
+// QualityRegion sets the encoding quality of a rectangular part of an image,
+// in the image's coordinate space.
+type QualityRegion struct {
+	Rect    image.Rectangle
+	Quality int
+}
+
+// setRegions computes the quality of every MCU of an image with bounds b from the regions and the
+// quality mask in o, and sets up the quantization tables accordingly. The
+// tables written to the file are those of the highest quality in use, and the
+// MCUs with a lower quality are quantized more coarsely by fdctQuantize.
+func (e *encoder) setRegions(b image.Rectangle, o *Options, quality int) {
+	clip := func(q int) uint8 { return uint8(min(max(q, 1), 100)) }
+	n := e.mxx * e.myy
+	if cap(e.roi) >= n {
+		e.roi = e.roi[:n]
+	} else {
+		e.roi = make([]uint8, n)
+	}
+	base := clip(quality)
+	for i := range e.roi {
+		e.roi[i] = base
+	}
+	hmax, vmax := e.maxSampling()
+	mw, mh := 8*hmax, 8*vmax
+	raise := func(mx, my int, q uint8) {
+		if i := my*e.mxx + mx; e.roi[i] < q {
+			e.roi[i] = q
+		}
+	}
+	for _, r := range o.Regions {
+		r.Rect = r.Rect.Intersect(b)
+		if r.Rect.Empty() {
+			continue
+		}
+		q := clip(r.Quality)
+		for my := (r.Rect.Min.Y - b.Min.Y) / mh; my <= (r.Rect.Max.Y-1-b.Min.Y)/mh; my++ {
+			for mx := (r.Rect.Min.X - b.Min.X) / mw; mx <= (r.Rect.Max.X-1-b.Min.X)/mw; mx++ {
+				raise(mx, my, q)
+			}
+		}
+	}
+	if mask := o.QualityMask; mask != nil {
+		r := mask.Bounds().Intersect(b)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row := mask.Pix[mask.PixOffset(r.Min.X, y):]
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if q := row[x-r.Min.X]; q != 0 {
+					raise((x-b.Min.X)/mw, (y-b.Min.Y)/mh, clip(int(q)))
+				}
+			}
+		}
+	}
+
+	maxQuality := base
+	for _, q := range e.roi {
+		maxQuality = max(maxQuality, q)
+	}
+	e.setQuality(int(maxQuality))
+	clear(e.roiQuant[:])
+	for _, q := range e.roi {
+		if q != maxQuality && e.roiQuant[q] == nil {
+			e.roiQuant[q] = new([nQuantIndex][blockSize]byte)
+			quantTables(e.roiQuant[q], int(q))
+		}
+	}
+}
+
+// mcuQuant returns the coarser quantization tables to use for the MCU at
+// column mx and row my, or nil if the MCU uses the file's tables.
+func (e *encoder) mcuQuant(mx, my int) *[nQuantIndex][blockSize]byte {
+	if e.roi == nil {
+		return nil
+	}
+	return e.roiQuant[e.roi[my*e.mxx+mx]]
+}
+
+// blockSteps returns the quantization tables to use for the block (bx, by)
+// of the component c, whose MCU uses the tables coarse, as for
+// fdctQuantize: coarse itself, unless Options.BlockQuant is set, in which
+// case the steps it chooses are stored in dst, which is returned.
+func (e *encoder) blockSteps(dst *[nQuantIndex][blockSize]byte, c, bx, by int, coarse *[nQuantIndex][blockSize]byte) *[nQuantIndex][blockSize]byte {
+	if e.blockQuant == nil {
+		return coarse
+	}
+	q := e.comp[c].q
+	// The callback gets steps of its own, which it might retain, so that
+	// dst stays on the caller's stack.
+	steps := new([blockSize]byte)
+	if coarse != nil {
+		*steps = coarse[q]
+	} else {
+		*steps = e.quant[q]
+	}
+	e.blockQuant(bx, by, c, steps)
+	for zig, s := range steps {
+		dst[q][zig] = max(s, e.quant[q][zig])
+	}
+	return dst
+}
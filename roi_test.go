@@ -0,0 +1,141 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// meanSquaredError returns the mean squared error of the luma of m0 and m1
+// within r.
+func meanSquaredError(m0, m1 image.Image, r image.Rectangle) float64 {
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			g0 := color.GrayModel.Convert(m0.At(x, y)).(color.Gray)
+			g1 := color.GrayModel.Convert(m1.At(x, y)).(color.Gray)
+			d := float64(g0.Y) - float64(g1.Y)
+			sum += d * d
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+func TestQualityRegions(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 128, 64))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(rnd.Intn(256))
+	}
+	roi := image.Rect(16, 16, 48, 48)
+	bg := image.Rect(80, 16, 112, 48)
+	mask := image.NewGray(m.Bounds())
+	for y := roi.Min.Y; y < roi.Max.Y; y++ {
+		for x := roi.Min.X; x < roi.Max.X; x++ {
+			mask.SetGray(x, y, color.Gray{95})
+		}
+	}
+	encode := func(o *Options) (image.Image, int) {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		size := buf.Len()
+		d, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d, size
+	}
+	low, lowSize := encode(&Options{Quality: 30})
+	high, highSize := encode(&Options{Quality: 95})
+	for _, o := range []*Options{
+		{Quality: 30, Regions: []QualityRegion{{roi, 95}}},
+		{Quality: 30, QualityMask: mask},
+	} {
+		d, size := encode(o)
+		if size <= lowSize || size >= highSize {
+			t.Errorf("size %d not between %d and %d", size, lowSize, highSize)
+		}
+		if got, want := meanSquaredError(m, d, roi), meanSquaredError(m, high, roi); got > want*1.01 {
+			t.Errorf("region error: got %.2f, want at most %.2f", got, want)
+		}
+		if got, want := meanSquaredError(m, d, bg), meanSquaredError(m, low, bg); got < want*0.9 {
+			t.Errorf("background error: got %.2f, want about %.2f", got, want)
+		}
+	}
+}
+
+func TestBlockQuant(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(rnd.Intn(256))
+	}
+	encode := func(o *Options) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// Steps lower than the tables' do not change the output, and every
+	// block is seen once.
+	want := encode(&Options{Quality: 80})
+	seen := map[[3]int]int{}
+	got := encode(&Options{Quality: 80, BlockQuant: func(bx, by, comp int, q *[64]byte) {
+		seen[[3]int{bx, by, comp}]++
+		clear(q[:])
+	}})
+	if !bytes.Equal(got, want) {
+		t.Error("lowering the steps changes the output")
+	}
+	// The 4:2:0 frame has 7x4 MCUs of 2x2 luma blocks.
+	if n := 14*8 + 2*7*4; len(seen) != n {
+		t.Errorf("got %d blocks, want %d", len(seen), n)
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("block %v seen %d times", k, n)
+		}
+	}
+
+	// Coarser steps in the left half of a grayscale image only change that
+	// half.
+	coarse := func(bx, by, comp int, q *[64]byte) {
+		if bx < 6 {
+			for i := range q {
+				q[i] = 255
+			}
+		}
+	}
+	for _, o := range []*Options{
+		{Quality: 80, Grayscale: true},
+		{Quality: 80, Grayscale: true, Progressive: true, Concurrency: 4},
+	} {
+		plain := encode(o)
+		oo := *o
+		oo.BlockQuant = coarse
+		got := encode(&oo)
+		if len(got) >= len(plain) {
+			t.Errorf("%+v: got %d bytes, want fewer than %d", o, len(got), len(plain))
+		}
+		m0, err := Decode(bytes.NewReader(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, err := Decode(bytes.NewReader(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mse := meanSquaredError(m0, m1, image.Rect(48, 0, 100, 60)); mse != 0 {
+			t.Errorf("%+v: right half changed, MSE %.2f", o, mse)
+		}
+		if mse := meanSquaredError(m0, m1, image.Rect(0, 0, 48, 60)); mse == 0 {
+			t.Errorf("%+v: left half unchanged", o)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package progjpeg
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// A RowSource supplies the pixels of an image to [EncodeRows] one band of
+// rows at a time, so that the image never has to be held in memory as a
+// whole, such as the scanlines streamed by a TIFF or RAW converter.
+type RowSource interface {
+	// Bounds returns the domain of the image.
+	Bounds() image.Rectangle
+	// ColorModel returns the color model of the image. Sources whose model
+	// is color.GrayModel are read into *image.Gray bands and encoded as
+	// grayscale, all others are read into *image.RGBA bands.
+	ColorModel() color.Model
+	// ReadRows fills dst with the rows of the image from y to
+	// y+dst.Bounds().Dy()-1. dst is an *image.Gray or an *image.RGBA that
+	// spans the width of the image, and whose buffer is reused between
+	// calls. The rows are read in order, top to bottom, and only once.
+	ReadRows(dst draw.Image, y int) error
+}
+
+// EncodeRows writes the image supplied by src to w with the given options,
+// as [Encode] does, only holding one band of 8 or 16 rows of pixels at a
+// time. A baseline image is written as the rows are read; a progressive
+// image also holds the quantized coefficients of the whole image, or of
+// stripes of it if MaxCoefficientMemory is set.
+//
+// The Smoothing, Downsampler and Thumbnail options, which need the whole
+// image, cannot be used, and Concurrency is ignored. With
+// MaxCoefficientMemory, neither can OptimizeScans nor optimized Huffman
+// tables, which would read the rows more than once.
+func EncodeRows(w io.Writer, src RowSource, o *Options) error {
+	var e encoder
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	return e.encodeRows(src, o)
+}
+
+// EncodeRows writes the image supplied by src to the Encoder's output
+// stream with the given options, as [EncodeRows] does.
+func (enc *Encoder) EncodeRows(src RowSource, o *Options) error {
+	e := &enc.e
+	e.err = nil
+	e.bits, e.nBits, e.nOut = 0, 0, 0
+	return e.encodeRows(src, o)
+}
+
+// encodeRows checks that o can be used with a RowSource, and encodes the
+// rows of src.
+func (e *encoder) encodeRows(src RowSource, o *Options) error {
+	ro := Options{Quality: DefaultQuality}
+	if o != nil {
+		if o.Smoothing > 0 || o.Downsampler != nil || o.Thumbnail > 0 {
+			return errors.New("jpeg: Smoothing, Downsampler and Thumbnail cannot be used with a RowSource")
+		}
+		ro = *o
+		ro.Concurrency = 0
+	}
+	b := src.Bounds()
+	if b.Empty() {
+		return errors.New("jpeg: RowSource has an empty image")
+	}
+	m := &rowImage{src: src, gray: src.ColorModel() == color.GrayModel, next: b.Min.Y}
+	m.rows = 16
+	if m.gray || ro.Grayscale {
+		m.rows = 8
+	}
+	return e.encode(m, &ro)
+}
+
+// A rowImage is the image of a RowSource, as seen by the encoder. It only
+// holds the band of rows of the MCU row being transformed, which readMCU
+// loads as the encoder moves down the image.
+type rowImage struct {
+	src  RowSource
+	gray bool
+	// rows is the height of an MCU, in pixels.
+	rows int
+	// band holds the rows from band.Rect.Min.Y to band.Rect.Max.Y-1, and
+	// next is the first row that has not been read yet.
+	band draw.Image
+	next int
+	pix  []uint8
+	err  error
+}
+
+func (m *rowImage) Bounds() image.Rectangle { return m.src.Bounds() }
+
+func (m *rowImage) ColorModel() color.Model { return m.src.ColorModel() }
+
+// At returns the color of a pixel of the band last read, or transparent
+// black outside of it.
+func (m *rowImage) At(x, y int) color.Color {
+	if m.band == nil {
+		return color.Transparent
+	}
+	return m.band.At(x, y)
+}
+
+// load returns the band that holds the MCU row starting at row y, reading
+// it from the source if needed. It returns nil if the source fails, or if
+// the rows were already read.
+func (m *rowImage) load(y int) image.Image {
+	if m.band != nil && y >= m.band.Bounds().Min.Y && y < m.band.Bounds().Max.Y {
+		return m.band
+	}
+	if m.err != nil {
+		return nil
+	}
+	if y != m.next {
+		m.err = errors.New("jpeg: the rows of a RowSource cannot be read twice; OptimizeScans and optimized Huffman tables cannot be used with MaxCoefficientMemory")
+		return nil
+	}
+	b := m.src.Bounds()
+	r := image.Rect(b.Min.X, y, b.Max.X, min(y+m.rows, b.Max.Y))
+	if m.gray {
+		m.pix = growPix(m.pix, r.Dx()*r.Dy())
+		m.band = &image.Gray{Pix: m.pix, Stride: r.Dx(), Rect: r}
+	} else {
+		m.pix = growPix(m.pix, 4*r.Dx()*r.Dy())
+		m.band = &image.RGBA{Pix: m.pix, Stride: 4 * r.Dx(), Rect: r}
+	}
+	if err := m.src.ReadRows(m.band, y); err != nil {
+		m.err = err
+		return nil
+	}
+	m.next = r.Max.Y
+	return m.band
+}
@@ -0,0 +1,88 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// imageRows is a RowSource that copies the rows of an in-memory image, and
+// checks that they are read in order.
+type imageRows struct {
+	image.Image
+	t     *testing.T
+	next  int
+	calls int
+	fail  error
+}
+
+func (r *imageRows) ReadRows(dst draw.Image, y int) error {
+	r.calls++
+	if r.fail != nil {
+		return r.fail
+	}
+	db := dst.Bounds()
+	if y != r.next || db.Min.Y != y || db.Dx() != r.Bounds().Dx() {
+		r.t.Errorf("ReadRows(%v, %d): want row %d", db, y, r.next)
+	}
+	draw.Draw(dst, db, r.Image, db.Min, draw.Src)
+	r.next = db.Max.Y
+	return nil
+}
+
+func TestEncodeRows(t *testing.T) {
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(150, 97, 1), nil},
+		{testimg.Photo(150, 97, 1), &Options{Quality: 80, Progressive: true, OptimizeScans: true}},
+		{testimg.Photo(150, 97, 1), &Options{Quality: 80, Progressive: true, MaxCoefficientMemory: 1}},
+		{testimg.Photo(150, 97, 1), &Options{Quality: 70, Grayscale: true}},
+		{testimg.ZonePlate(75, 61), &Options{Quality: 60, Progressive: true}},
+		{testimg.ZonePlate(75, 61), &Options{Quality: 60}},
+	} {
+		var want, got bytes.Buffer
+		if err := Encode(&want, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		src := &imageRows{Image: tc.m, t: t}
+		if err := EncodeRows(&got, src, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%v, %+v: got %d bytes, want the %d bytes of Encode", tc.m.Bounds(), tc.o, got.Len(), want.Len())
+		}
+		if src.next != tc.m.Bounds().Max.Y {
+			t.Errorf("%v, %+v: read %d rows", tc.m.Bounds(), tc.o, src.next)
+		}
+	}
+}
+
+func TestEncodeRowsErrors(t *testing.T) {
+	m := testimg.Photo(64, 64, 1)
+	errRead := errors.New("read error")
+	src := &imageRows{Image: m, t: t, fail: errRead}
+	if err := EncodeRows(io.Discard, src, nil); err != errRead {
+		t.Errorf("failing source: got %v, want %v", err, errRead)
+	}
+	if src.calls != 1 {
+		t.Errorf("failing source: got %d calls, want 1", src.calls)
+	}
+
+	src = &imageRows{Image: m, t: t}
+	err := EncodeRows(io.Discard, src, &Options{Progressive: true, OptimizeScans: true, MaxCoefficientMemory: 1})
+	if err == nil || !strings.Contains(err.Error(), "read twice") {
+		t.Errorf("stripes with OptimizeScans: got %v", err)
+	}
+	err = EncodeRows(io.Discard, &imageRows{Image: m, t: t}, &Options{Thumbnail: 32})
+	if err == nil {
+		t.Error("Thumbnail: got nil error")
+	}
+}
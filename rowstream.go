@@ -0,0 +1,191 @@
+package progjpeg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// A RowStream is like a [RowSource], for images whose height is not known
+// until their last row is read.
+type RowStream interface {
+	// Bounds returns the domain of the image. Max.Y is ignored: the image
+	// ends with the last row read.
+	Bounds() image.Rectangle
+	// ColorModel returns the color model of the image, as for a RowSource.
+	ColorModel() color.Model
+	// ReadRows fills dst with the rows of the image from y on, and returns
+	// the number of rows read. dst is an *image.Gray or an *image.RGBA, as
+	// for a RowSource. ReadRows fills the whole of dst unless the image
+	// ends, in which case it returns io.EOF with the last rows, if any.
+	ReadRows(dst draw.Image, y int) (int, error)
+}
+
+// EncodeRowStream writes the image supplied by src to w as a baseline JPEG
+// image with the given options, in a single pass over its rows. The frame
+// header records a height of 0, and the height is written after the scan in
+// a DNL (Define Number of Lines) marker, as described in section B.2.5 of
+// the spec.
+//
+// Many decoders, including image/jpeg and this package's, do not support
+// DNL markers. The Progressive, Smoothing, Downsampler, Thumbnail, Regions
+// and QualityMask options cannot be used, and Concurrency is ignored.
+func EncodeRowStream(w io.Writer, src RowStream, o *Options) error {
+	var e encoder
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	return e.encodeRowStream(src, o)
+}
+
+// encodeRowStream writes the image supplied by src to e.w.
+func (e *encoder) encodeRowStream(src RowStream, o *Options) error {
+	if o == nil {
+		o = &Options{Quality: DefaultQuality}
+	}
+	if o.Progressive || o.Smoothing > 0 || o.Downsampler != nil || o.Thumbnail > 0 || len(o.Regions) > 0 || o.QualityMask != nil {
+		return errors.New("jpeg: a RowStream can only be encoded as a baseline image, without Smoothing, Downsampler, Thumbnail or quality regions")
+	}
+	b := src.Bounds()
+	if b.Dx() <= 0 || b.Dx() >= 1<<16 {
+		return fmt.Errorf("jpeg: invalid RowStream width %d", b.Dx())
+	}
+	if err := e.setColorMatrix(o); err != nil {
+		return err
+	}
+	e.setQuantOptions(o)
+	gray := src.ColorModel() == color.GrayModel
+	comp := ycbcrComponents
+	e.rgb = false
+	if gray || o.Grayscale {
+		comp = grayComponents
+	} else if o.RGB {
+		comp = rgbComponents
+		e.rgb = true
+	}
+	e.setQuality(o.Quality)
+	e.init(image.Pt(b.Dx(), 0), comp)
+	e.roi = nil
+	e.written = 0
+	e.ri = 0
+	e.session = nil
+	if o.Session != nil {
+		e.session = o.Session
+		e.startSession(o)
+	}
+
+	// Write the Start Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = soiMarker
+	e.write(e.buf[:2])
+	if e.rgb {
+		e.writeAdobe()
+	}
+	if len(o.ICCProfile) > 0 {
+		e.writeICC(o.ICCProfile)
+	}
+	if !o.OmitTables {
+		e.writeDQT()
+	}
+	e.writeSOF(sof0Marker)
+	if !o.OmitTables {
+		e.writeDHT()
+	}
+	height, err := e.writeRowStreamSOS(src, gray)
+	if err != nil {
+		return err
+	}
+	e.writeDNL(height)
+	// Write the End Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = eoiMarker
+	e.write(e.buf[:2])
+	if e.session != nil {
+		e.session.Height = height
+		e.endSession()
+	}
+	e.flush()
+	return e.err
+}
+
+// writeRowStreamSOS writes the scan of a baseline image from the rows of
+// src, one MCU row at a time, and returns the height of the image.
+func (e *encoder) writeRowStreamSOS(src RowStream, gray bool) (int, error) {
+	e.writeSOSHeader(e.allComponents(), 0, blockSize-1, 0, 0)
+	var (
+		mcu    = e.mcuBuffer()
+		prevDC [maxComponents]int32
+		pix    []uint8
+	)
+	_, vmax := e.maxSampling()
+	b := src.Bounds()
+	height := 0
+	for {
+		// The band of the MCU row is cropped to the rows read, so that
+		// readMCU replicates the last row of the image.
+		y := b.Min.Y + height
+		r := image.Rect(b.Min.X, y, b.Max.X, y+8*vmax)
+		var band draw.Image
+		if gray {
+			pix = growPix(pix, r.Dx()*r.Dy())
+			band = &image.Gray{Pix: pix, Stride: r.Dx(), Rect: r}
+		} else {
+			pix = growPix(pix, 4*r.Dx()*r.Dy())
+			band = &image.RGBA{Pix: pix, Stride: 4 * r.Dx(), Rect: r}
+		}
+		n, err := src.ReadRows(band, y)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if n < 0 || n > r.Dy() || n < r.Dy() && err == nil {
+			return 0, fmt.Errorf("jpeg: RowStream read %d rows of a band of %d", n, r.Dy())
+		}
+		if height+n >= 1<<16 {
+			return 0, errors.New("jpeg: image is too large to encode")
+		}
+		if n > 0 {
+			switch band := band.(type) {
+			case *image.Gray:
+				band.Rect.Max.Y = y + n
+			case *image.RGBA:
+				band.Rect.Max.Y = y + n
+			}
+			for mx := 0; mx < e.mxx; mx++ {
+				e.writeMCU(band, mx, 0, mcu, &prevDC)
+			}
+			height += n
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if height == 0 {
+		return 0, errors.New("jpeg: RowStream has no rows")
+	}
+	// Pad the last byte with 1's.
+	e.padBits()
+	return height, nil
+}
+
+// growPix returns pix resized to n bytes, reallocating it if needed.
+func growPix(pix []uint8, n int) []uint8 {
+	if cap(pix) < n {
+		return make([]uint8, n)
+	}
+	return pix[:n]
+}
+
+// writeDNL writes the Define Number of Lines marker, which gives the height
+// of an image whose frame header has a height of 0.
+func (e *encoder) writeDNL(height int) {
+	e.writeMarkerHeader(dnlMarker, 4)
+	e.buf[0] = uint8(height >> 8)
+	e.buf[1] = uint8(height & 0xff)
+	e.write(e.buf[:2])
+}
@@ -0,0 +1,97 @@
+package progjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// imageStream is a RowStream that copies the rows of an in-memory image,
+// whose height it does not report.
+type imageStream struct {
+	m    image.Image
+	next int
+	fail error
+}
+
+func (s *imageStream) Bounds() image.Rectangle {
+	b := s.m.Bounds()
+	b.Max.Y = b.Min.Y
+	return b
+}
+
+func (s *imageStream) ColorModel() color.Model { return s.m.ColorModel() }
+
+func (s *imageStream) ReadRows(dst draw.Image, y int) (int, error) {
+	if s.fail != nil {
+		return 0, s.fail
+	}
+	db := dst.Bounds()
+	db.Max.Y = min(db.Max.Y, s.m.Bounds().Max.Y)
+	draw.Draw(dst, db, s.m, db.Min, draw.Src)
+	s.next = db.Max.Y
+	if db.Max.Y == s.m.Bounds().Max.Y {
+		return db.Dy(), io.EOF
+	}
+	return db.Dy(), nil
+}
+
+func TestEncodeRowStream(t *testing.T) {
+	for _, tc := range []struct {
+		m image.Image
+		o *Options
+	}{
+		{testimg.Photo(150, 97, 1), nil},
+		{testimg.Photo(150, 96, 1), &Options{Quality: 70, Grayscale: true}},
+		{testimg.ZonePlate(75, 61), &Options{Quality: 60}},
+	} {
+		var want, got bytes.Buffer
+		if err := Encode(&want, tc.m, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		if err := EncodeRowStream(&got, &imageStream{m: tc.m}, tc.o); err != nil {
+			t.Fatal(err)
+		}
+		data := got.Bytes()
+		// The frame header has a height of 0.
+		sof := bytes.Index(data, []byte{0xff, sof0Marker})
+		if sof < 0 || data[sof+5] != 0 || data[sof+6] != 0 {
+			t.Fatalf("%v: SOF0 does not have a zero height", tc.m.Bounds())
+		}
+		// The DNL marker gives the height, just before EOI.
+		h := tc.m.Bounds().Dy()
+		dnl := []byte{0xff, dnlMarker, 0, 4, byte(h >> 8), byte(h), 0xff, eoiMarker}
+		if !bytes.HasSuffix(data, dnl) {
+			t.Fatalf("%v: got trailer % x, want % x", tc.m.Bounds(), data[len(data)-len(dnl):], dnl)
+		}
+		// With the height in the frame header, the image is the one that
+		// Encode writes.
+		data = append([]byte(nil), data[:len(data)-len(dnl)]...)
+		data = append(data, 0xff, eoiMarker)
+		data[sof+5], data[sof+6] = byte(h>>8), byte(h)
+		if !bytes.Equal(data, want.Bytes()) {
+			t.Errorf("%v, %+v: the image differs from the one written by Encode", tc.m.Bounds(), tc.o)
+		}
+	}
+}
+
+func TestEncodeRowStreamErrors(t *testing.T) {
+	m := testimg.Photo(64, 64, 1)
+	errRead := errors.New("read error")
+	if err := EncodeRowStream(io.Discard, &imageStream{m: m, fail: errRead}, nil); err != errRead {
+		t.Errorf("failing stream: got %v, want %v", err, errRead)
+	}
+	if err := EncodeRowStream(io.Discard, &imageStream{m: m}, &Options{Progressive: true}); err == nil {
+		t.Error("Progressive: got nil error")
+	}
+	empty := &imageStream{m: image.NewRGBA(image.Rect(0, 0, 16, 0))}
+	if err := EncodeRowStream(io.Discard, empty, nil); err == nil {
+		t.Error("no rows: got nil error")
+	}
+}
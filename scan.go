@@ -8,51 +8,77 @@ import (
 	"image"
 )
 
-// makeImg allocates and initializes the destination image.
+// makeImg allocates and initializes the destination image, which covers
+// the MCUs that the decoder reconstructs.
 func (d *decoder) makeImg(mxx, myy int) {
-	if d.nComp == 1 {
-		m := image.NewGray(image.Rect(0, 0, 8*mxx, 8*myy))
-		d.img1 = m.SubImage(image.Rect(0, 0, d.width, d.height)).(*image.Gray)
+	d.mcus = d.regionMCUs(mxx, myy)
+	// r is the area of the MCUs, and b is its part inside the image.
+	mw, mh := 8*d.comp[0].h, 8*d.comp[0].v
+	r := image.Rect(mw*d.mcus.Min.X, mh*d.mcus.Min.Y, mw*d.mcus.Max.X, mh*d.mcus.Max.Y)
+	b := r.Intersect(image.Rect(0, 0, d.width, d.height))
+	if d.nComp > maxComponents {
+		d.makeMultiplane(b)
+		return
+	}
+	if d.nComp == 1 || d.lumaOnly {
+		// The luma of a LumaOnly decode is the whole image.
+		if m := d.intoGray(b); m != nil {
+			d.img1 = m
+			return
+		}
+		m := image.NewGray(r)
+		d.img1 = m.SubImage(b).(*image.Gray)
 		return
 	}
 
-	h0 := d.comp[0].h
-	v0 := d.comp[0].v
-	hRatio := h0 / d.comp[1].h
-	vRatio := v0 / d.comp[1].v
-	var subsampleRatio image.YCbCrSubsampleRatio
+	subsampleRatio, ok := ycbcrRatio(d.comp[0].h/d.comp[1].h, d.comp[0].v/d.comp[1].v)
+	if !ok {
+		panic("unreachable")
+	}
+	if d.nComp == 3 && !d.isRGB() {
+		if m := d.intoYCbCr(b, subsampleRatio); m != nil {
+			d.img3 = m
+			return
+		}
+	}
+	m := image.NewYCbCr(r, subsampleRatio)
+	d.img3 = m.SubImage(b).(*image.YCbCr)
+
+	if d.nComp == 4 {
+		h3, v3 := d.comp[3].h, d.comp[3].v
+		d.blackPix = make([]byte, 8*h3*d.mcus.Dx()*8*v3*d.mcus.Dy())
+		d.blackStride = 8 * h3 * d.mcus.Dx()
+	}
+}
+
+// ycbcrRatio returns the subsampling ratio of a YCbCr image whose luma
+// sampling factors are hRatio and vRatio times those of its chroma, or false
+// if no ratio matches them.
+func ycbcrRatio(hRatio, vRatio int) (image.YCbCrSubsampleRatio, bool) {
 	switch hRatio<<4 | vRatio {
 	case 0x11:
-		subsampleRatio = image.YCbCrSubsampleRatio444
+		return image.YCbCrSubsampleRatio444, true
 	case 0x12:
-		subsampleRatio = image.YCbCrSubsampleRatio440
+		return image.YCbCrSubsampleRatio440, true
 	case 0x21:
-		subsampleRatio = image.YCbCrSubsampleRatio422
+		return image.YCbCrSubsampleRatio422, true
 	case 0x22:
-		subsampleRatio = image.YCbCrSubsampleRatio420
+		return image.YCbCrSubsampleRatio420, true
 	case 0x41:
-		subsampleRatio = image.YCbCrSubsampleRatio411
+		return image.YCbCrSubsampleRatio411, true
 	case 0x42:
-		subsampleRatio = image.YCbCrSubsampleRatio410
-	default:
-		panic("unreachable")
-	}
-	m := image.NewYCbCr(image.Rect(0, 0, 8*h0*mxx, 8*v0*myy), subsampleRatio)
-	d.img3 = m.SubImage(image.Rect(0, 0, d.width, d.height)).(*image.YCbCr)
-
-	if d.nComp == 4 {
-		h3, v3 := d.comp[3].h, d.comp[3].v
-		d.blackPix = make([]byte, 8*h3*mxx*8*v3*myy)
-		d.blackStride = 8 * h3 * mxx
+		return image.YCbCrSubsampleRatio410, true
 	}
+	return 0, false
 }
 
 // Specified in section B.2.3.
 func (d *decoder) processSOS(n int) error {
+	d.scanComps = d.scanComps[:0]
 	if d.nComp == 0 {
 		return FormatError("missing SOF marker")
 	}
-	if n < 6 || 4+2*d.nComp < n || n%2 != 0 {
+	if n < 6 || 4+2*min(d.nComp, maxComponents) < n || n%2 != 0 {
 		return FormatError("SOS has wrong length")
 	}
 	if err := d.readFull(d.tmp[:n]); err != nil {
@@ -62,6 +88,9 @@ func (d *decoder) processSOS(n int) error {
 	if n != 4+2*nComp {
 		return FormatError("SOS length inconsistent with number of components")
 	}
+	if nComp > maxComponents {
+		return FormatError("too many components in SOS")
+	}
 	var scan [maxComponents]struct {
 		compIndex uint8
 		td        uint8 // DC table selector.
@@ -141,20 +170,40 @@ func (d *decoder) processSOS(n int) error {
 			return FormatError("bad successive approximation values")
 		}
 	}
+	if d.dcOnly && zigStart > 0 {
+		// DecodeDC only needs the DC coefficients.
+		return d.skipToMarker()
+	}
+	if d.lumaOnly && nComp == 1 && scan[0].compIndex != 0 {
+		// The chroma of LumaOnly decodes is not needed either.
+		return d.skipToMarker()
+	}
+	// Motion JPEG frames may have no DHT segment, but their quantization
+	// tables, all of whose values are positive, must be defined.
+	d.loadDefaultHuffmanTables()
+	for _, sc := range scan[:nComp] {
+		if d.quant[d.comp[sc.compIndex].tq] == (block{}) {
+			return FormatError("missing quantization table")
+		}
+	}
 
 	// mxx and myy are the number of MCUs (Minimum Coded Units) in the image.
 	h0, v0 := d.comp[0].h, d.comp[0].v // The h and v values from the Y components.
 	mxx := (d.width + 8*h0 - 1) / (8 * h0)
 	myy := (d.height + 8*v0 - 1) / (8 * v0)
-	if d.img1 == nil && d.img3 == nil {
+	if !d.coeffsOnly && d.img1 == nil && d.img3 == nil && d.imgN == nil {
 		d.makeImg(mxx, myy)
 	}
-	if d.progressive {
+	if d.progressive || d.coeffsOnly {
 		for i := 0; i < nComp; i++ {
 			compIndex := scan[i].compIndex
-			if d.progCoeffs[compIndex] == nil {
-				d.progCoeffs[compIndex] = make([]block, mxx*myy*d.comp[compIndex].h*d.comp[compIndex].v)
+			if !d.hasCoefficients(int(compIndex)) {
+				n := mxx * myy * d.comp[compIndex].h * d.comp[compIndex].v
+				if err := d.allocCoefficients(int(compIndex), n); err != nil {
+					return err
+				}
 			}
+			d.backupCoefficients(int(compIndex))
 		}
 	}
 
@@ -163,14 +212,61 @@ func (d *decoder) processSOS(n int) error {
 	var (
 		// b is the decoded coefficients, in natural (not zig-zag) order.
 		b  block
-		dc [maxComponents]int32
+		dc [maxFrameComponents]int32
 		// bx and by are the location of the current block, in units of 8x8
 		// blocks: the third block in the first row has (bx, by) = (2, 0).
 		bx, by     int
 		blockCount int
+		// nBlock is the number of blocks decoded by a non-interleaved scan,
+		// whose restart intervals count blocks rather than the frame's MCUs.
+		nBlock int
+		// skip is whether the current restart interval is skipped, because
+		// DecodeRegion needs none of its blocks. Only the intervals of
+		// sequential images can be: the coefficients of a progressive
+		// image depend on those of the previous scans.
+		skip      bool
+		skippable = d.ri > 0 && !d.region.Empty() && !d.progressive
 	)
+	// restart reads the RST marker that ends a restart interval, and resets
+	// the decoder state.
+	restart := func() error {
+		// For well-formed input, the RST[0-7] restart marker follows
+		// immediately. For corrupt input, call findRST to try to
+		// resynchronize.
+		if err := d.readFull(d.tmp[:2]); err != nil {
+			return err
+		} else if d.tmp[0] != 0xff || d.tmp[1] != expectedRST {
+			if d.restarts != nil {
+				d.restarts.Resyncs = append(d.restarts.Resyncs, d.offset()-2)
+			}
+			if err := d.findRST(expectedRST); err != nil {
+				return err
+			}
+		}
+		if d.restarts != nil {
+			d.restarts.Markers++
+		}
+		expectedRST++
+		if expectedRST == rst7Marker+1 {
+			expectedRST = rst0Marker
+		}
+		// Reset the Huffman decoder.
+		d.bits = bits{}
+		// Reset the DC components, as per section F.2.1.3.1.
+		dc = [maxFrameComponents]int32{}
+		// Reset the progressive decoder state, as per section G.1.2.2.
+		d.eobRun = 0
+		return nil
+	}
 	for my := 0; my < myy; my++ {
 		for mx := 0; mx < mxx; mx++ {
+			if skippable && nComp != 1 && mcu%d.ri == 0 {
+				if skip = !runInRect(mcu, d.ri, mxx, d.mcus); skip {
+					if err := d.skipToMarker(); err != nil {
+						return err
+					}
+				}
+			}
 			for i := 0; i < nComp; i++ {
 				compIndex := scan[i].compIndex
 				hi := d.comp[compIndex].h
@@ -212,11 +308,38 @@ func (d *decoder) processSOS(n int) error {
 						if bx*8 >= d.width || by*8 >= d.height {
 							continue
 						}
+						// The MCU of a non-interleaved scan is a single
+						// block, as per section A.2.2.
+						if d.ri > 0 && nBlock%d.ri == 0 {
+							if nBlock > 0 {
+								if err := restart(); err != nil {
+									return err
+								}
+							}
+							if skippable {
+								// The blocks of the scan are those inside
+								// the image.
+								w := min(q, (d.width+7)/8)
+								r := image.Rect(d.mcus.Min.X*hi, d.mcus.Min.Y*vi, d.mcus.Max.X*hi, d.mcus.Max.Y*vi)
+								if skip = !runInRect(nBlock, d.ri, w, r); skip {
+									if err := d.skipToMarker(); err != nil {
+										return err
+									}
+								}
+							}
+						}
+						nBlock++
+					}
+					if skip {
+						continue
 					}
 
 					// Load the previous partially decoded coefficients, if applicable.
 					if d.progressive {
-						b = d.progCoeffs[compIndex][by*mxx*hi+bx]
+						var err error
+						if b, err = d.loadCoefficients(int(compIndex), by*mxx*hi+bx); err != nil {
+							return err
+						}
 					} else {
 						b = block{}
 					}
@@ -286,9 +409,11 @@ func (d *decoder) processSOS(n int) error {
 						}
 					}
 
-					if d.progressive {
+					if d.progressive || d.coeffsOnly {
 						// Save the coefficients.
-						d.progCoeffs[compIndex][by*mxx*hi+bx] = b
+						if err := d.storeCoefficients(int(compIndex), by*mxx*hi+bx, &b); err != nil {
+							return err
+						}
 						// At this point, we could call reconstructBlock to dequantize and perform the
 						// inverse DCT, to save early stages of a progressive image to the *image.YCbCr
 						// buffers (the whole point of progressive encoding), but in Go, the jpeg.Decode
@@ -304,29 +429,15 @@ func (d *decoder) processSOS(n int) error {
 				} // for j
 			} // for i
 			mcu++
-			if d.ri > 0 && mcu%d.ri == 0 && mcu < mxx*myy {
-				// For well-formed input, the RST[0-7] restart marker follows
-				// immediately. For corrupt input, call findRST to try to
-				// resynchronize.
-				if err := d.readFull(d.tmp[:2]); err != nil {
+			if nComp != 1 && d.ri > 0 && mcu%d.ri == 0 && mcu < mxx*myy {
+				if err := restart(); err != nil {
 					return err
-				} else if d.tmp[0] != 0xff || d.tmp[1] != expectedRST {
-					if err := d.findRST(expectedRST); err != nil {
-						return err
-					}
 				}
-				expectedRST++
-				if expectedRST == rst7Marker+1 {
-					expectedRST = rst0Marker
-				}
-				// Reset the Huffman decoder.
-				d.bits = bits{}
-				// Reset the DC components, as per section F.2.1.3.1.
-				dc = [maxComponents]int32{}
-				// Reset the progressive decoder state, as per section G.1.2.2.
-				d.eobRun = 0
 			}
 		} // for mx
+		if d.progress != nil {
+			d.reportProgress(false)
+		}
 	} // for my
 
 	return nil
@@ -439,20 +550,40 @@ func (d *decoder) refineNonZeroes(b *block, zig, zigEnd, nz, delta int32) (int32
 }
 
 func (d *decoder) reconstructProgressiveImage() error {
+	return d.reconstructComponents(false)
+}
+
+// reconstructComponents is reconstructProgressiveImage, which also sets the
+// components that no scan has included yet to mid-gray if missing is true,
+// for the previews of partially decoded images.
+func (d *decoder) reconstructComponents(missing bool) error {
 	// The h0, mxx, by and bx variables have the same meaning as in the
 	// processSOS method.
 	h0 := d.comp[0].h
 	mxx := (d.width + 8*h0 - 1) / (8 * h0)
 	for i := 0; i < d.nComp; i++ {
-		if d.progCoeffs[i] == nil {
+		if d.lumaOnly && i > 0 {
+			break
+		}
+		has := d.hasCoefficients(i)
+		if !has && !missing {
 			continue
 		}
 		v := 8 * d.comp[0].v / d.comp[i].v
 		h := 8 * d.comp[0].h / d.comp[i].h
 		stride := mxx * d.comp[i].h
-		for by := 0; by*v < d.height; by++ {
-			for bx := 0; bx*h < d.width; bx++ {
-				if err := d.reconstructBlock(&d.progCoeffs[i][by*stride+bx], bx, by, i); err != nil {
+		// Only the blocks of the MCUs in d.mcus are reconstructed.
+		ci := d.comp[i]
+		for by := d.mcus.Min.Y * ci.v; by < d.mcus.Max.Y*ci.v && by*v < d.height; by++ {
+			for bx := d.mcus.Min.X * ci.h; bx < d.mcus.Max.X*ci.h && bx*h < d.width; bx++ {
+				var b block
+				if has {
+					var err error
+					if b, err = d.loadCoefficients(i, by*stride+bx); err != nil {
+						return err
+					}
+				}
+				if err := d.reconstructBlock(&b, bx, by, i); err != nil {
 					return err
 				}
 			}
@@ -462,35 +593,36 @@ func (d *decoder) reconstructProgressiveImage() error {
 }
 
 // reconstructBlock dequantizes, performs the inverse DCT and stores the block
-// to the image.
+// to the image. The blocks outside the MCUs in d.mcus are ignored.
 func (d *decoder) reconstructBlock(b *block, bx, by, compIndex int) error {
+	if !d.inMCUs(bx, by, compIndex) || d.lumaOnly && compIndex > 0 {
+		return nil
+	}
 	qt := &d.quant[d.comp[compIndex].tq]
 	for zig := 0; zig < blockSize; zig++ {
 		b[unzig[zig]] *= qt[zig]
 	}
 	idct(b)
-	dst, stride := []byte(nil), 0
-	if d.nComp == 1 {
-		dst, stride = d.img1.Pix[8*(by*d.img1.Stride+bx):], d.img1.Stride
-	} else {
-		switch compIndex {
-		case 0:
-			dst, stride = d.img3.Y[8*(by*d.img3.YStride+bx):], d.img3.YStride
-		case 1:
-			dst, stride = d.img3.Cb[8*(by*d.img3.CStride+bx):], d.img3.CStride
-		case 2:
-			dst, stride = d.img3.Cr[8*(by*d.img3.CStride+bx):], d.img3.CStride
-		case 3:
-			dst, stride = d.blackPix[8*(by*d.blackStride+bx):], d.blackStride
-		default:
-			return UnsupportedError("too many components")
-		}
+	// Only the pixels inside the component's plane are stored, so that the
+	// planes of an image given to DecodeInto need no room for the padding
+	// of the last MCUs.
+	c := d.comp[compIndex]
+	cols := (d.width*c.h+d.comp[0].h-1)/d.comp[0].h - 8*bx
+	rows := (d.height*c.v+d.comp[0].v-1)/d.comp[0].v - 8*by
+	if cols <= 0 || rows <= 0 {
+		return nil
 	}
+	cols, rows = min(cols, 8), min(rows, 8)
+	// The image starts at the first MCU in d.mcus.
+	bx -= d.mcus.Min.X * c.h
+	by -= d.mcus.Min.Y * c.v
+	dst, stride := d.plane(compIndex)
+	dst = dst[8*(by*stride+bx):]
 	// Level shift by +128, clip to [0, 255], and write to dst.
-	for y := 0; y < 8; y++ {
+	for y := 0; y < rows; y++ {
 		y8 := y * 8
 		yStride := y * stride
-		for x := 0; x < 8; x++ {
+		for x := 0; x < cols; x++ {
 			c := b[y8+x]
 			if c < -128 {
 				c = 0
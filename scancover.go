@@ -0,0 +1,108 @@
+package progjpeg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// VerifyScanScriptCoverage checks that a scan script is a complete and
+// well-formed progressive sequence for an image with nComponent components,
+// as specified in section G.1.1.1.1:
+//
+//   - every scan is valid, as checked by [ValidateScanScript];
+//   - a scan covers either the DC coefficient or a band of AC coefficients,
+//     never both;
+//   - the DC coefficient of a component is sent before its AC coefficients;
+//   - the first scan of a coefficient has a SuccessiveApproxHigh of 0, and
+//     each following scan refines it by exactly one bit, with a
+//     SuccessiveApproxHigh equal to the previous SuccessiveApproxLow and a
+//     SuccessiveApproxLow one less than that;
+//   - at the end of the script, every coefficient of every component has
+//     been sent down to bit 0.
+//
+// It returns an error describing the first violation, if any. Scripts that
+// pass ValidateScanScript but not VerifyScanScriptCoverage still produce
+// decodable files, but the image is incomplete, or some coefficients are
+// sent more than once.
+func VerifyScanScriptCoverage(script ScanScript, nComponent int) error {
+	if len(script) == 0 {
+		return errors.New("jpeg: scan script cannot be empty")
+	}
+	for i, scan := range script {
+		// These are the checks of ValidateScanScript, except for the
+		// refinement of one bit, which is checked below along with the
+		// previous scans of each coefficient.
+		if scan.Component < -1 || scan.Component >= nComponent {
+			return fmt.Errorf("jpeg: scan %d has invalid component %d (must be -1 to %d)", i, scan.Component, nComponent-1)
+		}
+		if scan.Component == -1 && nComponent > maxComponents {
+			return fmt.Errorf("jpeg: scan %d cannot have component -1 (a scan has at most %d components)", i, maxComponents)
+		}
+		if scan.SpectralStart < 0 || scan.SpectralEnd < scan.SpectralStart || scan.SpectralEnd > 63 {
+			return fmt.Errorf("jpeg: scan %d has invalid spectral selection %d-%d (must be within 0-63)", i, scan.SpectralStart, scan.SpectralEnd)
+		}
+		if ah, al := scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow; ah < 0 || ah > 13 || al < 0 || al > 13 {
+			return fmt.Errorf("jpeg: scan %d has invalid successive approximation %d-%d (must be within 0-13)", i, ah, al)
+		}
+		if scan.Component == -1 && scan.SpectralStart > 0 {
+			return fmt.Errorf("jpeg: AC scan %d cannot have component -1 (interleaved AC not allowed)", i)
+		}
+		if err := scan.validateComponents(i, nComponent); err != nil {
+			return err
+		}
+		if err := scan.validateTables(i); err != nil {
+			return err
+		}
+		if scan.RestartInterval < 0 || scan.RestartInterval > 0xffff {
+			return fmt.Errorf("jpeg: scan %d has invalid restart interval %d (must be 0-65535)", i, scan.RestartInterval)
+		}
+	}
+
+	// bitPos[c][k] is the successive approximation bit position of
+	// coefficient k of component c after the scans so far, or -1 if it has
+	// not been sent yet.
+	bitPos := make([][blockSize]int, nComponent)
+	for c := range bitPos {
+		for k := range bitPos[c] {
+			bitPos[c][k] = -1
+		}
+	}
+	for i, scan := range script {
+		ss, se := scan.SpectralStart, scan.SpectralEnd
+		ah, al := scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow
+		if ss == 0 && se != 0 {
+			return fmt.Errorf("jpeg: scan %d mixes the DC coefficient with AC coefficients 1-%d", i, se)
+		}
+		if ah != 0 && al != ah-1 {
+			return fmt.Errorf("jpeg: refinement scan %d has successive approximation %d-%d (must refine one bit)", i, ah, al)
+		}
+		for _, c := range scan.components(nComponent) {
+			if ss > 0 && bitPos[c][0] < 0 {
+				return fmt.Errorf("jpeg: scan %d sends AC coefficients of component %d before its DC coefficient", i, c)
+			}
+			for k := ss; k <= se; k++ {
+				switch prev := bitPos[c][k]; {
+				case ah == 0 && prev >= 0:
+					return fmt.Errorf("jpeg: scan %d sends coefficient %d of component %d again", i, k, c)
+				case ah != 0 && prev < 0:
+					return fmt.Errorf("jpeg: scan %d refines coefficient %d of component %d before its first scan", i, k, c)
+				case ah != 0 && prev != ah:
+					return fmt.Errorf("jpeg: scan %d refines coefficient %d of component %d from bit %d, but it was sent down to bit %d", i, k, c, ah, prev)
+				}
+				bitPos[c][k] = al
+			}
+		}
+	}
+
+	for c := range bitPos {
+		for k, pos := range bitPos[c] {
+			switch {
+			case pos < 0:
+				return fmt.Errorf("jpeg: coefficient %d of component %d is never sent", k, c)
+			case pos > 0:
+				return fmt.Errorf("jpeg: coefficient %d of component %d is only sent down to bit %d", k, c, pos)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package progjpeg
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestVerifyScanScriptCoverage(t *testing.T) {
+	for _, tc := range []struct {
+		script     ScanScript
+		nComponent int
+	}{
+		{DefaultGrayscaleScanScript(), 1},
+		{DefaultColorScanScript(), 3},
+		{multiplaneScanScript(6), 6},
+		{ScanScript{
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 0, SuccessiveApproxLow: 2},
+			{Component: -1, SpectralStart: 0, SpectralEnd: 0, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+			{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1, SuccessiveApproxLow: 0},
+		}, 1},
+	} {
+		if err := VerifyScanScriptCoverage(tc.script, tc.nComponent); err != nil {
+			t.Errorf("%v: %v", tc.script, err)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		script := randomScanScript(rnd, 3)
+		if err := VerifyScanScriptCoverage(script, 3); err != nil {
+			t.Errorf("%v: %v", script, err)
+		}
+	}
+}
+
+func TestVerifyScanScriptCoverageErrors(t *testing.T) {
+	for _, tc := range []struct {
+		script ScanScript
+		want   string
+	}{
+		{ScanScript{{Component: 0, SpectralStart: 0, SpectralEnd: 63}}, "mixes the DC"},
+		{ScanScript{{Component: 0, SpectralStart: 1, SpectralEnd: 63}, {Component: 0}}, "before its DC"},
+		{ScanScript{{Component: 0}, {Component: 0, SpectralStart: 1, SpectralEnd: 9}, {Component: 0, SpectralStart: 9, SpectralEnd: 63}}, "coefficient 9 of component 0 again"},
+		{ScanScript{{Component: 0}, {Component: 0, SpectralStart: 1, SpectralEnd: 62}}, "coefficient 63 of component 0 is never sent"},
+		{ScanScript{{Component: 0, SuccessiveApproxLow: 1}, {Component: 0, SpectralStart: 1, SpectralEnd: 63}}, "only sent down to bit 1"},
+		{ScanScript{{Component: 0, SuccessiveApproxLow: 2}, {Component: 0, SuccessiveApproxHigh: 2}}, "must refine one bit"},
+		{ScanScript{{Component: 0, SuccessiveApproxLow: 2}, {Component: 0, SuccessiveApproxHigh: 1}}, "from bit 1"},
+		{ScanScript{{Component: 0}, {Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 1}}, "before its first scan"},
+		{ScanScript{{Component: 0, SpectralEnd: 64}}, "invalid spectral selection"},
+	} {
+		err := VerifyScanScriptCoverage(tc.script, 1)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v: got %v, want an error containing %q", tc.script, err, tc.want)
+		}
+	}
+}
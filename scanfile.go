@@ -0,0 +1,123 @@
+package progjpeg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseScanScript reads a scan script in the text format of the -scans option
+// of libjpeg's and mozjpeg's cjpeg, so that existing scan files can be used
+// with this encoder. Each scan lists its components, then optionally a colon
+// and the Ss, Se, Ah and Al parameters, and ends with a semicolon:
+//
+//	# Interleaved DC scan, then luma and chroma AC scans.
+//	0,1,2: 0 0 0 0;
+//	0: 1 5 0 0;
+//	1: 1 63 0 0;
+//	2: 1 63 0 0;
+//	0: 6 63 0 0;
+//
+// Numbers are separated by spaces or commas, and # starts a comment that runs
+// to the end of the line. A scan without parameters covers all of the
+// coefficients, as in cjpeg.
+//
+// A scan listing several components must be a DC scan of components in
+// increasing order. It becomes a scan of Component -1 and, unless the
+// components are 0, 1, ... in order, of the listed Components.
+// ParseScanScript does not check the script against an image; see
+// [ValidateScanScript].
+func ParseScanScript(r io.Reader) (ScanScript, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Remove the comments.
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			lines[i] = line[:j]
+		}
+	}
+	texts := strings.Split(strings.Join(lines, "\n"), ";")
+	// The last scan does not need a terminating semicolon.
+	if strings.TrimSpace(texts[len(texts)-1]) == "" {
+		texts = texts[:len(texts)-1]
+	}
+
+	var script ScanScript
+	for i, text := range texts {
+		scan, err := parseScan(text)
+		if err != nil {
+			return nil, fmt.Errorf("jpeg: scan %d: %v", i, err)
+		}
+		script = append(script, scan)
+	}
+	if len(script) == 0 {
+		return nil, errors.New("jpeg: scan script cannot be empty")
+	}
+	return script, nil
+}
+
+// parseScan parses the text of one scan of a cjpeg scan script, without its
+// terminating semicolon.
+func parseScan(text string) (ProgressiveScan, error) {
+	compText, paramText, hasParams := strings.Cut(text, ":")
+	comps, err := parseScanIntegers(compText)
+	if err != nil {
+		return ProgressiveScan{}, err
+	}
+	if len(comps) == 0 {
+		return ProgressiveScan{}, errors.New("no components")
+	}
+
+	scan := ProgressiveScan{SpectralStart: 0, SpectralEnd: blockSize - 1}
+	if hasParams {
+		params, err := parseScanIntegers(paramText)
+		if err != nil {
+			return ProgressiveScan{}, err
+		}
+		if len(params) != 4 {
+			return ProgressiveScan{}, fmt.Errorf("got %d parameters, want 4 (Ss Se Ah Al)", len(params))
+		}
+		scan.SpectralStart, scan.SpectralEnd = params[0], params[1]
+		scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow = params[2], params[3]
+	}
+
+	if len(comps) == 1 {
+		scan.Component = comps[0]
+		return scan, nil
+	}
+	if scan.SpectralStart != 0 || scan.SpectralEnd != 0 {
+		return ProgressiveScan{}, fmt.Errorf("components %v are interleaved in an AC scan", comps)
+	}
+	scan.Component = -1
+	for j, c := range comps {
+		if j > 0 && c <= comps[j-1] {
+			return ProgressiveScan{}, fmt.Errorf("interleaved components %v are not in increasing order", comps)
+		}
+		if c != j {
+			scan.Components = comps
+		}
+	}
+	return scan, nil
+}
+
+// parseScanIntegers parses a list of non-negative integers separated by
+// spaces or commas.
+func parseScanIntegers(text string) ([]int, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	values := make([]int, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid number %q", f)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
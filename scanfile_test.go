@@ -0,0 +1,99 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScanScript(t *testing.T) {
+	const text = `# A simple color script.
+0,1,2: 0 0 0 0;   # DC
+0: 1 5 0 0;
+1 : 1 63 0 0 ;
+2: 1,63,0,0;
+0: 6 63 0 0
+`
+	got, err := ParseScanScript(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ScanScript{
+		{Component: -1, SpectralStart: 0, SpectralEnd: 0},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 5},
+		{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 0, SpectralStart: 6, SpectralEnd: 63},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if err := ValidateScanScript(got, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 40, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			m.SetRGBA(x, y, color.RGBA{uint8(6 * x), uint8(10 * y), uint8(x * y), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Progressive: true, ScanScript: got, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseScanScriptDefaults(t *testing.T) {
+	got, err := ParseScanScript(strings.NewReader("0;\n0: 1 63 2 1;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ScanScript{
+		{Component: 0, SpectralStart: 0, SpectralEnd: 63},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63, SuccessiveApproxHigh: 2, SuccessiveApproxLow: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseScanScriptPartialDC(t *testing.T) {
+	got, err := ParseScanScript(strings.NewReader("0: 0 0 0 0; 1,2: 0 0 0 0;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ScanScript{
+		{Component: 0, SpectralStart: 0, SpectralEnd: 0},
+		{Component: -1, Components: []int{1, 2}, SpectralStart: 0, SpectralEnd: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseScanScriptErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"# only a comment\n",
+		"0: 1 5 0;",
+		"0: 1 5 0 0 0;",
+		"x: 0 0 0 0;",
+		"0: -1 5 0 0;",
+		"0,1: 1 5 0 0;",
+		"2,1: 0 0 0 0;",
+		"1,1: 0 0 0 0;",
+		"0;;1;",
+		": 0 0 0 0;",
+	} {
+		if script, err := ParseScanScript(strings.NewReader(text)); err == nil {
+			t.Errorf("%q: got %v, want an error", text, script)
+		}
+	}
+}
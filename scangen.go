@@ -0,0 +1,144 @@
+package progjpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"iter"
+	"math/rand"
+)
+
+// GenerateScanScripts returns an endless sequence of pseudo-random scan
+// scripts for images with nComponent components, determined by seed. It is
+// meant for testing decoders against unusual but legal progressive
+// structures.
+//
+// Each script comes with the error that [ValidateScanScript] reports for
+// it. Most scripts are valid, and cover every coefficient of every
+// component exactly once, in various orders and spectral bands, with the DC
+// coefficients first. About one in four is a valid script with a single
+// mutation that makes it invalid, such as a SpectralEnd of 64 or an
+// out-of-range component, to check that such scripts are rejected.
+func GenerateScanScripts(seed int64, nComponent int) iter.Seq2[ScanScript, error] {
+	return func(yield func(ScanScript, error) bool) {
+		rnd := rand.New(rand.NewSource(seed))
+		for {
+			script := randomScanScript(rnd, nComponent)
+			if rnd.Intn(4) == 0 {
+				mutateScanScript(rnd, script, nComponent)
+			}
+			if !yield(script, ValidateScanScript(script, nComponent)) {
+				return
+			}
+		}
+	}
+}
+
+// randomScanScript returns a valid scan script that covers every
+// coefficient of every component exactly once.
+func randomScanScript(rnd *rand.Rand, nComponent int) ScanScript {
+	// queues holds the scans of each component, in the order in which they
+	// must be sent.
+	queues := make([][]ProgressiveScan, nComponent)
+	var script ScanScript
+	interleavedDC := nComponent <= maxComponents && rnd.Intn(2) == 0
+	if interleavedDC {
+		script = append(script, ProgressiveScan{Component: -1})
+	}
+	for c := range queues {
+		if !interleavedDC {
+			queues[c] = append(queues[c], ProgressiveScan{Component: c})
+		}
+		// Split the AC coefficients into 1 to 5 bands.
+		cuts := rnd.Perm(62)[:rnd.Intn(5)]
+		start := 1
+		for end := 1; end <= 63; end++ {
+			cut := end == 63
+			for _, k := range cuts {
+				cut = cut || end == k+1
+			}
+			if cut {
+				queues[c] = append(queues[c], ProgressiveScan{Component: c, SpectralStart: start, SpectralEnd: end})
+				start = end + 1
+			}
+		}
+	}
+	// Interleave the components' scans randomly.
+	for {
+		var pending []int
+		for c, q := range queues {
+			if len(q) > 0 {
+				pending = append(pending, c)
+			}
+		}
+		if len(pending) == 0 {
+			return script
+		}
+		c := pending[rnd.Intn(len(pending))]
+		script = append(script, queues[c][0])
+		queues[c] = queues[c][1:]
+	}
+}
+
+// mutateScanScript makes one scan of a valid script invalid.
+func mutateScanScript(rnd *rand.Rand, script ScanScript, nComponent int) {
+	i := rnd.Intn(len(script))
+	s := &script[i]
+	switch rnd.Intn(5) {
+	case 0:
+		s.Component = nComponent
+	case 1:
+		s.SpectralEnd = 64
+	case 2:
+		s.SpectralStart, s.SpectralEnd = 2, 1
+	case 3:
+		// A refinement scan must refine exactly one bit.
+		s.SuccessiveApproxHigh, s.SuccessiveApproxLow = 1, 2
+	case 4:
+		// An interleaved AC scan.
+		s.Component, s.SpectralStart, s.SpectralEnd = -1, 1, 63
+	}
+}
+
+// CheckScanScript encodes m as a progressive JPEG with the given scan script,
+// decodes the result with both [Decode] and the given decode function, and
+// reports an error if the script is invalid, if decode fails, or if any
+// 8-bit color channel of the two decoded images differs by more than
+// tolerance. Decoders with a different IDCT typically need a tolerance of 1
+// or 2.
+func CheckScanScript(m image.Image, script ScanScript, decode func(io.Reader) (image.Image, error), tolerance int) error {
+	var buf bytes.Buffer
+	o := &Options{Quality: 90, Progressive: true, ScanScript: script, StrictScanScript: true}
+	if err := Encode(&buf, m, o); err != nil {
+		return err
+	}
+	want, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	got, err := decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return fmt.Errorf("jpeg: decoding scan script %v: %w", script, err)
+	}
+	b := want.Bounds()
+	if got.Bounds() != b {
+		return fmt.Errorf("jpeg: decoding scan script %v: bounds %v, want %v", script, got.Bounds(), b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+			c1 := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+			if !within(c0.R, c1.R, tolerance) || !within(c0.G, c1.G, tolerance) || !within(c0.B, c1.B, tolerance) {
+				return fmt.Errorf("jpeg: decoding scan script %v: pixel (%d, %d) is %v, want %v", script, x, y, c1, c0)
+			}
+		}
+	}
+	return nil
+}
+
+func within(a, b uint8, tolerance int) bool {
+	d := int(a) - int(b)
+	return -tolerance <= d && d <= tolerance
+}
@@ -0,0 +1,101 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateScanScripts(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 40, 24))
+	gray := image.NewGray(image.Rect(0, 0, 40, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{uint8(6 * x), uint8(10 * y), uint8(x * y), 0xff})
+			gray.SetGray(x, y, color.Gray{uint8(6*x + y)})
+		}
+	}
+	for _, tc := range []struct {
+		m          image.Image
+		nComponent int
+	}{
+		{gray, 1},
+		{rgba, 3},
+	} {
+		var baseline bytes.Buffer
+		if err := Encode(&baseline, tc.m, &Options{Quality: 90}); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(&baseline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nValid, nInvalid := 0, 0
+		for script, err := range GenerateScanScripts(1, tc.nComponent) {
+			if nValid+nInvalid == 100 {
+				break
+			}
+			if err != nil {
+				nInvalid++
+				if CheckScanScript(tc.m, script, Decode, 0) == nil {
+					t.Errorf("invalid script %v was accepted", script)
+				}
+				continue
+			}
+			nValid++
+			// A valid script covers every coefficient, so the decoder must
+			// give the same pixels as for a baseline image.
+			decode := func(r io.Reader) (image.Image, error) {
+				m, err := Decode(r)
+				if err == nil && !equalImages(m, want) {
+					t.Errorf("script %v: pixels differ from baseline", script)
+				}
+				return m, err
+			}
+			if err := CheckScanScript(tc.m, script, decode, 0); err != nil {
+				t.Errorf("script %v: %v", script, err)
+			}
+		}
+		if nValid < 50 || nInvalid < 10 {
+			t.Errorf("%d components: got %d valid and %d invalid scripts", tc.nComponent, nValid, nInvalid)
+		}
+	}
+}
+
+func TestGenerateScanScriptsDeterministic(t *testing.T) {
+	var a, b []ScanScript
+	for s := range GenerateScanScripts(42, 3) {
+		if a = append(a, s); len(a) == 20 {
+			break
+		}
+	}
+	for s := range GenerateScanScripts(42, 3) {
+		if b = append(b, s); len(b) == 20 {
+			break
+		}
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			t.Fatalf("script %d differs", i)
+		}
+	}
+}
+
+// equalImages reports whether m0 and m1 have the same bounds and colors.
+func equalImages(m0, m1 image.Image) bool {
+	b := m0.Bounds()
+	if m1.Bounds() != b {
+		return false
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(m0.At(x, y)) != color.NRGBAModel.Convert(m1.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UnmarshalJSON decodes a scan from a JSON object such as
+// {"component": 0, "spectralStart": 1, "spectralEnd": 5}. Unlike the default
+// decoding, it rejects unknown keys and a missing component, which are
+// usually typos in hand-written configuration files. The scan is not
+// checked against an image; see [ValidateScanScript].
+func (s *ProgressiveScan) UnmarshalJSON(data []byte) error {
+	// scan has the fields, tags and encoding of ProgressiveScan, but not
+	// its methods.
+	type scan ProgressiveScan
+	v := struct {
+		*scan
+		Component *int `json:"component"`
+	}{scan: (*scan)(s)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("jpeg: invalid scan: %v", err)
+	}
+	if v.Component == nil {
+		return errors.New("jpeg: invalid scan: missing component")
+	}
+	s.Component = *v.Component
+	return nil
+}
+
+// UnmarshalJSON decodes a scan script from a JSON array of scans, as
+// described in [ProgressiveScan.UnmarshalJSON], or from a JSON string holding
+// a scan script in the cjpeg syntax read by [ParseScanScript], such as
+// "0,1,2: 0 0 0 0; 0: 1 63 0 0; 1: 1 63 0 0; 2: 1 63 0 0;".
+func (s *ScanScript) UnmarshalJSON(data []byte) error {
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		script, err := ParseScanScript(strings.NewReader(text))
+		if err != nil {
+			return err
+		}
+		*s = script
+		return nil
+	}
+	var scans []ProgressiveScan
+	if err := json.Unmarshal(data, &scans); err != nil {
+		return err
+	}
+	*s = scans
+	return nil
+}
@@ -0,0 +1,73 @@
+package progjpeg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestScanScriptJSON(t *testing.T) {
+	script := DefaultColorScanScript()
+	script[1].SuccessiveApproxHigh, script[1].SuccessiveApproxLow = 1, 0
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `[{"component":-1,"spectralStart":0,"spectralEnd":0},` +
+		`{"component":0,"spectralStart":1,"spectralEnd":2,"successiveApproxHigh":1},`
+	if got := string(data); len(got) < len(want) || got[:len(want)] != want {
+		t.Errorf("got %s, want prefix %s", got, want)
+	}
+	var got ScanScript
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, script) {
+		t.Errorf("got %v, want %v", got, script)
+	}
+}
+
+func TestScanScriptJSONConfig(t *testing.T) {
+	var config struct {
+		Array ScanScript
+		Text  ScanScript
+		None  ScanScript
+	}
+	const data = `{
+		"Array": [{"component": -1, "spectralStart": 0, "spectralEnd": 0}, {"component": 0, "spectralStart": 1, "spectralEnd": 63}],
+		"Text": "0: 0 0 0 0; 0: 1 63 0 0;",
+		"None": null
+	}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	want := ScanScript{
+		{Component: -1, SpectralStart: 0, SpectralEnd: 0},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63},
+	}
+	if !reflect.DeepEqual(config.Array, want) {
+		t.Errorf("Array: got %v, want %v", config.Array, want)
+	}
+	want[0].Component = 0
+	if !reflect.DeepEqual(config.Text, want) {
+		t.Errorf("Text: got %v, want %v", config.Text, want)
+	}
+	if config.None != nil {
+		t.Errorf("None: got %v, want nil", config.None)
+	}
+}
+
+func TestScanScriptJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`[{"spectralStart": 1, "spectralEnd": 5}]`,
+		`[{"component": 0, "spectralStart": 1, "spectralEnd": 5, "ss": 1}]`,
+		`[{"component": "all"}]`,
+		`"0: 1 5 0;"`,
+		`{}`,
+	} {
+		var script ScanScript
+		if err := json.Unmarshal([]byte(data), &script); err == nil {
+			t.Errorf("%s: got %v, want an error", data, script)
+		}
+	}
+}
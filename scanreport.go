@@ -0,0 +1,108 @@
+package progjpeg
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ScanReport describes a scan of a JPEG file, as reported by [ReportScans].
+type ScanReport struct {
+	// Components are the indexes of the scan's components in the frame,
+	// in SOF order: 0 for Y, 1 for Cb and 2 for Cr in a YCbCr image. An
+	// identifier that the frame does not declare gives -1.
+	Components []int
+	// SpectralStart, SpectralEnd, SuccessiveApproxHigh and
+	// SuccessiveApproxLow are the Ss, Se, Ah and Al parameters of the scan.
+	SpectralStart, SpectralEnd                int
+	SuccessiveApproxHigh, SuccessiveApproxLow int
+	// Bytes is the size of the entropy-coded data of the scan, and
+	// Cumulative that of the scans up to this one, included. End is the
+	// offset in the file of the end of the scan: the number of bytes that
+	// a browser needs to display it, headers and metadata included.
+	Bytes, Cumulative, End int64
+}
+
+// ReportScans reads the JPEG file in r, from this package or any other
+// encoder, such as libjpeg or mozjpeg, and reports the parameters and the
+// size of each of its scans, as listed by [ParseStructure], to compare the
+// scan scripts of encoders and how they spend their bytes. [WriteScanReport]
+// prints them as a table.
+func ReportScans(r io.Reader) ([]ScanReport, error) {
+	markers, err := ParseStructure(r)
+	if err != nil {
+		return nil, err
+	}
+	var frame *FrameInfo
+	var scans []ScanReport
+	var total int64
+	for _, m := range markers {
+		switch {
+		case m.Frame != nil:
+			frame = m.Frame
+		case m.Scan != nil:
+			s := m.Scan
+			total += s.EntropyLength
+			sr := ScanReport{
+				Components:           make([]int, len(s.Components)),
+				SpectralStart:        s.SpectralStart,
+				SpectralEnd:          s.SpectralEnd,
+				SuccessiveApproxHigh: s.SuccessiveApproxHigh,
+				SuccessiveApproxLow:  s.SuccessiveApproxLow,
+				Bytes:                s.EntropyLength,
+				Cumulative:           total,
+				End:                  m.scanEnd(),
+			}
+			for i, c := range s.Components {
+				sr.Components[i] = -1
+				if frame == nil {
+					continue
+				}
+				for j, fc := range frame.Components {
+					if fc.ID == c.ID {
+						sr.Components[i] = j
+					}
+				}
+			}
+			scans = append(scans, sr)
+		}
+	}
+	if frame == nil {
+		return nil, FormatError("missing SOF marker")
+	}
+	return scans, nil
+}
+
+// scanEnd returns the offset in the file of the end of the entropy-coded
+// data of the scan m: the number of bytes that a browser needs to display
+// it, and that [RenderAt] renders it from.
+func (m MarkerInfo) scanEnd() int64 {
+	return m.Offset + 4 + int64(m.Length) + m.Scan.EntropyLength
+}
+
+// WriteScanReport writes scans to w as a table, one scan per line, with the
+// percentage of the entropy-coded data that each scan takes.
+func WriteScanReport(w io.Writer, scans []ScanReport) error {
+	var total int64
+	if len(scans) > 0 {
+		total = scans[len(scans)-1].Cumulative
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "scan\tcomponents\tSs\tSe\tAh\tAl\tbytes\t%\tcumulative\tend\t")
+	for i, s := range scans {
+		comps := make([]string, len(s.Components))
+		for j, c := range s.Components {
+			comps[j] = strconv.Itoa(c)
+		}
+		pct := 0.0
+		if total > 0 {
+			pct = 100 * float64(s.Bytes) / float64(total)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%.1f\t%d\t%d\t\n", i, strings.Join(comps, ","),
+			s.SpectralStart, s.SpectralEnd, s.SuccessiveApproxHigh, s.SuccessiveApproxLow,
+			s.Bytes, pct, s.Cumulative, s.End)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,65 @@
+package progjpeg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestReportScans(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, &Options{Quality: 75, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	scans, err := ReportScans(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := DefaultColorScanScript()
+	if len(scans) != len(script) {
+		t.Fatalf("got %d scans, want %d", len(scans), len(script))
+	}
+	var total int64
+	for i, s := range scans {
+		w := script[i]
+		if w.Component < 0 {
+			if len(s.Components) != 3 || s.Components[0] != 0 || s.Components[1] != 1 || s.Components[2] != 2 {
+				t.Errorf("scan %d: got components %v, want 0,1,2", i, s.Components)
+			}
+		} else if len(s.Components) != 1 || s.Components[0] != w.Component {
+			t.Errorf("scan %d: got components %v, want %d", i, s.Components, w.Component)
+		}
+		if s.SpectralStart != w.SpectralStart || s.SpectralEnd != w.SpectralEnd ||
+			s.SuccessiveApproxHigh != w.SuccessiveApproxHigh || s.SuccessiveApproxLow != w.SuccessiveApproxLow {
+			t.Errorf("scan %d: got %+v, want %+v", i, s, w)
+		}
+		total += s.Bytes
+		if s.Cumulative != total {
+			t.Errorf("scan %d: got cumulative %d, want %d", i, s.Cumulative, total)
+		}
+		// The next scan, or the EOI marker, follows the end of the scan.
+		if s.End <= 0 || s.End >= int64(len(data)) || data[s.End] != 0xff {
+			t.Errorf("scan %d: no marker at its end %d", i, s.End)
+		}
+	}
+	if end := scans[len(scans)-1].End; end != int64(len(data))-2 {
+		t.Errorf("the last scan ends at %d, want %d", end, len(data)-2)
+	}
+
+	var out strings.Builder
+	if err := WriteScanReport(&out, scans); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1+len(scans) || !strings.Contains(lines[0], "cumulative") || !strings.Contains(lines[1], "0,1,2") {
+		t.Errorf("got the table\n%s", out.String())
+	}
+
+	if _, err := ReportScans(strings.NewReader("\xff\xd8\xff\xd9")); err == nil {
+		t.Error("a file without a frame did not fail")
+	}
+}
@@ -0,0 +1,309 @@
+package progjpeg
+
+import (
+	"fmt"
+	"slices"
+)
+
+// HuffmanTable selects the Huffman tables used by a [ProgressiveScan].
+type HuffmanTable int
+
+const (
+	// HuffmanDefault uses the tables of each component of the scan.
+	HuffmanDefault HuffmanTable = iota
+	// HuffmanLuminance and HuffmanChrominance use the luminance or the
+	// chrominance tables of section K.3 of the spec, whatever the
+	// components of the scan.
+	HuffmanLuminance
+	HuffmanChrominance
+	// HuffmanOptimized uses a table computed from the symbols of the scan,
+	// as described in section K.2 of the spec, and written in a DHT marker
+	// just before the scan. It costs an extra pass over the scan's
+	// coefficients, and pays off for the late scans of high-frequency
+	// coefficients, whose symbols are mostly short runs of small values.
+	HuffmanOptimized
+)
+
+// huffmanTableNames are the names of the HuffmanTable values in JSON and
+// YAML scan scripts.
+var huffmanTableNames = [...]string{"default", "luminance", "chrominance", "optimized"}
+
+// String returns the name of t, such as "optimized".
+func (t HuffmanTable) String() string {
+	if t < 0 || int(t) >= len(huffmanTableNames) {
+		return fmt.Sprintf("HuffmanTable(%d)", int(t))
+	}
+	return huffmanTableNames[t]
+}
+
+// MarshalText encodes t as its name.
+func (t HuffmanTable) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(huffmanTableNames) {
+		return nil, fmt.Errorf("jpeg: invalid Huffman table %d", int(t))
+	}
+	return []byte(huffmanTableNames[t]), nil
+}
+
+// UnmarshalText decodes a Huffman table from its name.
+func (t *HuffmanTable) UnmarshalText(text []byte) error {
+	i := slices.Index(huffmanTableNames[:], string(text))
+	if i < 0 {
+		return fmt.Errorf("jpeg: unknown Huffman table %q", text)
+	}
+	*t = HuffmanTable(i)
+	return nil
+}
+
+// validateTables checks the Huffman table selection of scan i.
+func (s ProgressiveScan) validateTables(i int) error {
+	for _, t := range [...]HuffmanTable{s.DCTable, s.ACTable} {
+		if t < HuffmanDefault || t > HuffmanOptimized {
+			return fmt.Errorf("jpeg: scan %d has invalid Huffman table %d (must be 0-3)", i, int(t))
+		}
+	}
+	return nil
+}
+
+// usesHuffmanTable returns whether any scan of script selects t.
+func usesHuffmanTable(script ScanScript, t HuffmanTable) bool {
+	for _, scan := range script {
+		if scan.DCTable == t || scan.ACTable == t {
+			return true
+		}
+	}
+	return false
+}
+
+// optimizedTableID is the destination of the optimized Huffman tables, in
+// both classes. Destinations 0 and 1 hold the luminance and chrominance
+// tables, which stay defined for the following scans.
+const optimizedTableID = 2
+
+// scanHuffmanTables are the Huffman tables of a scan that selects its own.
+type scanHuffmanTables struct {
+	// sel[q] is the table selector byte, Td<<4 | Ta, written in the SOS
+	// header for the components with quantization table q.
+	sel [nQuantIndex]uint8
+	// lut replaces theHuffmanLUT for the scan.
+	lut [nHuffIndex]huffmanLUT
+	// dcFreq and acFreq count the symbols of the scan, for optimized
+	// tables.
+	dcFreq, acFreq [256]int
+}
+
+// selectScanTables sets up the Huffman tables selected by scan, whose
+// components are comps, writing a DHT marker with the optimized tables if
+// any. It leaves e.scanTables false if the scan uses the default tables.
+func (e *encoder) selectScanTables(scan ProgressiveScan, comps []int) {
+	if e.st == nil {
+		e.st = new(scanHuffmanTables)
+	}
+	if scanOptimizesTables(scan) {
+		e.st.dcFreq, e.st.acFreq = [256]int{}, [256]int{}
+		s := newScanRun(scan, comps)
+		e.codeScanRows(&s, 0, e.myy, &e.st.dcFreq, &e.st.acFreq)
+	}
+	if ids, specs := e.setScanTables(scan, comps); len(specs) > 0 {
+		e.writeHuffmanTables(ids, specs)
+	}
+}
+
+// scanTableSelection returns the Huffman tables selected by scan for the
+// classes of coefficients that it holds, HuffmanDefault for the others.
+func scanTableSelection(scan ProgressiveScan) (dc, ac HuffmanTable) {
+	dc, ac = scan.DCTable, scan.ACTable
+	// DC refinement scans send raw bits, without Huffman codes.
+	if scan.SpectralStart > 0 || scan.SuccessiveApproxHigh > 0 {
+		dc = HuffmanDefault
+	}
+	if scan.SpectralEnd == 0 {
+		ac = HuffmanDefault
+	}
+	return dc, ac
+}
+
+// scanOptimizesTables returns whether scan uses optimized Huffman tables,
+// which need the symbol counts of the scan.
+func scanOptimizesTables(scan ProgressiveScan) bool {
+	dc, ac := scanTableSelection(scan)
+	return dc == HuffmanOptimized || ac == HuffmanOptimized
+}
+
+// setScanTables sets e.st and e.scanTables up for scan, whose components
+// are comps, from the symbol counts in e.st if the scan uses optimized
+// tables. It returns the class and destination, and the specification, of
+// the optimized tables, which must be written before the scan.
+func (e *encoder) setScanTables(scan ProgressiveScan, comps []int) (ids string, specs []huffmanSpec) {
+	dc, ac := scanTableSelection(scan)
+	e.scanTables = dc != HuffmanDefault || ac != HuffmanDefault
+	if !e.scanTables {
+		return "", nil
+	}
+	st := e.st
+	st.lut = theHuffmanLUT
+	var dcOpt, acOpt huffmanLUT
+	var idBytes []byte
+	if dc == HuffmanOptimized {
+		s := optimalHuffmanSpec(&st.dcFreq)
+		dcOpt.init(s)
+		idBytes, specs = append(idBytes, 0<<4|optimizedTableID), append(specs, s)
+	}
+	if ac == HuffmanOptimized {
+		s := optimalHuffmanSpec(&st.acFreq)
+		acOpt.init(s)
+		idBytes, specs = append(idBytes, 1<<4|optimizedTableID), append(specs, s)
+	}
+	for _, c := range comps {
+		q := e.comp[c].q
+		td, dcLUT := scanTable(dc, q, 0, dcOpt)
+		ta, acLUT := scanTable(ac, q, 1, acOpt)
+		st.sel[q] = td<<4 | ta
+		st.lut[2*q+0], st.lut[2*q+1] = dcLUT, acLUT
+	}
+	return string(idBytes), specs
+}
+
+// scanTable returns the destination and the look-up table of the Huffman
+// table t of class tc, for a component with quantization table q. opt is
+// the optimized table of the scan, if t is HuffmanOptimized.
+func scanTable(t HuffmanTable, q quantIndex, tc int, opt huffmanLUT) (uint8, huffmanLUT) {
+	switch t {
+	case HuffmanLuminance:
+		q = quantIndexLuminance
+	case HuffmanChrominance:
+		q = quantIndexChrominance
+	case HuffmanOptimized:
+		return optimizedTableID, opt
+	}
+	return uint8(q), theHuffmanLUT[2*int(q)+tc]
+}
+
+// countBlock counts the symbols that writeBlock would emit for a block, and
+// returns the block's DC value.
+func countBlock(b *block, prevDC int32, zigStart, zigEnd int, dcFreq, acFreq *[256]int) int32 {
+	if zigStart == 0 {
+		dcFreq[symbolSize(b[0]-prevDC)]++
+		zigStart = 1
+	}
+	runLength := int32(0)
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		ac := b[unzig[zig]]
+		if ac == 0 {
+			runLength++
+			continue
+		}
+		for runLength > 15 {
+			acFreq[0xf0]++
+			runLength -= 16
+		}
+		acFreq[runLength<<4|symbolSize(ac)]++
+		runLength = 0
+	}
+	if runLength > 0 {
+		acFreq[0x00]++
+	}
+	return b[0]
+}
+
+// symbolSize returns the number of bits needed to hold the magnitude of v,
+// as emitted by emitHuffRLE.
+func symbolSize(v int32) int32 {
+	if v < 0 {
+		v = -v
+	}
+	if v < 0x100 {
+		return int32(bitCount[v])
+	}
+	return 8 + int32(bitCount[v>>8])
+}
+
+// optimalHuffmanSpec returns a Huffman table for symbols with the given
+// frequencies, with codes of at most 16 bits, built as in section K.2 of
+// the spec and in libjpeg's jpeg_gen_optimal_table.
+func optimalHuffmanSpec(freq *[256]int) huffmanSpec {
+	// A reserved symbol with the lowest frequency makes sure that no code
+	// is all 1 bits.
+	const reserved = 256
+	var f [257]int
+	copy(f[:], freq[:])
+	f[reserved] = 1
+	// codeSize[v] is the code length of symbol v, and others[v] is the next
+	// symbol in the tree branch of v, or -1.
+	var codeSize, others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+	for {
+		// Find the two least frequent symbols, preferring the largest
+		// values on ties.
+		c1, c2 := -1, -1
+		for i, n := range f {
+			if n > 0 && (c1 < 0 || n <= f[c1]) {
+				c1 = i
+			}
+		}
+		for i, n := range f {
+			if n > 0 && i != c1 && (c2 < 0 || n <= f[c2]) {
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+		// Merge the two branches.
+		f[c1] += f[c2]
+		f[c2] = 0
+		codeSize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codeSize[c1]++
+		}
+		others[c1] = c2
+		codeSize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codeSize[c2]++
+		}
+	}
+
+	// bits[n] is the number of codes of length n.
+	maxSize := slices.Max(codeSize[:])
+	bits := make([]int, max(maxSize, 16)+1)
+	for _, n := range codeSize {
+		if n > 0 {
+			bits[n]++
+		}
+	}
+	// Limit the code lengths to 16 bits, as in section K.3.
+	for i := len(bits) - 1; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	// Remove the reserved symbol, which has one of the longest codes.
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var s huffmanSpec
+	for n := 1; n <= 16; n++ {
+		s.count[n-1] = byte(bits[n])
+	}
+	for n := 1; n <= maxSize; n++ {
+		for v := 0; v < reserved; v++ {
+			if codeSize[v] == n {
+				s.value = append(s.value, byte(v))
+			}
+		}
+	}
+	return s
+}
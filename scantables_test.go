@@ -0,0 +1,139 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestOptimalHuffmanSpec(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		var freq [256]int
+		nSymbol := 1 + rnd.Intn(256)
+		for _, v := range rnd.Perm(256)[:nSymbol] {
+			// Skewed frequencies make long codes, which must be limited.
+			freq[v] = 1 + rnd.Intn(1<<uint(rnd.Intn(24)))
+		}
+		s := optimalHuffmanSpec(&freq)
+		if len(s.value) != nSymbol {
+			t.Fatalf("got %d values, want %d", len(s.value), nSymbol)
+		}
+		// The code must be prefix-free and leave the all 1 bits code
+		// unused: the Kraft sum must be less than 1.
+		n, kraft := 0, 0
+		for l, c := range s.count {
+			n += int(c)
+			kraft += int(c) << (15 - l)
+		}
+		if n != nSymbol {
+			t.Fatalf("got %d codes, want %d", n, nSymbol)
+		}
+		if kraft >= 1<<16 {
+			t.Fatalf("code lengths %v overflow", s.count)
+		}
+	}
+}
+
+// huffmanScanScript is the default color scan script, with optimized tables
+// for the late AC scans, and the luminance tables for the chrominance AC.
+var huffmanScanScript = ScanScript{
+	{Component: -1, SpectralStart: 0, SpectralEnd: 0, DCTable: HuffmanOptimized},
+	{Component: 0, SpectralStart: 1, SpectralEnd: 5},
+	{Component: 1, SpectralStart: 1, SpectralEnd: 63, ACTable: HuffmanLuminance},
+	{Component: 2, SpectralStart: 1, SpectralEnd: 63, ACTable: HuffmanOptimized},
+	{Component: 0, SpectralStart: 6, SpectralEnd: 63, ACTable: HuffmanOptimized},
+}
+
+func TestScanHuffmanTables(t *testing.T) {
+	m := testimg.Photo(512, 384, 1)
+	var def, opt bytes.Buffer
+	script := append(ScanScript(nil), huffmanScanScript...)
+	for i := range script {
+		script[i].DCTable, script[i].ACTable = HuffmanDefault, HuffmanDefault
+	}
+	if err := Encode(&def, m, &Options{Quality: 90, Progressive: true, ScanScript: script}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&opt, m, &Options{Quality: 90, Progressive: true, ScanScript: huffmanScanScript, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	if opt.Len() >= def.Len() {
+		t.Errorf("optimized tables: got %d bytes, want less than %d", opt.Len(), def.Len())
+	}
+	if n := bytes.Count(opt.Bytes(), []byte{0xff, dhtMarker}); n != 4 {
+		t.Errorf("got %d DHT markers, want 4", n)
+	}
+
+	m0, err := Decode(bytes.NewReader(def.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(bytes.NewReader(opt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m1) {
+		t.Error("the Huffman tables change the decoded image")
+	}
+	m2, err := jpeg.Decode(bytes.NewReader(opt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalImages(m0, m2) {
+		t.Error("image/jpeg decodes a different image")
+	}
+}
+
+func TestScanHuffmanTablesGray(t *testing.T) {
+	m := testimg.Photo(64, 64, 2)
+	gray := image.NewGray(m.Bounds())
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			gray.Set(x, y, m.At(x, y))
+		}
+	}
+	script := ScanScript{
+		{Component: 0, SpectralStart: 0, SpectralEnd: 0, DCTable: HuffmanChrominance},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63, ACTable: HuffmanChrominance},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, gray, &Options{Quality: 75, Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanHuffmanTablesJSON(t *testing.T) {
+	var script ScanScript
+	config := `[{"component": -1}, {"component": 0, "spectralStart": 1, "spectralEnd": 63, "acTable": "optimized"}]`
+	if err := json.Unmarshal([]byte(config), &script); err != nil {
+		t.Fatal(err)
+	}
+	if script[1].ACTable != HuffmanOptimized || script[1].DCTable != HuffmanDefault {
+		t.Errorf("got tables %v and %v", script[1].DCTable, script[1].ACTable)
+	}
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"acTable":"optimized"`) || strings.Contains(string(data), "dcTable") {
+		t.Errorf("got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`[{"component": 0, "dcTable": "fast"}]`), &script); err == nil {
+		t.Error("unknown table: got nil error")
+	}
+	err = ValidateScanScript(ScanScript{{Component: 0, ACTable: 4}}, 1)
+	if err == nil || !strings.Contains(err.Error(), "invalid Huffman table") {
+		t.Errorf("got %v, want an invalid Huffman table error", err)
+	}
+}
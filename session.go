@@ -0,0 +1,217 @@
+package progjpeg
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// A Session records the decisions that the encoder made while encoding an
+// image: the parameters and quantization tables in use, the scan script
+// actually applied, and the size of every scan. Sessions marshal to and from
+// JSON with the encoding/json package, so that an encode can be reproduced
+// exactly elsewhere with [Replay].
+//
+// To record a session, set [Options.Session] to a non-nil *Session, which is
+// overwritten by the next call to [Encode].
+type Session struct {
+	Width, Height int
+	Quality       int
+	Progressive   bool
+	Grayscale     bool `json:",omitempty"`
+	RGB           bool `json:",omitempty"`
+	Thumbnail     int  `json:",omitempty"`
+	OmitTables    bool `json:",omitempty"`
+	Smoothing     int  `json:",omitempty"`
+	Concurrency   int  `json:",omitempty"`
+	Deterministic bool `json:",omitempty"`
+	// ChromaCoefficients is the number of chroma coefficients kept, or 0 if
+	// they all are.
+	ChromaCoefficients int `json:",omitempty"`
+	Dither             int `json:",omitempty"`
+	// MaxCoefficientMemory is the memory limit of the DCT coefficients of
+	// the options, if any, which changes how the image is transformed but
+	// not the output.
+	MaxCoefficientMemory int64 `json:",omitempty"`
+	// ICCProfile is the ICC color profile written in the file, if any.
+	ICCProfile []byte `json:",omitempty"`
+	// RestartInterval is the number of MCUs per restart interval of a
+	// baseline image, or 0 if it has no restart markers. The restart
+	// intervals of progressive images are recorded in Scans.
+	RestartInterval int `json:",omitempty"`
+	// Downsampler is the Go type of the custom Downsampler, if any. It is
+	// informational only: Replay cannot re-create it.
+	Downsampler string `json:",omitempty"`
+	// ColorMatrix is the RGB to YCbCr matrix of the options, if any.
+	ColorMatrix *ColorMatrix `json:",omitempty"`
+	// Regions reports whether parts of the image used their own quality.
+	// The regions themselves are specific to the image and are not
+	// recorded, but their effect is part of QuantTables.
+	Regions bool `json:",omitempty"`
+	// Components describes the frame's components, and QuantTables holds
+	// the quantization tables written to the file, in zig-zag order.
+	Components  []SessionComponent
+	QuantTables [][blockSize]uint8
+	// ScanScript is the progressive scan script that was applied, and
+	// Fallback, if not empty, is the reason why it is the default script
+	// rather than the one in the options.
+	ScanScript ScanScript `json:",omitempty"`
+	Fallback   string     `json:",omitempty"`
+	// Scans lists the scans in file order, and Size is the size of the
+	// whole file, in bytes.
+	Scans []SessionScan
+	Size  int64
+}
+
+// SessionComponent describes one component of a recorded [Session].
+type SessionComponent struct {
+	H, V int
+	// Table is the index of the component's quantization and Huffman tables.
+	Table int
+}
+
+// SessionScan describes one scan of a recorded [Session].
+type SessionScan struct {
+	// Components are the indexes, in the frame, of the scan's components.
+	Components []int
+	// Ss, Se, Ah and Al are the spectral selection and successive
+	// approximation parameters of the scan header.
+	Ss, Se, Ah, Al int
+	// RestartInterval is the number of MCUs per restart interval of the
+	// scan, or 0 if the scan has no restart markers.
+	RestartInterval int `json:",omitempty"`
+	// Offset is the position of the scan's SOS marker in the file, and Size
+	// is the size of the scan, from its SOS marker to the next marker that
+	// is not an RST marker.
+	Offset, Size int64
+}
+
+// startSession starts recording the encoding of an image in e.session.
+func (e *encoder) startSession(o *Options) {
+	s := e.session
+	*s = Session{
+		Width:                e.size.X,
+		Height:               e.size.Y,
+		Quality:              o.Quality,
+		Progressive:          o.Progressive,
+		Grayscale:            o.Grayscale,
+		RGB:                  e.rgb,
+		Thumbnail:            o.Thumbnail,
+		OmitTables:           o.OmitTables,
+		Smoothing:            o.Smoothing,
+		Concurrency:          o.Concurrency,
+		Deterministic:        o.Deterministic,
+		Regions:              e.roi != nil,
+		ColorMatrix:          e.colorMatrix(),
+		ChromaCoefficients:   e.chromaCut,
+		Dither:               e.dither,
+		MaxCoefficientMemory: o.MaxCoefficientMemory,
+		ICCProfile:           o.ICCProfile,
+	}
+	if o.Downsampler != nil {
+		s.Downsampler = fmt.Sprintf("%T", o.Downsampler)
+	}
+	for _, c := range e.comp {
+		s.Components = append(s.Components, SessionComponent{c.h, c.v, int(c.q)})
+	}
+	s.QuantTables = make([][blockSize]uint8, nQuantIndex)
+	for i := range s.QuantTables {
+		s.QuantTables[i] = e.quant[i]
+	}
+}
+
+// recordScan records the start of a scan in e.session.
+func (e *encoder) recordScan(comps []int, zigStart, zigEnd, ah, al int) {
+	e.session.Scans = append(e.session.Scans, SessionScan{
+		Components:      append([]int(nil), comps...),
+		Ss:              zigStart,
+		Se:              zigEnd,
+		Ah:              ah,
+		Al:              al,
+		Offset:          e.offset(),
+		RestartInterval: e.ri,
+	})
+}
+
+// endSession completes the recording of e.session once the whole image has
+// been written.
+func (e *encoder) endSession() {
+	s := e.session
+	s.Size = e.offset()
+	for i := range s.Scans {
+		// The EOI marker follows the last scan.
+		end := s.Size - 2
+		if i+1 < len(s.Scans) {
+			end = s.Scans[i+1].Offset
+		}
+		s.Scans[i].Size = end - s.Scans[i].Offset
+	}
+}
+
+// offset returns the number of bytes written so far, including the buffered
+// entropy-coded bytes.
+func (e *encoder) offset() int64 {
+	return e.written + int64(e.nOut)
+}
+
+// Replay encodes m to w with the parameters, quantization tables and scan
+// script recorded in s, which must have been recorded for an image of the
+// same type, so that the output only differs by the pixel data. It returns
+// the session recorded during the replay, which can be compared with s.
+//
+// The Downsampler and the quality regions of the recorded encode, if any,
+// are not replayed: the built-in downsampling filter is used instead, and
+// the recorded quantization tables apply to the whole image.
+func Replay(w io.Writer, m image.Image, s *Session) (*Session, error) {
+	var e encoder
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	if len(s.QuantTables) != int(nQuantIndex) {
+		return nil, fmt.Errorf("jpeg: session has %d quantization tables, want %d", len(s.QuantTables), nQuantIndex)
+	}
+	comp, err := frameComponents(m, s.Grayscale)
+	if err != nil {
+		return nil, err
+	}
+	if rgbFrame(m, s.Grayscale, s.RGB) {
+		comp = rgbComponents
+	}
+	if len(comp) != len(s.Components) {
+		return nil, fmt.Errorf("jpeg: session was recorded for %d components, image has %d", len(s.Components), len(comp))
+	}
+	for i, c := range comp {
+		if sc := (SessionComponent{c.h, c.v, int(c.q)}); sc != s.Components[i] {
+			return nil, fmt.Errorf("jpeg: session component %d is %+v, image component is %+v", i, s.Components[i], sc)
+		}
+	}
+	var quant [nQuantIndex][blockSize]byte
+	copy(quant[:], s.QuantTables)
+	e.replayQuant = &quant
+	rec := new(Session)
+	o := &Options{
+		Quality:              s.Quality,
+		Progressive:          s.Progressive,
+		Grayscale:            s.Grayscale,
+		RGB:                  s.RGB,
+		Thumbnail:            s.Thumbnail,
+		OmitTables:           s.OmitTables,
+		ScanScript:           s.ScanScript,
+		Concurrency:          s.Concurrency,
+		Deterministic:        s.Deterministic,
+		Smoothing:            s.Smoothing,
+		ColorMatrix:          s.ColorMatrix,
+		ChromaCoefficients:   s.ChromaCoefficients,
+		Dither:               s.Dither,
+		Session:              rec,
+		MaxCoefficientMemory: s.MaxCoefficientMemory,
+		ICCProfile:           s.ICCProfile,
+	}
+	if err := e.encode(m, o); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
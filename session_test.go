@@ -0,0 +1,146 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	m0 := image.NewRGBA(image.Rect(0, 0, 40, 24))
+	m1 := image.NewRGBA(image.Rect(0, 0, 40, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			m0.SetRGBA(x, y, color.RGBA{uint8(6 * x), uint8(10 * y), 0x80, 0xff})
+			m1.SetRGBA(x, y, color.RGBA{uint8(x * y), uint8(6 * x), uint8(10 * y), 0xff})
+		}
+	}
+	for _, o := range []*Options{
+		{Quality: 60},
+		{Quality: 80, Concurrency: 2},
+		{Quality: 90, Progressive: true},
+		{Quality: 70, Progressive: true, Grayscale: true},
+		// An invalid script falls back to the default one.
+		{Quality: 90, Progressive: true, ScanScript: ScanScript{{Component: 0, SpectralStart: 1, SpectralEnd: 64}}},
+	} {
+		var s Session
+		o.Session = &s
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, o); err != nil {
+			t.Fatal(err)
+		}
+		if s.Size != int64(buf.Len()) {
+			t.Errorf("%+v: size: got %d, want %d", o, s.Size, buf.Len())
+		}
+		data := buf.Bytes()
+		for _, scan := range s.Scans {
+			if data[scan.Offset] != 0xff || data[scan.Offset+1] != sosMarker {
+				t.Errorf("%+v: no SOS marker at offset %d", o, scan.Offset)
+			}
+		}
+		if last := s.Scans[len(s.Scans)-1]; last.Offset+last.Size != s.Size-2 {
+			t.Errorf("%+v: last scan ends at %d, want %d", o, last.Offset+last.Size, s.Size-2)
+		}
+		if p, err := Probe(bytes.NewReader(data)); err != nil || p.Scans != len(s.Scans) {
+			t.Errorf("%+v: got %d scans, Probe found %d (%v)", o, len(s.Scans), p.Scans, err)
+		}
+		if invalid := o.ScanScript != nil; invalid != (s.Fallback != "") {
+			t.Errorf("%+v: fallback %q", o, s.Fallback)
+		}
+		if (o.Concurrency > 1) != (s.RestartInterval > 0) {
+			t.Errorf("%+v: restart interval %d", o, s.RestartInterval)
+		}
+
+		// Sessions survive a JSON round trip.
+		j, err := json.Marshal(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s2 Session
+		if err := json.Unmarshal(j, &s2); err != nil {
+			t.Fatal(err)
+		}
+
+		// Replaying a session on the same image gives the same output, and
+		// on another image the same structure.
+		var rbuf bytes.Buffer
+		rec, err := Replay(&rbuf, m0, &s2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rbuf.Bytes(), data) {
+			t.Errorf("%+v: replay gives a different output", o)
+		}
+		rbuf.Reset()
+		if rec, err = Replay(&rbuf, m1, &s2); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.Scans) != len(s.Scans) || rec.QuantTables[0] != s.QuantTables[0] {
+			t.Errorf("%+v: replay on another image has a different structure", o)
+		}
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	var s Session
+	if err := Encode(&bytes.Buffer{}, image.NewGray(image.Rect(0, 0, 8, 8)), &Options{Quality: 75, Session: &s}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Replay(&bytes.Buffer{}, image.NewRGBA(image.Rect(0, 0, 8, 8)), &s); err == nil {
+		t.Error("replaying a grayscale session on a color image: got no error")
+	}
+}
+
+func TestReplayRegions(t *testing.T) {
+	// A session recorded with quality regions uses the tables of the highest
+	// quality, which Replay applies to the whole image.
+	m := image.NewGray(image.Rect(0, 0, 32, 32))
+	var s Session
+	o := &Options{Quality: 20, Regions: []QualityRegion{{image.Rect(0, 0, 8, 8), 90}}, Session: &s}
+	if err := Encode(&bytes.Buffer{}, m, o); err != nil {
+		t.Fatal(err)
+	}
+	var want [nQuantIndex][blockSize]byte
+	quantTables(&want, 90)
+	if !s.Regions || s.QuantTables[0] != want[0] {
+		t.Errorf("got regions %t and table %v, want the quality 90 table", s.Regions, s.QuantTables[0])
+	}
+}
+
+func TestReplayICCAndMemory(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i * 7)
+	}
+	var s Session
+	// The coefficients of two MCU rows fit in the limit.
+	o := &Options{Progressive: true, ICCProfile: testProfile(3000), MaxCoefficientMemory: 2 * 4 * 6 * 256, Session: &s}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, o); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.ICCProfile, o.ICCProfile) || s.MaxCoefficientMemory != o.MaxCoefficientMemory {
+		t.Fatalf("recorded ICC profile of %d bytes and memory limit %d", len(s.ICCProfile), s.MaxCoefficientMemory)
+	}
+	j, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 Session
+	if err := json.Unmarshal(j, &s2); err != nil {
+		t.Fatal(err)
+	}
+	var rbuf bytes.Buffer
+	rec, err := Replay(&rbuf, m, &s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rbuf.Bytes(), buf.Bytes()) {
+		t.Error("replay gives a different output")
+	}
+	if !bytes.Equal(rec.ICCProfile, o.ICCProfile) || rec.MaxCoefficientMemory != o.MaxCoefficientMemory {
+		t.Errorf("replay recorded ICC profile of %d bytes and memory limit %d", len(rec.ICCProfile), rec.MaxCoefficientMemory)
+	}
+}
@@ -0,0 +1,65 @@
+package progjpeg
+
+import "image"
+
+// smoothImage returns a copy of m with every component smoothed by the given
+// factor, in [1, 100]. Color images are returned as 4:4:4 YCbCr images, with
+// their top-left corner at the origin, converted with the color transform cm,
+// except for CMYK images, which stay CMYK images.
+func smoothImage(m image.Image, factor int, cm *colorTransform) image.Image {
+	switch m := m.(type) {
+	case *image.Gray:
+		return smoothPlane(m, factor)
+	case *Multiplane:
+		dst := &Multiplane{Planes: make([]*image.Gray, len(m.Planes)), Rect: m.Rect}
+		for i, p := range m.Planes {
+			dst.Planes[i] = smoothPlane(p, factor)
+		}
+		return dst
+	case *image.CMYK:
+		return smoothCMYK(m, factor)
+	}
+	y, cb, cr := toYCbCrPlanes(m, cm)
+	y, cb, cr = smoothPlane(y, factor), smoothPlane(cb, factor), smoothPlane(cr, factor)
+	return &image.YCbCr{
+		Y:              y.Pix,
+		Cb:             cb.Pix,
+		Cr:             cr.Pix,
+		YStride:        y.Stride,
+		CStride:        cb.Stride,
+		SubsampleRatio: image.YCbCrSubsampleRatio444,
+		Rect:           y.Rect,
+	}
+}
+
+// smoothPlane returns a smoothed copy of p, using the filter of libjpeg's
+// fullsize_smooth_downsample: each pixel is replaced by a weighted sum of
+// itself and its 8 neighbors, with a weight of SF for each neighbor and
+// 1-8*SF for the pixel itself, where SF is factor/1024. The edge pixels are
+// repeated as needed.
+func smoothPlane(p *image.Gray, factor int) *image.Gray {
+	b := p.Bounds()
+	dst := image.NewGray(b)
+	memberScale := int32(65536 - factor*512)
+	neighScale := int32(factor * 64)
+	w, h := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		above := p.Pix[p.PixOffset(b.Min.X, b.Min.Y+max(y-1, 0)):]
+		row := p.Pix[p.PixOffset(b.Min.X, b.Min.Y+y):]
+		below := p.Pix[p.PixOffset(b.Min.X, b.Min.Y+min(y+1, h-1)):]
+		out := dst.Pix[dst.PixOffset(b.Min.X, b.Min.Y+y):]
+		colSum := func(x int) int32 {
+			x = min(max(x, 0), w-1)
+			return int32(above[x]) + int32(row[x]) + int32(below[x])
+		}
+		lastColSum, thisColSum := colSum(-1), colSum(0)
+		for x := 0; x < w; x++ {
+			nextColSum := colSum(x + 1)
+			member := int32(row[x])
+			neigh := lastColSum + (thisColSum - member) + nextColSum
+			out[x] = uint8((member*memberScale + neigh*neighScale + 32768) >> 16)
+			lastColSum, thisColSum = thisColSum, nextColSum
+		}
+	}
+	return dst
+}
@@ -0,0 +1,59 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestSmoothPlane(t *testing.T) {
+	p := image.NewGray(image.Rect(10, 20, 15, 25))
+	for i := range p.Pix {
+		p.Pix[i] = 100
+	}
+	// A constant plane is left unchanged.
+	if got := smoothPlane(p, 100); !bytes.Equal(got.Pix, p.Pix) {
+		t.Fatalf("constant plane: got %v", got.Pix)
+	}
+	// An impulse is spread over its neighbors: with a factor of 100, the
+	// center keeps 1-8*100/1024 of its weight and each neighbor gets 100/1024.
+	p.SetGray(12, 22, color.Gray{200})
+	got := smoothPlane(p, 100)
+	if y := got.GrayAt(12, 22).Y; y != 122 {
+		t.Errorf("center: got %d, want 122", y)
+	}
+	if y := got.GrayAt(11, 21).Y; y != 110 {
+		t.Errorf("neighbor: got %d, want 110", y)
+	}
+	if y := got.GrayAt(10, 20).Y; y != 100 {
+		t.Errorf("corner: got %d, want 100", y)
+	}
+}
+
+func TestSmoothing(t *testing.T) {
+	// Dithering-like noise on top of a smooth gradient.
+	m := image.NewRGBA(image.Rect(0, 0, 96, 64))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 96; x++ {
+			n := uint8(rnd.Intn(2) * 24)
+			m.SetRGBA(x, y, color.RGBA{uint8(2*x) + n, uint8(3*y) + n, 0x80 + n, 0xff})
+		}
+	}
+	sizes := make([]int, 0, 3)
+	for _, smoothing := range []int{0, 30, 100} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Quality: 90, Smoothing: smoothing}); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, buf.Len())
+		if _, err := Decode(&buf); err != nil {
+			t.Fatalf("smoothing %d: %v", smoothing, err)
+		}
+	}
+	if !(sizes[0] > sizes[1] && sizes[1] > sizes[2]) {
+		t.Errorf("sizes do not decrease with smoothing: %v", sizes)
+	}
+}
@@ -0,0 +1,87 @@
+// Package stdlibcheck compares the output of the progjpeg encoder with the
+// standard library's image/jpeg encoder.
+//
+// It lives in its own package because importing image/jpeg registers that
+// package's decoder for the "jpeg" format, which would otherwise shadow
+// progjpeg's own decoder in [image.Decode].
+package stdlibcheck
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+// StdlibComparison is the result of [VerifyAgainstStdlib].
+type StdlibComparison struct {
+	// Size and StdlibSize are the sizes in bytes of the files written by
+	// progjpeg and by image/jpeg. SizeDelta is Size - StdlibSize.
+	Size, StdlibSize, SizeDelta int
+	// MaxDelta is the largest difference, over all pixels and all of the R,
+	// G and B channels, between the two decoded images, in the range 0-255.
+	MaxDelta int
+}
+
+// VerifyAgainstStdlib encodes m as a baseline JPEG with both progjpeg and the
+// standard library's image/jpeg package, using the quality of o, and
+// reports how much the two results differ once decoded. Both files are
+// decoded with image/jpeg, so that progjpeg's decoder is not involved.
+//
+// It is meant as a canary for pipelines switching to this encoder: with the
+// same quality, the two encoders are expected to produce (nearly) identical
+// pixels and sizes.
+func VerifyAgainstStdlib(m image.Image, o *progjpeg.Options) (StdlibComparison, error) {
+	var bo progjpeg.Options
+	if o != nil {
+		bo = *o
+	} else {
+		bo.Quality = progjpeg.DefaultQuality
+	}
+	bo.Progressive = false
+	var ours, theirs bytes.Buffer
+	if err := progjpeg.Encode(&ours, m, &bo); err != nil {
+		return StdlibComparison{}, err
+	}
+	if err := jpeg.Encode(&theirs, m, &jpeg.Options{Quality: bo.Quality}); err != nil {
+		return StdlibComparison{}, err
+	}
+	res := StdlibComparison{
+		Size:       ours.Len(),
+		StdlibSize: theirs.Len(),
+		SizeDelta:  ours.Len() - theirs.Len(),
+	}
+	m0, err := jpeg.Decode(&ours)
+	if err != nil {
+		return StdlibComparison{}, err
+	}
+	m1, err := jpeg.Decode(&theirs)
+	if err != nil {
+		return StdlibComparison{}, err
+	}
+	res.MaxDelta = maxPixelDelta(m0, m1)
+	return res, nil
+}
+
+// maxPixelDelta returns the largest difference between the 8-bit R, G and B
+// values of m0 and m1, which must have the same bounds.
+func maxPixelDelta(m0, m1 image.Image) int {
+	b := m0.Bounds()
+	d := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r0, g0, b0, _ := m0.At(x, y).RGBA()
+			r1, g1, b1, _ := m1.At(x, y).RGBA()
+			d = max(d, absDiff(r0>>8, r1>>8), absDiff(g0>>8, g1>>8), absDiff(b0>>8, b1>>8))
+		}
+	}
+	return d
+}
+
+func absDiff(a, b uint32) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,34 @@
+package stdlibcheck
+
+import (
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg"
+)
+
+func TestVerifyAgainstStdlib(t *testing.T) {
+	f, err := os.Open("../testdata/video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []int{10, 75, 95} {
+		res, err := VerifyAgainstStdlib(m, &progjpeg.Options{Quality: q, Progressive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.SizeDelta != res.Size-res.StdlibSize {
+			t.Errorf("quality=%d: inconsistent sizes: %+v", q, res)
+		}
+		// The encoder is derived from image/jpeg and uses the same tables.
+		if res.MaxDelta != 0 || res.SizeDelta != 0 {
+			t.Errorf("quality=%d: got %+v, want identical output", q, res)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package progjpeg
+
+import (
+	"image"
+	"io"
+)
+
+// A StreamDecoder decodes a JPEG image pushed to it in chunks, such as those
+// of a network download, and shows the partially decoded image after every
+// complete scan: the first scans of a progressive image give a blurry
+// preview, which the following ones refine, as a browser renders them.
+//
+//	d := progjpeg.NewStreamDecoder()
+//	for chunk := range chunks {
+//		if _, err := d.Write(chunk); err != nil {
+//			return err
+//		}
+//		if m, scans := d.Current(); scans > shown {
+//			render(m)
+//			shown = scans
+//		}
+//	}
+//
+// A StreamDecoder is not safe for concurrent use by multiple goroutines.
+type StreamDecoder struct {
+	d decoder
+	// buf holds the bytes written and not yet discarded. pos is the start
+	// of the first segment that has not been given to the decoder, and
+	// rpos is the number of bytes that the decoder has read, which may be
+	// more. search is where the search for the end of the scan data of the
+	// segment at pos resumes.
+	buf               []byte
+	pos, rpos, search int
+	soi, eoi          bool
+	// scans is the number of complete scans, and shown is the number of
+	// scans of the last preview.
+	scans, shown int
+	err          error
+}
+
+// NewStreamDecoder returns a new StreamDecoder.
+func NewStreamDecoder() *StreamDecoder {
+	sd := &StreamDecoder{}
+	sd.d.r = streamReader{sd}
+	return sd
+}
+
+// streamReader is the io.Reader of a StreamDecoder's decoder. It only
+// returns the bytes already written: the StreamDecoder only gives a segment
+// to the decoder once it is complete, so that the decoder never needs more.
+type streamReader struct {
+	sd *StreamDecoder
+}
+
+func (r streamReader) Read(p []byte) (int, error) {
+	n := copy(p, r.sd.buf[r.sd.rpos:])
+	r.sd.rpos += n
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+// Write adds p to the data of the image, and decodes the segments that it
+// completes. It returns an error if the data is not a valid JPEG image, in
+// which case every later call fails too. The data after the End Of Image
+// marker is ignored.
+func (sd *StreamDecoder) Write(p []byte) (int, error) {
+	if sd.err != nil {
+		return 0, sd.err
+	}
+	if sd.eoi {
+		return len(p), nil
+	}
+	sd.buf = append(sd.buf, p...)
+	for !sd.eoi {
+		end, ok := sd.segmentEnd()
+		if !ok {
+			break
+		}
+		if err := sd.process(); err != nil {
+			sd.err = err
+			return len(p), err
+		}
+		sd.pos, sd.search = end, 0
+	}
+	sd.compact()
+	return len(p), nil
+}
+
+// segmentEnd returns the end of the segment at sd.pos, and whether all of
+// it has been written. The data of a scan, which has no length, ends with
+// the first marker that is not a restart marker. The extraneous bytes
+// before a marker are skipped as nextMarker does.
+func (sd *StreamDecoder) segmentEnd() (int, bool) {
+	b, i := sd.buf, sd.pos
+	if !sd.soi {
+		return i + 2, len(b) >= i+2
+	}
+	var marker byte
+	for {
+		for i < len(b) && b[i] != 0xff {
+			i++
+		}
+		j := i + 1
+		for j < len(b) && b[j] == 0xff {
+			j++
+		}
+		if j >= len(b) {
+			return 0, false
+		}
+		if b[j] != 0 {
+			marker, i = b[j], j+1
+			break
+		}
+		// Skip "\xff\x00" as extraneous data.
+		i = j + 1
+	}
+	if marker == eoiMarker || rst0Marker <= marker && marker <= rst7Marker {
+		return i, true
+	}
+	if len(b) < i+2 {
+		return 0, false
+	}
+	end := i + int(b[i])<<8 + int(b[i+1])
+	if len(b) < end {
+		return 0, false
+	}
+	if marker != sosMarker {
+		return end, true
+	}
+	k := max(end, sd.search)
+	for ; k+1 < len(b); k++ {
+		if b[k] == 0xff && b[k+1] != 0 && (b[k+1] < rst0Marker || b[k+1] > rst7Marker) {
+			return k, true
+		}
+	}
+	sd.search = k
+	return 0, false
+}
+
+// process gives the complete segment at sd.pos to the decoder.
+func (sd *StreamDecoder) process() error {
+	d := &sd.d
+	if !sd.soi {
+		sd.soi = true
+		return d.readSOI()
+	}
+	marker, err := d.nextMarker()
+	if err != nil {
+		return err
+	}
+	if marker == eoiMarker {
+		sd.eoi = true
+		if d.progress != nil {
+			d.reportProgress(true)
+		}
+		return nil
+	}
+	if _, err := d.processSegment(marker, false); err != nil {
+		return err
+	}
+	if marker == sosMarker {
+		sd.scans++
+		d.scans = sd.scans
+	}
+	if d.progress != nil {
+		d.reportProgress(false)
+	}
+	return nil
+}
+
+// SetProgressReporter makes the StreamDecoder tell p of its progress, after
+// every segment and every MCU row of the scans. totalBytes is the size of
+// the image, such as the Content-Length of a download, or 0 if it is not
+// known.
+func (sd *StreamDecoder) SetProgressReporter(p ProgressReporter, totalBytes int64) {
+	sd.d.progress, sd.d.totalBytes = p, totalBytes
+}
+
+// compact discards the bytes that neither the decoder nor segmentEnd need
+// anymore.
+func (sd *StreamDecoder) compact() {
+	n := min(sd.pos, sd.rpos)
+	if n < len(sd.buf)/2 && n < 1<<16 {
+		return
+	}
+	sd.buf = sd.buf[:copy(sd.buf, sd.buf[n:])]
+	sd.pos -= n
+	sd.rpos -= n
+	if sd.search > 0 {
+		sd.search -= n
+	}
+}
+
+// Current returns the image decoded so far, and the number of complete
+// scans it shows. The image is nil until the first scan is complete. The
+// components of a progressive image that no scan has included yet are
+// mid-gray, and the coefficients that no scan has included yet are zero.
+// Once the End Of Image marker has been written, the image is the same as
+// that of [Decode].
+//
+// The image may share memory with the StreamDecoder, and later calls to
+// Current may change it.
+func (sd *StreamDecoder) Current() (image.Image, int) {
+	d := &sd.d
+	if sd.scans == 0 {
+		return nil, 0
+	}
+	var (
+		m   image.Image
+		err error
+	)
+	if sd.shown != sd.scans {
+		m, err = d.snapshot(!sd.eoi)
+	} else {
+		m, err = d.image()
+	}
+	if err != nil {
+		return nil, 0
+	}
+	sd.shown = sd.scans
+	return m, sd.scans
+}
+
+// DecodeWithCallback reads a JPEG image from r and returns it, as [Decode]
+// does, and calls f with the image decoded so far after every scan, which
+// are numbered from 1. The components of a progressive image that no scan
+// has included yet are mid-gray in those images, which share memory with
+// the final image: f must copy the ones it keeps.
+func DecodeWithCallback(r io.Reader, f func(scan int, m image.Image)) (image.Image, error) {
+	d := decoder{onScan: f}
+	return d.decode(r, false)
+}
+
+// Done reports whether the End Of Image marker has been written.
+func (sd *StreamDecoder) Done() bool {
+	return sd.eoi
+}
@@ -0,0 +1,145 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	m := testimg.Photo(150, 97, 1)
+	for _, o := range []*Options{
+		{Quality: 80},
+		{Quality: 80, Progressive: true},
+		{Quality: 80, Progressive: true, Grayscale: true},
+		{Quality: 80, Concurrency: 4},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nScans := 1
+		if o.Progressive {
+			nScans = len(defaultScanScript(3))
+			if o.Grayscale {
+				nScans = len(defaultScanScript(1))
+			}
+		}
+		for _, chunk := range []int{1, 7, 1000, buf.Len()} {
+			d := NewStreamDecoder()
+			data := buf.Bytes()
+			var previews []int
+			for len(data) > 0 {
+				n := min(chunk, len(data))
+				if _, err := d.Write(data[:n]); err != nil {
+					t.Fatalf("%+v, chunks of %d: %v", o, chunk, err)
+				}
+				data = data[n:]
+				got, scans := d.Current()
+				if scans == 0 || len(previews) > 0 && previews[len(previews)-1] == scans {
+					continue
+				}
+				if len(previews) == 0 && o.Progressive && len(data) > 0 {
+					// The first preview of a progressive image only has its
+					// DC coefficients.
+					if mse := meanSquaredError(got, want, want.Bounds()); mse == 0 {
+						t.Errorf("%+v, chunks of %d: the first preview is the final image", o, chunk)
+					}
+				}
+				previews = append(previews, scans)
+			}
+			if !d.Done() {
+				t.Errorf("%+v, chunks of %d: not done", o, chunk)
+			}
+			got, scans := d.Current()
+			if scans != nScans {
+				t.Errorf("%+v, chunks of %d: got %d scans, want %d", o, chunk, scans, nScans)
+			}
+			if mse := meanSquaredError(got, want, want.Bounds()); mse != 0 {
+				t.Errorf("%+v, chunks of %d: final image has an MSE of %.2f", o, chunk, mse)
+			}
+			if chunk == 1 && len(previews) != nScans {
+				t.Errorf("%+v: got previews after scans %v, want one per scan", o, previews)
+			}
+		}
+	}
+}
+
+func TestStreamDecoderErrors(t *testing.T) {
+	d := NewStreamDecoder()
+	if _, err := d.Write([]byte("GIF89a")); err == nil {
+		t.Fatal("invalid data: got nil error")
+	}
+	if _, err := d.Write([]byte{0xff, 0xd8}); err == nil {
+		t.Error("Write after an error: got nil error")
+	}
+	if m, scans := NewStreamDecoder().Current(); m != nil || scans != 0 {
+		t.Errorf("empty decoder: got %T, %d scans", m, scans)
+	}
+
+	// A truncated progressive image shows its complete scans.
+	var buf bytes.Buffer
+	if err := Encode(&buf, image.NewGray(image.Rect(0, 0, 32, 32)), &Options{Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	d = NewStreamDecoder()
+	if _, err := d.Write(buf.Bytes()[:buf.Len()-10]); err != nil {
+		t.Fatal(err)
+	}
+	if m, scans := d.Current(); m == nil || scans != len(defaultScanScript(1))-1 || d.Done() {
+		t.Errorf("truncated image: got %T, %d scans, done %v", m, scans, d.Done())
+	}
+}
+
+func TestDecodeWithCallback(t *testing.T) {
+	m := testimg.Photo(150, 97, 1)
+	for _, o := range []*Options{
+		{Quality: 80},
+		{Quality: 80, Progressive: true},
+		{Quality: 80, Progressive: true, Grayscale: true},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, o); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mse []float64
+		got, err := DecodeWithCallback(bytes.NewReader(buf.Bytes()), func(scan int, m image.Image) {
+			if scan != len(mse)+1 {
+				t.Errorf("%+v: got scan %d, want %d", o, scan, len(mse)+1)
+			}
+			mse = append(mse, meanSquaredError(m, want, want.Bounds()))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := meanSquaredError(got, want, want.Bounds()); e != 0 {
+			t.Errorf("%+v: final image has an MSE of %.2f", o, e)
+		}
+		nScans := 1
+		if o.Progressive {
+			nScans = len(DefaultColorScanScript())
+			if o.Grayscale {
+				nScans = len(DefaultGrayscaleScanScript())
+			}
+		}
+		if len(mse) != nScans {
+			t.Fatalf("%+v: got %d calls, want %d", o, len(mse), nScans)
+		}
+		if mse[nScans-1] != 0 {
+			t.Errorf("%+v: the last scan's image has an MSE of %.2f", o, mse[nScans-1])
+		}
+		if o.Progressive && mse[0] == 0 {
+			t.Errorf("%+v: the first scan's image is the final image", o)
+		}
+	}
+}
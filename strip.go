@@ -0,0 +1,66 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+)
+
+// A MetadataClass is a set of kinds of APPn and COM segments, which
+// [StripMetadata] keeps.
+type MetadataClass uint
+
+const (
+	MetadataExif     MetadataClass = 1 << iota // APP1 Exif segments.
+	MetadataICC                                // APP2 ICC profile segments.
+	MetadataXMP                                // APP1 XMP segments, including extended XMP.
+	MetadataComments                           // COM segments.
+	MetadataOther                              // Other APPn segments, such as MPF indexes and vendor data.
+
+	MetadataNone MetadataClass = 0
+	MetadataAll                = MetadataExif | MetadataICC | MetadataXMP | MetadataComments | MetadataOther
+)
+
+// StripMetadata reads the JPEG image in r and writes it to w with only the
+// APPn and COM segments of the classes in keep, as jpegtran -copy does:
+// MetadataNone gives a privacy-scrubbed image, without Exif location or
+// camera serial numbers. The coefficients are copied as they are, so the
+// pixels do not change, and the image is baseline or progressive like the
+// original. The JFIF and Adobe segments are always kept, since they tell
+// how to convert the image to RGB; dropping the ICC profile, though, may
+// change the colors that color-managed viewers display.
+func StripMetadata(w io.Writer, r io.Reader, keep MetadataClass) error {
+	return transcode(w, r, nil, func(t *transcoding) error {
+		t.keepMetadata(keep)
+		return nil
+	})
+}
+
+// keepMetadata drops the segments of t whose class is not in keep.
+func (t *transcoding) keepMetadata(keep MetadataClass) {
+	kept := t.segments[:0]
+	for _, s := range t.segments {
+		if c := metadataClass(s); c == 0 || keep&c != 0 {
+			kept = append(kept, s)
+		}
+	}
+	t.segments = kept
+}
+
+// metadataClass returns the class of the segment s, or 0 for the JFIF and
+// Adobe segments, which are not metadata.
+func metadataClass(s Segment) MetadataClass {
+	switch {
+	case s.Marker == comMarker:
+		return MetadataComments
+	case s.Marker == app0Marker && bytes.HasPrefix(s.Data, jfifID),
+		s.Marker == app14Marker && bytes.HasPrefix(s.Data, adobeID):
+		return 0
+	case s.Marker == app1Marker && bytes.HasPrefix(s.Data, exifID):
+		return MetadataExif
+	case s.Marker == app1Marker && (bytes.HasPrefix(s.Data, xmpID) || bytes.HasPrefix(s.Data, xmpExtID)):
+		return MetadataXMP
+	case s.Marker == app2Marker && bytes.HasPrefix(s.Data, iccID):
+		return MetadataICC
+	}
+	return MetadataOther
+}
@@ -0,0 +1,91 @@
+package progjpeg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestStripMetadata(t *testing.T) {
+	src := testimg.Photo(40, 24, 1)
+	segments := []struct {
+		class MetadataClass
+		s     Segment
+	}{
+		{0, Segment{app0Marker, append([]byte("JFIF\x00\x01\x02"), 0, 0, 1, 0, 1, 0, 0)}},
+		{MetadataExif, Segment{app1Marker, append([]byte("Exif\x00\x00"), bigEndianExif()...)}},
+		{MetadataXMP, Segment{app1Marker, append(append([]byte(nil), xmpID...), "<x:xmpmeta/>"...)}},
+		{MetadataICC, Segment{app2Marker, append(append([]byte(nil), iccID...), 1, 1, 'p', 'r', 'o', 'f')}},
+		{MetadataComments, Segment{comMarker, []byte("a comment")}},
+		{MetadataOther, Segment{app0Marker + 5, []byte("Vendor\x00data")}},
+		{0, Segment{app14Marker, adobeSegment(1)}},
+	}
+	var data bytes.Buffer
+	mw, err := NewMarkerWriter(&data, src, &Options{Quality: 75})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	for _, s := range segments {
+		if err := mw.WriteSegment(s.s.Marker, s.s.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	mw.WriteScan(ProgressiveScan{Component: -1, SpectralEnd: blockSize - 1})
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keep := range []MetadataClass{
+		MetadataNone,
+		MetadataAll,
+		MetadataExif | MetadataICC,
+		MetadataXMP | MetadataComments,
+		MetadataOther,
+	} {
+		var buf bytes.Buffer
+		if err := StripMetadata(&buf, bytes.NewReader(data.Bytes()), keep); err != nil {
+			t.Fatal(err)
+		}
+		got, meta, err := DecodeFull(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalImages(got, want) {
+			t.Errorf("keep %#x: the pixels differ from those of the original", keep)
+		}
+		// DecodeFull reports the APPn segments, and the comments apart.
+		var wantSegments []Segment
+		wantComments := 0
+		for _, s := range segments {
+			if s.class != 0 && keep&s.class == 0 {
+				continue
+			}
+			if s.s.Marker == comMarker {
+				wantComments++
+			} else {
+				wantSegments = append(wantSegments, s.s)
+			}
+		}
+		if len(meta.Comments) != wantComments {
+			t.Errorf("keep %#x: got %d comments, want %d", keep, len(meta.Comments), wantComments)
+		}
+		if len(meta.Segments) != len(wantSegments) {
+			t.Errorf("keep %#x: got %d segments, want %d", keep, len(meta.Segments), len(wantSegments))
+			continue
+		}
+		for i, s := range meta.Segments {
+			if s.Marker != wantSegments[i].Marker || !bytes.Equal(s.Data, wantSegments[i].Data) {
+				t.Errorf("keep %#x: segment %d is %#x %q, want %#x %q", keep, i, s.Marker, s.Data, wantSegments[i].Marker, wantSegments[i].Data)
+			}
+		}
+	}
+}
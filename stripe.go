@@ -0,0 +1,119 @@
+package progjpeg
+
+import "image"
+
+// stripeRows returns the number of MCU rows whose coefficients fit in the
+// memory limit of o, at least 1. It returns e.myy if the whole image fits.
+func (e *encoder) stripeRows(o *Options) int {
+	if o.MaxCoefficientMemory <= 0 {
+		return e.myy
+	}
+	rowSize := int64(e.mxx*e.blocksPerMCU()) * blockSize * 4
+	return int(min(max(o.MaxCoefficientMemory/rowSize, 1), int64(e.myy)))
+}
+
+// A stripedScan is a scan of an image coded in stripes: the state of its
+// entropy coder, which is swapped into the encoder to code each stripe, and
+// the entropy-coded data of the stripes coded so far.
+type stripedScan struct {
+	scan  ProgressiveScan
+	run   scanRun
+	bits  uint64
+	nBits uint32
+	buf   bufferWriter
+	// st holds the scan's Huffman tables if custom is true, and ids and
+	// specs are the optimized tables written before the scan.
+	st     scanHuffmanTables
+	custom bool
+	ids    string
+	specs  []huffmanSpec
+}
+
+// writeProgressiveStripes writes the scans of a progressive image, like
+// writeProgressive does once the frame header is written, but only holds
+// the coefficients of rows MCU rows at a time. Every stripe is transformed
+// and quantized, then coded by every scan into the scan's buffer, and the
+// scans are written out once the last stripe is coded. Scan scripts that
+// need statistics of the whole image, for OptimizeScans or for optimized
+// Huffman tables, transform the image once more to collect them.
+func (e *encoder) writeProgressiveStripes(m image.Image, o *Options, rows int) {
+	// stripes transforms and quantizes the image one stripe at a time, and
+	// calls f with the MCU rows of every stripe.
+	stripes := func(f func(my0, my1 int)) {
+		mcu := e.mcuBuffer()
+		for my0 := 0; my0 < e.myy; my0 += rows {
+			my1 := min(my0+rows, e.myy)
+			e.allocStripe(my0, my1)
+			for my := my0; my < my1; my++ {
+				e.computeMCURow(m, my, mcu)
+			}
+			f(my0, my1)
+		}
+	}
+
+	script := e.scanScript(o, func() []autoStats {
+		stats := make([]autoStats, len(e.comp))
+		stripes(func(int, int) { e.addAutoStats(stats) })
+		return stats
+	})
+	scans := make([]stripedScan, len(script))
+	for i, scan := range script {
+		scans[i] = stripedScan{scan: scan, run: newScanRun(scan, scan.components(len(e.comp)))}
+	}
+	if usesHuffmanTable(script, HuffmanOptimized) {
+		stripes(func(my0, my1 int) {
+			for i := range scans {
+				s := &scans[i]
+				if scanOptimizesTables(s.scan) {
+					e.codeScanRows(&s.run, my0, my1, &s.st.dcFreq, &s.st.acFreq)
+				}
+			}
+		})
+	}
+	for i := range scans {
+		s := &scans[i]
+		e.st = &s.st
+		s.ids, s.specs = e.setScanTables(s.scan, s.run.comps)
+		s.custom = e.scanTables
+		s.run = newScanRun(s.scan, s.run.comps)
+	}
+
+	// Code the stripes into the buffers of the scans. The bytes written to
+	// the buffers are not part of the output yet.
+	w, written := e.w, e.written
+	swap := func(s *stripedScan) {
+		e.w, e.bits, e.nBits = &s.buf, s.bits, s.nBits
+		e.scanTables, e.st = s.custom, &s.st
+	}
+	stripes(func(my0, my1 int) {
+		for i := range scans {
+			s := &scans[i]
+			swap(s)
+			e.codeScanRows(&s.run, my0, my1, nil, nil)
+			e.flushEntropy()
+			s.bits, s.nBits = e.bits, e.nBits
+		}
+	})
+	for i := range scans {
+		swap(&scans[i])
+		e.padBits()
+		e.flushEntropy()
+	}
+	e.w, e.written = w, written
+
+	for i := range scans {
+		s := &scans[i]
+		if s.scan.RestartInterval != e.ri {
+			e.writeDRI(s.scan.RestartInterval)
+		}
+		if len(s.specs) > 0 {
+			e.writeHuffmanTables(s.ids, s.specs)
+		}
+		e.scanTables, e.st = s.custom, &s.st
+		e.writeSOSHeader(s.run.comps, s.scan.SpectralStart, s.scan.SpectralEnd,
+			s.scan.SuccessiveApproxHigh, s.scan.SuccessiveApproxLow)
+		e.write(s.buf.Bytes())
+		s.buf = bufferWriter{}
+	}
+	e.scanTables, e.st = false, nil
+}
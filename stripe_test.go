@@ -0,0 +1,75 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestEncodeStripes(t *testing.T) {
+	restarts := DefaultColorScanScript()
+	restarts[0].RestartInterval = 3
+	restarts[0].DCTable = HuffmanOptimized
+	restarts[5].ACTable = HuffmanOptimized
+	restarts[5].RestartInterval = 10
+	for _, tc := range []struct {
+		m image.Image
+		o Options
+	}{
+		{testimg.Photo(150, 97, 1), Options{Quality: 80, Progressive: true}},
+		{testimg.Photo(150, 97, 1), Options{Quality: 80, Progressive: true, OptimizeScans: true}},
+		{testimg.Photo(150, 97, 1), Options{Quality: 80, Progressive: true, ScanScript: restarts}},
+		{testimg.ZonePlate(75, 61), Options{Quality: 60, Progressive: true}},
+	} {
+		var want bytes.Buffer
+		var wantSession Session
+		o := tc.o
+		o.Session = &wantSession
+		if err := Encode(&want, tc.m, &o); err != nil {
+			t.Fatal(err)
+		}
+		// The limits hold 1 MCU row, 2 MCU rows, and the whole image.
+		for _, limit := range []int64{1, 2 * 10 * 6 * 256, 1 << 30} {
+			var got bytes.Buffer
+			var s Session
+			o := tc.o
+			o.MaxCoefficientMemory, o.Session = limit, &s
+			if err := Encode(&got, tc.m, &o); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("%v, %+v, limit %d: got %d bytes, want the %d bytes of an unlimited encode", tc.m.Bounds(), tc.o, limit, got.Len(), want.Len())
+				continue
+			}
+			for i := range s.Scans {
+				if s.Scans[i].Offset != wantSession.Scans[i].Offset || s.Scans[i].Size != wantSession.Scans[i].Size {
+					t.Errorf("%v, limit %d: scan %d recorded at %d+%d, want %d+%d", tc.m.Bounds(), limit, i,
+						s.Scans[i].Offset, s.Scans[i].Size, wantSession.Scans[i].Offset, wantSession.Scans[i].Size)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeStripesMemory(t *testing.T) {
+	// A 4:2:0 MCU row of a 512 pixel wide image has 32 MCUs of 6 blocks.
+	const rowSize = 32 * 6 * 256
+	m := testimg.Photo(512, 512, 2)
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(m, &Options{Quality: 75, Progressive: true, MaxCoefficientMemory: 3 * rowSize}); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, p := range enc.e.coeffs {
+		n += cap(p.blocks)
+	}
+	if n*256 > 3*rowSize {
+		t.Errorf("got %d bytes of coefficients, want at most %d", n*256, 3*rowSize)
+	}
+	if _, err := Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
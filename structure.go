@@ -0,0 +1,252 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+)
+
+// MarkerInfo describes a marker of a JPEG file, as listed by
+// [ParseStructure], with the decoded fields of the segments that define
+// the image: at most one of Frame, QuantTables, HuffmanTables, Scan and
+// RestartInterval is set, according to Marker.
+type MarkerInfo struct {
+	// Marker is the second byte of the marker, such as 0xda for SOS.
+	Marker byte
+	// Offset is the offset in the file of the marker's 0xff byte, and
+	// Length is that of its payload, after the 16-bit length field, or 0
+	// for the SOI and EOI markers, which have none.
+	Offset int64
+	Length int
+	// ID is the identifier at the start of an APPn payload, up to its NUL
+	// byte, such as "JFIF", "Exif", "ICC_PROFILE" or "Adobe", or "" if the
+	// payload does not start with a printable identifier.
+	ID string
+
+	// Frame is the content of an SOFn segment.
+	Frame *FrameInfo
+	// QuantTables are the tables of a DQT segment.
+	QuantTables []QuantTableInfo
+	// HuffmanTables are the tables of a DHT segment.
+	HuffmanTables []HuffmanTableInfo
+	// Scan is the header of an SOS segment.
+	Scan *ScanInfo
+	// RestartInterval is the interval of a DRI segment, in MCUs.
+	RestartInterval int
+}
+
+// QuantTableInfo is a quantization table defined by a DQT segment.
+type QuantTableInfo struct {
+	// Index is the destination of the table, from 0 to 3, and Precision
+	// the size of its values, 8 or 16 bits.
+	Index, Precision int
+	// Values are the steps of the table, in zig-zag order.
+	Values [blockSize]uint16
+}
+
+// HuffmanTableInfo is a Huffman table defined by a DHT segment.
+type HuffmanTableInfo struct {
+	// Class is 0 for a DC table and 1 for an AC table, and Index is the
+	// destination of the table, from 0 to 3.
+	Class, Index int
+	// Counts holds the number of codes of each length, from 1 to 16 bits,
+	// and Values the symbols of the codes, by increasing length.
+	Counts [16]int
+	Values []byte
+}
+
+// ScanInfo is the header of a scan, from its SOS segment.
+type ScanInfo struct {
+	// Components lists the components of the scan.
+	Components []ScanComponentInfo
+	// SpectralStart, SpectralEnd, SuccessiveApproxHigh and
+	// SuccessiveApproxLow are the Ss, Se, Ah and Al parameters of the scan,
+	// as in [ProgressiveScan].
+	SpectralStart, SpectralEnd                int
+	SuccessiveApproxHigh, SuccessiveApproxLow int
+	// EntropyLength is the number of bytes of entropy-coded data that
+	// follow the SOS segment, including its RST markers, up to the next
+	// marker.
+	EntropyLength int64
+}
+
+// ScanComponentInfo is a component of a scan.
+type ScanComponentInfo struct {
+	// ID is the component identifier, as in [ComponentInfo], and DCTable
+	// and ACTable are the indexes of its Huffman tables.
+	ID, DCTable, ACTable int
+}
+
+// ParseStructure reads the JPEG file in r up to its EOI marker and returns
+// its markers, in file order, with their offsets and lengths, and the
+// decoded fields of its SOFn, DQT, DHT, SOS and DRI segments, without
+// decoding the entropy-coded data, for analysis tools. It accepts any SOF
+// type and any number of components, as [Inspect] does. The RST markers
+// are counted in the EntropyLength of their scan, not listed. If the file
+// is truncated or malformed, the markers read before the error are
+// returned with it.
+func ParseStructure(r io.Reader) ([]MarkerInfo, error) {
+	s := newMarkerScanner(r)
+	if err := s.readSOI(); err != nil {
+		return nil, err
+	}
+	markers := []MarkerInfo{{Marker: soiMarker}}
+	// scan is the scan whose entropy-coded data is being skipped, and end
+	// the offset of the end of its SOS segment.
+	var scan *ScanInfo
+	var end int64
+	for {
+		marker, err := s.next()
+		if err != nil {
+			return markers, err
+		}
+		m := MarkerInfo{Marker: marker, Offset: s.off - 2}
+		if scan != nil {
+			scan.EntropyLength = m.Offset - end
+			scan = nil
+		}
+		if marker == eoiMarker {
+			return append(markers, m), nil
+		}
+		if !hasLength(marker) {
+			markers = append(markers, m)
+			continue
+		}
+		n, err := s.readLength()
+		if err != nil {
+			return markers, err
+		}
+		m.Length = n
+		p := make([]byte, n)
+		if err := s.readFull(p); err != nil {
+			return markers, err
+		}
+		switch {
+		case isSOF(marker):
+			fi, err := parseFrame(marker, p)
+			if err != nil {
+				return markers, err
+			}
+			m.Frame = &fi
+		case marker == dqtMarker:
+			if m.QuantTables, err = parseDQT(p); err != nil {
+				return markers, err
+			}
+		case marker == dhtMarker:
+			if m.HuffmanTables, err = parseDHT(p); err != nil {
+				return markers, err
+			}
+		case marker == sosMarker:
+			if m.Scan, err = parseSOS(p); err != nil {
+				return markers, err
+			}
+		case marker == driMarker:
+			if n != 2 {
+				return markers, FormatError("DRI has wrong length")
+			}
+			m.RestartInterval = int(p[0])<<8 + int(p[1])
+		case app0Marker <= marker && marker <= app15Marker:
+			m.ID = appID(p)
+		}
+		markers = append(markers, m)
+		if m.Scan != nil {
+			scan, end = markers[len(markers)-1].Scan, s.off
+		}
+	}
+}
+
+// parseDQT parses the payload p of a DQT segment.
+func parseDQT(p []byte) ([]QuantTableInfo, error) {
+	var tables []QuantTableInfo
+	for len(p) > 0 {
+		t := QuantTableInfo{Index: int(p[0] & 0x0f), Precision: 8}
+		if p[0]>>4 != 0 {
+			t.Precision = 16
+		}
+		p = p[1:]
+		if t.Precision == 16 {
+			if len(p) < 2*blockSize {
+				return tables, FormatError("DQT has wrong length")
+			}
+			for i := range t.Values {
+				t.Values[i] = uint16(p[2*i])<<8 | uint16(p[2*i+1])
+			}
+			p = p[2*blockSize:]
+		} else {
+			if len(p) < blockSize {
+				return tables, FormatError("DQT has wrong length")
+			}
+			for i := range t.Values {
+				t.Values[i] = uint16(p[i])
+			}
+			p = p[blockSize:]
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// parseDHT parses the payload p of a DHT segment.
+func parseDHT(p []byte) ([]HuffmanTableInfo, error) {
+	var tables []HuffmanTableInfo
+	for len(p) > 0 {
+		if len(p) < 17 {
+			return tables, FormatError("DHT has wrong length")
+		}
+		t := HuffmanTableInfo{Class: int(p[0] >> 4), Index: int(p[0] & 0x0f)}
+		n := 0
+		for i := range t.Counts {
+			t.Counts[i] = int(p[1+i])
+			n += t.Counts[i]
+		}
+		p = p[17:]
+		if len(p) < n {
+			return tables, FormatError("DHT has wrong length")
+		}
+		t.Values = append([]byte(nil), p[:n]...)
+		p = p[n:]
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// parseSOS parses the payload p of an SOS segment.
+func parseSOS(p []byte) (*ScanInfo, error) {
+	if len(p) < 1 || len(p) != 1+2*int(p[0])+3 {
+		return nil, FormatError("SOS has wrong length")
+	}
+	ns := int(p[0])
+	scan := &ScanInfo{
+		Components:           make([]ScanComponentInfo, ns),
+		SpectralStart:        int(p[1+2*ns]),
+		SpectralEnd:          int(p[2+2*ns]),
+		SuccessiveApproxHigh: int(p[3+2*ns] >> 4),
+		SuccessiveApproxLow:  int(p[3+2*ns] & 0x0f),
+	}
+	for i := range scan.Components {
+		scan.Components[i] = ScanComponentInfo{
+			ID:      int(p[1+2*i]),
+			DCTable: int(p[2+2*i] >> 4),
+			ACTable: int(p[2+2*i] & 0x0f),
+		}
+	}
+	return scan, nil
+}
+
+// appID returns the identifier at the start of the APPn payload p: its
+// printable ASCII bytes up to a NUL byte.
+func appID(p []byte) string {
+	i := bytes.IndexByte(p[:min(len(p), 64)], 0)
+	if i < 0 {
+		// Some identifiers are not NUL-terminated; keep their letters.
+		i = 0
+		for i < len(p) && i < 64 && 'a' <= p[i]|0x20 && p[i]|0x20 <= 'z' {
+			i++
+		}
+	}
+	for _, c := range p[:i] {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return string(p[:i])
+}
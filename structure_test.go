@@ -0,0 +1,103 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestParseStructure(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	exif := append([]byte("Exif\x00\x00"), bigEndianExif()...)
+	var buf bytes.Buffer
+	mw, err := NewMarkerWriter(&buf, src, &Options{Quality: 75, Progressive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteSOI()
+	mw.WriteSegment(app1Marker, exif)
+	mw.WriteSegment(driMarker, []byte{0, 4})
+	mw.WriteDQT()
+	mw.WriteSOF()
+	mw.WriteDHT()
+	for _, s := range DefaultColorScanScript() {
+		mw.WriteScan(s)
+	}
+	if err := mw.WriteEOI(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	markers, err := ParseStructure(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := DecodeFull(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scans []*ScanInfo
+	for i, m := range markers {
+		if data[m.Offset] != 0xff || data[m.Offset+1] != m.Marker {
+			t.Fatalf("marker %d: no %#x marker at offset %d", i, m.Marker, m.Offset)
+		}
+		if m.Length > 0 && int(data[m.Offset+2])<<8+int(data[m.Offset+3]) != m.Length+2 {
+			t.Errorf("marker %d: wrong length %d", i, m.Length)
+		}
+		switch m.Marker {
+		case app1Marker:
+			if m.ID != "Exif" {
+				t.Errorf("got APP1 identifier %q, want Exif", m.ID)
+			}
+		case driMarker:
+			if m.RestartInterval != 4 {
+				t.Errorf("got restart interval %d, want 4", m.RestartInterval)
+			}
+		case dqtMarker:
+			for _, q := range m.QuantTables {
+				for j, v := range q.Values {
+					if q.Precision != 8 || uint8(v) != meta.QuantTables[q.Index][j] {
+						t.Fatalf("DQT table %d differs", q.Index)
+					}
+				}
+			}
+		case dhtMarker:
+			if len(m.HuffmanTables) == 0 {
+				t.Error("DHT without tables")
+			}
+		case sof2Marker:
+			if f := m.Frame; f.Width != 83 || f.Height != 47 || !f.Progressive || len(f.Components) != 3 || f.Components[0].H != 2 {
+				t.Errorf("got frame %+v", f)
+			}
+		case sosMarker:
+			scans = append(scans, m.Scan)
+			// The entropy-coded data runs to the next marker.
+			next := markers[i+1].Offset
+			if end := m.Offset + 4 + int64(m.Length) + m.Scan.EntropyLength; end != next {
+				t.Errorf("scan %d ends at %d, the next marker is at %d", len(scans), end, next)
+			}
+		}
+	}
+	if markers[0].Marker != soiMarker || markers[len(markers)-1].Marker != eoiMarker {
+		t.Errorf("got markers %#x to %#x, want SOI to EOI", markers[0].Marker, markers[len(markers)-1].Marker)
+	}
+	if len(scans) != len(meta.Scans) {
+		t.Fatalf("got %d scans, want %d", len(scans), len(meta.Scans))
+	}
+	for i, s := range scans {
+		w := meta.Scans[i]
+		if s.SpectralStart != w.SpectralStart || s.SpectralEnd != w.SpectralEnd ||
+			s.SuccessiveApproxHigh != w.SuccessiveApproxHigh || s.SuccessiveApproxLow != w.SuccessiveApproxLow ||
+			(len(s.Components) == 1) != (w.Component >= 0) || s.EntropyLength == 0 {
+			t.Errorf("scan %d: got %+v, want %+v", i, s, w)
+		}
+	}
+
+	// A truncated file returns the markers read so far.
+	truncated, err := ParseStructure(bytes.NewReader(data[:markers[len(markers)-3].Offset+3]))
+	if err != io.ErrUnexpectedEOF || len(truncated) != len(markers)-3 {
+		t.Errorf("got %d markers and %v, want %d and %v", len(truncated), err, len(markers)-3, io.ErrUnexpectedEOF)
+	}
+}
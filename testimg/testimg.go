@@ -0,0 +1,172 @@
+// Package testimg generates synthetic test images of arbitrary sizes, for
+// tuning and benchmarking encoding options on reproducible inputs.
+//
+// Every generator is deterministic: the same arguments always give the same
+// pixels.
+package testimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Names lists the names accepted by [Generate], in a stable order.
+var Names = []string{"gradient", "zoneplate", "text", "noise", "photo"}
+
+// Generate returns the named test image with the given size. seed is only
+// used by the images that have random content.
+func Generate(name string, w, h int, seed int64) (image.Image, error) {
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("testimg: invalid size %dx%d", w, h)
+	}
+	switch name {
+	case "gradient":
+		return Gradient(w, h), nil
+	case "zoneplate":
+		return ZonePlate(w, h), nil
+	case "text":
+		return Text(w, h), nil
+	case "noise":
+		return Noise(w, h, seed), nil
+	case "photo":
+		return Photo(w, h, seed), nil
+	}
+	return nil, fmt.Errorf("testimg: unknown image %q", name)
+}
+
+// Gradient returns an image whose red channel increases from left to right,
+// green channel from top to bottom, and blue channel along the diagonal. Its
+// smooth content compresses very well, but shows banding and blocking
+// artifacts at low qualities.
+func Gradient(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetRGBA(x, y, color.RGBA{
+				R: uint8(255 * x / max(w-1, 1)),
+				G: uint8(255 * y / max(h-1, 1)),
+				B: uint8(255 * (x + y) / max(w+h-2, 1)),
+				A: 0xff,
+			})
+		}
+	}
+	return m
+}
+
+// ZonePlate returns a grayscale zone plate: concentric rings whose spatial
+// frequency increases linearly from the center, up to and beyond the Nyquist
+// frequency in the corners. It shows how each frequency survives
+// quantization, and any aliasing.
+func ZonePlate(w, h int) *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	n := float64(max(w, h))
+	cx, cy := float64(w)/2, float64(h)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			v := 127.5 + 127.5*math.Cos(math.Pi*(dx*dx+dy*dy)/n)
+			m.SetGray(x, y, color.Gray{uint8(v)})
+		}
+	}
+	return m
+}
+
+// Text returns a panel of black text on a white background, at two sizes,
+// with a few colored rules. Its sharp edges show ringing artifacts, and
+// chroma subsampling bleeding around the colored rules. The text is scaled
+// up for large images.
+func Text(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	fill(m, m.Bounds(), color.RGBA{0xff, 0xff, 0xff, 0xff})
+	rules := []color.RGBA{{0xe0, 0x20, 0x20, 0xff}, {0x20, 0xa0, 0x20, 0xff}, {0x20, 0x40, 0xe0, 0xff}}
+	s := max(1, min(w, h)/256)
+	for line, y := 0, 2*s; y < h; line++ {
+		scale := s * (1 + line%2)
+		drawString(m, 2*s, y, scale, pangram, color.RGBA{0, 0, 0, 0xff})
+		y += 9 * scale
+		if line%3 == 2 {
+			fill(m, image.Rect(0, y, w, y+s), rules[line/3%len(rules)])
+			y += 3 * s
+		}
+	}
+	return m
+}
+
+// Noise returns an image of uniformly distributed random pixels. It is the
+// worst case for the encoder: nearly every coefficient is non-zero.
+func Noise(w, h int, seed int64) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < len(m.Pix); i += 4 {
+		m.Pix[i+0] = uint8(rnd.Intn(256))
+		m.Pix[i+1] = uint8(rnd.Intn(256))
+		m.Pix[i+2] = uint8(rnd.Intn(256))
+		m.Pix[i+3] = 0xff
+	}
+	return m
+}
+
+// Photo returns a composite that mimics the statistics of a photograph: a
+// sky gradient, soft-edged colored shapes, textured ground and a caption.
+func Photo(w, h int, seed int64) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(seed))
+	horizon := h * 3 / 5
+	// Sky.
+	for y := 0; y < horizon; y++ {
+		t := float64(y) / float64(max(horizon, 1))
+		fill(m, image.Rect(0, y, w, y+1), color.RGBA{
+			uint8(60 + 120*t), uint8(110 + 100*t), uint8(220 - 30*t), 0xff,
+		})
+	}
+	// Ground, with fine-grained texture.
+	for y := horizon; y < h; y++ {
+		for x := 0; x < w; x++ {
+			n := rnd.Intn(40)
+			m.SetRGBA(x, y, color.RGBA{uint8(70 + n), uint8(100 + n), uint8(40 + n/2), 0xff})
+		}
+	}
+	// Soft-edged shapes.
+	size := float64(min(w, h))
+	for i := 0; i < 6; i++ {
+		cx, cy := rnd.Float64()*float64(w), rnd.Float64()*float64(h)
+		r := size * (0.05 + 0.15*rnd.Float64())
+		c := color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 0xff}
+		blob(m, cx, cy, r, c)
+	}
+	// Caption.
+	s := max(1, h/200)
+	drawString(m, 4*s, h-10*s, s, "PROGJPEG 0123456789", color.RGBA{0xff, 0xff, 0xff, 0xff})
+	return m
+}
+
+// blob blends a disc of color c, centered on (cx, cy) with radius r, into m.
+// The disc fades out over its outer quarter.
+func blob(m *image.RGBA, cx, cy, r float64, c color.RGBA) {
+	b := image.Rect(int(cx-r), int(cy-r), int(cx+r)+1, int(cy+r)+1).Intersect(m.Bounds())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / r
+			a := min(max((1-d)*4, 0), 1)
+			if a == 0 {
+				continue
+			}
+			i := m.PixOffset(x, y)
+			for k, v := range [3]uint8{c.R, c.G, c.B} {
+				m.Pix[i+k] = uint8(float64(m.Pix[i+k])*(1-a) + float64(v)*a)
+			}
+		}
+	}
+}
+
+func fill(m *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(m.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetRGBA(x, y, c)
+		}
+	}
+}
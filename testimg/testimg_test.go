@@ -0,0 +1,57 @@
+package testimg
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func pixels(m image.Image) []byte {
+	rgba := image.NewRGBA(m.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), m, m.Bounds().Min, draw.Src)
+	return rgba.Pix
+}
+
+func TestGenerate(t *testing.T) {
+	for _, name := range Names {
+		for _, size := range []image.Point{{1, 1}, {17, 9}, {320, 240}} {
+			m, err := Generate(name, size.X, size.Y, 1)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got, want := m.Bounds(), image.Rect(0, 0, size.X, size.Y); got != want {
+				t.Errorf("%s: bounds: got %v, want %v", name, got, want)
+			}
+			m2, _ := Generate(name, size.X, size.Y, 1)
+			if !bytes.Equal(pixels(m), pixels(m2)) {
+				t.Errorf("%s %v: not deterministic", name, size)
+			}
+		}
+	}
+	if _, err := Generate("nope", 8, 8, 1); err == nil {
+		t.Error("unknown name: got no error")
+	}
+	if _, err := Generate("noise", 0, 8, 1); err == nil {
+		t.Error("empty size: got no error")
+	}
+}
+
+func TestNoiseSeed(t *testing.T) {
+	if bytes.Equal(Noise(16, 16, 1).Pix, Noise(16, 16, 2).Pix) {
+		t.Error("different seeds give the same noise")
+	}
+}
+
+func TestText(t *testing.T) {
+	// The panel must have both ink and paper.
+	m := Text(200, 100)
+	var ink, paper bool
+	for i := 0; i < len(m.Pix); i += 4 {
+		ink = ink || m.Pix[i] == 0
+		paper = paper || m.Pix[i] == 0xff
+	}
+	if !ink || !paper {
+		t.Errorf("ink %t, paper %t", ink, paper)
+	}
+}
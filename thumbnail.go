@@ -0,0 +1,145 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+)
+
+// thumbnailQualities are the qualities tried, in order, for the thumbnail,
+// until it fits in an APP1 segment.
+var thumbnailQualities = [...]int{75, 50, 25}
+
+// thumbnailSamples is the maximum number of source pixels sampled in each
+// direction to compute a thumbnail pixel.
+const thumbnailSamples = 4
+
+// exifThumbnailHeader is the size of the Exif data that precedes the
+// thumbnail in the APP1 segment written by writeThumbnail: the Exif
+// identifier, the TIFF header, IFD0, IFD1 and the resolutions of IFD1.
+const exifThumbnailHeader = 6 + 8 + 18 + 78 + 16
+
+// writeThumbnail writes an APP1 Exif segment holding, in its IFD1, a
+// baseline JPEG thumbnail of m that fits in a size x size square. The
+// thumbnail is grayscale if the frame only has one component.
+func (e *encoder) writeThumbnail(m image.Image, size int) {
+	if e.err != nil {
+		return
+	}
+	t := thumbnailImage(m, size, len(e.comp) == 1)
+	var thumb bytes.Buffer
+	for _, q := range thumbnailQualities {
+		thumb.Reset()
+		if e.err = Encode(&thumb, t, &Options{Quality: q, ColorMatrix: e.colorMatrix()}); e.err != nil {
+			return
+		}
+		if 2+exifThumbnailHeader+thumb.Len() <= 0xffff {
+			break
+		}
+	}
+	if 2+exifThumbnailHeader+thumb.Len() > 0xffff {
+		e.err = errors.New("jpeg: thumbnail is too large")
+		return
+	}
+
+	// The TIFF structure is little-endian, and its offsets are relative to
+	// the start of the TIFF header.
+	le := binary.LittleEndian
+	p := make([]byte, exifThumbnailHeader, exifThumbnailHeader+thumb.Len())
+	copy(p, "Exif\x00\x00")
+	tiff := p[6:]
+	copy(tiff, "II\x2a\x00")
+	le.PutUint32(tiff[4:], 8)
+	// The TIFF field types, and the offsets of IFD1, of the resolution
+	// values and of the thumbnail.
+	const (
+		short    = 3
+		long     = 4
+		rational = 5
+		ifd1     = 8 + 18
+		res      = ifd1 + 78
+		data     = res + 16
+	)
+	// entry writes an IFD entry with a value, or the offset of the value,
+	// of 4 bytes or less.
+	entry := func(b []byte, tag, typ uint16, value uint32) {
+		le.PutUint16(b[0:], tag)
+		le.PutUint16(b[2:], typ)
+		le.PutUint32(b[4:], 1)
+		if typ == short { // Left-justified.
+			le.PutUint16(b[8:], uint16(value))
+		} else {
+			le.PutUint32(b[8:], value)
+		}
+	}
+	// IFD0 only holds the orientation, and links to IFD1.
+	le.PutUint16(tiff[8:], 1)
+	entry(tiff[10:], 0x0112, short, 1) // Orientation: top-left.
+	le.PutUint32(tiff[22:], ifd1)
+	// IFD1 describes the thumbnail.
+	le.PutUint16(tiff[ifd1:], 6)
+	entry(tiff[ifd1+2:], 0x0103, short, 6)         // Compression: JPEG.
+	entry(tiff[ifd1+14:], 0x011a, rational, res)   // XResolution.
+	entry(tiff[ifd1+26:], 0x011b, rational, res+8) // YResolution.
+	entry(tiff[ifd1+38:], 0x0128, short, 2)        // ResolutionUnit: inches.
+	entry(tiff[ifd1+50:], 0x0201, long, data)      // JPEGInterchangeFormat.
+	entry(tiff[ifd1+62:], 0x0202, long, uint32(thumb.Len()))
+	le.PutUint32(tiff[ifd1+74:], 0) // No more IFDs.
+	for i := res; i < data; i += 8 {
+		le.PutUint32(tiff[i:], 72)
+		le.PutUint32(tiff[i+4:], 1)
+	}
+	p = append(p, thumb.Bytes()...)
+
+	e.writeMarkerHeader(app1Marker, 2+len(p))
+	e.write(p)
+}
+
+// thumbnailImage returns m reduced to fit in a size x size square, keeping
+// its aspect ratio, as an *image.Gray if gray is true, and as an
+// *image.RGBA otherwise. Each pixel is the average of up to
+// thumbnailSamples x thumbnailSamples pixels of the area it covers.
+func thumbnailImage(m image.Image, size int, gray bool) image.Image {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, (h*size+w/2)/w)
+		} else {
+			tw, th = max(1, (w*size+h/2)/h), size
+		}
+	}
+	r := image.Rect(0, 0, tw, th)
+	var t interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	}
+	if gray {
+		t = image.NewGray(r)
+	} else {
+		t = image.NewRGBA(r)
+	}
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		ny := min(y1-y0, thumbnailSamples)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			nx := min(x1-x0, thumbnailSamples)
+			var sr, sg, sb uint32
+			for j := 0; j < ny; j++ {
+				sy := b.Min.Y + y0 + (2*j+1)*(y1-y0)/(2*ny)
+				for i := 0; i < nx; i++ {
+					sx := b.Min.X + x0 + (2*i+1)*(x1-x0)/(2*nx)
+					cr, cg, cb, _ := m.At(sx, sy).RGBA()
+					sr, sg, sb = sr+cr, sg+cg, sb+cb
+				}
+			}
+			n := uint32(nx * ny)
+			t.Set(x, y, color.RGBA64{uint16(sr / n), uint16(sg / n), uint16(sb / n), 0xffff})
+		}
+	}
+	return t
+}
@@ -0,0 +1,93 @@
+package progjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+// exifThumbnail returns the thumbnail in the Exif IFD1 of the APP1 segment
+// that follows the SOI marker of data.
+func exifThumbnail(t *testing.T, data []byte) []byte {
+	t.Helper()
+	if data[2] != 0xff || data[3] != app1Marker {
+		t.Fatalf("no APP1 segment after SOI: % x", data[:4])
+	}
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	p := data[6 : 4+n]
+	if string(p[:6]) != "Exif\x00\x00" || string(p[6:10]) != "II\x2a\x00" {
+		t.Fatalf("bad Exif header: % x", p[:10])
+	}
+	tiff := p[6:]
+	le := binary.LittleEndian
+	ifd0 := le.Uint32(tiff[4:])
+	ifd1 := le.Uint32(tiff[ifd0+2+12*uint32(le.Uint16(tiff[ifd0:])):])
+	var offset, length uint32
+	for i := uint32(0); i < uint32(le.Uint16(tiff[ifd1:])); i++ {
+		e := tiff[ifd1+2+12*i:]
+		switch le.Uint16(e) {
+		case 0x0201:
+			offset = le.Uint32(e[8:])
+		case 0x0202:
+			length = le.Uint32(e[8:])
+		}
+	}
+	if offset == 0 || int(offset+length) != len(tiff) {
+		t.Fatalf("thumbnail at %d, length %d, in %d bytes", offset, length, len(tiff))
+	}
+	return tiff[offset : offset+length]
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, tc := range []struct {
+		m    image.Image
+		o    Options
+		want image.Rectangle
+		gray bool
+	}{
+		{testimg.Photo(300, 200, 1), Options{Progressive: true, Thumbnail: 160}, image.Rect(0, 0, 160, 107), false},
+		{testimg.Photo(200, 300, 1), Options{Grayscale: true, Thumbnail: 64}, image.Rect(0, 0, 43, 64), true},
+		{testimg.ZonePlate(40, 30), Options{Thumbnail: 160}, image.Rect(0, 0, 40, 30), true},
+	} {
+		// want is encoded without the thumbnail, and got with it.
+		var want, got bytes.Buffer
+		o := tc.o
+		if err := Encode(&got, tc.m, &o); err != nil {
+			t.Fatal(err)
+		}
+		o.Thumbnail = 0
+		if err := Encode(&want, tc.m, &o); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := Probe(bytes.NewReader(got.Bytes())); err != nil || !p.HasEXIF {
+			t.Errorf("%+v: Probe found no Exif segment (%v)", tc.o, err)
+		}
+
+		thumb, err := Decode(bytes.NewReader(exifThumbnail(t, got.Bytes())))
+		if err != nil {
+			t.Fatalf("%+v: thumbnail: %v", tc.o, err)
+		}
+		if thumb.Bounds() != tc.want {
+			t.Errorf("%+v: thumbnail bounds: got %v, want %v", tc.o, thumb.Bounds(), tc.want)
+		}
+		if _, gray := thumb.(*image.Gray); gray != tc.gray {
+			t.Errorf("%+v: thumbnail is a %T", tc.o, thumb)
+		}
+
+		// The thumbnail does not change the image itself.
+		m0, err := Decode(&want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, err := Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalImages(m0, m1) {
+			t.Errorf("%+v: the image differs with a thumbnail", tc.o)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package progjpeg
+
+import (
+	"bytes"
+	"io"
+)
+
+// Transcode reads the JPEG image in r, baseline or progressive, and writes
+// it to w as a progressive JPEG image with the given scan script, or with
+// the default one if script is nil, as jpegtran -progressive does. Only the
+// coefficients are decoded, and they are re-encoded as they are, so the
+// pixels of the new image are exactly those of the original; the script
+// must send all of them, as [VerifyScanScriptCoverage] checks. The APPn and
+// COM segments, such as Exif, ICC profiles and Adobe color transforms, are
+// copied in their original order.
+func Transcode(w io.Writer, r io.Reader, script ScanScript) error {
+	return transcode(w, r, &Options{Progressive: true, ScanScript: script, StrictScanScript: true})
+}
+
+// TranscodeBaseline is the inverse of [Transcode]: it writes the JPEG image
+// in r, progressive or not, to w as a baseline sequential image with the
+// same pixels, for the decoders that do not support progressive images,
+// such as old hardware decoders and some PDF workflows.
+func TranscodeBaseline(w io.Writer, r io.Reader) error {
+	return transcode(w, r, &Options{})
+}
+
+// A transcoding is the state of a [transcode], which its edits change
+// before it is written.
+type transcoding struct {
+	d      *decoder
+	planes []CoefficientPlane
+	meta   *CoefficientMeta
+	// o is the options of EncodeCoefficients. It is nil until the edits
+	// are done if the image must be written like the original.
+	o *Options
+	// scans is the scan script of the original image, and segments are
+	// its APPn and COM segments, which are written after the SOI marker.
+	scans    ScanScript
+	segments []Segment
+}
+
+// mcuSize returns the size in pixels of the MCUs of t, which the edits may
+// have transposed. The MCUs of a single-component image are single blocks.
+func (t *transcoding) mcuSize() (mw, mh int) {
+	if len(t.planes) == 1 {
+		return 8, 8
+	}
+	return 8 * t.planes[0].H, 8 * t.planes[0].V
+}
+
+// transcode writes the coefficients and the APPn and COM segments of the
+// JPEG image in r to w, with the options o of [EncodeCoefficients], or as
+// a baseline or progressive image like the original if o is nil. The edits
+// may change them before they are written, in order.
+func transcode(w io.Writer, r io.Reader, o *Options, edits ...func(t *transcoding) error) error {
+	t := transcoding{d: &decoder{coeffsOnly: true}, o: o}
+	d := t.d
+	// restart is the interval of the last DRI segment.
+	restart := 0
+	d.onSegment = func(marker byte, p []byte) {
+		switch {
+		case app0Marker <= marker && marker <= app15Marker || marker == comMarker:
+			t.segments = append(t.segments, Segment{marker, p})
+		case marker == driMarker && len(p) == 2:
+			restart = int(p[0])<<8 + int(p[1])
+		case marker == sosMarker:
+			t.scans = append(t.scans, d.scanOf(p, restart))
+		}
+	}
+	if _, err := d.decode(r, false); err != nil {
+		return err
+	}
+	var err error
+	if t.planes, t.meta, err = d.coefficients(); err != nil {
+		return err
+	}
+	for _, edit := range edits {
+		if err := edit(&t); err != nil {
+			return err
+		}
+	}
+	if t.o == nil {
+		t.o = &Options{Progressive: d.progressive}
+	}
+	// A script that misses coefficients would lose them.
+	if t.o.ScanScript != nil {
+		if err := VerifyScanScriptCoverage(t.o.ScanScript, len(t.planes)); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := EncodeCoefficients(&buf, t.planes, t.meta, t.o); err != nil {
+		return err
+	}
+	// The segments follow the SOI marker, before the tables.
+	data := buf.Bytes()
+	size := len(data)
+	for _, s := range t.segments {
+		size += 4 + len(s.Data)
+	}
+	out := make([]byte, 0, size)
+	out = append(out, data[:2]...)
+	for _, s := range t.segments {
+		n := len(s.Data) + 2
+		out = append(out, 0xff, s.Marker, byte(n>>8), byte(n))
+		out = append(out, s.Data...)
+	}
+	out = append(out, data[2:]...)
+	_, err = w.Write(out)
+	return err
+}
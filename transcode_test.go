@@ -0,0 +1,112 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestTranscode(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	exif := append([]byte("Exif\x00\x00"), bigEndianExif()...)
+	var rgb, progressive bytes.Buffer
+	if err := Encode(&rgb, src, &Options{Quality: 90, RGB: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&progressive, src, &Options{Quality: 90, Progressive: true}); err != nil {
+		t.Fatal(err)
+	}
+	script := ScanScript{
+		{Component: -1, SpectralEnd: 0},
+		{Component: 0, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 1, SpectralStart: 1, SpectralEnd: 63},
+		{Component: 2, SpectralStart: 1, SpectralEnd: 63},
+	}
+	for _, data := range [][]byte{
+		encodeWithOptionsAndSegment(t, src, &Options{Quality: 90}, app1Marker, exif),
+		rgb.Bytes(),
+		progressive.Bytes(),
+	} {
+		want, wantMeta, err := DecodeFull(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []ScanScript{nil, script} {
+			var buf bytes.Buffer
+			if err := Transcode(&buf, bytes.NewReader(data), s); err != nil {
+				t.Fatal(err)
+			}
+			got, meta, err := DecodeFull(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalImages(got, want) {
+				t.Errorf("%d scans: the pixels differ from those of the original", len(s))
+			}
+			if s != nil && len(meta.Scans) != len(s) {
+				t.Errorf("got %d scans, want %d", len(meta.Scans), len(s))
+			}
+			if p, err := Probe(bytes.NewReader(buf.Bytes())); err != nil || !p.Progressive {
+				t.Errorf("the transcoded image is not progressive (%v)", err)
+			}
+			if len(meta.Segments) != len(wantMeta.Segments) {
+				t.Fatalf("got %d APPn segments, want %d", len(meta.Segments), len(wantMeta.Segments))
+			}
+			for i := range meta.Segments {
+				if meta.Segments[i].Marker != wantMeta.Segments[i].Marker || !bytes.Equal(meta.Segments[i].Data, wantMeta.Segments[i].Data) {
+					t.Errorf("segment %d differs", i)
+				}
+			}
+		}
+		if _, ok := want.(*image.RGBA); ok != bytes.Equal(data, rgb.Bytes()) {
+			t.Errorf("got a %T", want)
+		}
+	}
+
+	// Invalid scan scripts are rejected.
+	var buf bytes.Buffer
+	if err := Transcode(&buf, bytes.NewReader(progressive.Bytes()), script[1:]); err == nil {
+		t.Error("a scan script without a DC scan did not fail")
+	}
+}
+
+func TestTranscodeBaseline(t *testing.T) {
+	src := testimg.Photo(83, 47, 1)
+	for _, o := range []*Options{
+		{Quality: 90, Progressive: true, Thumbnail: 32},
+		{Quality: 90, Progressive: true, Grayscale: true},
+	} {
+		var progressive bytes.Buffer
+		if err := Encode(&progressive, src, o); err != nil {
+			t.Fatal(err)
+		}
+		data := progressive.Bytes()
+		var buf bytes.Buffer
+		if err := TranscodeBaseline(&buf, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := Probe(bytes.NewReader(buf.Bytes())); err != nil || p.Progressive || p.Scans != 1 {
+			t.Errorf("got %+v and error %v, want a single scan baseline image", p, err)
+		}
+		want, wantMeta, err := DecodeWithMetadata(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, meta, err := DecodeWithMetadata(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalImages(got, want) {
+			t.Error("the pixels differ from those of the original")
+		}
+		if !bytes.Equal(meta.Exif, wantMeta.Exif) {
+			t.Error("the Exif data differs from that of the original")
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("image/jpeg: %v", err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package progjpeg
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// A Transcoder chains the lossless operations of [Crop], [Reorient],
+// [TranscodeGrayscale], [Requantize], [StripMetadata], [Transcode],
+// [TranscodeBaseline] and [Rescan], and performs them all in a single pass
+// over the coefficients when its WriteTo method is called:
+//
+//	_, err := progjpeg.NewTranscoder(r).
+//		Crop(rect).
+//		Rotate(90).
+//		Progressive(nil).
+//		StripMetadata(progjpeg.MetadataNone).
+//		WriteTo(w)
+//
+// The operations apply in the order of the calls, each to the result of
+// the previous ones: the rectangle of a Crop that follows a Rotate is in
+// the rotated image. The output is baseline or progressive like the
+// original, unless Progressive, Baseline or Rescan, the last of which
+// applies, says otherwise. A
+// Transcoder is used once; an error of an operation is returned by WriteTo.
+type Transcoder struct {
+	r     io.Reader
+	edits []func(t *transcoding) error
+}
+
+// NewTranscoder returns a Transcoder of the JPEG image in r.
+func NewTranscoder(r io.Reader) *Transcoder {
+	return &Transcoder{r: r}
+}
+
+// edit adds the operation f to tc.
+func (tc *Transcoder) edit(f func(t *transcoding) error) *Transcoder {
+	tc.edits = append(tc.edits, f)
+	return tc
+}
+
+// Crop keeps the part of the image inside rect, as [Crop] does.
+func (tc *Transcoder) Crop(rect image.Rectangle) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		return t.crop(rect)
+	})
+}
+
+// Reorient rotates or flips the image as tr says, as [Reorient] does.
+func (tc *Transcoder) Reorient(tr Transform) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		if tr < FlipHorizontal || tr > Rotate270 {
+			return fmt.Errorf("jpeg: invalid transform %d", tr)
+		}
+		return t.reorient(int(tr))
+	})
+}
+
+// Rotate rotates the image clockwise by degrees, which is 90, 180 or 270,
+// as [Reorient] does.
+func (tc *Transcoder) Rotate(degrees int) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		switch degrees {
+		case 90:
+			return t.reorient(int(Rotate90))
+		case 180:
+			return t.reorient(int(Rotate180))
+		case 270:
+			return t.reorient(int(Rotate270))
+		}
+		return fmt.Errorf("jpeg: cannot rotate by %d degrees (must be 90, 180 or 270)", degrees)
+	})
+}
+
+// Grayscale drops the chroma of the image, as [TranscodeGrayscale] does.
+func (tc *Transcoder) Grayscale() *Transcoder {
+	return tc.edit((*transcoding).grayscale)
+}
+
+// Requantize lowers the quality of the image, as [Requantize] does.
+func (tc *Transcoder) Requantize(quality int) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		t.requantize(quality)
+		return nil
+	})
+}
+
+// StripMetadata keeps only the metadata segments of the classes in keep,
+// as [StripMetadata] does.
+func (tc *Transcoder) StripMetadata(keep MetadataClass) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		t.keepMetadata(keep)
+		return nil
+	})
+}
+
+// Progressive writes a progressive image with the given scan script, or
+// with the default one if it is nil, as [Transcode] does.
+func (tc *Transcoder) Progressive(script ScanScript) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		t.o = &Options{Progressive: true, ScanScript: script, StrictScanScript: true}
+		return nil
+	})
+}
+
+// Baseline writes a baseline image, as [TranscodeBaseline] does.
+func (tc *Transcoder) Baseline() *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		t.o = &Options{}
+		return nil
+	})
+}
+
+// Rescan writes a progressive image with the scan script that edit
+// returns, given the scans of the original, as [Rescan] does. The script
+// must send all the components of the result, which differ from those of
+// the original after Grayscale.
+func (tc *Transcoder) Rescan(edit func(scans ScanScript) ScanScript) *Transcoder {
+	return tc.edit(func(t *transcoding) error {
+		return t.rescan(edit)
+	})
+}
+
+// WriteTo performs the operations of tc and writes the result to w. It
+// returns the number of bytes written.
+func (tc *Transcoder) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := transcode(cw, tc.r, nil, tc.edits...)
+	return cw.n, err
+}
@@ -0,0 +1,79 @@
+package progjpeg
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
+)
+
+func TestTranscoder(t *testing.T) {
+	src := toYCbCr422(testimg.Photo(83, 47, 1))
+	exif := append([]byte("Exif\x00\x00"), bigEndianExif()...)
+	data := encodeWithOptionsAndSegment(t, src, &Options{Quality: 75}, app1Marker, exif)
+
+	// The pipeline gives the same file as the operations one after the
+	// other. The 4:2:2 image is 4:4:0 once rotated, so the crop is aligned
+	// to 8x16 MCUs.
+	var got bytes.Buffer
+	n, err := NewTranscoder(bytes.NewReader(data)).
+		Rotate(90).
+		Crop(image.Rect(8, 16, 40, 80)).
+		Requantize(50).
+		Progressive(nil).
+		StripMetadata(MetadataNone).
+		WriteTo(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(got.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, got.Len())
+	}
+	var want bytes.Buffer
+	step := data
+	for _, f := range []func(w *bytes.Buffer, r *bytes.Reader) error{
+		func(w *bytes.Buffer, r *bytes.Reader) error { return Reorient(w, r, Rotate90) },
+		func(w *bytes.Buffer, r *bytes.Reader) error { return Crop(w, r, image.Rect(8, 16, 40, 80)) },
+		func(w *bytes.Buffer, r *bytes.Reader) error { return Requantize(w, r, 50) },
+		func(w *bytes.Buffer, r *bytes.Reader) error { return Transcode(w, r, nil) },
+		func(w *bytes.Buffer, r *bytes.Reader) error { return StripMetadata(w, r, MetadataNone) },
+	} {
+		want.Reset()
+		if err := f(&want, bytes.NewReader(step)); err != nil {
+			t.Fatal(err)
+		}
+		step = bytes.Clone(want.Bytes())
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("the pipeline and the operations one after the other differ")
+	}
+	_, meta, err := DecodeFull(bytes.NewReader(got.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Segments) != 0 {
+		t.Errorf("got %d APPn segments, want none", len(meta.Segments))
+	}
+
+	// The last of Progressive, Baseline and Rescan applies.
+	got.Reset()
+	if _, err := NewTranscoder(bytes.NewReader(data)).Progressive(nil).Grayscale().Baseline().WriteTo(&got); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := Probe(bytes.NewReader(got.Bytes())); err != nil || p.Progressive || p.Components != 1 {
+		t.Errorf("got %+v, want a baseline grayscale image (%v)", p, err)
+	}
+
+	// The errors of the operations are returned by WriteTo.
+	for _, tc := range []*Transcoder{
+		NewTranscoder(bytes.NewReader(data)).Rotate(45),
+		NewTranscoder(bytes.NewReader(data)).Reorient(9),
+		NewTranscoder(bytes.NewReader(data)).Rotate(90).Crop(image.Rect(0, 8, 16, 16)),
+		NewTranscoder(bytes.NewReader(data)).Rescan(func(s ScanScript) ScanScript { return s }),
+	} {
+		if _, err := tc.WriteTo(new(bytes.Buffer)); err == nil {
+			t.Error("an invalid operation did not fail")
+		}
+	}
+}
@@ -6,6 +6,7 @@ package progjpeg
 
 import (
 	"bufio"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
@@ -223,13 +224,141 @@ type encoder struct {
 	err error
 	// buf is a scratch buffer.
 	buf [16]byte
-	// bits and nBits are accumulated bits to write to w.
-	bits, nBits uint32
-	// quant is the scaled quantization tables, in zig-zag order.
-	quant [nQuantIndex][blockSize]byte
+	// bits and nBits are accumulated bits to write to w. The valid bits are
+	// the nBits most significant bits of bits.
+	bits  uint64
+	nBits uint32
+	// out buffers the byte-stuffed entropy-coded data. Its first nOut bytes
+	// have yet to be written to w.
+	out  [4096]byte
+	nOut int
+	// quant is the scaled quantization tables, in zig-zag order, for the
+	// given quality. A zero quality means that quant is not initialized.
+	quant   [nQuantIndex][blockSize]byte
+	quality int
+	// size is the image size. comp describes the frame's components, and
+	// mxx and myy are the number of MCUs (Minimum Coded Units) in the image.
+	size     image.Point
+	comp     []encComponent
+	mxx, myy int
+	// coeffs are the quantized DCT coefficients of each component. They are
+	// only computed for images with several scans, where they are shared by
+	// all of the scans instead of being recomputed from the pixels for every
+	// scan.
+	coeffs []coeffPlane
+	// mcu is a scratch buffer holding the blocks of an MCU.
+	mcu []block
+	// roi is the quality of each MCU, left to right and top to bottom, if
+	// the options set the quality of parts of the image. roiQuant holds the
+	// quantization tables of the qualities, other than e.quality, in use.
+	roi      []uint8
+	roiQuant [101]*[nQuantIndex][blockSize]byte
+	// written is the number of bytes written to w. session, if non-nil,
+	// records the encoder's decisions, and replayQuant, if non-nil,
+	// replaces the quantization tables computed from the quality.
+	written     int64
+	session     *Session
+	replayQuant *[nQuantIndex][blockSize]byte
+	// alloc, if non-nil, records the bits of every block.
+	alloc *BitAllocation
+	// bands, if non-nil, records the bits of every spectral band.
+	bands *BandBits
+	// scanTables is whether the current scan uses the Huffman tables in st
+	// instead of the default ones.
+	scanTables bool
+	st         *scanHuffmanTables
+	// ri is the restart interval defined by the last DRI marker, if any.
+	ri int
+	// avi, set by an MJPEGWriter for AVI frames, writes the AVI1 APP0
+	// segment and omits the Huffman tables, which such frames imply.
+	avi bool
+	// cm is the RGB to YCbCr transform of Options.ColorMatrix, or nil for
+	// color.RGBToYCbCr.
+	cm *colorTransform
+	// rgb is whether the frame's components are R, G and B, with no color
+	// transform.
+	rgb bool
+	// cmyk is whether the frame's components are C, M, Y and K, from an
+	// *image.CMYK.
+	cmyk bool
+	// chromaCut, if positive, is the number of coefficients, in zig-zag
+	// order, kept in the blocks of the chroma components.
+	chromaCut int
+	// dither is the strength, in percent, of the dither noise added to
+	// smooth blocks, or 0.
+	dither int
+	// blockQuant is Options.BlockQuant, or nil.
+	blockQuant func(bx, by, comp int, q *[blockSize]byte)
+}
+
+// encComponent describes one component of the frame being encoded.
+type encComponent struct {
+	// h and v are the horizontal and vertical sampling factors.
+	h, v int
+	// q selects both the quantization table and the pair of Huffman tables
+	// used by the component.
+	q quantIndex
+}
+
+// grayComponents and ycbcrComponents are the usual frame layouts of the
+// encoder: a single luminance component, or YCbCr with 4:2:0 chroma
+// subsampling.
+var (
+	grayComponents  = []encComponent{{1, 1, quantIndexLuminance}}
+	ycbcrComponents = []encComponent{
+		{2, 2, quantIndexLuminance},
+		{1, 1, quantIndexChrominance},
+		{1, 1, quantIndexChrominance},
+	}
+)
+
+// coeffPlane holds the quantized DCT coefficients of one component, in
+// natural (not zig-zag) order. The plane covers whole MCUs: it is bw blocks
+// wide and bh blocks high, stored left to right, top to bottom.
+type coeffPlane struct {
+	blocks []block
+	bw, bh int
+	// y0 is the first block row held in blocks, when the plane only holds
+	// a stripe of the image.
+	y0 int
+}
+
+// at returns the block at column bx and row by of the plane.
+func (p *coeffPlane) at(bx, by int) *block {
+	return &p.blocks[(by-p.y0)*p.bw+bx]
+}
+
+// init sets up the frame layout for an image of the given size.
+func (e *encoder) init(size image.Point, comp []encComponent) {
+	e.size = size
+	e.comp = comp
+	hmax, vmax := e.maxSampling()
+	e.mxx = (size.X + 8*hmax - 1) / (8 * hmax)
+	e.myy = (size.Y + 8*vmax - 1) / (8 * vmax)
+}
+
+// maxSampling returns the largest horizontal and vertical sampling factors of
+// the frame's components.
+func (e *encoder) maxSampling() (hmax, vmax int) {
+	for _, c := range e.comp {
+		hmax = max(hmax, c.h)
+		vmax = max(vmax, c.v)
+	}
+	return hmax, vmax
+}
+
+// compBlocks returns the number of blocks per row and per column of the
+// component c, not counting the padding needed to complete the last MCUs.
+// Those are the blocks coded by a non-interleaved scan.
+func (e *encoder) compBlocks(c int) (bw, bh int) {
+	hmax, vmax := e.maxSampling()
+	w := (e.size.X*e.comp[c].h + hmax - 1) / hmax
+	h := (e.size.Y*e.comp[c].v + vmax - 1) / vmax
+	return (w + 7) / 8, (h + 7) / 8
 }
 
 func (e *encoder) flush() {
+	e.flushEntropy()
 	if e.err != nil {
 		return
 	}
@@ -237,40 +366,101 @@ func (e *encoder) flush() {
 }
 
 func (e *encoder) write(p []byte) {
+	e.flushEntropy()
 	if e.err != nil {
 		return
 	}
 	_, e.err = e.w.Write(p)
+	e.written += int64(len(p))
 }
 
 func (e *encoder) writeByte(b byte) {
+	e.flushEntropy()
 	if e.err != nil {
 		return
 	}
 	e.err = e.w.WriteByte(b)
+	e.written++
+}
+
+// flushEntropy writes the buffered entropy-coded bytes to w.
+func (e *encoder) flushEntropy() {
+	if e.nOut == 0 {
+		return
+	}
+	if e.err == nil {
+		_, e.err = e.w.Write(e.out[:e.nOut])
+	}
+	e.written += int64(e.nOut)
+	e.nOut = 0
 }
 
 // emit emits the least significant nBits bits of bits to the bit-stream.
 // The precondition is bits < 1<<nBits && nBits <= 16.
+//
+// The bits are accumulated in the most significant bits of the 64-bit e.bits
+// and moved to e.out 32 bits at a time, which leaves room for at least 32
+// more bits. Byte stuffing only needs to be done byte by byte if one of the
+// four bytes is 0xff.
 func (e *encoder) emit(bits, nBits uint32) {
 	nBits += e.nBits
-	bits <<= 32 - nBits
-	bits |= e.bits
-	for nBits >= 8 {
-		b := uint8(bits >> 24)
-		e.writeByte(b)
+	acc := e.bits | uint64(bits)<<(64-nBits)
+	if nBits >= 32 {
+		if e.nOut > len(e.out)-8 {
+			e.flushEntropy()
+		}
+		x := uint32(acc >> 32)
+		// x has no 0xff byte if ^x has no zero byte, which the classic
+		// "has zero byte" bit trick checks without branching.
+		if y := ^x; (y-0x01010101)&^y&0x80808080 == 0 {
+			binary.BigEndian.PutUint32(e.out[e.nOut:], x)
+			e.nOut += 4
+		} else {
+			for i := 24; i >= 0; i -= 8 {
+				b := uint8(x >> i)
+				e.out[e.nOut] = b
+				e.nOut++
+				if b == 0xff {
+					e.out[e.nOut] = 0x00
+					e.nOut++
+				}
+			}
+		}
+		acc <<= 32
+		nBits -= 32
+	}
+	e.bits, e.nBits = acc, nBits
+}
+
+// padBits pads the last byte of the entropy-coded data with 1's, moves all
+// of the accumulated bits to e.out and resets the bit accumulator, so that
+// the data ends on a byte boundary. It must be called at the end of each
+// scan, and of each restart interval.
+func (e *encoder) padBits() {
+	e.emit(0x7f, 7)
+	for ; e.nBits >= 8; e.nBits -= 8 {
+		if e.nOut > len(e.out)-2 {
+			e.flushEntropy()
+		}
+		b := uint8(e.bits >> 56)
+		e.out[e.nOut] = b
+		e.nOut++
 		if b == 0xff {
-			e.writeByte(0x00)
+			e.out[e.nOut] = 0x00
+			e.nOut++
 		}
-		bits <<= 8
-		nBits -= 8
+		e.bits <<= 8
 	}
-	e.bits, e.nBits = bits, nBits
+	e.bits, e.nBits = 0, 0
 }
 
 // emitHuff emits the given value with the given Huffman encoder.
 func (e *encoder) emitHuff(h huffIndex, value int32) {
-	x := theHuffmanLUT[h][value]
+	lut := &theHuffmanLUT
+	if e.scanTables {
+		lut = &e.st.lut
+	}
+	x := lut[h][value]
 	e.emit(x&(1<<24-1), x>>24)
 }
 
@@ -312,63 +502,121 @@ func (e *encoder) writeDQT() {
 	}
 }
 
-// writeSOF0 writes the Start Of Frame (Baseline Sequential) marker.
-func (e *encoder) writeSOF(size image.Point, nComponent int, marker uint8) {
+// writeSOF writes the Start Of Frame marker, either SOF0 (Baseline Sequential)
+// or SOF2 (Progressive).
+func (e *encoder) writeSOF(marker uint8) {
+	nComponent := len(e.comp)
 	markerlen := 8 + 3*nComponent
 	e.writeMarkerHeader(marker, markerlen)
 	e.buf[0] = 8 // 8-bit color.
-	e.buf[1] = uint8(size.Y >> 8)
-	e.buf[2] = uint8(size.Y & 0xff)
-	e.buf[3] = uint8(size.X >> 8)
-	e.buf[4] = uint8(size.X & 0xff)
+	e.buf[1] = uint8(e.size.Y >> 8)
+	e.buf[2] = uint8(e.size.Y & 0xff)
+	e.buf[3] = uint8(e.size.X >> 8)
+	e.buf[4] = uint8(e.size.X & 0xff)
 	e.buf[5] = uint8(nComponent)
-	if nComponent == 1 {
-		e.buf[6] = 1
-		// No subsampling for grayscale image.
-		e.buf[7] = 0x11
-		e.buf[8] = 0x00
-	} else {
-		for i := 0; i < nComponent; i++ {
-			e.buf[3*i+6] = uint8(i + 1)
-			// We use 4:2:0 chroma subsampling.
-			e.buf[3*i+7] = "\x22\x11\x11"[i]
-			e.buf[3*i+8] = "\x00\x01\x01"[i]
-		}
+	e.write(e.buf[:6])
+	for i, c := range e.comp {
+		e.buf[0] = uint8(i + 1)
+		e.buf[1] = uint8(c.h<<4 | c.v)
+		e.buf[2] = uint8(c.q)
+		e.write(e.buf[:3])
 	}
-	e.write(e.buf[:3*(nComponent-1)+9])
 }
 
 // writeDHT writes the Define Huffman Table marker.
-func (e *encoder) writeDHT(nComponent int) {
-	markerlen := 2
+func (e *encoder) writeDHT() {
 	specs := theHuffmanSpec[:]
-	if nComponent == 1 {
+	if !e.usesChrominance() {
 		// Drop the Chrominance tables.
 		specs = specs[:2]
 	}
+	e.writeHuffmanTables("\x00\x10\x01\x11", specs)
+}
+
+// writeHuffmanTables writes a Define Huffman Table marker holding specs[i]
+// as the table whose class and destination are ids[i].
+func (e *encoder) writeHuffmanTables(ids string, specs []huffmanSpec) {
+	markerlen := 2
 	for _, s := range specs {
 		markerlen += 1 + 16 + len(s.value)
 	}
 	e.writeMarkerHeader(dhtMarker, markerlen)
-	for i, s := range specs {
-		e.writeByte("\x00\x10\x01\x11"[i])
-		e.write(s.count[:])
-		e.write(s.value)
+	for i := range specs {
+		e.writeByte(ids[i])
+		e.write(specs[i].count[:])
+		e.write(specs[i].value)
 	}
 }
 
-// writeBlock writes a block of pixel data using the given quantization table,
-// returning the post-quantized DC value of the DCT-transformed block. b is in
-// natural (not zig-zag) order.
-func (e *encoder) writeBlock(b *block, q quantIndex, prevDC int32) int32 {
+// usesChrominance returns whether any of the frame's components uses the
+// chrominance tables.
+func (e *encoder) usesChrominance() bool {
+	for _, c := range e.comp {
+		if c.q == quantIndexChrominance {
+			return true
+		}
+	}
+	return false
+}
+
+// fdctQuantize performs the forward DCT of a block of pixel data and
+// quantizes the result with the given quantization table, in place. b is in
+// natural (not zig-zag) order. If coarse is non-nil, the coefficients are
+// first quantized with the coarser tables in coarse, as computed by
+// mcuQuant, and then expressed in units of the quantization table. id, from
+// blockID, seeds the dither noise, if any.
+func (e *encoder) fdctQuantize(b *block, q quantIndex, coarse *[nQuantIndex][blockSize]byte, id uint32) {
 	fdct(b)
-	// Emit the DC delta.
-	dc := div(b[0], 8*int32(e.quant[q][0]))
-	e.emitHuffRLE(huffIndex(2*q+0), 0, dc-prevDC)
+	if e.dither > 0 {
+		if coarse != nil {
+			e.ditherBlock(b, &coarse[q], id)
+		} else {
+			e.ditherBlock(b, &e.quant[q], id)
+		}
+	}
+	if coarse != nil {
+		for zig := 0; zig < blockSize; zig++ {
+			s := int32(coarse[q][zig])
+			v := div(b[unzig[zig]], 8*s)
+			b[unzig[zig]] = div(v*s, int32(e.quant[q][zig]))
+		}
+		if q == quantIndexChrominance && e.chromaCut > 0 {
+			for zig := e.chromaCut; zig < blockSize; zig++ {
+				b[unzig[zig]] = 0
+			}
+		}
+		return
+	}
+	n := blockSize
+	if q == quantIndexChrominance && e.chromaCut > 0 {
+		n = e.chromaCut
+	}
+	for zig := 0; zig < n; zig++ {
+		b[unzig[zig]] = div(b[unzig[zig]], 8*int32(e.quant[q][zig]))
+	}
+	for zig := n; zig < blockSize; zig++ {
+		b[unzig[zig]] = 0
+	}
+}
+
+// writeBlock writes the zig-zag coefficients zigStart to zigEnd (inclusive)
+// of a block of quantized DCT coefficients, using the Huffman tables selected
+// by q. A zigStart of 0 means that the DC coefficient is included, and is
+// delta-encoded against prevDC. It returns the block's DC value. b is in
+// natural (not zig-zag) order.
+func (e *encoder) writeBlock(b *block, q quantIndex, prevDC int32, zigStart, zigEnd int) int32 {
+	if zigStart == 0 {
+		// Emit the DC delta.
+		e.emitHuffRLE(huffIndex(2*q+0), 0, b[0]-prevDC)
+		zigStart = 1
+	}
+	if zigStart > zigEnd {
+		return b[0]
+	}
 	// Emit the AC components.
 	h, runLength := huffIndex(2*q+1), int32(0)
-	for zig := 1; zig < blockSize; zig++ {
-		ac := div(b[unzig[zig]], 8*int32(e.quant[q][zig]))
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		ac := b[unzig[zig]]
 		if ac == 0 {
 			runLength++
 		} else {
@@ -383,19 +631,24 @@ func (e *encoder) writeBlock(b *block, q quantIndex, prevDC int32) int32 {
 	if runLength > 0 {
 		e.emitHuff(h, 0x00)
 	}
-	return dc
+	return b[0]
 }
 
 // toYCbCr converts the 8x8 region of m whose top-left corner is p to its
-// YCbCr values.
-func toYCbCr(m image.Image, p image.Point, yBlock, cbBlock, crBlock *block) {
+// YCbCr values, with the color transform cm, or as color.RGBToYCbCr does if
+// cm is nil. Images with a registered ColorConverter are converted by it.
+func toYCbCr(m image.Image, p image.Point, cm *colorTransform, yBlock, cbBlock, crBlock *block) {
+	if f := colorConverter(m); f != nil {
+		convertBlocks(f, m, p, yBlock, cbBlock, crBlock)
+		return
+	}
 	b := m.Bounds()
 	xmax := b.Max.X - 1
 	ymax := b.Max.Y - 1
 	for j := 0; j < 8; j++ {
 		for i := 0; i < 8; i++ {
 			r, g, b, _ := m.At(min(p.X+i, xmax), min(p.Y+j, ymax)).RGBA()
-			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			yy, cb, cr := rgbToYCbCr(cm, uint8(r>>8), uint8(g>>8), uint8(b>>8))
 			yBlock[8*j+i] = int32(yy)
 			cbBlock[8*j+i] = int32(cb)
 			crBlock[8*j+i] = int32(cr)
@@ -403,6 +656,15 @@ func toYCbCr(m image.Image, p image.Point, yBlock, cbBlock, crBlock *block) {
 	}
 }
 
+// rgbToYCbCr converts an RGB color with the color transform cm, or with
+// color.RGBToYCbCr if cm is nil.
+func rgbToYCbCr(cm *colorTransform, r, g, b uint8) (uint8, uint8, uint8) {
+	if cm != nil {
+		return cm.convert(r, g, b)
+	}
+	return color.RGBToYCbCr(r, g, b)
+}
+
 // grayToY stores the 8x8 region of m whose top-left corner is p in yBlock.
 func grayToY(m *image.Gray, p image.Point, yBlock *block) {
 	b := m.Bounds()
@@ -418,7 +680,7 @@ func grayToY(m *image.Gray, p image.Point, yBlock *block) {
 }
 
 // rgbaToYCbCr is a specialized version of toYCbCr for image.RGBA images.
-func rgbaToYCbCr(m *image.RGBA, p image.Point, yBlock, cbBlock, crBlock *block) {
+func rgbaToYCbCr(m *image.RGBA, p image.Point, cm *colorTransform, yBlock, cbBlock, crBlock *block) {
 	b := m.Bounds()
 	xmax := b.Max.X - 1
 	ymax := b.Max.Y - 1
@@ -434,7 +696,7 @@ func rgbaToYCbCr(m *image.RGBA, p image.Point, yBlock, cbBlock, crBlock *block)
 				sx = xmax
 			}
 			pix := m.Pix[offset+sx*4:]
-			yy, cb, cr := color.RGBToYCbCr(pix[0], pix[1], pix[2])
+			yy, cb, cr := rgbToYCbCr(cm, pix[0], pix[1], pix[2])
 			yBlock[8*j+i] = int32(yy)
 			cbBlock[8*j+i] = int32(cb)
 			crBlock[8*j+i] = int32(cr)
@@ -442,6 +704,43 @@ func rgbaToYCbCr(m *image.RGBA, p image.Point, yBlock, cbBlock, crBlock *block)
 	}
 }
 
+// rgbaToY is a specialized version of rgbaToYCbCr that only computes the
+// luminance, for grayscale output.
+func rgbaToY(m *image.RGBA, p image.Point, cm *colorTransform, yBlock *block) {
+	b := m.Bounds()
+	xmax := b.Max.X - 1
+	ymax := b.Max.Y - 1
+	for j := 0; j < 8; j++ {
+		sj := min(p.Y+j, ymax)
+		offset := (sj-b.Min.Y)*m.Stride - b.Min.X*4
+		for i := 0; i < 8; i++ {
+			pix := m.Pix[offset+min(p.X+i, xmax)*4:]
+			r, g, b := int32(pix[0]), int32(pix[1]), int32(pix[2])
+			if cm != nil {
+				k := &cm.k[0]
+				yBlock[8*j+i] = int32(clampComponent(k[0]*r + k[1]*g + k[2]*b + 1<<15))
+				continue
+			}
+			// This is the luminance computed by color.RGBToYCbCr.
+			yBlock[8*j+i] = (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+		}
+	}
+}
+
+// yCbCrToY is a specialized version of yCbCrToYCbCr that only copies the
+// luminance, for grayscale output.
+func yCbCrToY(m *image.YCbCr, p image.Point, yBlock *block) {
+	b := m.Bounds()
+	xmax := b.Max.X - 1
+	ymax := b.Max.Y - 1
+	for j := 0; j < 8; j++ {
+		yi := m.YOffset(0, min(p.Y+j, ymax))
+		for i := 0; i < 8; i++ {
+			yBlock[8*j+i] = int32(m.Y[yi+min(p.X+i, xmax)])
+		}
+	}
+}
+
 // yCbCrToYCbCr is a specialized version of toYCbCr for image.YCbCr images.
 func yCbCrToYCbCr(m *image.YCbCr, p image.Point, yBlock, cbBlock, crBlock *block) {
 	b := m.Bounds()
@@ -481,120 +780,317 @@ func scale(dst *block, src *[4]block) {
 	}
 }
 
-// sosHeaderY is the SOS marker "\xff\xda" followed by 8 bytes:
-//   - the marker length "\x00\x08",
-//   - the number of components "\x01",
-//   - component 1 uses DC table 0 and AC table 0 "\x01\x00",
-//   - the bytes "\x00\x3f\x00". Section B.2.3 of the spec says that for
-//     sequential DCTs, those bytes (8-bit Ss, 8-bit Se, 4-bit Ah, 4-bit Al)
-//     should be 0x00, 0x3f, 0x00<<4 | 0x00.
-var sosHeaderY = []byte{
-	0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00, 0x00, 0x3f, 0x00,
+// readMCU converts the MCU of m whose top-left corner is p to blocks of pixel
+// data, in natural order. The blocks are stored in dst in the order of an
+// interleaved scan: the h*v blocks of the first component, left to right and
+// top to bottom, then the blocks of the second component, and so on.
+func (e *encoder) readMCU(m image.Image, p image.Point, dst []block) {
+	if r, ok := m.(*rowImage); ok {
+		if m = r.load(p.Y); m == nil {
+			if e.err == nil {
+				e.err = r.err
+			}
+			return
+		}
+	}
+	if mp, ok := m.(*Multiplane); ok {
+		// Every plane is a full resolution component.
+		for c, plane := range mp.Planes {
+			grayToY(plane, p, &dst[c])
+		}
+		return
+	}
+	if cmyk, ok := m.(*image.CMYK); ok && e.cmyk {
+		cmykToBlocks(cmyk, p, dst)
+		return
+	}
+	if e.rgb {
+		if rgba, ok := m.(*image.RGBA); ok {
+			rgbaToRGB(rgba, p, dst)
+		} else {
+			toRGB(m, p, dst)
+		}
+		return
+	}
+	if len(e.comp) == 1 {
+		switch m := m.(type) {
+		case *image.Gray:
+			grayToY(m, p, &dst[0])
+		case *image.RGBA:
+			rgbaToY(m, p, e.cm, &dst[0])
+		case *image.YCbCr:
+			yCbCrToY(m, p, &dst[0])
+		default:
+			var cb, cr block
+			toYCbCr(m, p, e.cm, &dst[0], &cb, &cr)
+		}
+		return
+	}
+	h, v := e.comp[0].h, e.comp[0].v
+	ycbcr, _ := m.(*image.YCbCr)
+	if ycbcr != nil && nativeYCbCr(ycbcr, e.comp) {
+		yCbCrNative(ycbcr, p, h, v, dst)
+		return
+	}
+	if h != 2 || v != 2 {
+		readSubsampledMCU(m, p, h, v, e.cm, dst)
+		return
+	}
+	// Scratch buffers to hold the full resolution chroma values.
+	var cb, cr [4]block
+	rgba, _ := m.(*image.RGBA)
+	for i := 0; i < 4; i++ {
+		xOff := (i & 1) * 8 // 0 8 0 8
+		yOff := (i & 2) * 4 // 0 0 8 8
+		p := image.Pt(p.X+xOff, p.Y+yOff)
+		if rgba != nil {
+			rgbaToYCbCr(rgba, p, e.cm, &dst[i], &cb[i], &cr[i])
+		} else if ycbcr != nil {
+			yCbCrToYCbCr(ycbcr, p, &dst[i], &cb[i], &cr[i])
+		} else {
+			toYCbCr(m, p, e.cm, &dst[i], &cb[i], &cr[i])
+		}
+	}
+	scale(&dst[4], &cb)
+	scale(&dst[5], &cr)
 }
 
-// sosHeaderYCbCr is the SOS marker "\xff\xda" followed by 12 bytes:
-//   - the marker length "\x00\x0c",
-//   - the number of components "\x03",
-//   - component 1 uses DC table 0 and AC table 0 "\x01\x00",
-//   - component 2 uses DC table 1 and AC table 1 "\x02\x11",
-//   - component 3 uses DC table 1 and AC table 1 "\x03\x11",
-//   - the bytes "\x00\x3f\x00". Section B.2.3 of the spec says that for
-//     sequential DCTs, those bytes (8-bit Ss, 8-bit Se, 4-bit Ah, 4-bit Al)
-//     should be 0x00, 0x3f, 0x00<<4 | 0x00.
-var sosHeaderYCbCr = []byte{
-	0xff, 0xda, 0x00, 0x0c, 0x03, 0x01, 0x00, 0x02,
-	0x11, 0x03, 0x11, 0x00, 0x3f, 0x00,
+// readSubsampledMCU is the general case of readMCU for color images whose
+// luma component has the sampling factors h and v, and whose chroma
+// components have one block per MCU: every chroma value is the average of
+// h*v full resolution values. cm is the color transform of RGB images.
+func readSubsampledMCU(m image.Image, p image.Point, h, v int, cm *colorTransform, dst []block) {
+	// Scratch buffers to hold the full resolution chroma values, of up to
+	// the 8 luma blocks of a 4:1:0 MCU.
+	var cb, cr [8]block
+	for i := 0; i < h*v; i++ {
+		p := image.Pt(p.X+8*(i%h), p.Y+8*(i/h))
+		switch m := m.(type) {
+		case *image.RGBA:
+			rgbaToYCbCr(m, p, cm, &dst[i], &cb[i], &cr[i])
+		case *image.YCbCr:
+			yCbCrToYCbCr(m, p, &dst[i], &cb[i], &cr[i])
+		default:
+			toYCbCr(m, p, cm, &dst[i], &cb[i], &cr[i])
+		}
+	}
+	scaleSampling(&dst[h*v], cb[:h*v], h, v)
+	scaleSampling(&dst[h*v+1], cr[:h*v], h, v)
 }
 
-// writeSOS writes the StartOfScan marker.
-func (e *encoder) writeSOS(m image.Image) {
-	switch m.(type) {
-	case *image.Gray:
-		e.write(sosHeaderY)
-	default:
-		e.write(sosHeaderYCbCr)
+// scaleSampling scales the 8h x 8v region represented by the h*v src
+// blocks, left to right and top to bottom, to the 8x8 dst block.
+func scaleSampling(dst *block, src []block, h, v int) {
+	n := int32(h * v)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			sum := int32(0)
+			for sy := v * y; sy < v*(y+1); sy++ {
+				for sx := h * x; sx < h*(x+1); sx++ {
+					sum += src[sy/8*h+sx/8][8*(sy%8)+sx%8]
+				}
+			}
+			dst[8*y+x] = (sum + n/2) / n
+		}
 	}
+}
 
-	// Process all blocks using baseline encoding
-	e.processImageBlocks(m, -1, e.writeBlock)
+// nativeYCbCr returns whether the planes of m can be copied to the blocks of
+// the frame components comp as they are: the components have the chroma
+// subsampling of m, whose top-left corner is on a chroma sample.
+func nativeYCbCr(m *image.YCbCr, comp []encComponent) bool {
+	h, v := subsampleFactors(m.SubsampleRatio)
+	return len(comp) == 3 && comp[0].h == h && comp[0].v == v &&
+		m.Rect.Min.X%h == 0 && m.Rect.Min.Y%v == 0
+}
 
-	// Pad the last byte with 1's.
-	e.emit(0x7f, 7)
+// yCbCrNative stores the MCU of m whose top-left corner is p in dst, for a
+// frame with the chroma subsampling of m, whose luma component has the
+// sampling factors h and v: the h*v luma blocks and the two chroma blocks
+// are copied from the planes of m.
+func yCbCrNative(m *image.YCbCr, p image.Point, h, v int, dst []block) {
+	b := m.Rect
+	x, y := p.X-b.Min.X, p.Y-b.Min.Y
+	for i := 0; i < h*v; i++ {
+		planeToBlock(m.Y, m.YStride, b.Dx(), b.Dy(), x+8*(i%h), y+8*(i/h), &dst[i])
+	}
+	cw, ch := (b.Dx()+h-1)/h, (b.Dy()+v-1)/v
+	planeToBlock(m.Cb, m.CStride, cw, ch, x/h, y/v, &dst[h*v])
+	planeToBlock(m.Cr, m.CStride, cw, ch, x/h, y/v, &dst[h*v+1])
+}
+
+// planeToBlock stores the 8x8 region whose top-left corner is (x, y) of a
+// plane of w x h samples in dst, repeating the last column and row of the
+// plane as needed.
+func planeToBlock(pix []uint8, stride, w, h, x, y int, dst *block) {
+	for j := 0; j < 8; j++ {
+		row := pix[min(y+j, h-1)*stride:]
+		for i := 0; i < 8; i++ {
+			dst[8*j+i] = int32(row[min(x+i, w-1)])
+		}
+	}
 }
 
-// blockProcessor defines a function that processes a block of DCT coefficients.
-// It receives the block, quantization index, previous DC value, and returns the new DC value.
-type blockProcessor func(b *block, q quantIndex, prevDC int32) int32
+// blocksPerMCU returns the number of blocks in an interleaved MCU.
+func (e *encoder) blocksPerMCU() int {
+	n := 0
+	for _, c := range e.comp {
+		n += c.h * c.v
+	}
+	return n
+}
 
-// processImageBlocks iterates over image blocks and calls the processor function for each block.
-// This function consolidates the common block iteration logic used by both baseline and progressive encoding.
-func (e *encoder) processImageBlocks(m image.Image, component int, processor blockProcessor) {
+// mcuBuffer returns a scratch buffer large enough to hold the blocks of an
+// interleaved MCU.
+func (e *encoder) mcuBuffer() []block {
+	n := e.blocksPerMCU()
+	if cap(e.mcu) < n {
+		e.mcu = make([]block, n)
+	}
+	return e.mcu[:n]
+}
+
+// mcuOrigin returns the top-left corner, in m's coordinate space, of the MCU
+// at column mx and row my.
+func (e *encoder) mcuOrigin(m image.Image, mx, my int) image.Point {
+	hmax, vmax := e.maxSampling()
+	min := m.Bounds().Min
+	return image.Pt(min.X+8*hmax*mx, min.Y+8*vmax*my)
+}
+
+// writeSOSHeader writes the Start Of Scan marker for a scan of the given
+// components, coding the zig-zag coefficients zigStart to zigEnd. ah and al
+// are the successive approximation bit positions. Section B.2.3 of the spec
+// says that for sequential DCTs, those last four values should be 0, 63, 0
+// and 0.
+func (e *encoder) writeSOSHeader(comps []int, zigStart, zigEnd, ah, al int) {
+	if e.session != nil {
+		e.recordScan(comps, zigStart, zigEnd, ah, al)
+	}
+	e.writeMarkerHeader(sosMarker, 6+2*len(comps))
+	e.writeByte(uint8(len(comps)))
+	for _, c := range comps {
+		// Component c uses DC table q and AC table q, unless the scan
+		// selects other tables.
+		q := uint8(e.comp[c].q)
+		e.buf[0] = uint8(c + 1)
+		e.buf[1] = q<<4 | q
+		if e.scanTables {
+			e.buf[1] = e.st.sel[q]
+		}
+		e.write(e.buf[:2])
+	}
+	e.buf[0] = uint8(zigStart)
+	e.buf[1] = uint8(zigEnd)
+	e.buf[2] = uint8(ah<<4 | al&0x0f)
+	e.write(e.buf[:3])
+}
+
+// componentIndexes holds the indexes of every possible component, so that
+// scans can refer to a range of components without allocating.
+var componentIndexes [maxFrameComponents]int
+
+func init() {
+	for i := range componentIndexes {
+		componentIndexes[i] = i
+	}
+}
+
+// allComponents returns the indexes of all of the frame's components.
+func (e *encoder) allComponents() []int {
+	return componentIndexes[:len(e.comp)]
+}
+
+// writeSOS writes the StartOfScan marker and the image data of a baseline
+// image, which is a single interleaved scan of all of the coefficients.
+func (e *encoder) writeSOS(m image.Image) {
+	e.writeSOSHeader(e.allComponents(), 0, blockSize-1, 0, 0)
 	var (
-		// Scratch buffers to hold the YCbCr values.
-		// The blocks are in natural (not zig-zag) order.
-		b      block
-		cb, cr [4]block
+		// Scratch buffer to hold the MCU's blocks.
+		mcu = e.mcuBuffer()
 		// DC components are delta-encoded.
-		prevDCY, prevDCCb, prevDCCr int32
+		prevDC [maxComponents]int32
 	)
-	bounds := m.Bounds()
+	for my := 0; my < e.myy; my++ {
+		for mx := 0; mx < e.mxx; mx++ {
+			e.writeMCU(m, mx, my, mcu, &prevDC)
+		}
+	}
+	// Pad the last byte with 1's.
+	e.padBits()
+}
 
-	switch m := m.(type) {
-	case *image.Gray:
-		for y := bounds.Min.Y; y < bounds.Max.Y; y += 8 {
-			for x := bounds.Min.X; x < bounds.Max.X; x += 8 {
-				p := image.Pt(x, y)
-				grayToY(m, p, &b)
-				prevDCY = processor(&b, 0, prevDCY)
+// writeMCU transforms, quantizes and writes the MCU (mx, my) of a baseline
+// image, using mcu as scratch space. prevDC holds the DC values of the
+// previous blocks of each component, for delta-encoding.
+func (e *encoder) writeMCU(m image.Image, mx, my int, mcu []block, prevDC *[maxComponents]int32) {
+	e.readMCU(m, e.mcuOrigin(m, mx, my), mcu)
+	coarse := e.mcuQuant(mx, my)
+	var steps [nQuantIndex][blockSize]byte
+	i := 0
+	for c, comp := range e.comp {
+		for j := 0; j < comp.h*comp.v; j++ {
+			q := e.blockSteps(&steps, c, mx*comp.h+j%comp.h, my*comp.v+j/comp.h, coarse)
+			e.fdctQuantize(&mcu[i], comp.q, q, e.blockID(mx, my, i))
+			if e.alloc != nil || e.bands != nil {
+				prevDC[c] = e.writeMeasuredBlock(c, mx*comp.h+j%comp.h, my*comp.v+j/comp.h, &mcu[i], comp.q, prevDC[c], 0, blockSize-1)
+			} else {
+				prevDC[c] = e.writeBlock(&mcu[i], comp.q, prevDC[c], 0, blockSize-1)
 			}
+			i++
 		}
-	default:
-		rgba, _ := m.(*image.RGBA)
-		ycbcr, _ := m.(*image.YCbCr)
-
-		if component != 0 {
-			// Process color image with potential component filtering
-			for y := bounds.Min.Y; y < bounds.Max.Y; y += 16 {
-				for x := bounds.Min.X; x < bounds.Max.X; x += 16 {
-					for i := 0; i < 4; i++ {
-						xOff := (i & 1) * 8 // 0 8 0 8
-						yOff := (i & 2) * 4 // 0 0 8 8
-						p := image.Pt(x+xOff, y+yOff)
-						if rgba != nil {
-							rgbaToYCbCr(rgba, p, &b, &cb[i], &cr[i])
-						} else if ycbcr != nil {
-							yCbCrToYCbCr(ycbcr, p, &b, &cb[i], &cr[i])
-						} else {
-							toYCbCr(m, p, &b, &cb[i], &cr[i])
-						}
-						if component == -1 || component == 0 {
-							prevDCY = processor(&b, 0, prevDCY)
-						}
-					}
-					if component == -1 || component == 1 {
-						scale(&b, &cb)
-						prevDCCb = processor(&b, 1, prevDCCb)
-					}
-					if component == -1 || component == 2 {
-						scale(&b, &cr)
-						prevDCCr = processor(&b, 1, prevDCCr)
-					}
-				}
-			}
+	}
+}
+
+// computeCoefficients transforms and quantizes every block of m, storing the
+// results in e.coeffs.
+func (e *encoder) computeCoefficients(m image.Image) {
+	e.allocCoefficients()
+	mcu := e.mcuBuffer()
+	for my := 0; my < e.myy; my++ {
+		e.computeMCURow(m, my, mcu)
+	}
+}
+
+// allocCoefficients sizes e.coeffs for the frame layout, reusing the
+// existing blocks if possible.
+func (e *encoder) allocCoefficients() {
+	e.allocStripe(0, e.myy)
+}
+
+// allocStripe sizes e.coeffs to hold the blocks of the MCU rows my0 to
+// my1-1, reusing the existing blocks if possible.
+func (e *encoder) allocStripe(my0, my1 int) {
+	if len(e.coeffs) < len(e.comp) {
+		e.coeffs = append(e.coeffs, make([]coeffPlane, len(e.comp)-len(e.coeffs))...)
+	}
+	for c, comp := range e.comp {
+		p := &e.coeffs[c]
+		p.bw, p.bh, p.y0 = e.mxx*comp.h, (my1-my0)*comp.v, my0*comp.v
+		if n := p.bw * p.bh; cap(p.blocks) >= n {
+			p.blocks = p.blocks[:n]
 		} else {
-			// Y component only processing
-			for y := bounds.Min.Y; y < bounds.Max.Y; y += 8 {
-				for x := bounds.Min.X; x < bounds.Max.X; x += 8 {
-					p := image.Pt(x, y)
-					if rgba != nil {
-						rgbaToYCbCr(rgba, p, &b, &cb[0], &cr[0])
-					} else if ycbcr != nil {
-						yCbCrToYCbCr(ycbcr, p, &b, &cb[0], &cr[0])
-					} else {
-						toYCbCr(m, p, &b, &cb[0], &cr[0])
-					}
-					prevDCY = processor(&b, 0, prevDCY)
-				}
+			p.blocks = make([]block, n)
+		}
+	}
+}
+
+// computeMCURow transforms and quantizes the blocks of the MCU row my of m,
+// storing the results in e.coeffs. mcu is a scratch buffer.
+func (e *encoder) computeMCURow(m image.Image, my int, mcu []block) {
+	var steps [nQuantIndex][blockSize]byte
+	for mx := 0; mx < e.mxx; mx++ {
+		e.readMCU(m, e.mcuOrigin(m, mx, my), mcu)
+		coarse := e.mcuQuant(mx, my)
+		i := 0
+		for c, comp := range e.comp {
+			for j := 0; j < comp.h*comp.v; j++ {
+				bx, by := mx*comp.h+j%comp.h, my*comp.v+j/comp.h
+				b := e.coeffs[c].at(bx, by)
+				*b = mcu[i]
+				q := e.blockSteps(&steps, c, bx, by, coarse)
+				e.fdctQuantize(b, comp.q, q, e.blockID(mx, my, i))
+				i++
 			}
 		}
 	}
@@ -608,19 +1104,46 @@ const DefaultQuality = 75
 type ProgressiveScan struct {
 	// Component specifies which color component to encode:
 	// -1 = all components (DC scan), 0 = Y (luminance), 1 = Cb, 2 = Cr
-	Component int
+	Component int `json:"component" yaml:"component"`
+
+	// Components, if non-nil, restricts a DC scan of Component -1 to the
+	// listed components, in increasing order, such as 1 and 2 for a DC scan
+	// of Cb and Cr.
+	Components []int `json:"components,omitempty" yaml:"components,omitempty"`
 
 	// SpectralStart and SpectralEnd define the range of DCT coefficients (0-63)
 	// 0,0 = DC only, 1,5 = low frequency AC, 6,63 = high frequency AC
-	SpectralStart, SpectralEnd int
+	SpectralStart int `json:"spectralStart" yaml:"spectralStart"`
+	SpectralEnd   int `json:"spectralEnd" yaml:"spectralEnd"`
 
 	// SuccessiveApproxHigh and SuccessiveApproxLow control bit-plane refinement
 	// For spectral selection only: both should be 0
-	// For successive approximation: ah=starting bit position, al=ending bit position
-	SuccessiveApproxHigh, SuccessiveApproxLow int
+	// For a first scan: ah=0, al=the lowest bit sent
+	// For a refinement scan: ah=the previous al, al=ah-1
+	SuccessiveApproxHigh int `json:"successiveApproxHigh,omitempty" yaml:"successiveApproxHigh,omitempty"`
+	SuccessiveApproxLow  int `json:"successiveApproxLow,omitempty" yaml:"successiveApproxLow,omitempty"`
+
+	// DCTable and ACTable select the Huffman tables of the scan's DC and AC
+	// coefficients. The zero value, HuffmanDefault, uses the tables of each
+	// component: luminance for Y, chrominance for Cb and Cr.
+	DCTable HuffmanTable `json:"dcTable,omitempty" yaml:"dcTable,omitempty"`
+	ACTable HuffmanTable `json:"acTable,omitempty" yaml:"acTable,omitempty"`
+
+	// RestartInterval, if non-zero, inserts a restart marker every
+	// RestartInterval MCUs of the scan, so that a decoder can resynchronize
+	// after corrupted data, at the cost of a few bytes per interval. The
+	// MCU of a single-component scan is one block. A DRI marker is written
+	// before each scan whose interval differs from the previous scan's.
+	// Go's image/jpeg counts the restart intervals of single-component
+	// scans in MCUs of the frame instead, and fails to decode the scans of
+	// subsampled luma with restart markers; it does decode restart markers
+	// in the DC scan of all components and in chroma scans.
+	RestartInterval int `json:"restartInterval,omitempty" yaml:"restartInterval,omitempty"`
 }
 
-// ScanScript defines a complete progressive scan sequence.
+// ScanScript defines a complete progressive scan sequence. Scan scripts
+// marshal to and from JSON as an array of scans; see
+// [ScanScript.UnmarshalJSON].
 type ScanScript []ProgressiveScan
 
 // Options are the encoding parameters.
@@ -633,31 +1156,217 @@ type Options struct {
 	// If nil, default scan scripts are used based on the image type.
 	// Only used when Progressive is true.
 	ScanScript ScanScript
+
+	// OptimizeScans, if ScanScript is nil, chooses the scan script from the
+	// statistics of the image's DCT coefficients instead of using the
+	// default script. The AC coefficients of each component are split in
+	// two bands, the first being the shortest that carries most of the
+	// component's AC energy, so that the first scans are as small as
+	// possible for a preview of a given quality. Components with little AC
+	// content are sent in a single AC scan. The chosen script is recorded
+	// in the Session, if any.
+	OptimizeScans bool
+
+	// StrictScanScript makes Encode return the error reported by
+	// [ValidateScanScript] for an invalid ScanScript, without writing
+	// anything, instead of silently falling back to the default script.
+	StrictScanScript bool
+
+	// Concurrency is the number of goroutines used to transform and code
+	// the image. Values of 0 and 1 mean that the image is encoded on the
+	// calling goroutine. With higher values, baseline images are coded as
+	// one restart interval per MCU row, which lets the rows be coded in
+	// parallel at the cost of a few bytes per row, and progressive images
+	// compute their DCT coefficients in parallel. The output only depends on
+	// whether Concurrency is greater than 1, not on its exact value.
+	Concurrency int
+	// Deterministic guarantees that encoding the same image with the same
+	// options writes the same bytes, on every run and machine, for a given
+	// version of this package, as content-addressed storage and CDNs that
+	// deduplicate files need. The encoder does not use timing, randomness
+	// or map order, and its dithering noise is seeded by block positions;
+	// Deterministic also ignores Concurrency, so that the output does not
+	// depend on whether the encoder runs in parallel. BlockQuant and the
+	// converters registered with RegisterColorConverter must be
+	// deterministic too.
+	Deterministic bool
+	// MaxCoefficientMemory, if positive, is the maximum number of bytes of
+	// DCT coefficients that a progressive image keeps in memory. Each 8x8
+	// block takes 256 bytes, so that a 4:2:0 image needs 6 bytes per
+	// pixel. Larger images are transformed in stripes of MCU rows that fit
+	// in the limit, or one row if none does, and the entropy-coded data of
+	// every scan is buffered in memory, where it takes about as much as the
+	// output file, until the last stripe is coded. The output is the same,
+	// but OptimizeScans and optimized Huffman tables each cost an extra pass
+	// over the pixels, and Concurrency is ignored.
+	MaxCoefficientMemory int64
+	// Regions and QualityMask give parts of the image a different quality,
+	// such as a higher quality for faces than for the background. The
+	// quality of each MCU (a 16x16 block of pixels for color images, 8x8
+	// for grayscale ones) is the highest of Quality, of the regions that
+	// overlap it, and of the non-zero values of the mask, which are
+	// qualities, within it. A baseline JPEG only holds one set of
+	// quantization tables, so the tables of the highest quality are used
+	// and the other MCUs are quantized more coarsely to match their quality.
+	Regions     []QualityRegion
+	QualityMask *image.Gray
+
+	// Smoothing, from 1 to 100, lightly blurs the image before it is
+	// transformed, like libjpeg's smoothing_factor. It suppresses dithering
+	// noise, such as that of images converted from GIF, and improves the
+	// compression of noisy scans. Values of 0 or less disable smoothing.
+	Smoothing int
+
+	// Session, if non-nil, is overwritten with a record of the encoder's
+	// decisions. See [Replay].
+	Session *Session
+
+	// Grayscale encodes color images as a single-component JPEG of their
+	// luminance, without converting them to *image.Gray first. It is
+	// ignored for *Multiplane images.
+	Grayscale bool
+
+	// Thumbnail, if positive, embeds in an Exif APP1 segment a baseline
+	// JPEG thumbnail of the image that fits in a Thumbnail x Thumbnail
+	// square, so that file managers can show a preview without decoding
+	// the whole image. The Exif standard suggests 160 for a 160x120
+	// thumbnail. It is ignored for *Multiplane images.
+	Thumbnail int
+
+	// OmitTables writes an abbreviated image-only datastream, without the
+	// quantization and Huffman tables, for decoders that have already read
+	// them from the tables-only datastream written by [WriteTables] with
+	// the same Quality, such as the frames of an MJPEG stream after the
+	// first one. It cannot be used with Regions or QualityMask, which
+	// change the tables.
+	OmitTables bool
+
+	// Downsampler, if non-nil, replaces the built-in 2x2 box filter used to
+	// subsample the chroma planes of color images. It is not used for
+	// *image.YCbCr images that are already 4:2:0 subsampled; other
+	// *image.YCbCr images are downsampled to 4:2:0 instead of keeping their
+	// own subsampling.
+	Downsampler Downsampler
+
+	// ColorMatrix, if non-nil, replaces the BT.601 matrix used to convert
+	// RGB colors to YCbCr, such as with [BT709] for stills taken from HD
+	// video. It does not apply to *image.YCbCr and *image.Gray images,
+	// whose values are encoded as they are.
+	ColorMatrix *ColorMatrix
+
+	// RGB encodes color images as their R, G and B components, without
+	// converting them to YCbCr nor subsampling them, and with an Adobe
+	// APP14 segment that tells decoders so. Some print and prepress
+	// workflows require such files, which are about twice as large. It is
+	// ignored for grayscale output and for *Multiplane images.
+	RGB bool
+
+	// ChromaCoefficients, if in [1, 63], is the number of coefficients, in
+	// zig-zag order, kept in the blocks of the chroma components: the
+	// higher frequencies are zeroed during quantization, as aggressive web
+	// encoders do, for little visible change on photos. 1 only keeps the DC
+	// coefficient, and 0 keeps all of them.
+	ChromaCoefficients int
+
+	// Dither, if positive, dithers the quantization of smooth blocks, so
+	// that the gradients of skies and vignettes do not turn into hard
+	// bands at low qualities: the DC and lowest AC coefficients of blocks
+	// with no detail get a pseudo-random noise of up to Dither percent of a
+	// quantization step, 100 at most, before they are rounded. The noise
+	// is deterministic: the same image and options give the same file.
+	Dither int
+
+	// BlockQuant, if non-nil, is called for every block of the image with
+	// its column and row, counted in blocks of its component, its
+	// component index, and its quantization steps, in zig-zag order. It may
+	// raise the steps of the block, to quantize it more coarsely, such as
+	// from a saliency map; steps lower than those of the file's tables are
+	// raised to them, since decoders dequantize every block with the
+	// tables. It is called concurrently if Concurrency is used, and is not
+	// recorded by a Session.
+	BlockQuant func(bx, by, comp int, q *[64]byte)
+
+	// ICCProfile, if not empty, is an ICC color profile written in APP2
+	// "ICC_PROFILE" segments, such as the Metadata.ICC of a decoded image,
+	// so that color-managed applications display the image as intended.
+	ICCProfile []byte
+
+	// QuantTables, if not empty, replaces the quantization tables computed
+	// from Quality with one or two tables in zig-zag order, as written in
+	// a DQT marker: the first for luminance, and the second, or the first
+	// again, for chrominance. Re-encoding a decoded JPEG image with the
+	// Metadata.QuantTables of the original quantizes most coefficients
+	// back to the same values, instead of adding the artifacts of another
+	// grid of steps. It cannot be used with Regions or QualityMask.
+	QuantTables [][blockSize]uint8
+
+	// BitAllocation, if non-nil, is overwritten with the number of bits
+	// that each 8x8 block of the image takes, to see where the bytes go
+	// and to tune Regions or BlockQuant. It is not recorded by a Session.
+	BitAllocation *BitAllocation
+
+	// BandBits, if non-nil, is overwritten with the number of bits that
+	// each spectral band of each component takes. It is not recorded by a
+	// Session.
+	BandBits *BandBits
 }
 
 // Encode writes the Image m to w in JPEG 4:2:0 baseline format with the given
 // options. Default parameters are used if a nil *[Options] is passed.
+// *image.YCbCr images keep their own chroma subsampling, such as 4:4:4 or
+// 4:2:2, and *image.CMYK images are written as Adobe CMYK files, which
+// decode to an *image.CMYK.
 func Encode(w io.Writer, m image.Image, o *Options) error {
-	b := m.Bounds()
-	if b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
-		return errors.New("jpeg: image is too large to encode")
-	}
 	var e encoder
 	if ww, ok := w.(writer); ok {
 		e.w = ww
 	} else {
 		e.w = bufio.NewWriter(w)
 	}
-	// Clip quality to [1, 100].
-	quality := DefaultQuality
-	if o != nil {
-		quality = o.Quality
-		if quality < 1 {
-			quality = 1
-		} else if quality > 100 {
-			quality = 100
-		}
+	return e.encode(m, o)
+}
+
+// concurrency returns the number of goroutines that encode with o, or 0 if
+// the image is encoded on the calling goroutine.
+func (o *Options) concurrency() int {
+	if o == nil || o.Deterministic {
+		return 0
+	}
+	return o.Concurrency
+}
+
+// setQuantOptions sets e.chromaCut, e.dither and e.blockQuant up for the
+// ChromaCoefficients, Dither and BlockQuant options of o.
+func (e *encoder) setQuantOptions(o *Options) {
+	e.chromaCut, e.dither, e.blockQuant = 0, 0, nil
+	if o == nil {
+		return
+	}
+	e.blockQuant = o.BlockQuant
+	if o.ChromaCoefficients > 0 && o.ChromaCoefficients < blockSize {
+		e.chromaCut = o.ChromaCoefficients
+	}
+	e.dither = min(max(o.Dither, 0), 100)
+}
+
+// setQuality initializes the quantization tables for the given quality,
+// clipped to [1, 100].
+func (e *encoder) setQuality(quality int) {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
 	}
+	if quality == e.quality {
+		return
+	}
+	e.quality = quality
+	quantTables(&e.quant, quality)
+}
+
+// quantTables scales the standard quantization tables for the given quality,
+// in [1, 100], storing the results in t.
+func quantTables(t *[nQuantIndex][blockSize]byte, quality int) {
 	// Convert from a quality rating to a scaling factor.
 	var scale int
 	if quality < 50 {
@@ -666,8 +1375,8 @@ func Encode(w io.Writer, m image.Image, o *Options) error {
 		scale = 200 - quality*2
 	}
 	// Initialize the quantization tables.
-	for i := range e.quant {
-		for j := range e.quant[i] {
+	for i := range t {
+		for j := range t[i] {
 			x := int(unscaledQuant[i][j])
 			x = (x*scale + 50) / 100
 			if x < 1 {
@@ -675,40 +1384,202 @@ func Encode(w io.Writer, m image.Image, o *Options) error {
 			} else if x > 255 {
 				x = 255
 			}
-			e.quant[i][j] = uint8(x)
+			t[i][j] = uint8(x)
 		}
 	}
-	// Compute number of components based on input image type.
-	nComponent := 3
-	switch m.(type) {
-	// TODO(wathiede): switch on m.ColorModel() instead of type.
-	case *image.Gray:
-		nComponent = 1
+}
+
+// encode writes m to e.w with the given options.
+func (e *encoder) encode(m image.Image, o *Options) error {
+	m, err := e.setup(m, o)
+	if err != nil {
+		return err
+	}
+	e.written = 0
+	e.ri = 0
+	e.session = nil
+	if o != nil && o.Session != nil {
+		e.session = o.Session
+		e.startSession(o)
 	}
 	// Write the Start Of Image marker.
 	e.buf[0] = 0xff
 	e.buf[1] = 0xd8
 	e.write(e.buf[:2])
+	if e.avi {
+		e.writeAVI1()
+	}
+	if e.rgb || e.cmyk {
+		e.writeAdobe()
+	}
+	if o != nil && len(o.ICCProfile) > 0 {
+		e.writeICC(o.ICCProfile)
+	}
+	if o != nil && o.Thumbnail > 0 && len(e.comp) <= 3 {
+		e.writeThumbnail(m, o.Thumbnail)
+	}
 	// Write the quantization tables.
-	e.writeDQT()
+	tables := o == nil || !o.OmitTables
+	if tables {
+		e.writeDQT()
+	}
 	if o != nil && o.Progressive {
-		e.writeProgressive(m, b, nComponent, o)
+		e.writeProgressive(m, o)
 	} else {
 		// Write the image dimensions.
-		e.writeSOF(b.Size(), nComponent, sof0Marker)
+		e.writeSOF(sof0Marker)
 		// Write the Huffman tables.
-		e.writeDHT(nComponent)
+		if tables && !e.avi {
+			e.writeDHT()
+		}
 		// Write the image data.
-		e.writeSOS(m)
+		if len(e.comp) > maxComponents {
+			e.writeSOSChunked(m)
+		} else if n := o.concurrency(); n > 1 {
+			e.writeSOSParallel(m, n)
+		} else {
+			e.writeSOS(m)
+		}
 	}
 	// Write the End Of Image marker.
 	e.buf[0] = 0xff
 	e.buf[1] = 0xd9
 	e.write(e.buf[:2])
+	if e.session != nil {
+		e.endSession()
+	}
 	e.flush()
 	return e.err
 }
 
+// setup sets e up to encode m with the given options: the frame layout, the
+// quantization tables and the options that apply to the coefficients. It
+// returns the image to transform, which the Smoothing and Downsampler
+// options replace.
+func (e *encoder) setup(m image.Image, o *Options) (image.Image, error) {
+	b := m.Bounds()
+	if b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return nil, errors.New("jpeg: image is too large to encode")
+	}
+	quality := DefaultQuality
+	if o != nil {
+		quality = o.Quality
+	}
+	e.setQuality(quality)
+	// Compute the frame layout based on input image type.
+	comp, err := frameComponents(m, o != nil && o.Grayscale)
+	if err != nil {
+		return nil, err
+	}
+	e.rgb = o != nil && rgbFrame(m, o.Grayscale, o.RGB)
+	if e.rgb {
+		comp = rgbComponents
+	}
+	_, cmyk := m.(*image.CMYK)
+	e.cmyk = cmyk && len(comp) == len(cmykComponents)
+	// A progressive frame has at most 4 components (section B.2.2).
+	if o != nil && o.Progressive && len(comp) > maxComponents {
+		return nil, fmt.Errorf("jpeg: cannot encode %d components as a progressive image (must be at most %d)", len(comp), maxComponents)
+	}
+	if o != nil && o.Progressive && o.StrictScanScript && o.ScanScript != nil {
+		if err := ValidateScanScript(o.ScanScript, len(comp)); err != nil {
+			return nil, err
+		}
+	}
+	if o != nil && o.OmitTables && (len(o.Regions) > 0 || o.QualityMask != nil) {
+		return nil, errors.New("jpeg: OmitTables cannot be used with quality regions")
+	}
+	if o != nil && len(o.QuantTables) > 0 {
+		if len(o.Regions) > 0 || o.QualityMask != nil {
+			return nil, errors.New("jpeg: QuantTables cannot be used with quality regions")
+		}
+		if err := checkQuantTables(o.QuantTables); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.setColorMatrix(o); err != nil {
+		return nil, err
+	}
+	e.setQuantOptions(o)
+	if o != nil && o.Smoothing > 0 {
+		if e.rgb {
+			m = rgbPlanes(m)
+		}
+		m = smoothImage(m, min(o.Smoothing, 100), e.cm)
+	}
+	if o != nil && o.Downsampler != nil && len(comp) == 3 && !e.rgb {
+		if ycc, ok := m.(*image.YCbCr); !ok || ycc.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+			m = downsampleYCbCr(m, o.Downsampler, e.cm)
+		}
+		comp = ycbcrComponents
+	}
+	e.init(b.Size(), comp)
+	e.bands = nil
+	if o != nil {
+		e.startBitAllocation(o.BitAllocation)
+		if o.BandBits != nil {
+			e.bands = o.BandBits
+			e.bands.Components = make([][NumBands]int64, len(e.comp))
+		}
+	} else {
+		e.startBitAllocation(nil)
+	}
+	if o != nil && (len(o.Regions) > 0 || o.QualityMask != nil) {
+		e.setRegions(b, o, quality)
+	} else {
+		e.roi = nil
+	}
+	if o != nil && len(o.QuantTables) > 0 {
+		// The tables do not come from a quality, so the next image must
+		// compute its own.
+		for i := range e.quant {
+			e.quant[i] = o.QuantTables[min(i, len(o.QuantTables)-1)]
+		}
+		e.quality = 0
+	}
+	if e.replayQuant != nil {
+		e.quant, e.quality = *e.replayQuant, 0
+	}
+	return m, nil
+}
+
+// frameComponents returns the frame layout used to encode m. If grayscale is
+// true, color images are encoded as their luminance only. *image.YCbCr
+// images keep their chroma subsampling, *image.CMYK images have four full
+// resolution components, and other color images are subsampled to 4:2:0.
+func frameComponents(m image.Image, grayscale bool) ([]encComponent, error) {
+	switch m := m.(type) {
+	// TODO(wathiede): switch on m.ColorModel() instead of type.
+	case *image.Gray:
+		return grayComponents, nil
+	case *Multiplane:
+		return multiplaneComponents(m)
+	case *image.CMYK:
+		if !grayscale {
+			return cmykComponents, nil
+		}
+	case *image.YCbCr:
+		// Keep the chroma resolution of m if its planes can be copied as
+		// they are.
+		h, v := subsampleFactors(m.SubsampleRatio)
+		if !grayscale && m.Rect.Min.X%h == 0 && m.Rect.Min.Y%v == 0 {
+			return []encComponent{
+				{h, v, quantIndexLuminance},
+				{1, 1, quantIndexChrominance},
+				{1, 1, quantIndexChrominance},
+			}, nil
+		}
+	case *rowImage:
+		if m.gray {
+			return grayComponents, nil
+		}
+	}
+	if grayscale {
+		return grayComponents, nil
+	}
+	return ycbcrComponents, nil
+}
+
 // DefaultGrayscaleScanScript returns the default progressive scan script for grayscale images.
 func DefaultGrayscaleScanScript() ScanScript {
 	return ScanScript{
@@ -742,8 +1613,23 @@ func DefaultColorScanScript() ScanScript {
 	}
 }
 
-// validateScanScript checks if a scan script is valid for JPEG encoding.
-func validateScanScript(script ScanScript, nComponent int) error {
+// defaultScanScript returns the default progressive scan script for an image
+// with nComponent components.
+func defaultScanScript(nComponent int) ScanScript {
+	switch nComponent {
+	case 1:
+		return DefaultGrayscaleScanScript()
+	case 3:
+		return DefaultColorScanScript()
+	}
+	return multiplaneScanScript(nComponent)
+}
+
+// ValidateScanScript checks if a scan script is valid for encoding an image
+// with nComponent components: 1 for grayscale images, 3 for color images, and
+// the number of planes for [Multiplane] images. It returns an error
+// describing the first invalid scan, if any.
+func ValidateScanScript(script ScanScript, nComponent int) error {
 	if len(script) == 0 {
 		return errors.New("jpeg: scan script cannot be empty")
 	}
@@ -753,6 +1639,9 @@ func validateScanScript(script ScanScript, nComponent int) error {
 		if scan.Component < -1 || scan.Component >= nComponent {
 			return fmt.Errorf("jpeg: scan %d has invalid component %d (must be -1 to %d)", i, scan.Component, nComponent-1)
 		}
+		if scan.Component == -1 && nComponent > maxComponents {
+			return fmt.Errorf("jpeg: scan %d cannot have component -1 (a scan has at most %d components)", i, maxComponents)
+		}
 
 		// Validate spectral selection
 		if scan.SpectralStart < 0 || scan.SpectralStart > 63 {
@@ -769,8 +1658,25 @@ func validateScanScript(script ScanScript, nComponent int) error {
 		if scan.SuccessiveApproxLow < 0 || scan.SuccessiveApproxLow > 13 {
 			return fmt.Errorf("jpeg: scan %d has invalid successive approximation low %d (must be 0-13)", i, scan.SuccessiveApproxLow)
 		}
-		if scan.SuccessiveApproxLow > scan.SuccessiveApproxHigh {
-			return fmt.Errorf("jpeg: scan %d has successive approximation low > high (%d > %d)", i, scan.SuccessiveApproxLow, scan.SuccessiveApproxHigh)
+		// A first scan may send the coefficients from any bit, and a
+		// refinement scan sends exactly one more bit of them.
+		if ah, al := scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow; ah != 0 && al != ah-1 {
+			return fmt.Errorf("jpeg: refinement scan %d has successive approximation %d-%d (must refine one bit)", i, ah, al)
+		}
+
+		// Validate Huffman table selection
+		if err := scan.validateTables(i); err != nil {
+			return err
+		}
+
+		// Validate restart interval
+		if scan.RestartInterval < 0 || scan.RestartInterval > 0xffff {
+			return fmt.Errorf("jpeg: scan %d has invalid restart interval %d (must be 0-65535)", i, scan.RestartInterval)
+		}
+
+		// Validate the components of a partial DC scan
+		if err := scan.validateComponents(i, nComponent); err != nil {
+			return err
 		}
 
 		// Validate DC scan constraints
@@ -790,126 +1696,235 @@ func validateScanScript(script ScanScript, nComponent int) error {
 	return nil
 }
 
+// validateComponents checks the Components of the scan i of a script for
+// an image with nComponent components.
+func (s ProgressiveScan) validateComponents(i, nComponent int) error {
+	if s.Components == nil {
+		return nil
+	}
+	if s.Component != -1 {
+		return fmt.Errorf("jpeg: scan %d lists components but has component %d (must be -1)", i, s.Component)
+	}
+	if len(s.Components) == 0 || len(s.Components) > maxComponents {
+		return fmt.Errorf("jpeg: scan %d lists %d components (must be 1 to %d)", i, len(s.Components), maxComponents)
+	}
+	for j, c := range s.Components {
+		if c < 0 || c >= nComponent || j > 0 && c <= s.Components[j-1] {
+			return fmt.Errorf("jpeg: scan %d has invalid components %v (must be increasing within 0-%d)", i, s.Components, nComponent-1)
+		}
+	}
+	return nil
+}
+
+// components returns the indexes of the components of the scan, in an
+// image with nComponent components.
+func (s ProgressiveScan) components(nComponent int) []int {
+	switch {
+	case s.Component != -1:
+		return componentIndexes[s.Component : s.Component+1]
+	case s.Components != nil:
+		return s.Components
+	}
+	return componentIndexes[:nComponent]
+}
+
 // writeProgressive encodes the image using progressive JPEG format.
 // Progressive JPEG allows the image to be displayed incrementally as it loads.
-func (e *encoder) writeProgressive(m image.Image, b image.Rectangle, nComponent int, o *Options) {
+func (e *encoder) writeProgressive(m image.Image, o *Options) {
 	// Write the image dimensions.
-	e.writeSOF(b.Size(), nComponent, sof2Marker)
+	e.writeSOF(sof2Marker)
 	// Write the Huffman tables.
-	e.writeDHT(nComponent)
+	if !o.OmitTables && !e.avi {
+		e.writeDHT()
+	}
+
+	if rows := e.stripeRows(o); rows < e.myy {
+		e.writeProgressiveStripes(m, o, rows)
+		return
+	}
+
+	// Transform and quantize the image once. Every scan is then
+	// entropy-coded from the same coefficients.
+	if n := o.concurrency(); n > 1 {
+		e.computeCoefficientsParallel(m, n)
+	} else {
+		e.computeCoefficients(m)
+	}
+	e.writeScanScript(o)
+}
 
+// writeScanScript writes the scans of a progressive image, following the
+// scan script selected by o, from the coefficients in e.coeffs.
+func (e *encoder) writeScanScript(o *Options) {
+	script := e.scanScript(o, func() []autoStats {
+		stats := make([]autoStats, len(e.comp))
+		e.addAutoStats(stats)
+		return stats
+	})
+	for _, scan := range script {
+		e.writeProgressiveSOS(scan)
+	}
+}
+
+// scanScript returns the scan script selected by o, recording it in the
+// session, and writes the Huffman tables that its scans need besides those
+// of the frame. stats returns the coefficient statistics of the whole
+// image, which OptimizeScans needs.
+func (e *encoder) scanScript(o *Options, stats func() []autoStats) ScanScript {
+	nComponent := len(e.comp)
 	// Determine which scan script to use
 	var script ScanScript
-	if o != nil && o.ScanScript != nil {
+	switch {
+	case o != nil && o.ScanScript != nil:
 		script = o.ScanScript
-	} else {
-		// Use default scan script based on image type
-		if nComponent == 3 {
-			script = DefaultColorScanScript()
-		} else {
-			script = DefaultGrayscaleScanScript()
-		}
+	case o != nil && o.OptimizeScans:
+		script = e.autoScanScript(stats())
+	default:
+		script = defaultScanScript(nComponent)
 	}
 
 	// Validate the scan script
-	if err := validateScanScript(script, nComponent); err != nil {
+	if err := ValidateScanScript(script, nComponent); err != nil {
 		// If validation fails, fall back to default script
-		if nComponent == 3 {
-			script = DefaultColorScanScript()
-		} else {
-			script = DefaultGrayscaleScanScript()
+		script = defaultScanScript(nComponent)
+		if e.session != nil {
+			e.session.Fallback = err.Error()
 		}
 	}
-
-	// Execute the scan script
-	for _, scan := range script {
-		e.writeProgressiveSOS(m, scan.SpectralStart, scan.SpectralEnd,
-			scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow, scan.Component)
+	if e.session != nil {
+		e.session.ScanScript = script
+	}
+	// Scans of grayscale images that select the chrominance tables need
+	// them to be defined too.
+	if !o.OmitTables && !e.usesChrominance() && usesHuffmanTable(script, HuffmanChrominance) {
+		e.writeHuffmanTables("\x01\x11", theHuffmanSpec[2:])
 	}
+	return script
 }
 
-// writeProgressiveSOS writes a Start Of Scan marker for a progressive scan
-// and processes the image blocks for that scan.
-// zigStart and zigEnd define the range of DCT coefficients to encode.
-// ah and al define the successive approximation bit positions (currently supports only 0).
-// component specifies which color component to encode (-1 for all components).
-func (e *encoder) writeProgressiveSOS(m image.Image, zigStart, zigEnd, ah, al, component int) {
-	if component != -1 {
-		var sosHeaderYShort = []byte{
-			0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00,
-		}
-		sosHeaderYShort[5] = byte(component + 1)
-		if component == 1 || component == 2 {
-			sosHeaderYShort[6] = 0x11
-		} else {
-			sosHeaderYShort[6] = 0x00
-		}
-		e.write(sosHeaderYShort)
-	} else {
-		var sosHeaderYCbCrShort = []byte{
-			0xff, 0xda, 0x00, 0x0c, 0x03, 0x01, 0x00, 0x02,
-			0x11, 0x03, 0x11,
-		}
-		e.write(sosHeaderYCbCrShort)
+// writeProgressiveSOS writes a Start Of Scan marker for a progressive scan,
+// followed by the scan's entropy-coded data, taken from e.coeffs.
+// A scan.Component of -1 means an interleaved scan of all components, or of
+// scan.Components, which is only valid for DC scans.
+func (e *encoder) writeProgressiveSOS(scan ProgressiveScan) {
+	comps := scan.components(len(e.comp))
+	if scan.RestartInterval != e.ri {
+		e.writeDRI(scan.RestartInterval)
 	}
-	refinement := (byte(ah) << 4) | (byte(al) & 0x0F)
+	e.selectScanTables(scan, comps)
+	e.writeCoefficientScan(comps, scan.SpectralStart, scan.SpectralEnd,
+		scan.SuccessiveApproxHigh, scan.SuccessiveApproxLow)
+	e.scanTables = false
+}
 
-	progressiveScript := []byte{byte(zigStart), byte(zigEnd), refinement}
-	e.write(progressiveScript)
+// writeCoefficientScan writes a Start Of Scan marker for a scan of the given
+// components, followed by the scan's entropy-coded data, taken from e.coeffs.
+// The data is split in restart intervals of e.ri MCUs, if e.ri is non-zero.
+func (e *encoder) writeCoefficientScan(comps []int, zigStart, zigEnd, ah, al int) {
+	e.writeSOSHeader(comps, zigStart, zigEnd, ah, al)
+	s := scanRun{comps: comps, zigStart: zigStart, zigEnd: zigEnd, ah: ah, al: al, ri: e.ri}
+	e.codeScanRows(&s, 0, e.myy, nil, nil)
+	// Pad the last byte with 1's, so that each scan ends on a byte boundary.
+	e.padBits()
+}
 
-	// Create a closure that captures the zigzag range for progressive encoding
-	processor := func(b *block, q quantIndex, prevDC int32) int32 {
-		return e.writePartialBlock(b, q, prevDC, zigStart, zigEnd)
-	}
+// A scanRun is the state of the entropy coder of a scan between two MCU
+// rows.
+type scanRun struct {
+	comps            []int
+	zigStart, zigEnd int
+	// ah and al are the successive approximation bit positions of the
+	// scan, and shifted holds the coefficients of a block of a first scan
+	// with a non-zero al, shifted by al bits.
+	ah, al  int
+	shifted block
+	// ri is the restart interval of the scan, n is the number of MCUs coded
+	// in the current restart interval, and rst is the number of RST markers
+	// written.
+	ri, n, rst int
+	prevDC     [maxComponents]int32
+}
 
-	// Process blocks using the shared logic
-	e.processImageBlocks(m, component, processor)
+// newScanRun returns the initial state of the entropy coder of scan, whose
+// components are comps.
+func newScanRun(scan ProgressiveScan, comps []int) scanRun {
+	return scanRun{
+		comps:    comps,
+		zigStart: scan.SpectralStart,
+		zigEnd:   scan.SpectralEnd,
+		ah:       scan.SuccessiveApproxHigh,
+		al:       scan.SuccessiveApproxLow,
+		ri:       scan.RestartInterval,
+	}
+}
 
-	// Pad the last byte with 1's.
-	e.emit(0x7f, 7)
-	// Flush any remaining bits and reset the bit buffer for the next scan.
-	// In progressive mode, each scan must end with a byte-aligned boundary.
-	if e.nBits > 0 {
-		// Pad to byte boundary with 1's. We need to add (8 - nBits) more bits.
-		bitsNeeded := 8 - e.nBits
-		e.emit((1<<bitsNeeded)-1, bitsNeeded)
-	}
-	// Reset the bit buffer for the next scan
-	e.bits = 0
-	e.nBits = 0
-}
-
-// writePartialBlock writes a block of pixel data for a progressive scan,
-// processing only the specified range of DCT coefficients (from ss to se).
-// It returns the post-quantized DC value of the DCT-transformed block.
-// b is in natural (not zig-zag) order.
-func (e *encoder) writePartialBlock(b *block, q quantIndex, prevDC int32, ss, se int) int32 {
-	fdct(b)
-	if ss == 0 && se == 0 {
-		// Emit the DC delta.
-		dc := div(b[0], 8*int32(e.quant[q][0]))
-		e.emitHuffRLE(huffIndex(2*q+0), 0, dc-prevDC)
-		return dc
-	}
-	if ss > 0 {
-		// Emit the AC components.
-		h, runLength := huffIndex(2*q+1), int32(0)
-		for zig := ss; zig <= se; zig++ {
-			ac := div(b[unzig[zig]], 8*int32(e.quant[q][zig]))
-			if ac == 0 {
-				runLength++
-			} else {
-				for runLength > 15 {
-					e.emitHuff(h, 0xf0)
-					runLength -= 16
+// codeScanRows codes the blocks of the scan s that belong to the MCU rows
+// my0 to my1-1, taken from e.coeffs. If dcFreq and acFreq are non-nil, it
+// counts the symbols of the blocks in them instead, without writing
+// anything.
+func (e *encoder) codeScanRows(s *scanRun, my0, my1 int, dcFreq, acFreq *[256]int) {
+	count := dcFreq != nil
+	if len(s.comps) > 1 {
+		// Interleaved scans are coded one MCU at a time.
+		for my := my0; my < my1; my++ {
+			for mx := 0; mx < e.mxx; mx++ {
+				if s.n == s.ri && s.n > 0 {
+					if !count {
+						e.writeRST(s.rst)
+					}
+					s.rst, s.n = s.rst+1, 0
+					s.prevDC = [maxComponents]int32{}
+				}
+				s.n++
+				for k, c := range s.comps {
+					comp := e.comp[c]
+					for j := 0; j < comp.h*comp.v; j++ {
+						e.codeBlock(s, k, c, mx*comp.h+j%comp.h, my*comp.v+j/comp.h, dcFreq, acFreq)
+					}
 				}
-				e.emitHuffRLE(h, runLength, ac)
-				runLength = 0
 			}
 		}
-		if runLength > 0 {
-			e.emitHuff(h, 0x00)
+		return
+	}
+	c := s.comps[0]
+	// Non-interleaved scans are coded one block at a time, left to right
+	// and top to bottom, and skip the blocks that only exist to pad the
+	// last MCUs. See the corresponding comment in processSOS.
+	v := e.comp[c].v
+	bw, bh := e.compBlocks(c)
+	for by := my0 * v; by < min(my1*v, bh); by++ {
+		for bx := 0; bx < bw; bx++ {
+			if s.n == s.ri && s.n > 0 {
+				if !count {
+					e.writeRST(s.rst)
+				}
+				s.rst, s.n, s.prevDC[0] = s.rst+1, 0, 0
+			}
+			s.n++
+			e.codeBlock(s, 0, c, bx, by, dcFreq, acFreq)
 		}
 	}
-	return 0
+}
+
+// codeBlock codes the block (bx, by) of the component c, the k-th
+// component of the scan s, taken from e.coeffs, or counts its symbols in
+// dcFreq and acFreq if they are non-nil.
+func (e *encoder) codeBlock(s *scanRun, k, c, bx, by int, dcFreq, acFreq *[256]int) {
+	b, q := e.coeffs[c].at(bx, by), e.comp[c].q
+	if s.ah > 0 {
+		e.refineBlock(s, c, bx, by, b, q, dcFreq != nil, acFreq)
+		return
+	}
+	if s.al > 0 {
+		shiftBlock(&s.shifted, b, s.al)
+		b = &s.shifted
+	}
+	switch {
+	case dcFreq != nil:
+		s.prevDC[k] = countBlock(b, s.prevDC[k], s.zigStart, s.zigEnd, dcFreq, acFreq)
+	case e.alloc != nil || e.bands != nil:
+		s.prevDC[k] = e.writeMeasuredBlock(c, bx, by, b, q, s.prevDC[k], s.zigStart, s.zigEnd)
+	default:
+		s.prevDC[k] = e.writeBlock(b, q, s.prevDC[k], s.zigStart, s.zigEnd)
+	}
 }
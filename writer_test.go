@@ -15,6 +15,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/dlecorfec/progjpeg/testimg"
 )
 
 // zigzag maps from the natural ordering to the zig-zag ordering. For example,
@@ -241,15 +243,123 @@ func TestEncodeYCbCr(t *testing.T) {
 		}
 	}
 
-	// Now check that both images are identical after an encode.
+	// Now check that both images are identical after an encode. A 4:4:4
+	// YCbCr image keeps its subsampling unless a Downsampler is set.
 	var bufRGBA, bufYCbCr bytes.Buffer
-	Encode(&bufRGBA, imgRGBA, nil)
-	Encode(&bufYCbCr, imgYCbCr, nil)
+	o := &Options{Quality: DefaultQuality, Downsampler: BoxDownsampler{}}
+	Encode(&bufRGBA, imgRGBA, o)
+	Encode(&bufYCbCr, imgYCbCr, o)
 	if !bytes.Equal(bufRGBA.Bytes(), bufYCbCr.Bytes()) {
 		t.Errorf("RGBA and YCbCr encoded bytes differ")
 	}
 }
 
+func TestEncodeYCbCrSubsampling(t *testing.T) {
+	src := testimg.Photo(61, 43, 3)
+	b := src.Bounds()
+	for _, ratio := range []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio444,
+		image.YCbCrSubsampleRatio422,
+		image.YCbCrSubsampleRatio420,
+		image.YCbCrSubsampleRatio440,
+		image.YCbCrSubsampleRatio411,
+		image.YCbCrSubsampleRatio410,
+	} {
+		m := image.NewYCbCr(b, ratio)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := src.RGBAAt(x, y)
+				m.Y[m.YOffset(x, y)], m.Cb[m.COffset(x, y)], m.Cr[m.COffset(x, y)] = color.RGBToYCbCr(c.R, c.G, c.B)
+			}
+		}
+		for _, o := range []*Options{{Quality: 100}, {Quality: 100, Progressive: true}, {Quality: 100, Smoothing: 10}} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, m, o); err != nil {
+				t.Fatal(err)
+			}
+			d, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("%v, %+v: %v", ratio, o, err)
+			}
+			got, ok := d.(*image.YCbCr)
+			if !ok || got.SubsampleRatio != ratio {
+				t.Errorf("%v, %+v: decoded a %T with ratio %v", ratio, o, d, got.SubsampleRatio)
+				continue
+			}
+			if o.Smoothing > 0 {
+				continue
+			}
+			// The chroma planes are copied as they are, so at quality 100
+			// they come back almost unchanged.
+			maxDelta := 0
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					d := int(got.Cb[got.COffset(x, y)]) - int(m.Cb[m.COffset(x, y)])
+					maxDelta = max(maxDelta, d, -d)
+				}
+			}
+			if maxDelta > 4 {
+				t.Errorf("%v, %+v: Cb is off by up to %d", ratio, o, maxDelta)
+			}
+		}
+	}
+
+	// A sub-image whose corner is not on a chroma sample is subsampled to
+	// 4:2:0.
+	m := image.NewYCbCr(b, image.YCbCrSubsampleRatio422)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m.SubImage(image.Rect(1, 0, 40, 40)), nil); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := d.(*image.YCbCr); !ok || got.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		t.Errorf("unaligned sub-image: decoded a %T", d)
+	}
+}
+
+func TestEncodeGrayscaleOption(t *testing.T) {
+	bo := image.Rect(0, 0, 45, 37)
+	rgba := image.NewRGBA(bo)
+	ycbcr := image.NewYCbCr(bo, image.YCbCrSubsampleRatio420)
+	nrgba := image.NewNRGBA(bo)
+	gray := image.NewGray(bo)
+	rnd := rand.New(rand.NewSource(123))
+	for y := bo.Min.Y; y < bo.Max.Y; y++ {
+		for x := bo.Min.X; x < bo.Max.X; x++ {
+			col := color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255}
+			rgba.SetRGBA(x, y, col)
+			nrgba.SetNRGBA(x, y, color.NRGBA(col))
+			yy, _, _ := color.RGBToYCbCr(col.R, col.G, col.B)
+			gray.SetGray(x, y, color.Gray{yy})
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+		}
+	}
+	// Sub-images check the handling of the bounds' origin.
+	sub := image.Rect(3, 5, 40, 30)
+	for _, o := range []*Options{{Quality: 80}, {Quality: 80, Progressive: true}} {
+		var want bytes.Buffer
+		if err := Encode(&want, gray.SubImage(sub), o); err != nil {
+			t.Fatal(err)
+		}
+		g := *o
+		g.Grayscale = true
+		for _, m := range []image.Image{rgba, ycbcr, nrgba} {
+			var got bytes.Buffer
+			if err := Encode(&got, m.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(sub), &g); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("%T, progressive %t: grayscale output differs from encoding the luminance", m, o.Progressive)
+			}
+		}
+	}
+}
+
 func BenchmarkEncodeRGBA(b *testing.B) {
 	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
 	bo := img.Bounds()
@@ -339,3 +449,85 @@ func BenchmarkEncodeYCbCrProgressive(b *testing.B) {
 		Encode(io.Discard, img, options)
 	}
 }
+
+// TestProgressiveMatchesBaseline tests that progressive and baseline
+// encodings of the same image carry the same DCT coefficients, so that they
+// decode to exactly the same pixels.
+func TestProgressiveMatchesBaseline(t *testing.T) {
+	m0, err := readPng("testdata/video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := image.NewGray(m0.Bounds())
+	for y := gray.Rect.Min.Y; y < gray.Rect.Max.Y; y++ {
+		for x := gray.Rect.Min.X; x < gray.Rect.Max.X; x++ {
+			gray.Set(x, y, m0.At(x, y))
+		}
+	}
+	for _, m := range []image.Image{m0, gray} {
+		var base, prog bytes.Buffer
+		if err := Encode(&base, m, &Options{Quality: 75}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(&prog, m, &Options{Quality: 75, Progressive: true}); err != nil {
+			t.Fatal(err)
+		}
+		m1, err := Decode(&base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Decode(&prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := averageDelta(m1, m2); d != 0 {
+			t.Errorf("%T: baseline and progressive decodings differ: average delta %d", m, d)
+		}
+	}
+}
+
+func TestStrictScanScript(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 16, 16))
+	script := ScanScript{{Component: 0}, {Component: 0, SpectralStart: 1, SpectralEnd: 64}}
+	if err := ValidateScanScript(script, 1); err == nil {
+		t.Fatal("ValidateScanScript: got no error")
+	}
+	// By default, an invalid script falls back to the default script.
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Progressive: true, ScanScript: script}); err != nil {
+		t.Fatalf("non-strict: %v", err)
+	}
+	buf.Reset()
+	err := Encode(&buf, m, &Options{Progressive: true, ScanScript: script, StrictScanScript: true})
+	if err == nil {
+		t.Fatal("strict: got no error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("strict: %d bytes written", buf.Len())
+	}
+	// A valid script is accepted in strict mode.
+	script[1].SpectralEnd = 63
+	if err := Encode(&buf, m, &Options{Progressive: true, ScanScript: script, StrictScanScript: true}); err != nil {
+		t.Errorf("strict, valid script: %v", err)
+	}
+}
+
+func TestScanComponents(t *testing.T) {
+	for _, tc := range []struct {
+		scan ProgressiveScan
+		ok   bool
+	}{
+		{ProgressiveScan{Component: -1, Components: []int{1, 2}}, true},
+		{ProgressiveScan{Component: -1, Components: []int{0}}, true},
+		{ProgressiveScan{Component: 1, Components: []int{1, 2}}, false},
+		{ProgressiveScan{Component: -1, Components: []int{}}, false},
+		{ProgressiveScan{Component: -1, Components: []int{2, 1}}, false},
+		{ProgressiveScan{Component: -1, Components: []int{1, 1}}, false},
+		{ProgressiveScan{Component: -1, Components: []int{1, 3}}, false},
+		{ProgressiveScan{Component: -1, Components: []int{1, 2}, SpectralStart: 1, SpectralEnd: 63}, false},
+	} {
+		if err := ValidateScanScript(ScanScript{tc.scan}, 3); (err == nil) != tc.ok {
+			t.Errorf("%+v: ValidateScanScript returned %v", tc.scan, err)
+		}
+	}
+}